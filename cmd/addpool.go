@@ -37,6 +37,7 @@ type addPoolCmd struct {
 	resourceGroupName string
 	nodePoolPath      string
 	location          string
+	diagnosticsFile   string
 
 	// derived
 	containerService *api.ContainerService
@@ -65,7 +66,11 @@ func newAddPoolCmd() *cobra.Command {
 		Use:   addPoolName,
 		Short: addPoolShortDescription,
 		Long:  addPoolLongDescription,
-		RunE:  apc.run,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := apc.run(cmd, args)
+			writeDeploymentDiagnostics(apc.diagnosticsFile, addPoolName, err)
+			return err
+		},
 	}
 
 	f := addPoolCmd.Flags()
@@ -73,6 +78,7 @@ func newAddPoolCmd() *cobra.Command {
 	f.StringVarP(&apc.resourceGroupName, "resource-group", "g", "", "the resource group where the cluster is deployed")
 	f.StringVarP(&apc.apiModelPath, "api-model", "m", "", "path to the generated apimodel.json file")
 	f.StringVarP(&apc.nodePoolPath, "node-pool", "p", "", "path to a JSON file that defines the new node pool spec")
+	f.StringVar(&apc.diagnosticsFile, "diagnostics-file", "", "path to a file to write a JSON document describing the failure to, including the failed deployment operations and the decoded CSE exit codes")
 
 	addAuthFlags(&apc.authArgs, f)
 
@@ -209,12 +215,9 @@ func (apc *addPoolCmd) run(cmd *cobra.Command, args []string) error {
 	if err := apc.load(); err != nil {
 		return errors.Wrap(err, "failed to load existing container service")
 	}
-	apCount := len(apc.containerService.Properties.AgentPoolProfiles)
 
 	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
 	defer cancel()
-	orchestratorInfo := apc.containerService.Properties.OrchestratorProfile
-	winPoolIndex := -1
 
 	if apc.nodePool.IsVirtualMachineScaleSets() {
 		for vmssListPage, err := apc.client.ListVirtualMachineScaleSets(ctx, apc.resourceGroupName); vmssListPage.NotDone(); err = vmssListPage.NextWithContext(ctx) {
@@ -228,6 +231,44 @@ func (apc *addPoolCmd) run(cmd *cobra.Command, args []string) error {
 			}
 		}
 	}
+	templateJSON, parametersJSON, err := apc.generateTemplate()
+	if err != nil {
+		return err
+	}
+
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	deploymentSuffix := random.Int31()
+
+	err = armhelpers.DeployTemplateSyncWithContext(
+		ctx,
+		apc.client,
+		apc.logger,
+		apc.resourceGroupName,
+		fmt.Sprintf("%s-%d", apc.resourceGroupName, deploymentSuffix),
+		templateJSON,
+		parametersJSON)
+	if err != nil {
+		return err
+	}
+	if apc.nodes != nil {
+		nodes, err := operations.GetNodes(apc.client, apc.logger, apc.apiserverURL, apc.kubeconfig, time.Duration(5)*time.Minute, apc.nodePool.Name, apc.nodePool.Count)
+		if err == nil && nodes != nil {
+			apc.nodes = nodes
+			apc.logger.Infof("Nodes in pool '%s' after scaling:\n", apc.nodePool.Name)
+			operations.PrintNodes(apc.nodes)
+		} else {
+			apc.logger.Warningf("Unable to get nodes in pool %s after scaling:\n", apc.nodePool.Name)
+		}
+	}
+
+	return apc.saveAPIModel()
+}
+
+// generateTemplate generates the ARM template and parameters required to add the new node pool
+// and applies the addpool-specific template normalizations
+func (apc *addPoolCmd) generateTemplate() (map[string]interface{}, map[string]interface{}, error) {
+	apCount := len(apc.containerService.Properties.AgentPoolProfiles)
+	winPoolIndex := -1
 	translator := engine.Context{
 		Translator: &i18n.Translator{
 			Locale: apc.locale,
@@ -235,7 +276,7 @@ func (apc *addPoolCmd) run(cmd *cobra.Command, args []string) error {
 	}
 	templateGenerator, err := engine.InitializeTemplateGenerator(translator)
 	if err != nil {
-		return errors.Wrap(err, "failed to initialize template generator")
+		return nil, nil, errors.Wrap(err, "failed to initialize template generator")
 	}
 
 	apc.containerService.Properties.AgentPoolProfiles = []*api.AgentPoolProfile{apc.nodePool}
@@ -246,15 +287,15 @@ func (apc *addPoolCmd) run(cmd *cobra.Command, args []string) error {
 		PkiKeySize: helpers.DefaultPkiKeySize,
 	})
 	if err != nil {
-		return errors.Wrapf(err, "error in SetPropertiesDefaults template %s", apc.apiModelPath)
+		return nil, nil, errors.Wrapf(err, "error in SetPropertiesDefaults template %s", apc.apiModelPath)
 	}
 	template, parameters, err := templateGenerator.GenerateTemplateV2(apc.containerService, engine.DefaultGeneratorCode, BuildTag)
 	if err != nil {
-		return errors.Wrapf(err, "error generating template %s", apc.apiModelPath)
+		return nil, nil, errors.Wrapf(err, "error generating template %s", apc.apiModelPath)
 	}
 
 	if template, err = transform.PrettyPrintArmTemplate(template); err != nil {
-		return errors.Wrap(err, "error pretty printing template")
+		return nil, nil, errors.Wrap(err, "error pretty printing template")
 	}
 
 	templateJSON := make(map[string]interface{})
@@ -262,12 +303,12 @@ func (apc *addPoolCmd) run(cmd *cobra.Command, args []string) error {
 
 	err = json.Unmarshal([]byte(template), &templateJSON)
 	if err != nil {
-		return errors.Wrap(err, "error unmarshaling template")
+		return nil, nil, errors.Wrap(err, "error unmarshaling template")
 	}
 
 	err = json.Unmarshal([]byte(parameters), &parametersJSON)
 	if err != nil {
-		return errors.Wrap(err, "error unmarshaling parameters")
+		return nil, nil, errors.Wrap(err, "error unmarshaling parameters")
 	}
 
 	if apc.nodePool.OSType == api.Windows {
@@ -281,50 +322,26 @@ func (apc *addPoolCmd) run(cmd *cobra.Command, args []string) error {
 	}
 	transformer := transform.Transformer{Translator: translator.Translator}
 
-	if orchestratorInfo.KubernetesConfig.LoadBalancerSku == api.StandardLoadBalancerSku {
+	if apc.containerService.Properties.OrchestratorProfile.KubernetesConfig.LoadBalancerSku == api.StandardLoadBalancerSku {
 		err = transformer.NormalizeForK8sSLBScalingOrUpgrade(apc.logger, templateJSON)
 		if err != nil {
-			return errors.Wrapf(err, "error transforming the template for scaling with SLB %s", apc.apiModelPath)
+			return nil, nil, errors.Wrapf(err, "error transforming the template for scaling with SLB %s", apc.apiModelPath)
 		}
 	}
 
 	if apc.nodePool.IsVirtualMachineScaleSets() {
 		err = transformer.NormalizeForK8sVMASScalingUp(apc.logger, templateJSON)
 		if err != nil {
-			return errors.Wrapf(err, "error transforming the template for scaling template %s", apc.apiModelPath)
+			return nil, nil, errors.Wrapf(err, "error transforming the template for scaling template %s", apc.apiModelPath)
 		}
 		addValue(parametersJSON, apc.nodePool.Name+"Count", 0)
 	} else {
 		err = transformer.NormalizeForK8sAddVMASPool(apc.logger, templateJSON)
 		if err != nil {
-			return errors.Wrap(err, "error transforming the template to add a VMAS node pool")
+			return nil, nil, errors.Wrap(err, "error transforming the template to add a VMAS node pool")
 		}
 	}
-
-	random := rand.New(rand.NewSource(time.Now().UnixNano()))
-	deploymentSuffix := random.Int31()
-
-	_, err = apc.client.DeployTemplate(
-		ctx,
-		apc.resourceGroupName,
-		fmt.Sprintf("%s-%d", apc.resourceGroupName, deploymentSuffix),
-		templateJSON,
-		parametersJSON)
-	if err != nil {
-		return err
-	}
-	if apc.nodes != nil {
-		nodes, err := operations.GetNodes(apc.client, apc.logger, apc.apiserverURL, apc.kubeconfig, time.Duration(5)*time.Minute, apc.nodePool.Name, apc.nodePool.Count)
-		if err == nil && nodes != nil {
-			apc.nodes = nodes
-			apc.logger.Infof("Nodes in pool '%s' after scaling:\n", apc.nodePool.Name)
-			operations.PrintNodes(apc.nodes)
-		} else {
-			apc.logger.Warningf("Unable to get nodes in pool %s after scaling:\n", apc.nodePool.Name)
-		}
-	}
-
-	return apc.saveAPIModel()
+	return templateJSON, parametersJSON, nil
 }
 
 func (apc *addPoolCmd) saveAPIModel() error {
@@ -7,7 +7,6 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
-	"io"
 	"math/rand"
 	"os"
 	"path"
@@ -39,6 +38,20 @@ const (
 	deployLongDescription  = "Deploy an Azure Resource Manager template, parameters file and other assets for a cluster"
 )
 
+// servicePrincipalFileName is the file of the output directory that holds the credentials of the application created by deploy
+const servicePrincipalFileName = "serviceprincipal.json"
+
+// createdServicePrincipal holds the credentials of the application created by deploy,
+// persisted in the output directory so that subsequent runs reuse the application
+type createdServicePrincipal struct {
+	ApplicationID       string `json:"applicationId"`
+	ApplicationObjectID string `json:"applicationObjectId"`
+	ObjectID            string `json:"servicePrincipalObjectId"`
+	// Secret is empty if the secret is stored in keyvault
+	Secret       string `json:"secret,omitempty"`
+	RoleAssigned bool   `json:"roleAssigned"`
+}
+
 type deployCmd struct {
 	authProvider
 	apimodelPath      string
@@ -50,16 +63,21 @@ type deployCmd struct {
 	caPrivateKeyPath  string
 	parametersOnly    bool
 	set               []string
+	cleanupOnFailure  bool
+	diagnosticsFile   string
 
 	// derived
 	containerService *api.ContainerService
 	apiVersion       string
 	locale           *gotext.Locale
 
-	client        armhelpers.AKSEngineClient
-	resourceGroup string
-	random        *rand.Rand
-	location      string
+	client           armhelpers.AKSEngineClient
+	resourceGroup    string
+	random           *rand.Rand
+	location         string
+	servicePrincipal *createdServicePrincipal
+	// createdApp is true if this run created the application, an application reused from a previous run may already back a cluster
+	createdApp bool
 }
 
 func newDeployCmd() *cobra.Command {
@@ -71,18 +89,24 @@ func newDeployCmd() *cobra.Command {
 		Use:   deployName,
 		Short: deployShortDescription,
 		Long:  deployLongDescription,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			if err := dc.validateArgs(cmd, args); err != nil {
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			if err = dc.validateArgs(cmd, args); err != nil {
 				return errors.Wrap(err, "validating deployCmd")
 			}
-			if err := dc.mergeAPIModel(); err != nil {
+			defer func() {
+				writeDeploymentDiagnostics(dc.diagnosticsFile, deployName, err)
+				if err != nil && dc.cleanupOnFailure {
+					dc.deleteServicePrincipal()
+				}
+			}()
+			if err = dc.mergeAPIModel(); err != nil {
 				return errors.Wrap(err, "merging API model in deployCmd")
 			}
-			if err := dc.loadAPIModel(); err != nil {
+			if err = dc.loadAPIModel(); err != nil {
 				return errors.Wrap(err, "loading API model")
 			}
 			if dc.apiVersion == "vlabs" {
-				if err := dc.validateAPIModelAsVLabs(); err != nil {
+				if err = dc.validateAPIModelAsVLabs(); err != nil {
 					return errors.Wrap(err, "validating API model after populating values")
 				}
 			} else {
@@ -103,6 +127,8 @@ func newDeployCmd() *cobra.Command {
 	f.StringVarP(&dc.location, "location", "l", "", "location to deploy to (required)")
 	f.BoolVarP(&dc.forceOverwrite, "force-overwrite", "f", false, "automatically overwrite existing files in the output directory")
 	f.StringArrayVar(&dc.set, "set", []string{}, "set values on the command line (can specify multiple or separate values with commas: key1=val1,key2=val2)")
+	f.BoolVar(&dc.cleanupOnFailure, "cleanup-on-failure", false, "delete the application and role assignments created by deploy if the deployment fails")
+	f.StringVar(&dc.diagnosticsFile, "diagnostics-file", "", "path to a file to write a JSON document describing the failure to, including the failed deployment operations and the decoded CSE exit codes")
 
 	addAuthFlags(dc.getAuthArgs(), f)
 
@@ -341,39 +367,19 @@ func autofillApimodel(dc *deployCmd) error {
 		return err
 	}
 
+	if err = loadKeyvaultCa(ctx, dc.client, dc.containerService.Properties.CertificateProfile); err != nil {
+		return err
+	}
+
 	k8sConfig := dc.containerService.Properties.OrchestratorProfile.KubernetesConfig
 
 	useManagedIdentity := k8sConfig != nil && to.Bool(k8sConfig.UseManagedIdentity)
 
 	if !useManagedIdentity {
 		spp := dc.containerService.Properties.ServicePrincipalProfile
-		if spp != nil && spp.ClientID == "" && spp.Secret == "" && spp.KeyvaultSecretRef == nil && (dc.getAuthArgs().ClientID.String() == "" || dc.getAuthArgs().ClientID.String() == "00000000-0000-0000-0000-000000000000") && dc.getAuthArgs().ClientSecret == "" {
-			log.Warnln("apimodel: ServicePrincipalProfile was missing or empty, creating application...")
-
-			// TODO: consider caching the creds here so they persist between subsequent runs of 'deploy'
-			appName := dc.containerService.Properties.MasterProfile.DNSPrefix
-			appURL := fmt.Sprintf("https://%s/", appName)
-			var replyURLs *[]string
-			var requiredResourceAccess *[]graphrbac.RequiredResourceAccess
-			applicationResp, servicePrincipalObjectID, secret, createErr := dc.client.CreateApp(ctx, appName, appURL, replyURLs, requiredResourceAccess)
-			if createErr != nil {
-				return errors.Wrap(createErr, "apimodel invalid: ServicePrincipalProfile was empty, and we failed to create valid credentials")
-			}
-			applicationID := to.String(applicationResp.AppID)
-			log.Warnf("created application with applicationID (%s) and servicePrincipalObjectID (%s).", applicationID, servicePrincipalObjectID)
-
-			log.Warnln("apimodel: ServicePrincipalProfile was empty, assigning role to application...")
-
-			err = dc.client.CreateRoleAssignmentSimple(ctx, dc.resourceGroup, servicePrincipalObjectID)
-			if err != nil {
-				return errors.Wrap(err, "apimodel: could not create or assign ServicePrincipal")
-
-			}
-
-			dc.containerService.Properties.ServicePrincipalProfile = &api.ServicePrincipalProfile{
-				ClientID: applicationID,
-				Secret:   secret,
-				ObjectID: servicePrincipalObjectID,
+		if spp != nil && spp.ClientID == "" && spp.Secret == "" && (dc.getAuthArgs().ClientID.String() == "" || dc.getAuthArgs().ClientID.String() == "00000000-0000-0000-0000-000000000000") && dc.getAuthArgs().ClientSecret == "" {
+			if err = dc.ensureServicePrincipal(ctx); err != nil {
+				return err
 			}
 		} else if (dc.containerService.Properties.ServicePrincipalProfile == nil || ((dc.containerService.Properties.ServicePrincipalProfile.ClientID == "" || dc.containerService.Properties.ServicePrincipalProfile.ClientID == "00000000-0000-0000-0000-000000000000") && dc.containerService.Properties.ServicePrincipalProfile.Secret == "")) && dc.getAuthArgs().ClientID.String() != "" && dc.getAuthArgs().ClientSecret != "" {
 			dc.containerService.Properties.ServicePrincipalProfile = &api.ServicePrincipalProfile{
@@ -399,6 +405,143 @@ func autofillApimodel(dc *deployCmd) error {
 	return nil
 }
 
+// ensureServicePrincipal creates an application and assigns it the contributor role on the resource group,
+// or reuses the application created by a previous run, and sets it in the ServicePrincipalProfile.
+// The secret is stored in keyvault if the ServicePrincipalProfile references a keyvault secret
+func (dc *deployCmd) ensureServicePrincipal(ctx context.Context) error {
+	spp := dc.containerService.Properties.ServicePrincipalProfile
+	credentialsPath := path.Join(dc.outputDirectory, servicePrincipalFileName)
+	sp, err := loadServicePrincipal(credentialsPath)
+	if err != nil {
+		return err
+	}
+	if sp != nil {
+		log.Infof("apimodel: reusing application %s created by a previous run, see %s", sp.ApplicationID, credentialsPath)
+		if sp.Secret == "" && spp.KeyvaultSecretRef == nil {
+			return errors.Errorf("the secret of application %s is not in %s, set servicePrincipalProfile.keyvaultSecretRef to the keyvault secret holding it", sp.ApplicationID, credentialsPath)
+		}
+	} else {
+		log.Warnln("apimodel: ServicePrincipalProfile was missing or empty, creating application...")
+		appName := dc.containerService.Properties.MasterProfile.DNSPrefix
+		appURL := fmt.Sprintf("https://%s/", appName)
+		var replyURLs *[]string
+		var requiredResourceAccess *[]graphrbac.RequiredResourceAccess
+		applicationResp, servicePrincipalObjectID, secret, createErr := dc.client.CreateApp(ctx, appName, appURL, replyURLs, requiredResourceAccess)
+		if createErr != nil {
+			return errors.Wrap(createErr, "apimodel invalid: ServicePrincipalProfile was empty, and we failed to create valid credentials")
+		}
+		dc.createdApp = true
+		sp = &createdServicePrincipal{
+			ApplicationID:       to.String(applicationResp.AppID),
+			ApplicationObjectID: to.String(applicationResp.ObjectID),
+			ObjectID:            servicePrincipalObjectID,
+			Secret:              secret,
+		}
+		log.Warnf("created application with applicationID (%s) and servicePrincipalObjectID (%s).", sp.ApplicationID, sp.ObjectID)
+
+		// persisted right away so that a later run reuses the application if a following step fails
+		dc.servicePrincipal = sp
+		if err = dc.saveServicePrincipal(); err != nil {
+			return err
+		}
+	}
+	dc.servicePrincipal = sp
+
+	if ref := spp.KeyvaultSecretRef; ref != nil && sp.Secret != "" {
+		log.Infof("apimodel: storing the application secret in keyvault secret %s", ref.SecretName)
+		if ref.SecretVersion, err = dc.client.SetKeyVaultSecret(ctx, ref.VaultID, ref.SecretName, sp.Secret); err != nil {
+			return errors.Wrap(err, "apimodel: could not store the application secret in keyvault")
+		}
+		sp.Secret = ""
+		if err = dc.saveServicePrincipal(); err != nil {
+			return err
+		}
+	}
+
+	if !sp.RoleAssigned {
+		log.Warnln("apimodel: ServicePrincipalProfile was empty, assigning role to application...")
+		if err = dc.client.CreateRoleAssignmentSimple(ctx, dc.resourceGroup, sp.ObjectID); err != nil {
+			return errors.Wrap(err, "apimodel: could not create or assign ServicePrincipal")
+		}
+		sp.RoleAssigned = true
+		if err = dc.saveServicePrincipal(); err != nil {
+			return err
+		}
+	}
+
+	spp.ClientID = sp.ApplicationID
+	spp.ObjectID = sp.ObjectID
+	spp.Secret = sp.Secret
+	return nil
+}
+
+// loadServicePrincipal returns the application persisted in credentialsPath, nil if the file does not exist
+func loadServicePrincipal(credentialsPath string) (*createdServicePrincipal, error) {
+	b, err := os.ReadFile(credentialsPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", credentialsPath)
+	}
+	sp := &createdServicePrincipal{}
+	if err = json.Unmarshal(b, sp); err != nil {
+		return nil, errors.Wrapf(err, "parsing %s", credentialsPath)
+	}
+	return sp, nil
+}
+
+// saveServicePrincipal writes the credentials of the application created by deploy to the output directory
+func (dc *deployCmd) saveServicePrincipal() error {
+	b, err := json.MarshalIndent(dc.servicePrincipal, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "encoding application credentials")
+	}
+	f := helpers.FileSaver{Translator: &i18n.Translator{Locale: dc.locale}}
+	if err = f.SaveFile(dc.outputDirectory, servicePrincipalFileName, b); err != nil {
+		return errors.Wrap(err, "writing application credentials")
+	}
+	return nil
+}
+
+// deleteServicePrincipal deletes the role assignments and the application created by this run of deploy, if any
+func (dc *deployCmd) deleteServicePrincipal() {
+	sp := dc.servicePrincipal
+	if sp == nil {
+		return
+	}
+	if !dc.createdApp {
+		log.Warnf("not cleaning up application %s after the deployment failure, it was created by a previous run", sp.ApplicationID)
+		return
+	}
+	log.Warnf("cleaning up application %s after the deployment failure", sp.ApplicationID)
+	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+	defer cancel()
+
+	scope := fmt.Sprintf(armhelpers.AADRoleResourceGroupScopeTemplate, dc.getAuthArgs().SubscriptionID.String(), dc.resourceGroup)
+	page, err := dc.client.ListRoleAssignmentsForPrincipal(ctx, scope, sp.ObjectID)
+	for ; err == nil && page.NotDone(); err = page.Next() {
+		for _, roleAssignment := range page.Values() {
+			if _, err = dc.client.DeleteRoleAssignmentByID(ctx, to.String(roleAssignment.ID)); err != nil {
+				log.Errorf("failed to delete role assignment %s: %s", to.String(roleAssignment.ID), err)
+				return
+			}
+		}
+	}
+	if err != nil {
+		log.Errorf("failed to list the role assignments of application %s: %s", sp.ApplicationID, err)
+		return
+	}
+	if _, err := dc.client.DeleteApp(ctx, dc.containerService.Properties.MasterProfile.DNSPrefix, sp.ApplicationObjectID); err != nil {
+		log.Errorf("failed to delete application %s: %s", sp.ApplicationID, err)
+		return
+	}
+	if err := os.Remove(path.Join(dc.outputDirectory, servicePrincipalFileName)); err != nil && !os.IsNotExist(err) {
+		log.Warnf("failed to remove %s: %s", servicePrincipalFileName, err)
+	}
+	dc.servicePrincipal = nil
+}
+
 // validateAPIModelAsVLabs converts the ContainerService object to a vlabs ContainerService object and validates it
 func (dc *deployCmd) validateAPIModelAsVLabs() error {
 	return api.ConvertContainerServiceToVLabs(dc.containerService).Validate(false)
@@ -469,22 +612,14 @@ func (dc *deployCmd) run() error {
 
 	deploymentSuffix := dc.random.Int31()
 
-	if res, err := dc.client.DeployTemplate(
+	return armhelpers.DeployTemplateSyncWithContext(
 		cx,
+		dc.client,
+		log.NewEntry(log.StandardLogger()),
 		dc.resourceGroup,
 		fmt.Sprintf("%s-%d", dc.resourceGroup, deploymentSuffix),
 		templateJSON,
-		parametersJSON,
-	); err != nil {
-		if res.Response.Response != nil && res.Body != nil {
-			defer res.Body.Close()
-			body, _ := io.ReadAll(res.Body)
-			log.Errorf(string(body))
-		}
-		return err
-	}
-
-	return nil
+		parametersJSON)
 }
 
 // configure api model addon config with container monitoring addon
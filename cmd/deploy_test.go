@@ -137,7 +137,7 @@ func TestNewDeployCmd(t *testing.T) {
 		t.Fatalf("deploy command should have use %s equal %s, short %s equal %s and long %s equal to %s", command.Use, deployName, command.Short, deployShortDescription, command.Long, versionLongDescription)
 	}
 
-	expectedFlags := []string{"api-model", "dns-prefix", "auto-suffix", "output-directory", "ca-private-key-path", "resource-group", "location", "force-overwrite"}
+	expectedFlags := []string{"api-model", "dns-prefix", "auto-suffix", "output-directory", "ca-private-key-path", "resource-group", "location", "force-overwrite", "cleanup-on-failure", "diagnostics-file"}
 	for _, f := range expectedFlags {
 		if command.Flags().Lookup(f) == nil {
 			t.Fatalf("deploy command should have flag %s", f)
@@ -531,6 +531,174 @@ func TestAPIModelWithEmptyServicePrincipalProfileAndWithoutClientIdAndSecretInCm
 
 }
 
+func newServicePrincipalTestDeployCmd(t *testing.T, outDir string, client armhelpers.AKSEngineClient) *deployCmd {
+	apiloader := &api.Apiloader{
+		Translator: nil,
+	}
+	cs, ver, err := apiloader.DeserializeContainerService([]byte(getAPIModel(ExampleAPIModelWithDNSPrefix, false, "", "")), false, false, nil)
+	if err != nil {
+		t.Fatalf("unexpected error deserializing the example apimodel: %s", err)
+	}
+	return &deployCmd{
+		apimodelPath:     "./this/is/unused.json",
+		outputDirectory:  outDir,
+		forceOverwrite:   true,
+		location:         "westus",
+		containerService: cs,
+		apiVersion:       ver,
+
+		client: client,
+		authProvider: &mockAuthProvider{
+			authArgs: &authArgs{},
+		},
+	}
+}
+
+func TestAutofillApimodelPersistsCreatedServicePrincipal(t *testing.T) {
+	outDir, del := makeTmpDir(t)
+	defer del()
+
+	dc := newServicePrincipalTestDeployCmd(t, outDir, &armhelpers.MockAKSEngineClient{})
+	if err := autofillApimodel(dc); err != nil {
+		t.Fatalf("unexpected error autofilling the example apimodel: %s", err)
+	}
+
+	sp, err := loadServicePrincipal(path.Join(outDir, servicePrincipalFileName))
+	if err != nil {
+		t.Fatalf("unexpected error loading the persisted application: %s", err)
+	}
+	if sp == nil {
+		t.Fatalf("expected the created application to be persisted in %s", servicePrincipalFileName)
+	}
+	if sp.ApplicationID != "app-id" || sp.ObjectID != "client-id" || sp.Secret != "client-secret" || !sp.RoleAssigned {
+		t.Fatalf("unexpected persisted application %+v", sp)
+	}
+
+	// a subsequent run reuses the persisted application
+	if err = os.WriteFile(path.Join(outDir, servicePrincipalFileName), []byte(`{"applicationId":"previous-app-id","servicePrincipalObjectId":"previous-object-id","secret":"previous-secret","roleAssigned":true}`), 0600); err != nil {
+		t.Fatalf("unexpected error writing %s: %s", servicePrincipalFileName, err)
+	}
+	dc = newServicePrincipalTestDeployCmd(t, outDir, &armhelpers.MockAKSEngineClient{})
+	if err = autofillApimodel(dc); err != nil {
+		t.Fatalf("unexpected error autofilling the example apimodel: %s", err)
+	}
+	spp := dc.containerService.Properties.ServicePrincipalProfile
+	if spp.ClientID != "previous-app-id" || spp.ObjectID != "previous-object-id" || spp.Secret != "previous-secret" {
+		t.Fatalf("expected the persisted application to be reused but got %+v", spp)
+	}
+}
+
+func TestAutofillApimodelStoresCreatedServicePrincipalSecretInKeyvault(t *testing.T) {
+	outDir, del := makeTmpDir(t)
+	defer del()
+
+	dc := newServicePrincipalTestDeployCmd(t, outDir, &armhelpers.MockAKSEngineClient{})
+	dc.containerService.Properties.ServicePrincipalProfile.KeyvaultSecretRef = &api.KeyvaultSecretRef{VaultID: "vaultID", SecretName: "secret"}
+	if err := autofillApimodel(dc); err != nil {
+		t.Fatalf("unexpected error autofilling the example apimodel: %s", err)
+	}
+
+	spp := dc.containerService.Properties.ServicePrincipalProfile
+	if spp.ClientID != "app-id" || spp.Secret != "" || spp.KeyvaultSecretRef.SecretVersion != "version" {
+		t.Fatalf("expected the application secret to be stored in keyvault but got %+v", spp)
+	}
+	b, err := os.ReadFile(path.Join(outDir, servicePrincipalFileName))
+	if err != nil {
+		t.Fatalf("unexpected error reading %s: %s", servicePrincipalFileName, err)
+	}
+	if strings.Contains(string(b), "client-secret") {
+		t.Fatalf("expected the application secret not to be persisted in %s", servicePrincipalFileName)
+	}
+
+	dc = newServicePrincipalTestDeployCmd(t, outDir, &armhelpers.MockAKSEngineClient{FailSetKeyVaultSecret: true})
+	if err = os.Remove(path.Join(outDir, servicePrincipalFileName)); err != nil {
+		t.Fatalf("unexpected error removing %s: %s", servicePrincipalFileName, err)
+	}
+	dc.containerService.Properties.ServicePrincipalProfile.KeyvaultSecretRef = &api.KeyvaultSecretRef{VaultID: "vaultID", SecretName: "secret"}
+	if err = autofillApimodel(dc); err == nil {
+		t.Fatalf("expected an error when the application secret cannot be stored in keyvault")
+	}
+	if dc.servicePrincipal == nil {
+		t.Fatalf("expected the created application to be tracked for cleanup")
+	}
+	// the application is persisted before its secret is stored in keyvault, a later run reuses it
+	sp, err := loadServicePrincipal(path.Join(outDir, servicePrincipalFileName))
+	if err != nil {
+		t.Fatalf("unexpected error loading the persisted application: %s", err)
+	}
+	if sp == nil || sp.ApplicationID != "app-id" || sp.Secret != "client-secret" {
+		t.Fatalf("expected the created application to be persisted with its secret but got %+v", sp)
+	}
+
+	dc = newServicePrincipalTestDeployCmd(t, outDir, &armhelpers.MockAKSEngineClient{})
+	dc.containerService.Properties.ServicePrincipalProfile.KeyvaultSecretRef = &api.KeyvaultSecretRef{VaultID: "vaultID", SecretName: "secret"}
+	if err = autofillApimodel(dc); err != nil {
+		t.Fatalf("unexpected error autofilling the example apimodel: %s", err)
+	}
+	if dc.createdApp || dc.containerService.Properties.ServicePrincipalProfile.Secret != "" {
+		t.Fatalf("expected the persisted application to be reused and its secret stored in keyvault but got %+v", dc.containerService.Properties.ServicePrincipalProfile)
+	}
+	if sp, err = loadServicePrincipal(path.Join(outDir, servicePrincipalFileName)); err != nil || sp.Secret != "" {
+		t.Fatalf("expected the application secret to be removed from %s once stored in keyvault but got %+v, %v", servicePrincipalFileName, sp, err)
+	}
+}
+
+func TestDeployCmdDeleteServicePrincipal(t *testing.T) {
+	outDir, del := makeTmpDir(t)
+	defer del()
+
+	dc := newServicePrincipalTestDeployCmd(t, outDir, &armhelpers.MockAKSEngineClient{})
+	// no-op when deploy did not create an application
+	dc.deleteServicePrincipal()
+
+	if err := autofillApimodel(dc); err != nil {
+		t.Fatalf("unexpected error autofilling the example apimodel: %s", err)
+	}
+	dc.deleteServicePrincipal()
+	if dc.servicePrincipal != nil {
+		t.Fatalf("expected the created application to be deleted")
+	}
+	if _, err := os.Stat(path.Join(outDir, servicePrincipalFileName)); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to be removed", servicePrincipalFileName)
+	}
+
+	// the application is kept when its role assignments cannot be listed
+	dc = newServicePrincipalTestDeployCmd(t, outDir, &armhelpers.MockAKSEngineClient{FailListRoleAssignmentsForPrincipal: true})
+	if err := autofillApimodel(dc); err != nil {
+		t.Fatalf("unexpected error autofilling the example apimodel: %s", err)
+	}
+	dc.deleteServicePrincipal()
+	if dc.servicePrincipal == nil {
+		t.Fatalf("expected the application not to be deleted when its role assignments cannot be listed")
+	}
+	if _, err := os.Stat(path.Join(outDir, servicePrincipalFileName)); err != nil {
+		t.Fatalf("expected %s to be kept, got %s", servicePrincipalFileName, err)
+	}
+}
+
+func TestDeployCmdDeleteReusedServicePrincipal(t *testing.T) {
+	outDir, del := makeTmpDir(t)
+	defer del()
+
+	credentialsPath := path.Join(outDir, servicePrincipalFileName)
+	if err := os.WriteFile(credentialsPath, []byte(`{"applicationId":"previous-app-id","applicationObjectId":"previous-app-object-id","servicePrincipalObjectId":"previous-object-id","secret":"previous-secret","roleAssigned":true}`), 0600); err != nil {
+		t.Fatalf("unexpected error writing %s: %s", servicePrincipalFileName, err)
+	}
+	dc := newServicePrincipalTestDeployCmd(t, outDir, &armhelpers.MockAKSEngineClient{})
+	if err := autofillApimodel(dc); err != nil {
+		t.Fatalf("unexpected error autofilling the example apimodel: %s", err)
+	}
+
+	// an application created by a previous run may back a running cluster, it must not be deleted
+	dc.deleteServicePrincipal()
+	if dc.servicePrincipal == nil || dc.servicePrincipal.ApplicationID != "previous-app-id" {
+		t.Fatalf("expected the reused application to be kept but got %+v", dc.servicePrincipal)
+	}
+	if _, err := os.Stat(credentialsPath); err != nil {
+		t.Fatalf("expected %s to be kept, got %s", servicePrincipalFileName, err)
+	}
+}
+
 func testAutodeployCredentialHandling(t *testing.T, useManagedIdentity bool, clientID, clientSecret string) {
 	apiloader := &api.Apiloader{
 		Translator: nil,
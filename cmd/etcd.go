@@ -0,0 +1,319 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/Azure/aks-engine-azurestack/pkg/api"
+	"github.com/Azure/aks-engine-azurestack/pkg/helpers"
+	"github.com/Azure/aks-engine-azurestack/pkg/helpers/ssh"
+	"github.com/Azure/aks-engine-azurestack/pkg/i18n"
+	"github.com/Azure/aks-engine-azurestack/pkg/operations/etcd"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	etcdName             = "etcd"
+	etcdShortDescription = "Back up and restore the etcd cluster of an existing AKS Engine-created Kubernetes cluster"
+	etcdLongDescription  = "Back up and restore the etcd cluster running on the control plane nodes of a cluster built with AKS Engine"
+
+	etcdBackupName             = "backup"
+	etcdBackupShortDescription = "Take an etcd snapshot and download it"
+	etcdBackupLongDescription  = "Take a snapshot of the etcd cluster from one of the control plane nodes, download it and optionally upload it to an Azure Storage Account"
+
+	etcdRestoreName             = "restore"
+	etcdRestoreShortDescription = "Restore the etcd cluster from a snapshot"
+	etcdRestoreLongDescription  = "Rebuild the etcd cluster from a snapshot taken by 'etcd backup'. The control plane is unavailable while the snapshot is restored and any change made to the cluster after the snapshot was taken is lost."
+)
+
+const (
+	etcdBackupDirectoryName     = "_etcd_backup"
+	etcdDefaultStorageContainer = "etcd-backups"
+	etcdBackupTimeout           = 30 * time.Minute
+)
+
+// etcdCmd holds the input shared by the etcd subcommands
+type etcdCmd struct {
+	// user input
+	location               string
+	apiModelPath           string
+	sshHostURI             string
+	linuxSSHPrivateKeyPath string
+
+	// computed
+	cs      *api.ContainerService
+	masters []*ssh.RemoteHost
+}
+
+type etcdBackupCmd struct {
+	etcdCmd
+	authProvider
+
+	// user input
+	resourceGroupName    string
+	outputDirectory      string
+	storageAccountName   string
+	storageContainerName string
+}
+
+type etcdRestoreCmd struct {
+	etcdCmd
+
+	// user input
+	snapshotPath string
+}
+
+func newEtcdCmd() *cobra.Command {
+	command := &cobra.Command{
+		Use:   etcdName,
+		Short: etcdShortDescription,
+		Long:  etcdLongDescription,
+	}
+	command.AddCommand(newEtcdBackupCmd())
+	command.AddCommand(newEtcdRestoreCmd())
+	return command
+}
+
+func newEtcdBackupCmd() *cobra.Command {
+	ebc := etcdBackupCmd{
+		authProvider: &authArgs{},
+	}
+	command := &cobra.Command{
+		Use:   etcdBackupName,
+		Short: etcdBackupShortDescription,
+		Long:  etcdBackupLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := ebc.validateArgs(); err != nil {
+				return errors.Wrap(err, "validating etcd backup args")
+			}
+			if err := ebc.loadAPIModel(); err != nil {
+				return errors.Wrap(err, "loading API model")
+			}
+			if err := ebc.init(); err != nil {
+				return err
+			}
+			cmd.SilenceUsage = true
+			return ebc.run()
+		},
+	}
+	f := command.Flags()
+	ebc.addFlags(command)
+	f.StringVarP(&ebc.outputDirectory, "output-directory", "o", "", fmt.Sprintf("snapshot destination directory, defaults to %s next to --api-model", etcdBackupDirectoryName))
+	f.StringVarP(&ebc.resourceGroupName, "resource-group", "g", "", "the resource group of the storage account (required if --storage-account is set)")
+	f.StringVar(&ebc.storageAccountName, "storage-account", "", "name of the Azure Storage Account to upload the snapshot to")
+	f.StringVar(&ebc.storageContainerName, "storage-container", etcdDefaultStorageContainer, "name of the storage container to upload the snapshot to, created if it does not exist")
+	addAuthFlags(ebc.getAuthArgs(), f)
+	return command
+}
+
+func newEtcdRestoreCmd() *cobra.Command {
+	erc := etcdRestoreCmd{}
+	command := &cobra.Command{
+		Use:   etcdRestoreName,
+		Short: etcdRestoreShortDescription,
+		Long:  etcdRestoreLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := erc.validateArgs(); err != nil {
+				return errors.Wrap(err, "validating etcd restore args")
+			}
+			if err := erc.loadAPIModel(); err != nil {
+				return errors.Wrap(err, "loading API model")
+			}
+			if err := erc.init(); err != nil {
+				return err
+			}
+			cmd.SilenceUsage = true
+			return erc.run()
+		},
+	}
+	erc.addFlags(command)
+	command.Flags().StringVar(&erc.snapshotPath, "snapshot", "", "path to the etcd snapshot to restore (required)")
+	_ = command.MarkFlagRequired("snapshot")
+	return command
+}
+
+func (ec *etcdCmd) addFlags(command *cobra.Command) {
+	f := command.Flags()
+	f.StringVarP(&ec.location, "location", "l", "", "Azure location where the cluster is deployed (required)")
+	f.StringVarP(&ec.apiModelPath, "api-model", "m", "", "path to the generated apimodel.json file (required)")
+	f.StringVar(&ec.sshHostURI, "ssh-host", "", "FQDN, or IP address, of an SSH listener that can reach the control plane nodes (required)")
+	f.StringVar(&ec.linuxSSHPrivateKeyPath, "linux-ssh-private-key", "", "path to a valid private SSH key to access the control plane nodes (required)")
+	_ = command.MarkFlagRequired("location")
+	_ = command.MarkFlagRequired("api-model")
+	_ = command.MarkFlagRequired("ssh-host")
+	_ = command.MarkFlagRequired("linux-ssh-private-key")
+}
+
+func (ec *etcdCmd) validateArgs() error {
+	ec.location = helpers.NormalizeAzureRegion(ec.location)
+	if ec.location == "" {
+		return errors.New("--location must be specified")
+	}
+	if ec.sshHostURI == "" {
+		return errors.New("--ssh-host must be specified")
+	}
+	if ec.linuxSSHPrivateKeyPath == "" {
+		return errors.New("--linux-ssh-private-key must be specified")
+	} else if _, err := os.Stat(ec.linuxSSHPrivateKeyPath); os.IsNotExist(err) {
+		return errors.Errorf("specified --linux-ssh-private-key does not exist (%s)", ec.linuxSSHPrivateKeyPath)
+	}
+	if ec.apiModelPath == "" {
+		return errors.New("--api-model must be specified")
+	} else if _, err := os.Stat(ec.apiModelPath); os.IsNotExist(err) {
+		return errors.Errorf("specified --api-model does not exist (%s)", ec.apiModelPath)
+	}
+	return nil
+}
+
+func (ec *etcdCmd) loadAPIModel() error {
+	locale, err := i18n.LoadTranslations()
+	if err != nil {
+		return errors.Wrap(err, "loading translation files")
+	}
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{
+			Locale: locale,
+		},
+	}
+	if ec.cs, _, err = apiloader.LoadContainerServiceFromFile(ec.apiModelPath, false, false, nil); err != nil {
+		return errors.Wrap(err, "error parsing api-model")
+	}
+	if ec.cs.Properties.IsCustomCloudProfile() {
+		if err = writeCustomCloudProfile(ec.cs); err != nil {
+			return errors.Wrap(err, "error writing custom cloud profile")
+		}
+		if err = ec.cs.Properties.SetCustomCloudSpec(api.AzureCustomCloudSpecParams{IsUpgrade: false, IsScale: true}); err != nil {
+			return errors.Wrap(err, "error parsing the api model")
+		}
+	}
+	if ec.cs.Location == "" {
+		ec.cs.Location = ec.location
+	} else if ec.cs.Location != ec.location {
+		return errors.New("--location flag does not match api-model location")
+	}
+	if ec.cs.Properties.MasterProfile == nil {
+		return errors.New("api-model does not define a control plane")
+	}
+	if ec.cs.Properties.MasterProfile.HasCosmosEtcd() {
+		return errors.New("etcd snapshots are not supported on clusters using Cosmos DB as the etcd backend")
+	}
+	return nil
+}
+
+func (ec *etcdCmd) init() error {
+	authConfig := &ssh.AuthConfig{
+		User:           ec.cs.Properties.LinuxProfile.AdminUsername,
+		PrivateKeyPath: ec.linuxSSHPrivateKeyPath,
+	}
+	jumpbox := &ssh.JumpBox{URI: ec.sshHostURI, Port: vmssSSHPort, OperatingSystem: api.Linux, AuthConfig: authConfig}
+	if ec.cs.Properties.MasterProfile.IsAvailabilitySet() {
+		jumpbox.Port = vmasSSHPort
+	}
+	if err := ssh.ValidateConfig(jumpbox); err != nil {
+		return errors.Wrap(err, "validating ssh configuration")
+	}
+	ec.masters = getMasterHosts(ec.cs, authConfig, jumpbox)
+	return nil
+}
+
+func (ebc *etcdBackupCmd) validateArgs() error {
+	if err := ebc.etcdCmd.validateArgs(); err != nil {
+		return err
+	}
+	if ebc.outputDirectory == "" {
+		ebc.outputDirectory = path.Join(filepath.Dir(ebc.apiModelPath), etcdBackupDirectoryName)
+	}
+	if err := os.MkdirAll(ebc.outputDirectory, 0755); err != nil {
+		return errors.Errorf("error creating output directory (%s)", ebc.outputDirectory)
+	}
+	if ebc.storageAccountName != "" {
+		if ebc.resourceGroupName == "" {
+			return errors.New("--resource-group must be specified when --storage-account is set")
+		}
+		if ebc.storageContainerName == "" {
+			return errors.New("--storage-container cannot be empty")
+		}
+		if err := ebc.getAuthArgs().validateAuthArgs(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ebc *etcdBackupCmd) run() error {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdBackupTimeout)
+	defer cancel()
+	snapshotPath := filepath.Join(ebc.outputDirectory, etcdSnapshotFileName(time.Now()))
+	master, err := etcd.NewSnapshotter(ebc.masters, log.NewEntry(log.StandardLogger())).Save(ctx, snapshotPath)
+	if err != nil {
+		return err
+	}
+	log.Infof("Snapshot of etcd taken from %s saved to %s", master, snapshotPath)
+	if ebc.storageAccountName == "" {
+		return nil
+	}
+	client, err := ebc.authProvider.getClient()
+	if err != nil {
+		return errors.Wrap(err, "failed to get ARM client")
+	}
+	storageClient, err := client.GetStorageClient(ctx, ebc.resourceGroupName, ebc.storageAccountName)
+	if err != nil {
+		return errors.Wrapf(err, "getting storage client for account %s", ebc.storageAccountName)
+	}
+	blobName := path.Join(ebc.cs.Properties.MasterProfile.DNSPrefix, filepath.Base(snapshotPath))
+	if err = etcd.UploadSnapshot(storageClient, ebc.storageContainerName, blobName, snapshotPath); err != nil {
+		return err
+	}
+	log.Infof("Snapshot uploaded to %s/%s in storage account %s", ebc.storageContainerName, blobName, ebc.storageAccountName)
+	return nil
+}
+
+func (erc *etcdRestoreCmd) validateArgs() error {
+	if err := erc.etcdCmd.validateArgs(); err != nil {
+		return err
+	}
+	if erc.snapshotPath == "" {
+		return errors.New("--snapshot must be specified")
+	} else if _, err := os.Stat(erc.snapshotPath); os.IsNotExist(err) {
+		return errors.Errorf("specified --snapshot does not exist (%s)", erc.snapshotPath)
+	}
+	return nil
+}
+
+func (erc *etcdRestoreCmd) run() error {
+	log.Warnf("Restoring etcd from %s, the control plane will be unavailable until the restore completes", erc.snapshotPath)
+	if err := etcd.NewSnapshotter(erc.masters, log.NewEntry(log.StandardLogger())).Restore(context.Background(), erc.snapshotPath); err != nil {
+		return errors.Wrap(err, "restoring etcd snapshot")
+	}
+	log.Infoln("etcd restore completed")
+	return nil
+}
+
+// getMasterHosts returns the control plane nodes, reachable through the jumpbox
+func getMasterHosts(cs *api.ContainerService, authConfig *ssh.AuthConfig, jumpbox *ssh.JumpBox) []*ssh.RemoteHost {
+	masters := []*ssh.RemoteHost{}
+	for _, master := range cs.Properties.GetMasterVMNameList() {
+		masters = append(masters, &ssh.RemoteHost{
+			URI:             master,
+			Port:            22,
+			OperatingSystem: api.Linux,
+			AuthConfig:      authConfig,
+			Jumpbox:         jumpbox,
+		})
+	}
+	return masters
+}
+
+// etcdSnapshotFileName returns the name of a snapshot taken at time t
+func etcdSnapshotFileName(t time.Time) string {
+	return fmt.Sprintf("etcd-snapshot-%s.db", t.UTC().Format("20060102T150405Z"))
+}
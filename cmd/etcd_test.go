@@ -0,0 +1,161 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+func TestNewEtcdCmd(t *testing.T) {
+	t.Parallel()
+	g := NewGomegaWithT(t)
+
+	command := newEtcdCmd()
+	g.Expect(command.Use).Should(Equal(etcdName))
+	g.Expect(command.Short).Should(Equal(etcdShortDescription))
+	g.Expect(command.Long).Should(Equal(etcdLongDescription))
+	g.Expect(command.Commands()).To(HaveLen(2))
+
+	backup := command.Commands()[0]
+	g.Expect(backup.Use).Should(Equal(etcdBackupName))
+	for _, f := range []string{"location", "api-model", "ssh-host", "linux-ssh-private-key", "output-directory", "resource-group", "storage-account", "storage-container", "subscription-id"} {
+		if backup.Flags().Lookup(f) == nil {
+			t.Fatalf("etcd backup command should have flag %s", f)
+		}
+	}
+
+	restore := command.Commands()[1]
+	g.Expect(restore.Use).Should(Equal(etcdRestoreName))
+	for _, f := range []string{"location", "api-model", "ssh-host", "linux-ssh-private-key", "snapshot"} {
+		if restore.Flags().Lookup(f) == nil {
+			t.Fatalf("etcd restore command should have flag %s", f)
+		}
+	}
+}
+
+func TestEtcdBackupCmdValidateArgs(t *testing.T) {
+	t.Parallel()
+
+	existingFile := "../examples/kubernetes.json"
+	missingFile := "./random/file"
+	outputDirectory := t.TempDir()
+
+	cases := []struct {
+		ebc         *etcdBackupCmd
+		expectedErr error
+		name        string
+	}{
+		{
+			ebc: &etcdBackupCmd{
+				etcdCmd:         etcdCmd{apiModelPath: existingFile, linuxSSHPrivateKeyPath: existingFile, sshHostURI: "server.example.com", location: "southcentralus"},
+				authProvider:    &authArgs{},
+				outputDirectory: outputDirectory,
+			},
+			expectedErr: nil,
+			name:        "Valid input",
+		},
+		{
+			ebc: &etcdBackupCmd{
+				etcdCmd:         etcdCmd{apiModelPath: missingFile, linuxSSHPrivateKeyPath: existingFile, sshHostURI: "server.example.com", location: "southcentralus"},
+				authProvider:    &authArgs{},
+				outputDirectory: outputDirectory,
+			},
+			expectedErr: errors.Errorf("specified --api-model does not exist (%s)", missingFile),
+			name:        "Invalid api-model",
+		},
+		{
+			ebc: &etcdBackupCmd{
+				etcdCmd:         etcdCmd{apiModelPath: existingFile, linuxSSHPrivateKeyPath: existingFile, location: "southcentralus"},
+				authProvider:    &authArgs{},
+				outputDirectory: outputDirectory,
+			},
+			expectedErr: errors.New("--ssh-host must be specified"),
+			name:        "Missing SSH host",
+		},
+		{
+			ebc: &etcdBackupCmd{
+				etcdCmd:         etcdCmd{apiModelPath: existingFile, linuxSSHPrivateKeyPath: missingFile, sshHostURI: "server.example.com", location: "southcentralus"},
+				authProvider:    &authArgs{},
+				outputDirectory: outputDirectory,
+			},
+			expectedErr: errors.Errorf("specified --linux-ssh-private-key does not exist (%s)", missingFile),
+			name:        "Invalid SSH private key",
+		},
+		{
+			ebc: &etcdBackupCmd{
+				etcdCmd:            etcdCmd{apiModelPath: existingFile, linuxSSHPrivateKeyPath: existingFile, sshHostURI: "server.example.com", location: "southcentralus"},
+				authProvider:       &authArgs{},
+				outputDirectory:    outputDirectory,
+				storageAccountName: "backups",
+			},
+			expectedErr: errors.New("--resource-group must be specified when --storage-account is set"),
+			name:        "Missing storage account resource group",
+		},
+		{
+			ebc: &etcdBackupCmd{
+				etcdCmd:            etcdCmd{apiModelPath: existingFile, linuxSSHPrivateKeyPath: existingFile, sshHostURI: "server.example.com", location: "southcentralus"},
+				authProvider:       &authArgs{},
+				outputDirectory:    outputDirectory,
+				storageAccountName: "backups",
+				resourceGroupName:  "rg",
+			},
+			expectedErr: errors.New("--storage-container cannot be empty"),
+			name:        "Missing storage container",
+		},
+		{
+			ebc: &etcdBackupCmd{
+				etcdCmd:              etcdCmd{apiModelPath: existingFile, linuxSSHPrivateKeyPath: existingFile, sshHostURI: "server.example.com", location: "southcentralus"},
+				authProvider:         &authArgs{},
+				outputDirectory:      outputDirectory,
+				storageAccountName:   "backups",
+				storageContainerName: etcdDefaultStorageContainer,
+				resourceGroupName:    "rg",
+			},
+			expectedErr: errors.New("--auth-method is a required parameter"),
+			name:        "Missing auth args",
+		},
+	}
+
+	for _, tc := range cases {
+		c := tc
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			g := NewGomegaWithT(t)
+			err := c.ebc.validateArgs()
+			if c.expectedErr != nil {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(Equal(c.expectedErr.Error()))
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestEtcdRestoreCmdValidateArgs(t *testing.T) {
+	t.Parallel()
+	g := NewGomegaWithT(t)
+
+	existingFile := "../examples/kubernetes.json"
+	erc := &etcdRestoreCmd{
+		etcdCmd: etcdCmd{apiModelPath: existingFile, linuxSSHPrivateKeyPath: existingFile, sshHostURI: "server.example.com", location: "southcentralus"},
+	}
+	g.Expect(erc.validateArgs()).To(MatchError("--snapshot must be specified"))
+	erc.snapshotPath = "./random/file"
+	g.Expect(erc.validateArgs()).To(MatchError("specified --snapshot does not exist (./random/file)"))
+	erc.snapshotPath = existingFile
+	g.Expect(erc.validateArgs()).To(Succeed())
+	erc.location = ""
+	g.Expect(erc.validateArgs()).To(MatchError("--location must be specified"))
+}
+
+func TestEtcdSnapshotFileName(t *testing.T) {
+	g := NewGomegaWithT(t)
+	ts := time.Date(2026, 10, 17, 20, 4, 5, 0, time.FixedZone("UTC+2", 2*60*60))
+	g.Expect(etcdSnapshotFileName(ts)).To(Equal("etcd-snapshot-20261017T180405Z.db"))
+}
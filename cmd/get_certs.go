@@ -0,0 +1,339 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Azure/aks-engine-azurestack/pkg/api"
+	"github.com/Azure/aks-engine-azurestack/pkg/helpers"
+	"github.com/Azure/aks-engine-azurestack/pkg/helpers/ssh"
+	"github.com/Azure/aks-engine-azurestack/pkg/i18n"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	getCertsName             = "get-certs"
+	getCertsShortDescription = "Show the certificates of an existing AKS Engine-created Kubernetes cluster and when they expire"
+	getCertsLongDescription  = "Show subject, SANs, issuer and expiration date of the certificates stored in the API model and, optionally, of the certificate files found on the control plane nodes. Exits with a non-zero status if any certificate expires within the --expiring-within threshold."
+)
+
+const (
+	getCertsAPIModelSource         = "apimodel"
+	getCertsDefaultExpiringWithin  = "30d"
+	getCertsRemoteCertsDir         = "/etc/kubernetes/certs"
+	getCertsRemoteFileHeaderPrefix = "### "
+	getCertsTimeout                = 5 * time.Minute
+)
+
+// getCertsListScript prints every certificate file found on the node preceded by a header line with its path
+var getCertsListScript = fmt.Sprintf(`for f in %s/*.crt; do if sudo test -f "$f"; then echo "%s$f"; sudo cat "$f"; fi; done`, getCertsRemoteCertsDir, getCertsRemoteFileHeaderPrefix)
+
+// certificateDetail describes a single certificate
+type certificateDetail struct {
+	Source        string    `json:"source"`
+	Name          string    `json:"name"`
+	Subject       string    `json:"subject"`
+	Issuer        string    `json:"issuer"`
+	SANs          []string  `json:"sans,omitempty"`
+	NotAfter      time.Time `json:"notAfter"`
+	DaysRemaining int       `json:"daysRemaining"`
+	Expiring      bool      `json:"expiring"`
+}
+
+type getCertsCmd struct {
+	// user input
+	apiModelPath           string
+	sshHostURI             string
+	linuxSSHPrivateKeyPath string
+	output                 string
+	expiringWithin         string
+
+	// computed
+	cs               *api.ContainerService
+	expiringDuration time.Duration
+	masters          []*ssh.RemoteHost
+	executeRemote    func(ctx context.Context, host *ssh.RemoteHost, script string) (string, error)
+}
+
+func newGetCertsCmd() *cobra.Command {
+	gcc := getCertsCmd{
+		executeRemote: ssh.ExecuteRemote,
+	}
+	command := &cobra.Command{
+		Use:   getCertsName,
+		Short: getCertsShortDescription,
+		Long:  getCertsLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := gcc.validateArgs(); err != nil {
+				return errors.Wrap(err, "validating get-certs args")
+			}
+			if err := gcc.loadAPIModel(); err != nil {
+				return errors.Wrap(err, "loading API model")
+			}
+			if err := gcc.init(); err != nil {
+				return err
+			}
+			cmd.SilenceUsage = true
+			return gcc.run(os.Stdout)
+		},
+	}
+	f := command.Flags()
+	f.StringVarP(&gcc.apiModelPath, "api-model", "m", "", "path to the generated apimodel.json file (required)")
+	f.StringVar(&gcc.sshHostURI, "ssh-host", "", "FQDN, or IP address, of an SSH listener that can reach the control plane nodes, if set the certificate files found on the control plane nodes are inspected too")
+	f.StringVar(&gcc.linuxSSHPrivateKeyPath, "linux-ssh-private-key", "", "path to a valid private SSH key to access the control plane nodes (required if --ssh-host is set)")
+	f.StringVarP(&gcc.output, "output", "o", "human", fmt.Sprintf("Output format. Allowed values: %s", strings.Join(outputFormatOptions, ", ")))
+	f.StringVar(&gcc.expiringWithin, "expiring-within", getCertsDefaultExpiringWithin, "exit with a non-zero status if any certificate expires within the specified duration (e.g. 30d, 720h)")
+	_ = command.MarkFlagRequired("api-model")
+	return command
+}
+
+func (gcc *getCertsCmd) validateArgs() (err error) {
+	validOutput := false
+	for _, opt := range outputFormatOptions {
+		if gcc.output == opt {
+			validOutput = true
+			break
+		}
+	}
+	if !validOutput {
+		return errors.Errorf("invalid output format: \"%s\". Allowed values: %s", gcc.output, strings.Join(outputFormatOptions, ", "))
+	}
+	if gcc.apiModelPath == "" {
+		return errors.New("--api-model must be specified")
+	} else if _, err = os.Stat(gcc.apiModelPath); os.IsNotExist(err) {
+		return errors.Errorf("specified --api-model does not exist (%s)", gcc.apiModelPath)
+	}
+	if gcc.sshHostURI != "" {
+		if gcc.linuxSSHPrivateKeyPath == "" {
+			return errors.New("--linux-ssh-private-key must be specified when --ssh-host is set")
+		} else if _, err = os.Stat(gcc.linuxSSHPrivateKeyPath); os.IsNotExist(err) {
+			return errors.Errorf("specified --linux-ssh-private-key does not exist (%s)", gcc.linuxSSHPrivateKeyPath)
+		}
+	}
+	if gcc.expiringDuration, err = parseExpiringWithin(gcc.expiringWithin); err != nil {
+		return errors.Wrapf(err, "invalid --expiring-within value %s", gcc.expiringWithin)
+	}
+	return nil
+}
+
+func (gcc *getCertsCmd) loadAPIModel() error {
+	locale, err := i18n.LoadTranslations()
+	if err != nil {
+		return errors.Wrap(err, "loading translation files")
+	}
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{
+			Locale: locale,
+		},
+	}
+	if gcc.cs, _, err = apiloader.LoadContainerServiceFromFile(gcc.apiModelPath, false, false, nil); err != nil {
+		return errors.Wrap(err, "error parsing api-model")
+	}
+	if gcc.cs.Properties.MasterProfile == nil {
+		return errors.New("api-model does not define a control plane")
+	}
+	if gcc.cs.Properties.CertificateProfile == nil {
+		return errors.New("api-model does not contain a certificate profile")
+	}
+	return nil
+}
+
+func (gcc *getCertsCmd) init() error {
+	if gcc.sshHostURI == "" {
+		return nil
+	}
+	authConfig := &ssh.AuthConfig{
+		User:           gcc.cs.Properties.LinuxProfile.AdminUsername,
+		PrivateKeyPath: gcc.linuxSSHPrivateKeyPath,
+	}
+	jumpbox := &ssh.JumpBox{URI: gcc.sshHostURI, Port: vmssSSHPort, OperatingSystem: api.Linux, AuthConfig: authConfig}
+	if gcc.cs.Properties.MasterProfile.IsAvailabilitySet() {
+		jumpbox.Port = vmasSSHPort
+	}
+	if err := ssh.ValidateConfig(jumpbox); err != nil {
+		return errors.Wrap(err, "validating ssh configuration")
+	}
+	gcc.masters = getMasterHosts(gcc.cs, authConfig, jumpbox)
+	return nil
+}
+
+func (gcc *getCertsCmd) run(out io.Writer) error {
+	now := time.Now()
+	details, err := apiModelCertificates(gcc.cs, now, gcc.expiringDuration)
+	if err != nil {
+		return err
+	}
+	for _, master := range gcc.masters {
+		nodeDetails, err := gcc.nodeCertificates(master, now)
+		if err != nil {
+			return err
+		}
+		details = append(details, nodeDetails...)
+	}
+	if err = writeCertificateDetails(out, details, gcc.output); err != nil {
+		return err
+	}
+	expiring := 0
+	for _, d := range details {
+		if d.Expiring {
+			expiring++
+		}
+	}
+	if expiring > 0 {
+		return errors.Errorf("%d certificate(s) expire within %s", expiring, gcc.expiringWithin)
+	}
+	return nil
+}
+
+// nodeCertificates reads and parses the certificate files found on a control plane node
+func (gcc *getCertsCmd) nodeCertificates(node *ssh.RemoteHost, now time.Time) ([]certificateDetail, error) {
+	log.Debugf("Reading certificates from node %s", node.URI)
+	ctx, cancel := context.WithTimeout(context.Background(), getCertsTimeout)
+	defer cancel()
+	stdout, err := gcc.executeRemote(ctx, node, getCertsListScript)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading certificates from node %s: %s", node.URI, stdout)
+	}
+	details := []certificateDetail{}
+	for _, f := range splitRemoteCertificateFiles(stdout) {
+		d, err := newCertificateDetail(node.URI, f.name, f.content, now, gcc.expiringDuration)
+		if err != nil {
+			log.Warnf("Skipping %s on node %s: %s", f.name, node.URI, err)
+			continue
+		}
+		details = append(details, d)
+	}
+	return details, nil
+}
+
+type remoteCertificateFile struct {
+	name    string
+	content string
+}
+
+// splitRemoteCertificateFiles splits the output of getCertsListScript into the files it contains
+func splitRemoteCertificateFiles(stdout string) []remoteCertificateFile {
+	files := []remoteCertificateFile{}
+	var b strings.Builder
+	name := ""
+	flush := func() {
+		if name != "" {
+			files = append(files, remoteCertificateFile{name: name, content: b.String()})
+		}
+		b.Reset()
+	}
+	for _, line := range strings.Split(stdout, "\n") {
+		if strings.HasPrefix(line, getCertsRemoteFileHeaderPrefix) {
+			flush()
+			name = strings.TrimPrefix(line, getCertsRemoteFileHeaderPrefix)
+			continue
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	flush()
+	return files
+}
+
+// apiModelCertificates returns the details of the certificates stored in the API model certificate profile
+func apiModelCertificates(cs *api.ContainerService, now time.Time, expiringWithin time.Duration) ([]certificateDetail, error) {
+	p := cs.Properties.CertificateProfile
+	certs := []struct {
+		name string
+		pem  string
+	}{
+		{"ca.crt", p.CaCertificate},
+		{"apiserver.crt", p.APIServerCertificate},
+		{"client.crt", p.ClientCertificate},
+		{"kubectlClient.crt", p.KubeConfigCertificate},
+		{"etcdserver.crt", p.EtcdServerCertificate},
+		{"etcdclient.crt", p.EtcdClientCertificate},
+	}
+	for i, pem := range p.EtcdPeerCertificates {
+		certs = append(certs, struct {
+			name string
+			pem  string
+		}{fmt.Sprintf("etcdpeer%d.crt", i), pem})
+	}
+	details := []certificateDetail{}
+	for _, c := range certs {
+		if c.pem == "" {
+			log.Warnf("%s is not set in the api-model certificate profile", c.name)
+			continue
+		}
+		d, err := newCertificateDetail(getCertsAPIModelSource, c.name, c.pem, now, expiringWithin)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing %s", c.name)
+		}
+		details = append(details, d)
+	}
+	return details, nil
+}
+
+func newCertificateDetail(source, name, pem string, now time.Time, expiringWithin time.Duration) (certificateDetail, error) {
+	c, err := helpers.ParseCertificate(pem)
+	if err != nil {
+		return certificateDetail{}, err
+	}
+	return certificateDetail{
+		Source:        source,
+		Name:          name,
+		Subject:       c.Subject.String(),
+		Issuer:        c.Issuer.String(),
+		SANs:          certificateSANs(c),
+		NotAfter:      c.NotAfter.UTC(),
+		DaysRemaining: int(math.Floor(c.NotAfter.Sub(now).Hours() / 24)),
+		Expiring:      c.NotAfter.Before(now.Add(expiringWithin)),
+	}, nil
+}
+
+func certificateSANs(c *x509.Certificate) []string {
+	sans := append([]string{}, c.DNSNames...)
+	for _, ip := range c.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	return sans
+}
+
+func writeCertificateDetails(out io.Writer, details []certificateDetail, output string) error {
+	sort.SliceStable(details, func(i, j int) bool {
+		if details[i].Source != details[j].Source {
+			// API model certificates go first
+			return details[i].Source == getCertsAPIModelSource || (details[j].Source != getCertsAPIModelSource && details[i].Source < details[j].Source)
+		}
+		return details[i].Name < details[j].Name
+	})
+	switch output {
+	case "json":
+		data, err := helpers.JSONMarshalIndent(details, "", "  ", false)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, string(data))
+	default:
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', tabwriter.FilterHTML)
+		fmt.Fprintln(w, "SOURCE\tCERTIFICATE\tSUBJECT\tISSUER\tNOT AFTER\tDAYS LEFT\tSANS")
+		for _, d := range details {
+			daysLeft := fmt.Sprintf("%d", d.DaysRemaining)
+			if d.Expiring {
+				daysLeft += " (expiring)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", d.Source, d.Name, d.Subject, d.Issuer, d.NotAfter.Format(time.RFC3339), daysLeft, strings.Join(d.SANs, ","))
+		}
+		w.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Azure/aks-engine-azurestack/pkg/api"
+	"github.com/Azure/aks-engine-azurestack/pkg/helpers/ssh"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+func TestNewGetCertsCmd(t *testing.T) {
+	t.Parallel()
+	g := NewGomegaWithT(t)
+
+	command := newGetCertsCmd()
+	g.Expect(command.Use).Should(Equal(getCertsName))
+	g.Expect(command.Short).Should(Equal(getCertsShortDescription))
+	g.Expect(command.Long).Should(Equal(getCertsLongDescription))
+	for _, f := range []string{"api-model", "ssh-host", "linux-ssh-private-key", "output", "expiring-within"} {
+		if command.Flags().Lookup(f) == nil {
+			t.Fatalf("get-certs command should have flag %s", f)
+		}
+	}
+
+	command.SetArgs([]string{})
+	err := command.Execute()
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestGetCertsCmdValidateArgs(t *testing.T) {
+	t.Parallel()
+
+	existingFile := "../examples/kubernetes.json"
+	missingFile := "./random/file"
+
+	cases := []struct {
+		gcc         *getCertsCmd
+		expectedErr error
+		name        string
+	}{
+		{
+			gcc:         &getCertsCmd{apiModelPath: existingFile, output: "human", expiringWithin: "30d"},
+			expectedErr: nil,
+			name:        "Valid input",
+		},
+		{
+			gcc:         &getCertsCmd{apiModelPath: existingFile, sshHostURI: "server.example.com", linuxSSHPrivateKeyPath: existingFile, output: "json", expiringWithin: "720h"},
+			expectedErr: nil,
+			name:        "Valid input with SSH",
+		},
+		{
+			gcc:         &getCertsCmd{apiModelPath: existingFile, output: "yaml", expiringWithin: "30d"},
+			expectedErr: errors.New("invalid output format: \"yaml\". Allowed values: human, json"),
+			name:        "Invalid output format",
+		},
+		{
+			gcc:         &getCertsCmd{output: "human", expiringWithin: "30d"},
+			expectedErr: errors.New("--api-model must be specified"),
+			name:        "Missing api-model",
+		},
+		{
+			gcc:         &getCertsCmd{apiModelPath: missingFile, output: "human", expiringWithin: "30d"},
+			expectedErr: errors.Errorf("specified --api-model does not exist (%s)", missingFile),
+			name:        "Invalid api-model",
+		},
+		{
+			gcc:         &getCertsCmd{apiModelPath: existingFile, sshHostURI: "server.example.com", output: "human", expiringWithin: "30d"},
+			expectedErr: errors.New("--linux-ssh-private-key must be specified when --ssh-host is set"),
+			name:        "Missing SSH private key",
+		},
+		{
+			gcc:         &getCertsCmd{apiModelPath: existingFile, sshHostURI: "server.example.com", linuxSSHPrivateKeyPath: missingFile, output: "human", expiringWithin: "30d"},
+			expectedErr: errors.Errorf("specified --linux-ssh-private-key does not exist (%s)", missingFile),
+			name:        "Invalid SSH private key",
+		},
+		{
+			gcc:         &getCertsCmd{apiModelPath: existingFile, output: "human", expiringWithin: "0d"},
+			expectedErr: errors.New("invalid --expiring-within value 0d: duration must be positive"),
+			name:        "Invalid expiring-within",
+		},
+	}
+
+	for _, tc := range cases {
+		c := tc
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			g := NewGomegaWithT(t)
+			err := c.gcc.validateArgs()
+			if c.expectedErr != nil {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(Equal(c.expectedErr.Error()))
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestGetCertsCmdRun(t *testing.T) {
+	t.Parallel()
+	g := NewGomegaWithT(t)
+
+	cs := api.CreateMockContainerService("testcluster", "", 1, 1, false)
+	cs.Properties.MasterProfile.FirstConsecutiveStaticIP = "10.239.255.239"
+	_, _, err := cs.SetDefaultCerts(api.DefaultCertParams{PkiKeySize: 2048})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	gcc := &getCertsCmd{
+		cs:               cs,
+		output:           "json",
+		expiringWithin:   "30d",
+		expiringDuration: 30 * 24 * time.Hour,
+		masters:          []*ssh.RemoteHost{{URI: "k8s-master-12345678-0"}},
+		executeRemote: func(ctx context.Context, host *ssh.RemoteHost, script string) (string, error) {
+			return fmt.Sprintf("### /etc/kubernetes/certs/apiserver.crt\n%s### /etc/kubernetes/certs/broken.crt\nnot a certificate\n", cs.Properties.CertificateProfile.APIServerCertificate), nil
+		},
+	}
+	out := &bytes.Buffer{}
+	g.Expect(gcc.run(out)).To(Succeed())
+
+	details := []certificateDetail{}
+	g.Expect(json.Unmarshal(out.Bytes(), &details)).To(Succeed())
+	// 7 certificates from the api model, 1 from the node, broken.crt is skipped
+	g.Expect(details).To(HaveLen(8))
+	g.Expect(details[0].Source).To(Equal(getCertsAPIModelSource))
+	g.Expect(details[0].Name).To(Equal("apiserver.crt"))
+	g.Expect(details[0].Subject).To(Equal("CN=apiserver"))
+	g.Expect(details[0].Issuer).To(Equal("CN=ca"))
+	g.Expect(details[0].SANs).To(ContainElements("kubernetes.default.svc.cluster.local", "10.239.255.239"))
+	g.Expect(details[0].DaysRemaining).To(BeNumerically(">", 365*29))
+	g.Expect(details[0].Expiring).To(BeFalse())
+	g.Expect(details[7].Source).To(Equal("k8s-master-12345678-0"))
+	g.Expect(details[7].Name).To(Equal("/etc/kubernetes/certs/apiserver.crt"))
+
+	// all certificates expire within 31 years
+	gcc.output = "human"
+	gcc.expiringWithin = "11315d"
+	gcc.expiringDuration = 11315 * 24 * time.Hour
+	out.Reset()
+	err = gcc.run(out)
+	g.Expect(err).To(MatchError("8 certificate(s) expire within 11315d"))
+	g.Expect(out.String()).To(ContainSubstring("SOURCE"))
+	g.Expect(out.String()).To(ContainSubstring("(expiring)"))
+
+	gcc.executeRemote = func(ctx context.Context, host *ssh.RemoteHost, script string) (string, error) {
+		return "Permission denied", errors.New("exit status 1")
+	}
+	err = gcc.run(out)
+	g.Expect(err).To(MatchError("reading certificates from node k8s-master-12345678-0: Permission denied: exit status 1"))
+}
+
+func TestSplitRemoteCertificateFiles(t *testing.T) {
+	t.Parallel()
+	g := NewGomegaWithT(t)
+
+	g.Expect(splitRemoteCertificateFiles("")).To(BeEmpty())
+	files := splitRemoteCertificateFiles("### /etc/kubernetes/certs/a.crt\nA1\nA2\n### /etc/kubernetes/certs/b.crt\nB\n")
+	g.Expect(files).To(Equal([]remoteCertificateFile{
+		{name: "/etc/kubernetes/certs/a.crt", content: "A1\nA2\n"},
+		{name: "/etc/kubernetes/certs/b.crt", content: "B\n\n"},
+	}))
+}
@@ -4,29 +4,39 @@
 package cmd
 
 import (
+	"archive/zip"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 
 	"github.com/Azure/aks-engine-azurestack/pkg/api"
+	"github.com/Azure/aks-engine-azurestack/pkg/armhelpers"
 	"github.com/Azure/aks-engine-azurestack/pkg/helpers"
 	"github.com/Azure/aks-engine-azurestack/pkg/helpers/ssh"
 	"github.com/Azure/aks-engine-azurestack/pkg/i18n"
 	"github.com/Azure/aks-engine-azurestack/pkg/kubernetes"
+	azStorage "github.com/Azure/azure-sdk-for-go/storage"
 	"github.com/Azure/azure-storage-blob-go/azblob"
 	"github.com/leonelquinteros/gotext"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
@@ -41,8 +51,43 @@ const (
 	getLogsWindowsVHDScriptPath    = "c:\\k\\debug\\collect-windows-logs.ps1"
 	getLogsCustomWindowsScriptPath = "$env:temp\\collect-windows-logs.ps1"
 	getLogsUploadTimeout           = 300 * time.Second
+	getLogsConnectionTimeout       = 10 * time.Second
+	getLogsDefaultParallelism      = 10
+	getLogsDefaultNodeTimeout      = 10
+	getLogsIndexFileName           = "index.json"
+	getLogsClusterStateName        = "cluster-state"
 )
 
+var (
+	// redactPrivateKeyRegexp matches PEM-encoded private keys
+	redactPrivateKeyRegexp = regexp.MustCompile(`(?s)-----BEGIN ([A-Z ]*)PRIVATE KEY-----.*?-----END ([A-Z ]*)PRIVATE KEY-----`)
+	// redactAzureJSONRegexp matches the values of the azure.json secret properties
+	redactAzureJSONRegexp = regexp.MustCompile(`("(?:aadClientSecret|aadClientCertPassword)"\s*:\s*)"[^"]*"`)
+	// redactKubeConfigRegexp matches the values of the kubeconfig user credentials
+	redactKubeConfigRegexp = regexp.MustCompile(`("?(?:client-key-data|token|password)"?\s*:\s*)("[^"]*"|[^\s,}]+)`)
+	// kubeConfigRegexp matches the kind of a kubeconfig file
+	kubeConfigRegexp = regexp.MustCompile(`"?kind"?\s*:\s*"?Config\b`)
+)
+
+// nodeLogsArchive describes the logs collected from a node
+type nodeLogsArchive struct {
+	Node            string     `json:"node"`
+	Role            string     `json:"role"`
+	Pool            string     `json:"pool,omitempty"`
+	OperatingSystem api.OSType `json:"os"`
+	Archive         string     `json:"archive,omitempty"`
+	Size            int64      `json:"size,omitempty"`
+	CollectedAt     time.Time  `json:"collectedAt"`
+	Duration        string     `json:"duration"`
+	Error           string     `json:"error,omitempty"`
+}
+
+// logsIndex describes the content of the get-logs output directory
+type logsIndex struct {
+	ClusterState string            `json:"clusterState,omitempty"`
+	Nodes        []nodeLogsArchive `json:"nodes"`
+}
+
 type getLogsCmd struct {
 	// user input
 	location               string
@@ -55,6 +100,13 @@ type getLogsCmd struct {
 	controlPlaneOnly       bool
 	uploadSASURL           string
 	nodeNames              []string
+	parallelism            int
+	nodeTimeoutInMinutes   int
+	redact                 bool
+	storageAccount         string
+	storageContainer       string
+	storageResourceGroup   string
+	authArgs
 	// computed
 	cs                  *api.ContainerService
 	locale              *gotext.Locale
@@ -65,10 +117,16 @@ type getLogsCmd struct {
 	windowsVHDScript    *ssh.RemoteFile
 	windowsCustomScript *ssh.RemoteFile
 	jumpbox             *ssh.JumpBox
+	nodeTimeout         time.Duration
+	storageClient       armhelpers.AKSStorageClient
+	// collect collects the logs of a node to file dst, it defaults to collectLogs
+	collect func(ctx context.Context, glc *getLogsCmd, node *ssh.RemoteHost, script *ssh.RemoteFile, dst string) error
 }
 
 func newGetLogsCmd() *cobra.Command {
-	glc := getLogsCmd{}
+	glc := getLogsCmd{
+		collect: collectLogs,
+	}
 	command := &cobra.Command{
 		Use:   getLogsName,
 		Short: getLogsShortDescription,
@@ -83,6 +141,9 @@ func newGetLogsCmd() *cobra.Command {
 			if err := glc.init(); err != nil {
 				return errors.Wrap(err, "loading API model")
 			}
+			if err := glc.initStorageClient(cmd.Flags()); err != nil {
+				return errors.Wrap(err, "initializing storage account client")
+			}
 			cmd.SilenceUsage = true
 			return glc.run()
 		},
@@ -96,11 +157,18 @@ func newGetLogsCmd() *cobra.Command {
 	command.Flags().StringVarP(&glc.outputDirectory, "output-directory", "o", "", "collected logs destination directory, derived from --api-model if missing")
 	command.Flags().BoolVarP(&glc.controlPlaneOnly, "control-plane-only", "", false, "get logs from control plane VMs only")
 	command.Flags().StringVarP(&glc.uploadSASURL, "upload-sas-url", "", "", "Azure Storage Account SAS URL to upload the collected logs")
+	command.Flags().StringVar(&glc.storageAccount, "storage-account", "", "name of the Azure Storage Account to upload the collected logs to, its keys are retrieved using the cluster service principal unless auth flags are set")
+	command.Flags().StringVar(&glc.storageContainer, "storage-container", "", "name of the storage account container to upload the collected logs to, created if missing (required if --storage-account is set)")
+	command.Flags().StringVar(&glc.storageResourceGroup, "storage-account-resource-group", "", "resource group of the storage account (required if --storage-account is set)")
 	command.Flags().StringSliceVar(&glc.nodeNames, "vm-names", nil, "get logs from the VM name list only (comma-separated names)")
+	command.Flags().IntVar(&glc.parallelism, "parallelism", getLogsDefaultParallelism, "maximum number of nodes to collect logs from concurrently")
+	command.Flags().BoolVar(&glc.redact, "redact", false, "redact secrets, such as private keys and the azure.json and kubeconfig credentials, from the collected logs")
+	command.Flags().IntVar(&glc.nodeTimeoutInMinutes, "node-timeout", getLogsDefaultNodeTimeout, "how long to wait for the logs of each node to be collected in minutes")
 	_ = command.MarkFlagRequired("location")
 	_ = command.MarkFlagRequired("api-model")
 	_ = command.MarkFlagRequired("ssh-host")
 	_ = command.MarkFlagRequired("linux-ssh-private-key")
+	addAuthFlags(&glc.authArgs, command.Flags())
 	return command
 }
 
@@ -154,12 +222,29 @@ func (glc *getLogsCmd) validateArgs() (err error) {
 			return errors.New("invalid upload SAS URL format, expected 'https://{blob-service-uri}/{container-name}?{sas-token}'")
 		}
 	}
+	if glc.storageAccount != "" {
+		if glc.uploadSASURL != "" {
+			return errors.New("--upload-sas-url and --storage-account are mutually exclusive")
+		}
+		if glc.storageContainer == "" {
+			return errors.New("--storage-container must be specified when --storage-account is set")
+		}
+		if glc.storageResourceGroup == "" {
+			return errors.New("--storage-account-resource-group must be specified when --storage-account is set")
+		}
+	}
 	if glc.nodeNames != nil && len(glc.nodeNames) == 0 {
 		return errors.New("--vm-names cannot be empty")
 	}
 	if glc.nodeNames != nil && glc.controlPlaneOnly {
 		return errors.New("--control-plane-only and --vm-names are mutually exclusive")
 	}
+	if glc.parallelism < 1 {
+		return errors.New("--parallelism must be greater than 0")
+	}
+	if glc.nodeTimeoutInMinutes < 1 {
+		return errors.New("--node-timeout must be greater than 0")
+	}
 	return nil
 }
 
@@ -189,6 +274,7 @@ func (glc *getLogsCmd) loadAPIModel() (err error) {
 }
 
 func (glc *getLogsCmd) init() (err error) {
+	glc.nodeTimeout = time.Duration(glc.nodeTimeoutInMinutes) * time.Minute
 	if glc.linuxScriptPath != "" {
 		sc, err := os.ReadFile(glc.linuxScriptPath)
 		if err != nil {
@@ -231,29 +317,152 @@ func (glc *getLogsCmd) run() error {
 	if err != nil {
 		return errors.Wrap(err, "creating Kubernetes client")
 	}
+	index := logsIndex{}
+	log.Info("Collecting cluster state")
+	clusterState := path.Join(glc.outputDirectory, getLogsClusterStateName+".zip")
+	if err = collectClusterState(kubeClient, clusterState); err == nil && glc.redact {
+		if err = redactArchive(clusterState); err != nil {
+			_ = os.Remove(clusterState)
+		}
+	}
+	if err != nil {
+		log.Warnf("Error collecting cluster state: %s", err)
+	} else {
+		index.ClusterState = getLogsClusterStateName + ".zip"
+		if err = glc.uploadArchive(getLogsClusterStateName); err != nil {
+			log.Warn("Error uploading cluster state")
+			log.Debugf("Error: %s", err)
+		}
+	}
 	nodes := getClusterNodes(glc, kubeClient)
 	nodeScripts := getClusterNodeScripts(glc, nodes)
 	if len(nodeScripts) == 0 {
 		log.Info("All nodes skipped")
-		return nil
 	}
-	for node, script := range nodeScripts {
-		err = collectLogs(glc, node, script)
-		if err != nil {
-			return err
-		}
+	index.Nodes = glc.collectAllLogs(nodeScripts)
+	if err = writeLogsIndex(glc.outputDirectory, index); err != nil {
+		return err
 	}
 	log.Infof("Logs downloaded to %s", glc.outputDirectory)
-	if glc.uploadSASURL != "" {
-		for node := range nodeScripts {
-			err = uploadLogs(node, glc.outputDirectory, glc.uploadSASURL)
-			if err != nil {
-				log.Warnf("Error uploading %s logs", node.URI)
-				log.Debugf("Error: %s", err)
+	var failed []string
+	archives := index.Nodes
+	for _, a := range archives {
+		if a.Error != "" {
+			log.Errorf("Failed to collect logs from node %s: %s", a.Node, a.Error)
+			failed = append(failed, a.Node)
+			continue
+		}
+		if err = glc.uploadArchive(a.Node); err != nil {
+			log.Warnf("Error uploading %s logs", a.Node)
+			log.Debugf("Error: %s", err)
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("failed to collect logs from %d of %d nodes: %s", len(failed), len(archives), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// collectAllLogs collects the logs of the nodes concurrently, at most glc.parallelism at a time,
+// and returns the description of the collected logs sorted by node name
+func (glc *getLogsCmd) collectAllLogs(nodeScripts map[*ssh.RemoteHost]*ssh.RemoteFile) []nodeLogsArchive {
+	archives := make([]nodeLogsArchive, 0, len(nodeScripts))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, glc.parallelism)
+	for node, script := range nodeScripts {
+		wg.Add(1)
+		go func(node *ssh.RemoteHost, script *ssh.RemoteFile) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			a := glc.collectNodeLogs(node, script)
+			mu.Lock()
+			archives = append(archives, a)
+			mu.Unlock()
+		}(node, script)
+	}
+	wg.Wait()
+	sort.Slice(archives, func(i, j int) bool { return archives[i].Node < archives[j].Node })
+	return archives
+}
+
+// collectNodeLogs collects the logs of a node within glc.nodeTimeoutInMinutes
+func (glc *getLogsCmd) collectNodeLogs(node *ssh.RemoteHost, script *ssh.RemoteFile) nodeLogsArchive {
+	a := nodeLogsArchive{
+		Node:            node.URI,
+		Role:            "agent",
+		OperatingSystem: node.OperatingSystem,
+	}
+	if isMasterNode(node.URI, glc.cs.Properties.GetMasterVMPrefix()) {
+		a.Role = "master"
+	} else {
+		for i, pool := range glc.cs.Properties.AgentPoolProfiles {
+			if glc.cs.Properties.IsAgentPoolMember(node.URI, pool, i) {
+				a.Pool = pool.Name
+				break
 			}
 		}
 	}
-	return err
+	archive := fmt.Sprintf("%s.zip", node.URI)
+	dst := path.Join(glc.outputDirectory, archive)
+	// the logs are downloaded to a temporary file so that a node that times out
+	// or fails does not leave a partial archive behind
+	tmp := dst + ".tmp"
+	ctx, cancel := context.WithTimeout(context.Background(), glc.nodeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- glc.collect(ctx, glc, node, script, tmp)
+	}()
+	var err error
+	select {
+	case err = <-errc:
+		if err != nil {
+			_ = os.Remove(tmp)
+		}
+	case <-ctx.Done():
+		err = errors.Errorf("timed out after %s", glc.nodeTimeout)
+		// the collection is interrupted by the cancellation of ctx, the parallelism slot
+		// is released right away and the partial download removed once it returns
+		go func() {
+			<-errc
+			_ = os.Remove(tmp)
+		}()
+	}
+	a.CollectedAt = time.Now().UTC()
+	a.Duration = a.CollectedAt.Sub(start).Round(time.Second).String()
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err == nil && glc.redact {
+		if err = redactArchive(dst); err != nil {
+			_ = os.Remove(dst)
+		}
+	}
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	a.Archive = archive
+	if fi, err := os.Stat(dst); err == nil {
+		a.Size = fi.Size()
+	}
+	return a
+}
+
+// writeLogsIndex writes the description of the collected logs to the output directory
+func writeLogsIndex(outputDirectory string, index logsIndex) error {
+	b, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "encoding logs index")
+	}
+	if err = os.WriteFile(path.Join(outputDirectory, getLogsIndexFileName), b, 0644); err != nil {
+		return errors.Wrap(err, "writing logs index")
+	}
+	return nil
 }
 
 // getClusterNodes returns the target node list
@@ -353,38 +562,266 @@ func getClusterNodeScripts(glc *getLogsCmd, nodes []*ssh.RemoteHost) map[*ssh.Re
 	return nodeScript
 }
 
-// collectLogs uploads the log collection script (if needed), executes the script and downloads the collected logs
-func collectLogs(glc *getLogsCmd, node *ssh.RemoteHost, script *ssh.RemoteFile) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+// clusterStateWriter adds the cluster state retrieved from the api server to a zip archive,
+// the retrieval errors are collected and written to file errors.txt once the archive is closed
+type clusterStateWriter struct {
+	zw   *zip.Writer
+	errs []string
+}
+
+func (w *clusterStateWriter) write(name string, get func() ([]byte, error)) {
+	b, err := get()
+	if err != nil {
+		log.Debugf("Error retrieving %s: %s", name, err)
+		w.errs = append(w.errs, fmt.Sprintf("%s: %s", name, err))
+		return
+	}
+	f, err := w.zw.Create(name)
+	if err == nil {
+		_, err = f.Write(b)
+	}
+	if err != nil {
+		w.errs = append(w.errs, fmt.Sprintf("%s: %s", name, err))
+	}
+}
+
+func (w *clusterStateWriter) writeJSON(name string, get func() (interface{}, error)) {
+	w.write(name, func() ([]byte, error) {
+		o, err := get()
+		if err != nil {
+			return nil, err
+		}
+		return json.MarshalIndent(o, "", "  ")
+	})
+}
+
+func (w *clusterStateWriter) close() error {
+	if len(w.errs) > 0 {
+		errs := strings.Join(w.errs, "\n") + "\n"
+		w.write("errors.txt", func() ([]byte, error) { return []byte(errs), nil })
+	}
+	return w.zw.Close()
+}
+
+// collectClusterState dumps the cluster-scoped state retrieved from the api server to zip archive dst
+func collectClusterState(kubeClient kubernetes.Client, dst string) error {
+	f, err := os.Create(dst)
+	if err != nil {
+		return errors.Wrapf(err, "creating %s", dst)
+	}
+	defer f.Close()
+	w := &clusterStateWriter{zw: zip.NewWriter(f)}
+	w.writeJSON("nodes.json", func() (interface{}, error) { return kubeClient.ListNodes() })
+	w.writeJSON("events.json", func() (interface{}, error) { return kubeClient.ListEvents(metav1.NamespaceAll, metav1.ListOptions{}) })
+	w.writeJSON("daemonsets.json", func() (interface{}, error) {
+		return kubeClient.ListDaemonSets(metav1.NamespaceAll, metav1.ListOptions{})
+	})
+	w.writeJSON("deployments.json", func() (interface{}, error) {
+		return kubeClient.ListDeployments(metav1.NamespaceAll, metav1.ListOptions{})
+	})
+	w.write("apiserver/healthz.txt", func() ([]byte, error) { return kubeClient.GetRaw("/healthz") })
+	w.write("apiserver/metrics.txt", func() ([]byte, error) { return kubeClient.GetRaw("/metrics") })
+	pods, err := kubeClient.ListPodsByOptions(metav1.NamespaceSystem, metav1.ListOptions{})
+	w.writeJSON(path.Join(metav1.NamespaceSystem, "pods.json"), func() (interface{}, error) { return pods, err })
+	if err == nil {
+		for _, pod := range pods.Items {
+			writePodLogs(w, kubeClient, pod)
+		}
+	}
+	if err = w.close(); err != nil {
+		return errors.Wrapf(err, "writing %s", dst)
+	}
+	return nil
+}
+
+// writePodLogs adds the logs of the pod containers to the archive,
+// including the logs of the previous container instance if the container restarted
+func writePodLogs(w *clusterStateWriter, kubeClient kubernetes.Client, pod v1.Pod) {
+	restarts := map[string]int32{}
+	for _, cs := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+		restarts[cs.Name] = cs.RestartCount
+	}
+	for _, c := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+		container := c.Name
+		dir := path.Join(pod.Namespace, "logs", pod.Name)
+		w.write(path.Join(dir, container+".log"), func() ([]byte, error) {
+			return kubeClient.GetPodLogs(pod.Namespace, pod.Name, &v1.PodLogOptions{Container: container})
+		})
+		if restarts[container] > 0 {
+			w.write(path.Join(dir, container+".previous.log"), func() ([]byte, error) {
+				return kubeClient.GetPodLogs(pod.Namespace, pod.Name, &v1.PodLogOptions{Container: container, Previous: true})
+			})
+		}
+	}
+}
+
+// redactArchive replaces the secrets found in the files of zip archive src
+func redactArchive(src string) error {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return errors.Wrapf(err, "redacting %s", src)
+	}
+	defer r.Close()
+	tmp := src + ".redacted"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return errors.Wrapf(err, "redacting %s", src)
+	}
+	defer os.Remove(tmp)
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for _, entry := range r.File {
+		if err = redactArchiveEntry(w, entry); err != nil {
+			return errors.Wrapf(err, "redacting %s in %s", entry.Name, src)
+		}
+	}
+	if err = w.Close(); err != nil {
+		return errors.Wrapf(err, "redacting %s", src)
+	}
+	if err = f.Close(); err != nil {
+		return errors.Wrapf(err, "redacting %s", src)
+	}
+	return os.Rename(tmp, src)
+}
+
+func redactArchiveEntry(w *zip.Writer, entry *zip.File) error {
+	rc, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+	fh := entry.FileHeader
+	dst, err := w.CreateHeader(&fh)
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(redactContent(b))
+	return err
+}
+
+// redactContent replaces the private keys, the azure.json secrets and the kubeconfig credentials found in b
+func redactContent(b []byte) []byte {
+	b = redactPrivateKeyRegexp.ReplaceAll(b, []byte(api.RedactedValue))
+	b = redactAzureJSONRegexp.ReplaceAll(b, []byte(`${1}"`+api.RedactedValue+`"`))
+	if kubeConfigRegexp.Match(b) {
+		b = redactKubeConfigRegexp.ReplaceAll(b, []byte(`${1}"`+api.RedactedValue+`"`))
+	}
+	return b
+}
+
+// collectLogs uploads the log collection script (if needed), executes the script and downloads the collected logs to dst
+func collectLogs(ctx context.Context, glc *getLogsCmd, node *ssh.RemoteHost, script *ssh.RemoteFile, dst string) error {
+	// the connection attempts are bounded by getLogsConnectionTimeout,
+	// the remote commands are interrupted once ctx is done
+	connectCtx, cancel := context.WithTimeout(ctx, getLogsConnectionTimeout)
 	defer cancel()
 
 	log.Infof("Processing node: %s", node.URI)
 	if script.Content != nil {
-		stdout, err := ssh.CopyToRemote(ctx, node, script)
+		stdout, err := ssh.CopyToRemoteWithCancel(connectCtx, ctx.Done(), node, script)
 		if err != nil {
 			return errors.Wrap(err, stdout)
 		}
 	}
 	isAzureStack := glc.cs.Properties.IsAzureStackCloud()
-	stdout, err := ssh.ExecuteRemote(ctx, node, collectLogsScript(script, node.OperatingSystem, isAzureStack))
+	stdout, err := ssh.ExecuteRemoteWithCancel(connectCtx, ctx.Done(), node, collectLogsScript(script, node.OperatingSystem, isAzureStack))
 	if err != nil {
 		return errors.Wrap(err, stdout)
 	}
 	src := fileToDownload(node.OperatingSystem, node.URI)
-	dst := path.Join(glc.outputDirectory, fmt.Sprintf("%s.zip", node.URI))
-	stdout, err = ssh.CopyFromRemote(ctx, node, src, dst)
+	stdout, err = ssh.CopyFromRemoteWithCancel(connectCtx, ctx.Done(), node, src, dst)
 	if err != nil {
 		return errors.Wrap(err, stdout)
 	}
 	return err
 }
 
+// initStorageClient creates the storage account container the collected logs are uploaded to, if --storage-account is set.
+// Unless auth flags are set, the cluster service principal is used to retrieve the storage account keys
+func (glc *getLogsCmd) initStorageClient(flags *flag.FlagSet) error {
+	if glc.storageAccount == "" {
+		return nil
+	}
+	glc.useClusterCredentials(flags)
+	if err := glc.validateAuthArgs(); err != nil {
+		return err
+	}
+	client, err := glc.getClient()
+	if err != nil {
+		return errors.Wrap(err, "creating Azure client")
+	}
+	return glc.createStorageContainer(client)
+}
+
+// useClusterCredentials sets the auth args from the API model if they were not set by the user
+func (glc *getLogsCmd) useClusterCredentials(flags *flag.FlagSet) {
+	if glc.cs.Properties.IsAzureStackCloud() {
+		if !flags.Changed("azure-env") {
+			glc.RawAzureEnvironment = api.AzureStackCloud
+		}
+		if !flags.Changed("identity-system") && glc.cs.Properties.GetCustomCloudIdentitySystem() != "" {
+			glc.IdentitySystem = glc.cs.Properties.GetCustomCloudIdentitySystem()
+		}
+	}
+	sp := glc.cs.Properties.ServicePrincipalProfile
+	if flags.Changed("auth-method") || flags.Changed("client-id") || sp == nil || sp.ClientID == "" || sp.Secret == "" {
+		return
+	}
+	log.Info("Using the cluster service principal to access the storage account")
+	glc.AuthMethod = "client_secret"
+	glc.rawClientID = sp.ClientID
+	glc.ClientSecret = sp.Secret
+}
+
+// createStorageContainer retrieves the storage account keys and creates the logs container if it does not exist
+func (glc *getLogsCmd) createStorageContainer(client armhelpers.AKSEngineClient) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), getLogsUploadTimeout)
+	defer cancel()
+	if glc.storageClient, err = client.GetStorageClient(ctx, glc.storageResourceGroup, glc.storageAccount); err != nil {
+		return errors.Wrapf(err, "retrieving keys of storage account %s", glc.storageAccount)
+	}
+	if _, err = glc.storageClient.CreateContainer(glc.storageContainer, &azStorage.CreateContainerOptions{}); err != nil {
+		return errors.Wrapf(err, "creating storage container %s", glc.storageContainer)
+	}
+	return nil
+}
+
+// uploadArchive uploads archive {name}.zip to the storage account container or the SAS URL, if any
+func (glc *getLogsCmd) uploadArchive(name string) error {
+	if glc.storageClient != nil {
+		return uploadLogsToContainer(glc.storageClient, glc.storageContainer, name, glc.outputDirectory)
+	}
+	if glc.uploadSASURL != "" {
+		return uploadLogs(name, glc.outputDirectory, glc.uploadSASURL)
+	}
+	return nil
+}
+
+// uploadLogsToContainer uploads collected logs to a container of the storage account set by --storage-account
+func uploadLogsToContainer(client armhelpers.AKSStorageClient, container, name, outputDirectory string) error {
+	log.Infof("Uploading %s logs", name)
+	blob := fmt.Sprintf("%s.zip", name)
+	fp := path.Join(outputDirectory, blob)
+	b, err := os.ReadFile(fp)
+	if err != nil {
+		return errors.Wrapf(err, "reading file %s", fp)
+	}
+	if err = client.SaveBlockBlob(container, blob, b, &azStorage.PutBlobOptions{}); err != nil {
+		return errors.Wrapf(err, "uploading %s to container %s", blob, container)
+	}
+	return nil
+}
+
 // uploadLogs uploads collected logs to an azure storage account
-func uploadLogs(node *ssh.RemoteHost, outputDirectory, uploadSASURL string) error {
-	log.Infof("Uploading %s logs", node.URI)
+func uploadLogs(nodeName, outputDirectory, uploadSASURL string) error {
+	log.Infof("Uploading %s logs", nodeName)
 	ctx, cancel := context.WithTimeout(context.Background(), getLogsUploadTimeout)
 	defer cancel()
-	fp := path.Join(outputDirectory, fmt.Sprintf("%s.zip", node.URI))
+	fp := path.Join(outputDirectory, fmt.Sprintf("%s.zip", nodeName))
 	f, err := os.Open(fp)
 	if err != nil {
 		return errors.Wrapf(err, "reading file %s", fp)
@@ -393,7 +830,7 @@ func uploadLogs(node *ssh.RemoteHost, outputDirectory, uploadSASURL string) erro
 	if err != nil {
 		return errors.Wrap(err, "parsing upload SAS URL")
 	}
-	sas.Path = path.Join(sas.Path, fmt.Sprintf("%s.zip", node.URI))
+	sas.Path = path.Join(sas.Path, fmt.Sprintf("%s.zip", nodeName))
 	_, err = uploadToSASURL(ctx, f, sas)
 	if err != nil {
 		return err
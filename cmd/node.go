@@ -0,0 +1,511 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/aks-engine-azurestack/pkg/api"
+	"github.com/Azure/aks-engine-azurestack/pkg/api/common"
+	"github.com/Azure/aks-engine-azurestack/pkg/armhelpers"
+	"github.com/Azure/aks-engine-azurestack/pkg/engine"
+	"github.com/Azure/aks-engine-azurestack/pkg/helpers"
+	"github.com/Azure/aks-engine-azurestack/pkg/i18n"
+	"github.com/Azure/aks-engine-azurestack/pkg/kubernetes"
+	"github.com/Azure/aks-engine-azurestack/pkg/operations"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-12-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/leonelquinteros/gotext"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	nodeCmdName          = "node"
+	nodeShortDescription = "Restart or reimage the nodes of an existing AKS Engine-created Kubernetes cluster"
+	nodeLongDescription  = "Restart or reimage the VMs backing the nodes of an existing AKS Engine-created Kubernetes cluster, one node at a time, without recreating them"
+
+	nodeRestartName             = "restart"
+	nodeRestartShortDescription = "Cordon, drain and restart nodes"
+	nodeRestartLongDescription  = "Cordon and drain each node, restart its VM, wait for the node to be Ready and uncordon it, one node at a time"
+
+	nodeReimageName             = "reimage"
+	nodeReimageShortDescription = "Cordon, drain and reimage nodes"
+	nodeReimageLongDescription  = "Cordon and drain each node, reimage the OS disk of its VM, wait for the node to be Ready and uncordon it, one node at a time. Availability set VMs must have an ephemeral OS disk, control plane nodes cannot be reimaged."
+)
+
+const (
+	nodeDefaultTimeout            = 20 * time.Minute
+	nodeDefaultCordonDrainTimeout = 20 * time.Minute
+	nodeDefaultPollInterval       = 10 * time.Second
+	nodeReadySuccessesNeeded      = 3
+)
+
+type nodeCmd struct {
+	authArgs
+
+	// user input
+	location                    string
+	resourceGroupName           string
+	apiModelPath                string
+	nodeNames                   []string
+	allInPool                   string
+	timeoutInMinutes            int
+	cordonDrainTimeoutInMinutes int
+
+	// derived
+	operation          string
+	containerService   *api.ContainerService
+	client             armhelpers.AKSEngineClient
+	kubeClient         kubernetes.Client
+	locale             *gotext.Locale
+	nameSuffix         string
+	timeout            time.Duration
+	cordonDrainTimeout time.Duration
+	pollInterval       time.Duration
+	logger             *log.Entry
+}
+
+// nodeVM is the VM backing a Kubernetes node, either an availability set VM or a VMSS instance
+type nodeVM struct {
+	name       string
+	vmName     string
+	vmssName   string
+	instanceID string
+	isMaster   bool
+	// ephemeralOSDisk is true if the availability set VM has an ephemeral OS disk, which is required to reimage it
+	ephemeralOSDisk bool
+}
+
+func newNodeCmd() *cobra.Command {
+	command := &cobra.Command{
+		Use:   nodeCmdName,
+		Short: nodeShortDescription,
+		Long:  nodeLongDescription,
+	}
+	command.AddCommand(newNodeOperationCmd(nodeRestartName, nodeRestartShortDescription, nodeRestartLongDescription))
+	command.AddCommand(newNodeOperationCmd(nodeReimageName, nodeReimageShortDescription, nodeReimageLongDescription))
+	return command
+}
+
+func newNodeOperationCmd(operation, short, long string) *cobra.Command {
+	nc := nodeCmd{
+		operation:    operation,
+		pollInterval: nodeDefaultPollInterval,
+	}
+	command := &cobra.Command{
+		Use:   operation,
+		Short: short,
+		Long:  long,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return nc.run(cmd, args)
+		},
+	}
+
+	f := command.Flags()
+	f.StringVarP(&nc.location, "location", "l", "", "location the cluster is deployed in (required)")
+	f.StringVarP(&nc.resourceGroupName, "resource-group", "g", "", "the resource group where the cluster is deployed (required)")
+	f.StringVarP(&nc.apiModelPath, "api-model", "m", "", "path to the generated apimodel.json file (required)")
+	f.StringSliceVar(&nc.nodeNames, "node", nil, "comma-separated list of the nodes to "+operation)
+	f.StringVar(&nc.allInPool, "all-in-pool", "", "name of a node pool, or \"master\", to "+operation+" all its nodes one at a time")
+	f.IntVar(&nc.timeoutInMinutes, "vm-timeout", -1, "how long to wait for each node to be ready in minutes")
+	f.IntVar(&nc.cordonDrainTimeoutInMinutes, "cordon-drain-timeout", -1, "how long to wait for each node to be cordoned in minutes")
+
+	addAuthFlags(&nc.authArgs, f)
+
+	return command
+}
+
+func (nc *nodeCmd) validate(cmd *cobra.Command) error {
+	log.Debugf("validating node %s command line arguments...", nc.operation)
+	var err error
+
+	nc.locale, err = i18n.LoadTranslations()
+	if err != nil {
+		return errors.Wrap(err, "error loading translation files")
+	}
+
+	if nc.resourceGroupName == "" {
+		_ = cmd.Usage()
+		return errors.New("--resource-group must be specified")
+	}
+
+	if nc.location == "" {
+		_ = cmd.Usage()
+		return errors.New("--location must be specified")
+	}
+
+	nc.location = helpers.NormalizeAzureRegion(nc.location)
+
+	if nc.apiModelPath == "" {
+		_ = cmd.Usage()
+		return errors.New("--api-model must be specified")
+	}
+
+	if len(nc.nodeNames) == 0 && nc.allInPool == "" {
+		_ = cmd.Usage()
+		return errors.New("either --node or --all-in-pool must be specified")
+	}
+
+	if len(nc.nodeNames) > 0 && nc.allInPool != "" {
+		_ = cmd.Usage()
+		return errors.New("--node and --all-in-pool are mutually exclusive")
+	}
+
+	nc.timeout = nodeDefaultTimeout
+	if nc.timeoutInMinutes != -1 {
+		nc.timeout = time.Duration(nc.timeoutInMinutes) * time.Minute
+	}
+
+	if nc.cordonDrainTimeoutInMinutes != -1 {
+		nc.cordonDrainTimeout = time.Duration(nc.cordonDrainTimeoutInMinutes) * time.Minute
+	}
+	return nil
+}
+
+func (nc *nodeCmd) load() error {
+	nc.logger = log.NewEntry(log.New())
+	var err error
+
+	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+	defer cancel()
+
+	if _, err = os.Stat(nc.apiModelPath); os.IsNotExist(err) {
+		return errors.Errorf("specified api model does not exist (%s)", nc.apiModelPath)
+	}
+
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{
+			Locale: nc.locale,
+		},
+	}
+	nc.containerService, _, err = apiloader.LoadContainerServiceFromFile(nc.apiModelPath, true, true, nil)
+	if err != nil {
+		return errors.Wrap(err, "error parsing the api model")
+	}
+
+	if nc.containerService.Location == "" {
+		nc.containerService.Location = nc.location
+	} else if nc.containerService.Location != nc.location {
+		return errors.New("--location does not match api model location")
+	}
+
+	// Set 60 minutes cordonDrainTimeout for Azure Stack Cloud to give it enough time to move around resources during Node Drain,
+	// especially disk detach/attach operations. We still honor the user's input.
+	if nc.cordonDrainTimeout == 0 {
+		nc.cordonDrainTimeout = nodeDefaultCordonDrainTimeout
+		if nc.containerService.Properties.IsAzureStackCloud() {
+			nc.cordonDrainTimeout = time.Duration(60) * time.Minute
+		}
+	}
+
+	if nc.containerService.Properties.IsCustomCloudProfile() {
+		if err = writeCustomCloudProfile(nc.containerService); err != nil {
+			return errors.Wrap(err, "error writing custom cloud profile")
+		}
+		if err = nc.containerService.Properties.SetCustomCloudSpec(api.AzureCustomCloudSpecParams{IsUpgrade: false, IsScale: true}); err != nil {
+			return errors.Wrap(err, "error parsing the api model")
+		}
+	}
+
+	if err = nc.authArgs.validateAuthArgs(); err != nil {
+		return err
+	}
+
+	if nc.client, err = nc.authArgs.getClient(); err != nil {
+		return errors.Wrap(err, "failed to get client")
+	}
+
+	if _, err = nc.client.EnsureResourceGroup(ctx, nc.resourceGroupName, nc.location, nil); err != nil {
+		return errors.Wrap(err, "error ensuring resource group")
+	}
+
+	//allows to identify VMs in the resource group that belong to this cluster.
+	nc.nameSuffix = nc.containerService.Properties.GetClusterID()
+	log.Debugf("Cluster ID used in all agent pools: %s", nc.nameSuffix)
+
+	kubeconfig, err := engine.GenerateKubeConfig(nc.containerService.Properties, nc.location)
+	if err != nil {
+		return errors.New("Unable to derive kubeconfig from api model")
+	}
+	nc.kubeClient, err = nc.client.GetKubernetesClient("", kubeconfig, nc.pollInterval, nc.timeout)
+	if err != nil {
+		return errors.Wrap(err, "failed to get a Kubernetes client")
+	}
+	return nil
+}
+
+func (nc *nodeCmd) run(cmd *cobra.Command, args []string) error {
+	if err := nc.validate(cmd); err != nil {
+		return errors.Wrapf(err, "failed to validate node %s command", nc.operation)
+	}
+	if err := nc.load(); err != nil {
+		return errors.Wrap(err, "failed to load existing container service")
+	}
+	cmd.SilenceUsage = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+	defer cancel()
+	vms, err := nc.getNodeVMs(ctx)
+	if err != nil {
+		return err
+	}
+	return nc.runOperation(vms)
+}
+
+// runOperation restarts or reimages the given nodes one at a time, stopping at the first failure
+func (nc *nodeCmd) runOperation(vms []nodeVM) error {
+	for i, vm := range vms {
+		nc.logger.Infof("Running %s of node %s (%d/%d)", nc.operation, vm.name, i+1, len(vms))
+		if err := nc.runNodeOperation(vm); err != nil {
+			return errors.Wrapf(err, "failed to %s node %s", nc.operation, vm.name)
+		}
+		nc.logger.Infof("Node %s is ready", vm.name)
+	}
+	return nil
+}
+
+// runNodeOperation cordons and drains the node, restarts or reimages its VM,
+// then waits for the node to be Ready after it booted again and uncordons it.
+// The node is uncordoned as well if any step after the drain fails
+func (nc *nodeCmd) runNodeOperation(vm nodeVM) (err error) {
+	var bootID string
+	node, err := nc.kubeClient.GetNode(vm.name)
+	if err != nil {
+		nc.logger.Warnf("Failed to get node %s, it won't be drained: %v", vm.name, err)
+	} else {
+		bootID = node.Status.NodeInfo.BootID
+		defer func() {
+			if err == nil {
+				return
+			}
+			if uncordonErr := nc.uncordonNode(vm.name); uncordonErr != nil {
+				nc.logger.Warnf("Node %s was left unschedulable, uncordon it once it is healthy: %v", vm.name, uncordonErr)
+				return
+			}
+			nc.logger.Warnf("Uncordoned node %s after the failure", vm.name)
+		}()
+		if err = operations.SafelyDrainNodeWithClient(nc.kubeClient, nc.logger, vm.name, nc.cordonDrainTimeout); err != nil {
+			if kubernetes.IsNodeReady(node) {
+				// the pods that could not be evicted, i.e. because of a PodDisruptionBudget, would go down with the node
+				return errors.Wrapf(err, "draining node %s", vm.name)
+			}
+			nc.logger.Warnf("Failed to drain node %s, proceeding because it is not ready: %v", vm.name, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+	defer cancel()
+	switch {
+	case nc.operation == nodeReimageName && vm.vmssName != "":
+		nc.logger.Infof("Reimaging instance %s of VMSS %s", vm.instanceID, vm.vmssName)
+		err = nc.client.ReimageVirtualMachineScaleSetVMs(ctx, nc.resourceGroupName, vm.vmssName, []string{vm.instanceID})
+	case nc.operation == nodeReimageName:
+		nc.logger.Infof("Reimaging VM %s", vm.vmName)
+		err = nc.client.ReimageVirtualMachine(ctx, nc.resourceGroupName, vm.vmName)
+	case vm.vmssName != "":
+		nc.logger.Infof("Restarting instance %s of VMSS %s", vm.instanceID, vm.vmssName)
+		err = nc.client.RestartVirtualMachineScaleSets(ctx, nc.resourceGroupName, vm.vmssName, &compute.VirtualMachineScaleSetVMInstanceIDs{
+			InstanceIds: &[]string{vm.instanceID},
+		})
+	default:
+		nc.logger.Infof("Restarting VM %s", vm.vmName)
+		err = nc.client.RestartVirtualMachine(ctx, nc.resourceGroupName, vm.vmName)
+	}
+	if err != nil {
+		return err
+	}
+
+	nc.logger.Infof("Waiting for node %s to be ready", vm.name)
+	if err = nc.waitForNodeReady(vm.name, bootID); err != nil {
+		return errors.Wrapf(err, "waiting for node %s to be ready", vm.name)
+	}
+	return nc.uncordonNode(vm.name)
+}
+
+// waitForNodeReady waits for the node to be Ready for a few consecutive checks and, if previousBootID is set,
+// for the node to report a different boot ID so that the Ready condition posted before the reboot is not trusted
+func (nc *nodeCmd) waitForNodeReady(name, previousBootID string) error {
+	var successesCount int
+	return wait.PollImmediate(nc.pollInterval, nc.timeout, func() (bool, error) {
+		node, err := nc.kubeClient.GetNode(name)
+		if err != nil || !kubernetes.IsNodeReady(node) || (previousBootID != "" && node.Status.NodeInfo.BootID == previousBootID) {
+			successesCount = 0
+			return false, nil
+		}
+		successesCount++
+		return successesCount >= nodeReadySuccessesNeeded, nil
+	})
+}
+
+func (nc *nodeCmd) uncordonNode(name string) error {
+	node, err := nc.kubeClient.GetNode(name)
+	if err != nil {
+		return errors.Wrapf(err, "getting node %s", name)
+	}
+	node.Spec.Unschedulable = false
+	if _, err = nc.kubeClient.UpdateNode(node); err != nil {
+		return errors.Wrapf(err, "uncordoning node %s", name)
+	}
+	return nil
+}
+
+// getNodeVMs returns the VMs backing the nodes passed with --node, or all the VMs of the node pool passed with --all-in-pool
+func (nc *nodeCmd) getNodeVMs(ctx context.Context) ([]nodeVM, error) {
+	var vms []nodeVM
+	var err error
+	if nc.allInPool != "" {
+		vms, err = nc.getNodePoolVMs(ctx, nc.allInPool)
+		if err != nil {
+			return nil, err
+		}
+		if len(vms) == 0 {
+			return nil, errors.Errorf("found no VMs in node pool %s", nc.allInPool)
+		}
+	} else {
+		// resolve the nodes through the VMs of their node pools, which gives the instance IDs of VMSS instances
+		poolVMs := make(map[string][]nodeVM)
+		for _, name := range nc.nodeNames {
+			poolName, err := nc.getNodePoolName(name)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := poolVMs[poolName]; !ok {
+				if poolVMs[poolName], err = nc.getNodePoolVMs(ctx, poolName); err != nil {
+					return nil, err
+				}
+			}
+			found := false
+			for _, vm := range poolVMs[poolName] {
+				if strings.EqualFold(vm.name, name) {
+					vms = append(vms, vm)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, errors.Errorf("found no VM backing node %s in node pool %s", name, poolName)
+			}
+		}
+	}
+	if nc.operation == nodeReimageName {
+		// check all the nodes before draining any of them
+		for _, vm := range vms {
+			if err = nc.validateReimage(vm); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return vms, nil
+}
+
+// validateReimage returns an error if the VM backing the node can't be reimaged
+func (nc *nodeCmd) validateReimage(vm nodeVM) error {
+	switch {
+	case vm.isMaster:
+		return errors.Errorf("node %s is a control plane node, control plane nodes cannot be reimaged", vm.name)
+	case vm.vmssName != "":
+		return nil
+	case nc.containerService.Properties.IsAzureStackCloud():
+		return errors.Errorf("node %s is backed by availability set VM %s, availability set VMs cannot be reimaged on Azure Stack Hub, use repair-node to replace it", vm.name, vm.vmName)
+	case !vm.ephemeralOSDisk:
+		return errors.Errorf("node %s is backed by availability set VM %s which has no ephemeral OS disk, only availability set VMs with an ephemeral OS disk can be reimaged", vm.name, vm.vmName)
+	}
+	return nil
+}
+
+// getNodePoolName returns the name of the node pool of the given node, common.LegacyControlPlaneVMPrefix for control plane nodes
+func (nc *nodeCmd) getNodePoolName(name string) (string, error) {
+	props := nc.containerService.Properties
+	if props.MasterProfile != nil && strings.HasPrefix(strings.ToLower(name), strings.ToLower(props.GetMasterVMPrefix())) {
+		return common.LegacyControlPlaneVMPrefix, nil
+	}
+	for i, pool := range props.AgentPoolProfiles {
+		if strings.HasPrefix(strings.ToLower(name), strings.ToLower(props.GetAgentVMPrefix(pool, i))) {
+			return pool.Name, nil
+		}
+	}
+	return "", errors.Errorf("node %s was not found in any node pool of the api model", name)
+}
+
+// getNodePoolVMs lists the VMs of the given node pool, the control plane VMs if poolName is "master", sorted by name
+func (nc *nodeCmd) getNodePoolVMs(ctx context.Context, poolName string) ([]nodeVM, error) {
+	props := nc.containerService.Properties
+	var pool *api.AgentPoolProfile
+	var poolIndex int
+	var prefix string
+	if strings.EqualFold(poolName, common.LegacyControlPlaneVMPrefix) {
+		if props.MasterProfile == nil {
+			return nil, errors.New("the api model has no control plane")
+		}
+		prefix = props.GetMasterVMPrefix()
+	} else {
+		for i, p := range props.AgentPoolProfiles {
+			if strings.EqualFold(p.Name, poolName) {
+				pool, poolIndex = p, i
+				break
+			}
+		}
+		if pool == nil {
+			return nil, errors.Errorf("node pool %s was not found in the api model", poolName)
+		}
+		prefix = props.GetAgentVMPrefix(pool, poolIndex)
+	}
+
+	vms := make([]nodeVM, 0)
+	if pool != nil && pool.IsVirtualMachineScaleSets() {
+		// Back-compat logic to populate the VMSSName property for clusters built prior to VMSSName being a part of the API model spec
+		vmssName := pool.VMSSName
+		if vmssName == "" {
+			vmssName = prefix
+		}
+		for vmPage, err := nc.client.ListVirtualMachineScaleSetVMs(ctx, nc.resourceGroupName, vmssName); vmPage.NotDone(); err = vmPage.NextWithContext(ctx) {
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to list the instances of VMSS %s", vmssName)
+			}
+			for _, vm := range vmPage.Values() {
+				if vm.VirtualMachineScaleSetVMProperties == nil || vm.OsProfile == nil || vm.OsProfile.ComputerName == nil {
+					continue
+				}
+				vms = append(vms, nodeVM{
+					name:       strings.ToLower(to.String(vm.OsProfile.ComputerName)),
+					vmssName:   vmssName,
+					instanceID: to.String(vm.InstanceID),
+				})
+			}
+		}
+	} else {
+		for vmPage, err := nc.client.ListVirtualMachines(ctx, nc.resourceGroupName); vmPage.NotDone(); err = vmPage.Next() {
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to get VMs in the resource group")
+			}
+			for _, vm := range vmPage.Values() {
+				vmName := to.String(vm.Name)
+				if strings.HasPrefix(strings.ToLower(vmName), strings.ToLower(prefix)) {
+					vms = append(vms, nodeVM{
+						name:            strings.ToLower(vmName),
+						vmName:          vmName,
+						isMaster:        pool == nil,
+						ephemeralOSDisk: hasEphemeralOSDisk(vm),
+					})
+				}
+			}
+		}
+	}
+	sort.Slice(vms, func(i, j int) bool {
+		return vms[i].name < vms[j].name
+	})
+	return vms, nil
+}
+
+func hasEphemeralOSDisk(vm compute.VirtualMachine) bool {
+	return vm.VirtualMachineProperties != nil && vm.StorageProfile != nil && vm.StorageProfile.OsDisk != nil &&
+		vm.StorageProfile.OsDisk.DiffDiskSettings != nil && vm.StorageProfile.OsDisk.DiffDiskSettings.Option == compute.Local
+}
@@ -0,0 +1,393 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/aks-engine-azurestack/pkg/api"
+	"github.com/Azure/aks-engine-azurestack/pkg/armhelpers"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-12-01/compute"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestNewNodeCmd(t *testing.T) {
+	command := newNodeCmd()
+	if command.Use != nodeCmdName || command.Short != nodeShortDescription || command.Long != nodeLongDescription {
+		t.Fatalf("node command should have use %s equal %s, short %s equal %s and long %s equal to %s", command.Use, nodeCmdName, command.Short, nodeShortDescription, command.Long, nodeLongDescription)
+	}
+
+	expectedFlags := []string{"location", "resource-group", "api-model", "node", "all-in-pool", "vm-timeout", "cordon-drain-timeout"}
+	for _, name := range []string{nodeRestartName, nodeReimageName} {
+		subcommand, _, err := command.Find([]string{name})
+		if err != nil || subcommand.Use != name {
+			t.Fatalf("node command should have subcommand %s", name)
+		}
+		for _, f := range expectedFlags {
+			if subcommand.Flags().Lookup(f) == nil {
+				t.Fatalf("node %s command should have flag %s", name, f)
+			}
+		}
+	}
+}
+
+func TestNodeCmdValidate(t *testing.T) {
+	r := &cobra.Command{}
+
+	cases := []struct {
+		nc          *nodeCmd
+		expectedErr error
+		name        string
+	}{
+		{
+			nc: &nodeCmd{
+				apiModelPath: "./not/used",
+				nodeNames:    []string{"k8s-agentpool1-12345678-0"},
+				location:     "centralus",
+			},
+			expectedErr: errors.New("--resource-group must be specified"),
+			name:        "NoResourceGroup",
+		},
+		{
+			nc: &nodeCmd{
+				apiModelPath:      "./not/used",
+				nodeNames:         []string{"k8s-agentpool1-12345678-0"},
+				resourceGroupName: "testRG",
+			},
+			expectedErr: errors.New("--location must be specified"),
+			name:        "NoLocation",
+		},
+		{
+			nc: &nodeCmd{
+				nodeNames:         []string{"k8s-agentpool1-12345678-0"},
+				location:          "centralus",
+				resourceGroupName: "testRG",
+			},
+			expectedErr: errors.New("--api-model must be specified"),
+			name:        "NoAPIModel",
+		},
+		{
+			nc: &nodeCmd{
+				apiModelPath:      "./not/used",
+				location:          "centralus",
+				resourceGroupName: "testRG",
+			},
+			expectedErr: errors.New("either --node or --all-in-pool must be specified"),
+			name:        "NoNode",
+		},
+		{
+			nc: &nodeCmd{
+				apiModelPath:      "./not/used",
+				nodeNames:         []string{"k8s-agentpool1-12345678-0"},
+				allInPool:         "agentpool1",
+				location:          "centralus",
+				resourceGroupName: "testRG",
+			},
+			expectedErr: errors.New("--node and --all-in-pool are mutually exclusive"),
+			name:        "NodeAndAllInPool",
+		},
+		{
+			nc: &nodeCmd{
+				apiModelPath:                "./not/used",
+				allInPool:                   "agentpool1",
+				location:                    "centralus",
+				resourceGroupName:           "testRG",
+				timeoutInMinutes:            -1,
+				cordonDrainTimeoutInMinutes: -1,
+			},
+			expectedErr: nil,
+			name:        "IsValid",
+		},
+	}
+
+	for _, tc := range cases {
+		c := tc
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			err := c.nc.validate(r)
+			if err != nil && c.expectedErr != nil {
+				if err.Error() != c.expectedErr.Error() {
+					t.Fatalf("expected validate node command to return error %s, but instead got %s", c.expectedErr.Error(), err.Error())
+				}
+			} else {
+				if c.expectedErr != nil {
+					t.Fatalf("expected validate node command to return error %s, but instead got no error", c.expectedErr.Error())
+				} else if err != nil {
+					t.Fatalf("expected validate node command to return no error, but instead got %s", err.Error())
+				}
+			}
+		})
+	}
+}
+
+func TestNodeCmdValidateTimeouts(t *testing.T) {
+	nc := &nodeCmd{
+		apiModelPath:                "./not/used",
+		nodeNames:                   []string{"k8s-agentpool1-12345678-0"},
+		location:                    "centralus",
+		resourceGroupName:           "testRG",
+		timeoutInMinutes:            -1,
+		cordonDrainTimeoutInMinutes: 30,
+	}
+	if err := nc.validate(&cobra.Command{}); err != nil {
+		t.Fatalf("expected no error validating node command, got %s", err)
+	}
+	if nc.timeout != nodeDefaultTimeout {
+		t.Fatalf("expected a %s timeout when --vm-timeout is not set, got %s", nodeDefaultTimeout, nc.timeout)
+	}
+	if nc.cordonDrainTimeout != 30*time.Minute {
+		t.Fatalf("expected a 30 minutes cordon drain timeout, got %s", nc.cordonDrainTimeout)
+	}
+}
+
+// newMockNodeCmd returns a node command for a cluster with a control plane VM, two availability set VMs with an ephemeral
+// OS disk in agentpool1 and one instance in VMSS pool vmsspool, its nodes report a new boot ID every time they are fetched
+func newMockNodeCmd(operation string) (*nodeCmd, *armhelpers.MockAKSEngineClient, func() []string) {
+	cs := api.CreateMockContainerService("testcluster", "", 1, 2, false)
+	clusterID := cs.Properties.GetClusterID()
+	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &api.AgentPoolProfile{
+		Name:                "vmsspool",
+		Count:               1,
+		VMSize:              "Standard_D2_v2",
+		OSType:              api.Linux,
+		AvailabilityProfile: api.VirtualMachineScaleSets,
+		VMSSName:            fmt.Sprintf("k8s-vmsspool-%s-vmss", clusterID),
+	})
+
+	client := &armhelpers.MockAKSEngineClient{MockKubernetesClient: &armhelpers.MockKubernetesClient{}}
+	client.FakeListVirtualMachineResult = func() []compute.VirtualMachine {
+		vms := []compute.VirtualMachine{
+			client.MakeFakeVirtualMachine(fmt.Sprintf("k8s-agentpool1-%s-1", clusterID), "Kubernetes:1.18.8"),
+			client.MakeFakeVirtualMachine(fmt.Sprintf("k8s-master-%s-0", clusterID), "Kubernetes:1.18.8"),
+			client.MakeFakeVirtualMachine(fmt.Sprintf("k8s-agentpool1-%s-0", clusterID), "Kubernetes:1.18.8"),
+		}
+		for _, i := range []int{0, 2} {
+			vms[i].StorageProfile.OsDisk.DiffDiskSettings = &compute.DiffDiskSettings{Option: compute.Local}
+		}
+		return vms
+	}
+	client.FakeListVirtualMachineScaleSetVMsResult = func() []compute.VirtualMachineScaleSetVM {
+		return []compute.VirtualMachineScaleSetVM{
+			client.MakeFakeVirtualMachineScaleSetVMWithGivenName("Kubernetes:1.18.8", fmt.Sprintf("k8s-vmsspool-%s-vmss000000", clusterID)),
+		}
+	}
+
+	var mu sync.Mutex
+	var bootID int
+	var uncordoned []string
+	client.MockKubernetesClient.GetNodeFunc = func(name string) (*v1.Node, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		bootID++
+		node := &v1.Node{}
+		node.Name = name
+		node.Spec.Unschedulable = true
+		node.Status.NodeInfo.BootID = strconv.Itoa(bootID)
+		node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}
+		return node, nil
+	}
+	client.MockKubernetesClient.UpdateNodeFunc = func(node *v1.Node) (*v1.Node, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !node.Spec.Unschedulable {
+			uncordoned = append(uncordoned, node.Name)
+		}
+		return node, nil
+	}
+
+	nc := &nodeCmd{
+		operation:          operation,
+		resourceGroupName:  "testRG",
+		location:           "centralus",
+		containerService:   cs,
+		client:             client,
+		kubeClient:         client.MockKubernetesClient,
+		timeout:            time.Second,
+		cordonDrainTimeout: time.Second,
+		pollInterval:       time.Millisecond,
+	}
+	nc.logger = log.NewEntry(log.New())
+	getUncordoned := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, uncordoned...)
+	}
+	return nc, client, getUncordoned
+}
+
+func TestNodeCmdGetNodeVMs(t *testing.T) {
+	nc, _, _ := newMockNodeCmd(nodeRestartName)
+	clusterID := nc.containerService.Properties.GetClusterID()
+
+	nc.allInPool = "agentpool1"
+	vms, err := nc.getNodeVMs(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error getting the VMs of node pool agentpool1, got %s", err)
+	}
+	if len(vms) != 2 || vms[0].vmName != fmt.Sprintf("k8s-agentpool1-%s-0", clusterID) || vms[1].vmName != fmt.Sprintf("k8s-agentpool1-%s-1", clusterID) {
+		t.Fatalf("expected the 2 VMs of node pool agentpool1 sorted by name, got %v", vms)
+	}
+
+	nc.allInPool = ""
+	nc.nodeNames = []string{fmt.Sprintf("k8s-vmsspool-%s-vmss000000", clusterID), fmt.Sprintf("k8s-master-%s-0", clusterID)}
+	vms, err = nc.getNodeVMs(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error getting the VMs of nodes %v, got %s", nc.nodeNames, err)
+	}
+	if len(vms) != 2 || vms[0].vmssName != fmt.Sprintf("k8s-vmsspool-%s-vmss", clusterID) || vms[0].instanceID != "someguidthatshouldbeunique" {
+		t.Fatalf("expected node %s to be backed by an instance of VMSS k8s-vmsspool-%s-vmss, got %v", nc.nodeNames[0], clusterID, vms)
+	}
+	if vms[1].vmName != nc.nodeNames[1] || !vms[1].isMaster {
+		t.Fatalf("expected node %s to be backed by a control plane VM, got %v", nc.nodeNames[1], vms[1])
+	}
+
+	nc.operation = nodeReimageName
+	if _, err = nc.getNodeVMs(context.Background()); err == nil {
+		t.Fatalf("expected an error reimaging a control plane node")
+	}
+
+	nc.nodeNames = []string{fmt.Sprintf("k8s-agentpool1-%s-5", clusterID)}
+	if _, err = nc.getNodeVMs(context.Background()); err == nil {
+		t.Fatalf("expected an error getting the VM of a node with no VM")
+	}
+
+	nc.nodeNames = []string{"k8s-unknownpool-12345678-0"}
+	if _, err = nc.getNodeVMs(context.Background()); err == nil {
+		t.Fatalf("expected an error getting the VM of a node that is not part of the cluster")
+	}
+
+	nc.nodeNames = nil
+	nc.allInPool = "unknownpool"
+	if _, err = nc.getNodeVMs(context.Background()); err == nil {
+		t.Fatalf("expected an error getting the VMs of a node pool that is not part of the cluster")
+	}
+}
+
+func TestNodeCmdRunOperation(t *testing.T) {
+	cases := []struct {
+		operation string
+		allInPool string
+		fail      func(client *armhelpers.MockAKSEngineClient)
+		name      string
+	}{
+		{operation: nodeRestartName, allInPool: "agentpool1", name: "RestartAvailabilitySet"},
+		{operation: nodeRestartName, allInPool: "vmsspool", name: "RestartVMSS"},
+		{operation: nodeReimageName, allInPool: "agentpool1", name: "ReimageAvailabilitySet"},
+		{operation: nodeReimageName, allInPool: "vmsspool", name: "ReimageVMSS"},
+		{
+			operation: nodeRestartName,
+			allInPool: "agentpool1",
+			fail:      func(client *armhelpers.MockAKSEngineClient) { client.FailRestartVirtualMachine = true },
+			name:      "FailRestartAvailabilitySet",
+		},
+		{
+			operation: nodeRestartName,
+			allInPool: "vmsspool",
+			fail:      func(client *armhelpers.MockAKSEngineClient) { client.FailRestartVirtualMachineScaleSets = true },
+			name:      "FailRestartVMSS",
+		},
+		{
+			operation: nodeReimageName,
+			allInPool: "agentpool1",
+			fail:      func(client *armhelpers.MockAKSEngineClient) { client.FailReimageVirtualMachine = true },
+			name:      "FailReimageAvailabilitySet",
+		},
+		{
+			operation: nodeReimageName,
+			allInPool: "vmsspool",
+			fail:      func(client *armhelpers.MockAKSEngineClient) { client.FailReimageVirtualMachineScaleSetVMs = true },
+			name:      "FailReimageVMSS",
+		},
+	}
+
+	for _, tc := range cases {
+		c := tc
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			nc, client, getUncordoned := newMockNodeCmd(c.operation)
+			nc.allInPool = c.allInPool
+			vms, err := nc.getNodeVMs(context.Background())
+			if err != nil {
+				t.Fatalf("expected no error getting the VMs of node pool %s, got %s", c.allInPool, err)
+			}
+			if c.fail != nil {
+				c.fail(client)
+				if err = nc.runOperation(vms); err == nil {
+					t.Fatalf("expected an error running node %s on node pool %s", c.operation, c.allInPool)
+				}
+				// the failed node is uncordoned and the next nodes are left untouched
+				if uncordoned := getUncordoned(); len(uncordoned) != 1 || uncordoned[0] != vms[0].name {
+					t.Fatalf("expected only the failed node %s to be uncordoned, got %v", vms[0].name, uncordoned)
+				}
+				return
+			}
+			if err = nc.runOperation(vms); err != nil {
+				t.Fatalf("expected no error running node %s on node pool %s, got %s", c.operation, c.allInPool, err)
+			}
+			if uncordoned := getUncordoned(); len(uncordoned) != len(vms) {
+				t.Fatalf("expected the %d nodes of node pool %s to be uncordoned, got %v", len(vms), c.allInPool, uncordoned)
+			}
+		})
+	}
+}
+
+func TestNodeCmdValidateReimage(t *testing.T) {
+	nc, client, getUncordoned := newMockNodeCmd(nodeReimageName)
+	clusterID := nc.containerService.Properties.GetClusterID()
+	nc.allInPool = "agentpool1"
+	if _, err := nc.getNodeVMs(context.Background()); err != nil {
+		t.Fatalf("expected no error reimaging availability set VMs with an ephemeral OS disk, got %s", err)
+	}
+
+	client.FakeListVirtualMachineResult = func() []compute.VirtualMachine {
+		return []compute.VirtualMachine{
+			client.MakeFakeVirtualMachine(fmt.Sprintf("k8s-agentpool1-%s-0", clusterID), "Kubernetes:1.18.8"),
+		}
+	}
+	_, err := nc.getNodeVMs(context.Background())
+	expectedErr := fmt.Sprintf("node k8s-agentpool1-%[1]s-0 is backed by availability set VM k8s-agentpool1-%[1]s-0 which has no ephemeral OS disk, only availability set VMs with an ephemeral OS disk can be reimaged", clusterID)
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error %s reimaging an availability set VM without an ephemeral OS disk, got %v", expectedErr, err)
+	}
+	if uncordoned := getUncordoned(); len(uncordoned) != 0 {
+		t.Fatalf("expected no node to be drained when the VMs can't be reimaged, got %v", uncordoned)
+	}
+
+	nc.containerService.Properties.CustomCloudProfile = &api.CustomCloudProfile{PortalURL: "https://portal.local.azurestack.external/"}
+	_, err = nc.getNodeVMs(context.Background())
+	expectedErr = fmt.Sprintf("node k8s-agentpool1-%[1]s-0 is backed by availability set VM k8s-agentpool1-%[1]s-0, availability set VMs cannot be reimaged on Azure Stack Hub, use repair-node to replace it", clusterID)
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error %s reimaging an availability set VM on Azure Stack Hub, got %v", expectedErr, err)
+	}
+
+	nc.allInPool = "vmsspool"
+	if _, err = nc.getNodeVMs(context.Background()); err != nil {
+		t.Fatalf("expected no error reimaging VMSS instances on Azure Stack Hub, got %s", err)
+	}
+}
+
+func TestNodeCmdWaitForNodeReady(t *testing.T) {
+	nc, client, _ := newMockNodeCmd(nodeRestartName)
+	client.MockKubernetesClient.GetNodeFunc = func(name string) (*v1.Node, error) {
+		node := &v1.Node{}
+		node.Status.NodeInfo.BootID = "1"
+		node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}
+		return node, nil
+	}
+	nc.timeout = 50 * time.Millisecond
+	if err := nc.waitForNodeReady("k8s-agentpool1-12345678-0", "1"); err == nil {
+		t.Fatalf("expected an error waiting for a node that did not reboot")
+	}
+	if err := nc.waitForNodeReady("k8s-agentpool1-12345678-0", ""); err != nil {
+		t.Fatalf("expected no error waiting for a ready node with no previous boot ID, got %s", err)
+	}
+}
@@ -0,0 +1,359 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Azure/aks-engine-azurestack/pkg/api"
+	"github.com/Azure/aks-engine-azurestack/pkg/armhelpers"
+	"github.com/Azure/aks-engine-azurestack/pkg/engine"
+	"github.com/Azure/aks-engine-azurestack/pkg/helpers"
+	"github.com/Azure/aks-engine-azurestack/pkg/i18n"
+	"github.com/Azure/aks-engine-azurestack/pkg/kubernetes"
+	"github.com/Azure/aks-engine-azurestack/pkg/operations"
+	"github.com/Azure/aks-engine-azurestack/pkg/operations/kubernetesupgrade"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	orphansName             = "orphans"
+	orphansShortDescription = "Find and delete the Azure resources left behind by failed cluster operations"
+	orphansLongDescription  = "Compare the VMs, network interfaces and managed disks of the cluster resource group against the API model and the Kubernetes nodes, report the resources that do not belong to the cluster anymore and, if --delete is set, delete them"
+)
+
+const (
+	orphansDefaultInterval = 10 * time.Second
+	orphansDefaultTimeout  = 1 * time.Minute
+
+	orphanTypeVirtualMachine   = "VirtualMachine"
+	orphanTypeNetworkInterface = "NetworkInterface"
+	orphanTypeManagedDisk      = "ManagedDisk"
+)
+
+// orphanResource describes a cluster resource that does not belong to a cluster node
+type orphanResource struct {
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+	// Deleted is true if the resource was deleted by --delete
+	Deleted bool `json:"deleted"`
+}
+
+type orphansCmd struct {
+	authArgs
+
+	// user input
+	resourceGroupName string
+	apiModelPath      string
+	location          string
+	output            string
+	delete            bool
+
+	// derived
+	cs         *api.ContainerService
+	client     armhelpers.AKSEngineClient
+	kubeClient kubernetes.Client
+	logger     *log.Entry
+}
+
+func newOrphansCmd() *cobra.Command {
+	oc := orphansCmd{}
+
+	command := &cobra.Command{
+		Use:   orphansName,
+		Short: orphansShortDescription,
+		Long:  orphansLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := oc.validate(cmd); err != nil {
+				return errors.Wrap(err, "validating orphans command")
+			}
+			if err := oc.load(); err != nil {
+				return errors.Wrap(err, "loading cluster")
+			}
+			cmd.SilenceUsage = true
+			return oc.run(cmd.OutOrStdout())
+		},
+	}
+
+	f := command.Flags()
+	f.StringVarP(&oc.location, "location", "l", "", "location the cluster is deployed in (required)")
+	f.StringVarP(&oc.resourceGroupName, "resource-group", "g", "", "the resource group where the cluster is deployed (required)")
+	f.StringVarP(&oc.apiModelPath, "api-model", "m", "", "path to the generated apimodel.json file (required)")
+	f.StringVarP(&oc.output, "output", "o", "human", fmt.Sprintf("Output format. Allowed values: %s", strings.Join(outputFormatOptions, ", ")))
+	f.BoolVar(&oc.delete, "delete", false, "delete the orphaned resources")
+	addAuthFlags(&oc.authArgs, f)
+
+	return command
+}
+
+func (oc *orphansCmd) validate(cmd *cobra.Command) error {
+	log.Debugln("validating orphans command line arguments...")
+	validOutput := false
+	for _, opt := range outputFormatOptions {
+		if oc.output == opt {
+			validOutput = true
+			break
+		}
+	}
+	if !validOutput {
+		return errors.Errorf("invalid output format: \"%s\". Allowed values: %s", oc.output, strings.Join(outputFormatOptions, ", "))
+	}
+	if oc.resourceGroupName == "" {
+		_ = cmd.Usage()
+		return errors.New("--resource-group must be specified")
+	}
+	if oc.location == "" {
+		_ = cmd.Usage()
+		return errors.New("--location must be specified")
+	}
+	oc.location = helpers.NormalizeAzureRegion(oc.location)
+	if oc.apiModelPath == "" {
+		_ = cmd.Usage()
+		return errors.New("--api-model must be specified")
+	}
+	if _, err := os.Stat(oc.apiModelPath); os.IsNotExist(err) {
+		return errors.Errorf("specified --api-model does not exist (%s)", oc.apiModelPath)
+	}
+	return nil
+}
+
+func (oc *orphansCmd) load() error {
+	oc.logger = log.NewEntry(log.New())
+	locale, err := i18n.LoadTranslations()
+	if err != nil {
+		return errors.Wrap(err, "loading translation files")
+	}
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{
+			Locale: locale,
+		},
+	}
+	if oc.cs, _, err = apiloader.LoadContainerServiceFromFile(oc.apiModelPath, true, true, nil); err != nil {
+		return errors.Wrap(err, "error parsing the api model")
+	}
+	if oc.cs.Location == "" {
+		oc.cs.Location = oc.location
+	} else if oc.cs.Location != oc.location {
+		return errors.New("--location does not match api model location")
+	}
+
+	if oc.cs.Properties.IsCustomCloudProfile() {
+		if err = writeCustomCloudProfile(oc.cs); err != nil {
+			return errors.Wrap(err, "error writing custom cloud profile")
+		}
+		if err = oc.cs.Properties.SetCustomCloudSpec(api.AzureCustomCloudSpecParams{IsUpgrade: false, IsScale: true}); err != nil {
+			return errors.Wrap(err, "error parsing the api model")
+		}
+	}
+
+	if err = oc.authArgs.validateAuthArgs(); err != nil {
+		return err
+	}
+	if oc.client, err = oc.authArgs.getClient(); err != nil {
+		return errors.Wrap(err, "failed to get client")
+	}
+
+	kubeConfig, err := engine.GenerateKubeConfig(oc.cs.Properties, oc.location)
+	if err != nil {
+		return errors.Wrap(err, "generating kubeconfig")
+	}
+	if oc.kubeClient, err = oc.client.GetKubernetesClient("", kubeConfig, orphansDefaultInterval, orphansDefaultTimeout); err != nil {
+		log.Warnf("Failed to get a Kubernetes client, VMs will only be compared against the API model: %v", err)
+		oc.kubeClient = nil
+	}
+	return nil
+}
+
+func (oc *orphansCmd) run(out io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+	defer cancel()
+
+	orphans, err := oc.findOrphans(ctx)
+	if err != nil {
+		return err
+	}
+	var deleteErr error
+	if oc.delete {
+		deleteErr = oc.deleteOrphans(ctx, orphans)
+	}
+	if err = writeOrphans(out, orphans, oc.output); err != nil {
+		return err
+	}
+	return deleteErr
+}
+
+// isClusterResource returns true if the resource name is derived from one of the cluster VM name prefixes
+func (oc *orphansCmd) isClusterResource(name string) bool {
+	p := oc.cs.Properties
+	name = strings.ToLower(name)
+	// matches the Linux VMs of node pools that were removed from the api model too
+	if strings.Contains(name, fmt.Sprintf("-%s-", p.GetClusterID())) {
+		return true
+	}
+	prefixes := []string{p.GetMasterVMPrefix()}
+	for i, pool := range p.AgentPoolProfiles {
+		prefixes = append(prefixes, p.GetAgentVMPrefix(pool, i))
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, strings.ToLower(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// findOrphans lists the cluster VMs, network interfaces and managed disks that do not belong to a cluster node
+func (oc *orphansCmd) findOrphans(ctx context.Context) ([]orphanResource, error) {
+	orphans := make([]orphanResource, 0)
+
+	pools := map[string]bool{kubernetesupgrade.MasterPoolName: true}
+	for _, pool := range oc.cs.Properties.AgentPoolProfiles {
+		pools[pool.Name] = true
+	}
+
+	var nodes map[string]bool
+	if oc.kubeClient != nil {
+		nodeList, err := oc.kubeClient.ListNodes()
+		if err != nil {
+			log.Warnf("Failed to list the Kubernetes nodes, VMs will only be compared against the API model: %v", err)
+		} else {
+			nodes = make(map[string]bool)
+			for _, node := range nodeList.Items {
+				nodes[strings.ToLower(node.Name)] = true
+			}
+		}
+	}
+
+	for page, err := oc.client.ListVirtualMachines(ctx, oc.resourceGroupName); page.NotDone(); err = page.Next() {
+		if err != nil {
+			return nil, errors.Wrap(err, "listing virtual machines")
+		}
+		for _, vm := range page.Values() {
+			name := to.String(vm.Name)
+			if to.String(vm.Tags["resourceNameSuffix"]) != oc.cs.Properties.GetClusterID() && !oc.isClusterResource(name) {
+				continue
+			}
+			computerName := name
+			if vm.VirtualMachineProperties != nil && vm.OsProfile != nil && vm.OsProfile.ComputerName != nil {
+				computerName = to.String(vm.OsProfile.ComputerName)
+			}
+			if pool := to.String(vm.Tags["poolName"]); pool != "" && !pools[pool] {
+				orphans = append(orphans, orphanResource{
+					Type:   orphanTypeVirtualMachine,
+					Name:   name,
+					Reason: fmt.Sprintf("node pool %s is not defined in the api model", pool),
+				})
+			} else if nodes != nil && !nodes[strings.ToLower(computerName)] {
+				orphans = append(orphans, orphanResource{
+					Type:   orphanTypeVirtualMachine,
+					Name:   name,
+					Reason: "VM is not a Kubernetes node",
+				})
+			}
+		}
+	}
+
+	for page, err := oc.client.ListNetworkInterfaces(ctx, oc.resourceGroupName); page.NotDone(); err = page.Next() {
+		if err != nil {
+			return nil, errors.Wrap(err, "listing network interfaces")
+		}
+		for _, nic := range page.Values() {
+			name := to.String(nic.Name)
+			if !oc.isClusterResource(name) {
+				continue
+			}
+			if nic.InterfacePropertiesFormat == nil || nic.VirtualMachine == nil {
+				orphans = append(orphans, orphanResource{
+					Type:   orphanTypeNetworkInterface,
+					Name:   name,
+					Reason: "network interface is not attached to a VM",
+				})
+			}
+		}
+	}
+
+	for page, err := oc.client.ListManagedDisksByResourceGroup(ctx, oc.resourceGroupName); page.NotDone(); err = page.Next() {
+		if err != nil {
+			return nil, errors.Wrap(err, "listing managed disks")
+		}
+		for _, disk := range page.Values() {
+			name := to.String(disk.Name)
+			if !oc.isClusterResource(name) {
+				continue
+			}
+			if disk.ManagedBy == nil {
+				orphans = append(orphans, orphanResource{
+					Type:   orphanTypeManagedDisk,
+					Name:   name,
+					Reason: "managed disk is not attached to a VM",
+				})
+			}
+		}
+	}
+
+	return orphans, nil
+}
+
+// deleteOrphans deletes the orphaned VMs first, as that also deletes their network interfaces and OS disks,
+// then the detached network interfaces and managed disks
+func (oc *orphansCmd) deleteOrphans(ctx context.Context, orphans []orphanResource) error {
+	var failed []string
+	for i := range orphans {
+		o := &orphans[i]
+		var err error
+		switch o.Type {
+		case orphanTypeVirtualMachine:
+			err = operations.CleanDeleteVirtualMachine(oc.client, oc.logger, oc.getAuthArgs().SubscriptionID.String(), oc.resourceGroupName, o.Name)
+		case orphanTypeNetworkInterface:
+			log.Infof("deleting NIC %s in resource group %s ...", o.Name, oc.resourceGroupName)
+			err = oc.client.DeleteNetworkInterface(ctx, oc.resourceGroupName, o.Name)
+		case orphanTypeManagedDisk:
+			log.Infof("deleting managed disk %s in resource group %s ...", o.Name, oc.resourceGroupName)
+			err = oc.client.DeleteManagedDisk(ctx, oc.resourceGroupName, o.Name)
+		}
+		if err != nil {
+			log.Errorf("failed to delete %s %s: %v", o.Type, o.Name, err)
+			failed = append(failed, o.Name)
+			continue
+		}
+		o.Deleted = true
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("failed to delete %d of %d orphaned resources: %s", len(failed), len(orphans), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func writeOrphans(out io.Writer, orphans []orphanResource, output string) error {
+	switch output {
+	case "json":
+		b, err := helpers.JSONMarshalIndent(orphans, "", "  ", false)
+		if err != nil {
+			return errors.Wrap(err, "marshaling orphaned resources")
+		}
+		_, err = fmt.Fprintln(out, string(b))
+		return err
+	default:
+		if len(orphans) == 0 {
+			_, err := fmt.Fprintln(out, "No orphaned resources found")
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', tabwriter.FilterHTML)
+		fmt.Fprintln(w, "TYPE\tNAME\tREASON\tDELETED")
+		for _, o := range orphans {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\n", o.Type, o.Name, o.Reason, o.Deleted)
+		}
+		return w.Flush()
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/Azure/aks-engine-azurestack/pkg/api"
+	"github.com/Azure/aks-engine-azurestack/pkg/armhelpers"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-12-01/compute"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2018-08-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func TestNewOrphansCmd(t *testing.T) {
+	g := NewGomegaWithT(t)
+	command := newOrphansCmd()
+	g.Expect(command.Use).Should(Equal(orphansName))
+	g.Expect(command.Short).Should(Equal(orphansShortDescription))
+	g.Expect(command.Long).Should(Equal(orphansLongDescription))
+	for _, f := range []string{"location", "resource-group", "api-model", "output", "delete"} {
+		g.Expect(command.Flags().Lookup(f)).NotTo(BeNil())
+	}
+
+	command.SetArgs([]string{})
+	err := command.Execute()
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestOrphansCmdValidate(t *testing.T) {
+	r := &cobra.Command{}
+	existingFile := "../examples/kubernetes.json"
+
+	cases := []struct {
+		oc          *orphansCmd
+		expectedErr error
+		name        string
+	}{
+		{
+			oc:          &orphansCmd{resourceGroupName: "rg", location: "westus", apiModelPath: existingFile, output: "yaml"},
+			expectedErr: errors.New("invalid output format: \"yaml\". Allowed values: human, json"),
+			name:        "InvalidOutput",
+		},
+		{
+			oc:          &orphansCmd{location: "westus", apiModelPath: existingFile, output: "human"},
+			expectedErr: errors.New("--resource-group must be specified"),
+			name:        "NoResourceGroup",
+		},
+		{
+			oc:          &orphansCmd{resourceGroupName: "rg", apiModelPath: existingFile, output: "human"},
+			expectedErr: errors.New("--location must be specified"),
+			name:        "NoLocation",
+		},
+		{
+			oc:          &orphansCmd{resourceGroupName: "rg", location: "westus", output: "human"},
+			expectedErr: errors.New("--api-model must be specified"),
+			name:        "NoAPIModel",
+		},
+		{
+			oc:          &orphansCmd{resourceGroupName: "rg", location: "westus", apiModelPath: existingFile, output: "json", delete: true},
+			expectedErr: nil,
+			name:        "IsValid",
+		},
+	}
+
+	for _, tc := range cases {
+		c := tc
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			g := NewGomegaWithT(t)
+			err := c.oc.validate(r)
+			if c.expectedErr != nil {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(Equal(c.expectedErr.Error()))
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+		})
+	}
+}
+
+func newMockOrphansCmd() *orphansCmd {
+	cs := api.CreateMockContainerService("testcluster", "1.9.10", 1, 1, false)
+	clusterID := cs.Properties.GetClusterID()
+	client := &armhelpers.MockAKSEngineClient{MockKubernetesClient: &armhelpers.MockKubernetesClient{}}
+
+	makeVM := func(name, pool string) compute.VirtualMachine {
+		vm := client.MakeFakeVirtualMachine(name, "Kubernetes:1.9.10")
+		vm.Tags["poolName"] = to.StringPtr(pool)
+		vm.Tags["resourceNameSuffix"] = to.StringPtr(clusterID)
+		return vm
+	}
+	client.FakeListVirtualMachineResult = func() []compute.VirtualMachine {
+		return []compute.VirtualMachine{
+			// the mock Kubernetes client lists this VM as a node
+			makeVM("k8s-master-1234", "master"),
+			makeVM(fmt.Sprintf("k8s-agentpool1-%s-0", clusterID), "agentpool1"),
+			makeVM(fmt.Sprintf("k8s-oldpool-%s-0", clusterID), "oldpool"),
+			{Name: to.StringPtr("jumpbox")},
+		}
+	}
+	client.FakeListNetworkInterfacesResult = func() []network.Interface {
+		return []network.Interface{
+			{
+				Name: to.StringPtr(fmt.Sprintf("k8s-agentpool1-%s-nic-0", clusterID)),
+				InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+					VirtualMachine: &network.SubResource{ID: to.StringPtr("vmID")},
+				},
+			},
+			{
+				Name:                      to.StringPtr(fmt.Sprintf("k8s-agentpool1-%s-nic-1", clusterID)),
+				InterfacePropertiesFormat: &network.InterfacePropertiesFormat{},
+			},
+			{
+				Name:                      to.StringPtr("jumpbox-nic"),
+				InterfacePropertiesFormat: &network.InterfacePropertiesFormat{},
+			},
+		}
+	}
+	client.FakeListManagedDisksResult = func() []compute.Disk {
+		return []compute.Disk{
+			{Name: to.StringPtr(fmt.Sprintf("k8s-master-%s-0-etcddisk", clusterID)), ManagedBy: to.StringPtr("vmID")},
+			{Name: to.StringPtr(fmt.Sprintf("k8s-agentpool1-%s-1_OsDisk_1_0123", clusterID))},
+			{Name: to.StringPtr("testcluster-dynamic-pvc-0123")},
+		}
+	}
+	return &orphansCmd{
+		resourceGroupName: "rg",
+		output:            "human",
+		cs:                cs,
+		client:            client,
+		kubeClient:        client.MockKubernetesClient,
+		logger:            log.NewEntry(log.New()),
+	}
+}
+
+func TestOrphansCmdFindOrphans(t *testing.T) {
+	g := NewGomegaWithT(t)
+	oc := newMockOrphansCmd()
+	clusterID := oc.cs.Properties.GetClusterID()
+
+	orphans, err := oc.findOrphans(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(orphans).To(Equal([]orphanResource{
+		{Type: orphanTypeVirtualMachine, Name: fmt.Sprintf("k8s-agentpool1-%s-0", clusterID), Reason: "VM is not a Kubernetes node"},
+		{Type: orphanTypeVirtualMachine, Name: fmt.Sprintf("k8s-oldpool-%s-0", clusterID), Reason: "node pool oldpool is not defined in the api model"},
+		{Type: orphanTypeNetworkInterface, Name: fmt.Sprintf("k8s-agentpool1-%s-nic-1", clusterID), Reason: "network interface is not attached to a VM"},
+		{Type: orphanTypeManagedDisk, Name: fmt.Sprintf("k8s-agentpool1-%s-1_OsDisk_1_0123", clusterID), Reason: "managed disk is not attached to a VM"},
+	}))
+
+	// without the Kubernetes nodes, VMs are only compared against the api model
+	oc.kubeClient.(*armhelpers.MockKubernetesClient).FailListNodes = true
+	orphans, err = oc.findOrphans(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(orphans).To(HaveLen(3))
+	g.Expect(orphans[0].Name).To(Equal(fmt.Sprintf("k8s-oldpool-%s-0", clusterID)))
+
+	oc.client.(*armhelpers.MockAKSEngineClient).FailListNetworkInterfaces = true
+	_, err = oc.findOrphans(context.Background())
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestOrphansCmdRunDelete(t *testing.T) {
+	g := NewGomegaWithT(t)
+	oc := newMockOrphansCmd()
+	oc.delete = true
+	oc.output = "json"
+
+	out := &bytes.Buffer{}
+	g.Expect(oc.run(out)).To(Succeed())
+	var orphans []orphanResource
+	g.Expect(json.Unmarshal(out.Bytes(), &orphans)).To(Succeed())
+	g.Expect(orphans).To(HaveLen(4))
+	for _, o := range orphans {
+		g.Expect(o.Deleted).To(BeTrue())
+	}
+
+	oc = newMockOrphansCmd()
+	oc.delete = true
+	oc.client.(*armhelpers.MockAKSEngineClient).FailDeleteManagedDisk = true
+	out.Reset()
+	err := oc.run(out)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("failed to delete 1 of 4 orphaned resources"))
+	g.Expect(out.String()).To(ContainSubstring("false"))
+}
+
+func TestWriteOrphans(t *testing.T) {
+	g := NewGomegaWithT(t)
+	out := &bytes.Buffer{}
+	g.Expect(writeOrphans(out, []orphanResource{}, "human")).To(Succeed())
+	g.Expect(out.String()).To(Equal("No orphaned resources found\n"))
+
+	out.Reset()
+	g.Expect(writeOrphans(out, []orphanResource{{Type: orphanTypeManagedDisk, Name: "disk", Reason: "managed disk is not attached to a VM"}}, "human")).To(Succeed())
+	g.Expect(out.String()).To(ContainSubstring("TYPE"))
+	g.Expect(out.String()).To(ContainSubstring("disk"))
+}
@@ -0,0 +1,781 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Azure/aks-engine-azurestack/pkg/api"
+	"github.com/Azure/aks-engine-azurestack/pkg/armhelpers"
+	"github.com/Azure/aks-engine-azurestack/pkg/armhelpers/utils"
+	"github.com/Azure/aks-engine-azurestack/pkg/engine"
+	"github.com/Azure/aks-engine-azurestack/pkg/engine/transform"
+	"github.com/Azure/aks-engine-azurestack/pkg/helpers"
+	"github.com/Azure/aks-engine-azurestack/pkg/i18n"
+	"github.com/Azure/aks-engine-azurestack/pkg/kubernetes"
+	"github.com/Azure/aks-engine-azurestack/pkg/operations"
+	"github.com/Azure/aks-engine-azurestack/pkg/operations/kubernetesupgrade"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-12-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	planName             = "plan"
+	planShortDescription = "Preview the changes an upgrade, scale, update or addpool operation would make to a cluster"
+	planLongDescription  = "Preview the VMs and ARM resources that an upgrade, scale, update or addpool operation would create, delete or modify in an existing AKS Engine-created Kubernetes cluster, without making any change to the cluster"
+)
+
+const (
+	planOperationUpgrade = "upgrade"
+	planOperationScale   = "scale"
+	planOperationUpdate  = "update"
+	planOperationAddPool = "addpool"
+
+	planNodeActionCreate      = "Create"
+	planNodeActionDelete      = "Delete"
+	planNodeActionRecreate    = "Recreate"
+	planNodeActionReimage     = "Reimage"
+	planNodeActionUpdateModel = "UpdateModel"
+
+	planDefaultInterval = 10 * time.Second
+	planDefaultTimeout  = 1 * time.Minute
+
+	deployedTemplateFilename   = "azuredeploy.json"
+	deployedParametersFilename = "azuredeploy.parameters.json"
+)
+
+var planOperations = []string{planOperationUpgrade, planOperationScale, planOperationUpdate, planOperationAddPool}
+
+// planNodeChange describes what would happen to a single cluster VM or VMSS
+type planNodeChange struct {
+	Pool   string `json:"pool"`
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// planResult is the outcome of a plan operation
+type planResult struct {
+	Operation  string                      `json:"operation"`
+	Nodes      []planNodeChange            `json:"nodes"`
+	Resources  []transform.ResourceChange  `json:"resources"`
+	Parameters []transform.ParameterChange `json:"parameters"`
+}
+
+type planCmd struct {
+	authArgs
+
+	// user input
+	operation           string
+	resourceGroupName   string
+	apiModelPath        string
+	location            string
+	upgradeVersion      string
+	agentPoolName       string
+	newNodeCount        int
+	nodesToRemove       []string
+	preferUnhealthy     bool
+	apiserver           string
+	nodePoolPath        string
+	force               bool
+	controlPlaneOnly    bool
+	maxSurge            int
+	maxUnavailable      int
+	vmssUpgradeStrategy string
+	output              string
+
+	// derived
+	deployedTemplate   map[string]interface{}
+	deployedParameters map[string]interface{}
+}
+
+func newPlanCmd() *cobra.Command {
+	pc := planCmd{}
+
+	command := &cobra.Command{
+		Use:   planName,
+		Short: planShortDescription,
+		Long:  planLongDescription,
+		RunE:  pc.run,
+	}
+
+	f := command.Flags()
+	f.StringVar(&pc.operation, "operation", "", fmt.Sprintf("operation to preview. Allowed values: %s (required)", strings.Join(planOperations, ", ")))
+	f.StringVarP(&pc.location, "location", "l", "", "location the cluster is deployed in (required)")
+	f.StringVarP(&pc.resourceGroupName, "resource-group", "g", "", "the resource group where the cluster is deployed (required)")
+	f.StringVarP(&pc.apiModelPath, "api-model", "m", "", "path to the generated apimodel.json file (required)")
+	f.StringVarP(&pc.upgradeVersion, "upgrade-version", "k", "", "desired kubernetes version (used with --operation=upgrade)")
+	f.BoolVarP(&pc.force, "force", "f", false, "preview a forced upgrade (used with --operation=upgrade)")
+	f.BoolVar(&pc.controlPlaneOnly, "control-plane-only", false, "preview an upgrade of the control plane VMs only (used with --operation=upgrade)")
+	f.IntVar(&pc.maxSurge, "max-surge", 1, "maximum number of extra nodes created in each availability set node pool to take on the workload of the nodes being upgraded (used with --operation=upgrade)")
+	f.IntVar(&pc.maxUnavailable, "max-unavailable", 0, "maximum number of nodes of each availability set node pool, or of each VMSS node pool updated in place, that can be unavailable during the upgrade (used with --operation=upgrade)")
+	f.StringVar(&pc.vmssUpgradeStrategy, "vmss-upgrade-strategy", kubernetesupgrade.VMSSUpgradeStrategyReplace, fmt.Sprintf("how VMSS node pools are upgraded: %q or %q (used with --operation=upgrade)", kubernetesupgrade.VMSSUpgradeStrategyReplace, kubernetesupgrade.VMSSUpgradeStrategyInPlace))
+	f.StringVar(&pc.agentPoolName, "node-pool", "", "node pool to scale or update (used with --operation=[scale|update])")
+	f.IntVarP(&pc.newNodeCount, "new-node-count", "c", 0, "desired number of nodes (used with --operation=scale)")
+	f.StringSliceVar(&pc.nodesToRemove, "remove-nodes", []string{}, "comma-separated list of the nodes to remove from the node pool (used with --operation=scale)")
+	f.BoolVar(&pc.preferUnhealthy, "prefer-unhealthy", false, "when scaling down, remove the NotReady and cordoned nodes before the healthy ones, requires --apiserver (used with --operation=scale)")
+	f.StringVar(&pc.apiserver, "apiserver", "", "apiserver endpoint, used to find the unhealthy nodes (used with --operation=scale)")
+	f.StringVarP(&pc.nodePoolPath, "node-pool-spec", "p", "", "path to a JSON file that defines the new node pool spec (used with --operation=addpool)")
+	f.StringVarP(&pc.output, "output", "o", "human", fmt.Sprintf("Output format. Allowed values: %s", strings.Join(outputFormatOptions, ", ")))
+	addAuthFlags(&pc.authArgs, f)
+
+	return command
+}
+
+func (pc *planCmd) validate(cmd *cobra.Command) error {
+	log.Debugln("validating plan command line arguments...")
+	validOperation := false
+	for _, op := range planOperations {
+		if pc.operation == op {
+			validOperation = true
+			break
+		}
+	}
+	if !validOperation {
+		_ = cmd.Usage()
+		return errors.Errorf("--operation must be one of: %s", strings.Join(planOperations, ", "))
+	}
+
+	validOutput := false
+	for _, opt := range outputFormatOptions {
+		if pc.output == opt {
+			validOutput = true
+			break
+		}
+	}
+	if !validOutput {
+		return errors.Errorf("invalid output format: \"%s\". Allowed values: %s", pc.output, strings.Join(outputFormatOptions, ", "))
+	}
+
+	if pc.apiModelPath == "" {
+		_ = cmd.Usage()
+		return errors.New("--api-model must be specified")
+	}
+	return nil
+}
+
+// loadDeployedTemplate reads the last deployed ARM template and parameters stored next to the api model
+func (pc *planCmd) loadDeployedTemplate() error {
+	dir := filepath.Dir(pc.apiModelPath)
+	read := func(name string) (map[string]interface{}, error) {
+		p := filepath.Join(dir, name)
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[string]interface{})
+		if err = json.Unmarshal(b, &m); err != nil {
+			return nil, errors.Wrapf(err, "parsing %s", p)
+		}
+		return m, nil
+	}
+	var err error
+	if pc.deployedTemplate, err = read(deployedTemplateFilename); err != nil {
+		if os.IsNotExist(err) {
+			log.Warnf("%s not found in %s, ARM resources and parameters will not be compared", deployedTemplateFilename, dir)
+			return nil
+		}
+		return err
+	}
+	if pc.deployedParameters, err = read(deployedParametersFilename); err != nil {
+		if os.IsNotExist(err) {
+			log.Warnf("%s not found in %s, ARM parameters will not be compared", deployedParametersFilename, dir)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (pc *planCmd) run(cmd *cobra.Command, args []string) error {
+	if err := pc.validate(cmd); err != nil {
+		return errors.Wrap(err, "validating plan command")
+	}
+	if err := pc.loadDeployedTemplate(); err != nil {
+		return errors.Wrap(err, "loading deployed template")
+	}
+
+	var result *planResult
+	var template, parameters map[string]interface{}
+	var err error
+	switch pc.operation {
+	case planOperationUpgrade:
+		result, template, parameters, err = pc.planUpgrade(cmd)
+	case planOperationScale:
+		result, template, parameters, err = pc.planScale(cmd)
+	case planOperationUpdate:
+		result, template, parameters, err = pc.planUpdate(cmd)
+	case planOperationAddPool:
+		result, template, parameters, err = pc.planAddPool(cmd)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "planning %s operation", pc.operation)
+	}
+
+	if template != nil && pc.deployedTemplate != nil {
+		result.Resources = transform.DiffTemplateResources(pc.deployedTemplate, template)
+		if pc.deployedParameters != nil {
+			result.Parameters = transform.DiffTemplateParameters(pc.deployedParameters, parameters, template)
+		}
+	}
+	return writePlanResult(cmd.OutOrStdout(), result, pc.output)
+}
+
+func (pc *planCmd) planUpgrade(cmd *cobra.Command) (*planResult, map[string]interface{}, map[string]interface{}, error) {
+	uc := &upgradeCmd{
+		authProvider:                &pc.authArgs,
+		resourceGroupName:           pc.resourceGroupName,
+		apiModelPath:                pc.apiModelPath,
+		upgradeVersion:              pc.upgradeVersion,
+		location:                    pc.location,
+		force:                       pc.force,
+		controlPlaneOnly:            pc.controlPlaneOnly,
+		upgradeWindowsVHD:           true,
+		maxSurge:                    pc.maxSurge,
+		maxUnavailable:              pc.maxUnavailable,
+		vmssUpgradeStrategy:         pc.vmssUpgradeStrategy,
+		timeoutInMinutes:            -1,
+		cordonDrainTimeoutInMinutes: -1,
+	}
+	if err := uc.validate(cmd); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := uc.loadCluster(); err != nil {
+		return nil, nil, nil, err
+	}
+	translator := &i18n.Translator{Locale: uc.locale}
+
+	var kubeClient kubernetes.Client
+	kubeConfig, err := engine.GenerateKubeConfig(uc.containerService.Properties, uc.location)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "generating kubeconfig")
+	}
+	if k, err := uc.client.GetKubernetesClient("", kubeConfig, planDefaultInterval, planDefaultTimeout); err != nil {
+		log.Warnf("Failed to get a Kubernetes client, node versions will be read from VM tags only: %v", err)
+	} else {
+		kubeClient = k
+	}
+
+	cluster := kubernetesupgrade.UpgradeCluster{
+		Translator:       translator,
+		Logger:           log.NewEntry(log.New()),
+		Client:           uc.client,
+		Force:            uc.force,
+		ControlPlaneOnly: uc.controlPlaneOnly,
+		CurrentVersion:   uc.currentVersion,
+	}
+	cluster.ClusterTopology = kubernetesupgrade.ClusterTopology{
+		DataModel:           uc.containerService,
+		SubscriptionID:      uc.getAuthArgs().SubscriptionID.String(),
+		ResourceGroup:       uc.resourceGroupName,
+		NameSuffix:          uc.nameSuffix,
+		AgentPoolsToUpgrade: uc.agentPoolsToUpgrade,
+		IsVMSSToBeUpgraded:  isVMSSNameInAgentPoolsArray,
+	}
+	if err = cluster.LoadClusterTopology(kubeClient); err != nil {
+		return nil, nil, nil, err
+	}
+
+	result := &planResult{Operation: pc.operation, Nodes: getUpgradeNodeChanges(&cluster.ClusterTopology, uc.currentVersion, uc.maxSurge, uc.maxUnavailable, uc.vmssUpgradeStrategy)}
+
+	template, parameters, err := generateUpgradeTemplate(uc.containerService, translator)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return result, template, parameters, nil
+}
+
+// getUpgradeNodeChanges lists the VMs an upgrade would create, delete, recreate or reimage
+// with the given surge settings and VMSS upgrade strategy
+func getUpgradeNodeChanges(topology *kubernetesupgrade.ClusterTopology, currentVersion string, maxSurge, maxUnavailable int, vmssUpgradeStrategy string) []planNodeChange {
+	p := topology.DataModel.Properties
+	goalVersion := p.OrchestratorProfile.OrchestratorVersion
+	changes := make([]planNodeChange, 0)
+
+	masterCount := 0
+	for _, vm := range *topology.MasterVMs {
+		changes = append(changes, planNodeChange{
+			Pool:   kubernetesupgrade.MasterPoolName,
+			Name:   to.String(vm.Name),
+			Action: planNodeActionRecreate,
+			Detail: upgradeDetail(vm, currentVersion, goalVersion, p.MasterProfile.VMSize),
+		})
+		masterCount++
+	}
+	masterCount += len(*topology.UpgradedMasterVMs)
+	if p.MasterProfile != nil && masterCount < p.MasterProfile.Count {
+		changes = append(changes, planNodeChange{
+			Pool:   kubernetesupgrade.MasterPoolName,
+			Name:   fmt.Sprintf("%d missing VM(s)", p.MasterProfile.Count-masterCount),
+			Action: planNodeActionCreate,
+			Detail: fmt.Sprintf("Kubernetes %s", goalVersion),
+		})
+	}
+
+	pools := make(map[string]*api.AgentPoolProfile)
+	for _, pool := range p.AgentPoolProfiles {
+		pools[pool.Name] = pool
+	}
+	surge, _ := kubernetesupgrade.SurgeSettings(maxSurge, maxUnavailable)
+	for _, agentPool := range topology.AgentPools {
+		poolName := to.String(agentPool.Name)
+		var vmSize string
+		if pool, ok := pools[poolName]; ok {
+			vmSize = pool.VMSize
+		}
+		// like the upgrade, create up to maxSurge extra VMs first, recreate the VMs in the order of their index
+		// and delete the last ones instead of recreating them, the extra VMs taking their place
+		vms := sortAgentVMsByIndex(*agentPool.AgentVMs)
+		poolSurge := surge
+		if poolSurge > len(vms) {
+			poolSurge = len(vms)
+		}
+		if poolSurge > 0 {
+			changes = append(changes, planNodeChange{
+				Pool:   poolName,
+				Name:   fmt.Sprintf("%d extra VM(s)", poolSurge),
+				Action: planNodeActionCreate,
+				Detail: fmt.Sprintf("Kubernetes %s", goalVersion),
+			})
+		}
+		for i, vm := range vms {
+			if i < len(vms)-poolSurge {
+				changes = append(changes, planNodeChange{
+					Pool:   poolName,
+					Name:   to.String(vm.Name),
+					Action: planNodeActionRecreate,
+					Detail: upgradeDetail(vm, currentVersion, goalVersion, vmSize),
+				})
+				continue
+			}
+			changes = append(changes, planNodeChange{
+				Pool:   poolName,
+				Name:   to.String(vm.Name),
+				Action: planNodeActionDelete,
+				Detail: "cordoned, drained and deleted, an extra VM takes its place",
+			})
+		}
+	}
+	for _, vmss := range topology.AgentPoolScaleSetsToUpgrade {
+		for _, vm := range vmss.VMsToUpgrade {
+			change := planNodeChange{
+				Pool:   vmss.Name,
+				Name:   vm.Name,
+				Action: planNodeActionRecreate,
+				Detail: fmt.Sprintf("instance %s replaced by a new instance running Kubernetes %s", vm.InstanceID, goalVersion),
+			}
+			if vmssUpgradeStrategy == kubernetesupgrade.VMSSUpgradeStrategyInPlace {
+				change.Action = planNodeActionReimage
+				change.Detail = fmt.Sprintf("instance %s updated to the new VMSS model and reimaged to run Kubernetes %s", vm.InstanceID, goalVersion)
+			}
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// sortAgentVMsByIndex returns the VMs sorted by the index in their name, the order the upgrade processes them in
+func sortAgentVMsByIndex(vms []compute.VirtualMachine) []compute.VirtualMachine {
+	index := func(vm compute.VirtualMachine) int {
+		osType := compute.Linux
+		if vm.VirtualMachineProperties != nil && vm.StorageProfile != nil && vm.StorageProfile.OsDisk != nil {
+			osType = vm.StorageProfile.OsDisk.OsType
+		}
+		i, _ := utils.GetVMNameIndex(osType, to.String(vm.Name))
+		return i
+	}
+	sorted := append([]compute.VirtualMachine{}, vms...)
+	sort.SliceStable(sorted, func(i, j int) bool { return index(sorted[i]) < index(sorted[j]) })
+	return sorted
+}
+
+func upgradeDetail(vm compute.VirtualMachine, currentVersion, goalVersion, goalVMSize string) string {
+	from := currentVersion
+	if vm.Tags != nil && vm.Tags["orchestrator"] != nil {
+		if parts := strings.Split(to.String(vm.Tags["orchestrator"]), ":"); len(parts) == 2 {
+			from = parts[1]
+		}
+	}
+	detail := fmt.Sprintf("Kubernetes %s -> %s", from, goalVersion)
+	if vm.VirtualMachineProperties != nil && vm.HardwareProfile != nil {
+		if currentSize := string(vm.HardwareProfile.VMSize); goalVMSize != "" && !strings.EqualFold(currentSize, goalVMSize) {
+			detail = fmt.Sprintf("%s, resize %s -> %s", detail, currentSize, goalVMSize)
+		}
+	}
+	return detail
+}
+
+// generateUpgradeTemplate generates the upgrade template and applies the normalizations shared by all upgrade steps
+func generateUpgradeTemplate(cs *api.ContainerService, translator *i18n.Translator) (map[string]interface{}, map[string]interface{}, error) {
+	logger := log.NewEntry(log.New())
+	templateGenerator, err := engine.InitializeTemplateGenerator(engine.Context{Translator: translator})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to initialize template generator")
+	}
+	if _, err = cs.SetPropertiesDefaults(api.PropertiesDefaultsParams{
+		IsScale:    false,
+		IsUpgrade:  true,
+		PkiKeySize: helpers.DefaultPkiKeySize,
+	}); err != nil {
+		return nil, nil, errors.Wrap(err, "error in SetPropertiesDefaults")
+	}
+	template, parameters, err := templateGenerator.GenerateTemplateV2(cs, engine.DefaultGeneratorCode, BuildTag)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error generating upgrade template")
+	}
+	templateJSON := make(map[string]interface{})
+	parametersJSON := make(map[string]interface{})
+	if err = json.Unmarshal([]byte(template), &templateJSON); err != nil {
+		return nil, nil, errors.Wrap(err, "error unmarshaling template")
+	}
+	if err = json.Unmarshal([]byte(parameters), &parametersJSON); err != nil {
+		return nil, nil, errors.Wrap(err, "error unmarshaling parameters")
+	}
+
+	transformer := transform.Transformer{Translator: translator}
+	kc := cs.Properties.OrchestratorProfile.KubernetesConfig
+	if kc.PrivateJumpboxProvision() {
+		if err = transformer.RemoveJumpboxResourcesFromTemplate(logger, templateJSON); err != nil {
+			return nil, nil, errors.Wrap(err, "error removing jumpbox resources from template")
+		}
+	}
+	if kc.LoadBalancerSku == api.StandardLoadBalancerSku {
+		if err = transformer.NormalizeForK8sSLBScalingOrUpgrade(logger, templateJSON); err != nil {
+			return nil, nil, errors.Wrap(err, "error normalizing upgrade template for SLB")
+		}
+	}
+	if to.Bool(kc.EnableEncryptionWithExternalKms) {
+		if err = transformer.RemoveKMSResourcesFromTemplate(logger, templateJSON); err != nil {
+			return nil, nil, errors.Wrap(err, "error removing KMS resources from template")
+		}
+	}
+	transformer.RemoveImmutableResourceProperties(logger, templateJSON)
+	return templateJSON, parametersJSON, nil
+}
+
+func (pc *planCmd) planScale(cmd *cobra.Command) (*planResult, map[string]interface{}, map[string]interface{}, error) {
+	sc := &scaleCmd{
+		authArgs:             pc.authArgs,
+		apiModelPath:         pc.apiModelPath,
+		resourceGroupName:    pc.resourceGroupName,
+		location:             pc.location,
+		agentPoolToScale:     pc.agentPoolName,
+		newDesiredAgentCount: pc.newNodeCount,
+		nodesToRemove:        pc.nodesToRemove,
+		preferUnhealthy:      pc.preferUnhealthy,
+		masterFQDN:           pc.apiserver,
+	}
+	if err := sc.validate(cmd); err != nil {
+		return nil, nil, nil, err
+	}
+	if sc.preferUnhealthy && sc.masterFQDN == "" {
+		_ = cmd.Usage()
+		return nil, nil, nil, errors.New("--apiserver is required to find the unhealthy nodes with --prefer-unhealthy")
+	}
+	if err := sc.load(); err != nil {
+		return nil, nil, nil, err
+	}
+	if sc.preferUnhealthy {
+		nodes, err := operations.GetNodes(sc.client, sc.logger, sc.apiserverURL, sc.kubeconfig, time.Duration(5)*time.Minute, sc.agentPoolToScale, -1)
+		if err != nil {
+			return nil, nil, nil, errors.Wrapf(err, "listing the nodes of pool %s", sc.agentPoolToScale)
+		}
+		sc.nodes = nodes
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+	defer cancel()
+
+	result := &planResult{Operation: pc.operation, Nodes: make([]planNodeChange, 0)}
+	var currentNodeCount, highestUsedIndex int
+	winPoolIndex := -1
+	if sc.agentPool.IsAvailabilitySets() {
+		indexes, indexToVM, wpi, err := sc.getVMASAgentPoolVMs(ctx)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		winPoolIndex = wpi
+		currentNodeCount = len(indexes)
+		if currentNodeCount == 0 {
+			return nil, nil, nil, errors.New("None of the VMs in the provided resource group contain any nodes")
+		}
+		highestUsedIndex = indexes[currentNodeCount-1]
+		if err = sc.deriveNewNodeCount(currentNodeCount); err != nil {
+			return nil, nil, nil, err
+		}
+		if currentNodeCount >= sc.newDesiredAgentCount {
+			// scaling down a VMAS pool does not deploy a template
+			changes, err := vmasScaleDownChanges(sc, indexes, indexToVM)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			result.Nodes = append(result.Nodes, changes...)
+			return result, nil, nil, nil
+		}
+		poolIndex := sc.agentPoolIndex
+		if winPoolIndex != -1 {
+			poolIndex = winPoolIndex
+		}
+		prefix := sc.containerService.Properties.GetAgentVMPrefix(sc.agentPool, poolIndex)
+		for i := 0; i < sc.newDesiredAgentCount-currentNodeCount; i++ {
+			result.Nodes = append(result.Nodes, planNodeChange{
+				Pool:   sc.agentPool.Name,
+				Name:   prefix + strconv.Itoa(highestUsedIndex+1+i),
+				Action: planNodeActionCreate,
+				Detail: sc.agentPool.VMSize,
+			})
+		}
+	} else {
+		capacity, err := getVMSSCapacity(ctx, sc.client, sc.resourceGroupName, sc.agentPool.VMSSName)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		currentNodeCount = capacity
+		if err = sc.deriveNewNodeCount(currentNodeCount); err != nil {
+			return nil, nil, nil, err
+		}
+		var instancesToRemove []string
+		if currentNodeCount > sc.newDesiredAgentCount {
+			// scaling down a VMSS pool deletes specific instances, picked the way scale picks them
+			candidates, _, err := sc.getVMSSInstances(ctx, sc.agentPool.VMSSName)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			if instancesToRemove, err = sc.selectNodesToRemove(candidates, currentNodeCount-sc.newDesiredAgentCount); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		result.Nodes = append(result.Nodes, vmssCapacityChanges(sc.agentPool, currentNodeCount, sc.newDesiredAgentCount, instancesToRemove)...)
+	}
+
+	countForTemplate := sc.newDesiredAgentCount
+	if highestUsedIndex != 0 {
+		countForTemplate += highestUsedIndex + 1 - currentNodeCount
+	}
+	template, parameters, err := sc.generateTemplate(countForTemplate, highestUsedIndex, winPoolIndex)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return result, template, parameters, nil
+}
+
+// vmasScaleDownChanges describes the VMs deleted when scaling down an availability set node pool,
+// they are picked the way scale picks them, honoring --remove-nodes and --prefer-unhealthy
+func vmasScaleDownChanges(sc *scaleCmd, indexes []int, indexToVM map[int]string) ([]planNodeChange, error) {
+	vmsToDelete, err := sc.selectNodesToRemove(vmasRemovalCandidates(indexes, indexToVM), len(indexes)-sc.newDesiredAgentCount)
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]planNodeChange, 0, len(vmsToDelete))
+	for _, name := range vmsToDelete {
+		changes = append(changes, planNodeChange{
+			Pool:   sc.agentPool.Name,
+			Name:   name,
+			Action: planNodeActionDelete,
+			Detail: "cordoned, drained and deleted along with its NIC and OS disk",
+		})
+	}
+	return changes, nil
+}
+
+// vmssCapacityChanges describes a change of the VMSS capacity, instancesToRemove are the instances deleted when scaling down
+func vmssCapacityChanges(pool *api.AgentPoolProfile, current, desired int, instancesToRemove []string) []planNodeChange {
+	changes := make([]planNodeChange, 0)
+	switch {
+	case desired > current:
+		changes = append(changes, planNodeChange{
+			Pool:   pool.Name,
+			Name:   pool.VMSSName,
+			Action: planNodeActionCreate,
+			Detail: fmt.Sprintf("capacity %d -> %d, %d new %s instance(s)", current, desired, desired-current, pool.VMSize),
+		})
+	case desired < current:
+		changes = append(changes, planNodeChange{
+			Pool:   pool.Name,
+			Name:   pool.VMSSName,
+			Action: planNodeActionDelete,
+			Detail: fmt.Sprintf("capacity %d -> %d, %d instance(s) are cordoned, drained and deleted", current, desired, current-desired),
+		})
+		for _, name := range instancesToRemove {
+			changes = append(changes, planNodeChange{
+				Pool:   pool.Name,
+				Name:   name,
+				Action: planNodeActionDelete,
+				Detail: "cordoned, drained and deleted",
+			})
+		}
+	}
+	changes = append(changes, planNodeChange{
+		Pool:   pool.Name,
+		Name:   pool.VMSSName,
+		Action: planNodeActionUpdateModel,
+		Detail: "existing instances keep running the previous model until they are reimaged or replaced",
+	})
+	return changes
+}
+
+func getVMSSCapacity(ctx context.Context, client armhelpers.AKSEngineClient, resourceGroup, vmssName string) (int, error) {
+	for page, err := client.ListVirtualMachineScaleSets(ctx, resourceGroup); page.NotDone(); err = page.NextWithContext(ctx) {
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to get VMSS list in the resource group")
+		}
+		for _, vmss := range page.Values() {
+			if to.String(vmss.Name) == vmssName && vmss.Sku != nil {
+				return int(to.Int64(vmss.Sku.Capacity)), nil
+			}
+		}
+	}
+	return 0, errors.Errorf("failed to find VMSS %s in resource group %s", vmssName, resourceGroup)
+}
+
+func (pc *planCmd) planUpdate(cmd *cobra.Command) (*planResult, map[string]interface{}, map[string]interface{}, error) {
+	uc := &updateCmd{
+		authArgs:          pc.authArgs,
+		apiModelPath:      pc.apiModelPath,
+		resourceGroupName: pc.resourceGroupName,
+		location:          pc.location,
+		agentPoolToUpdate: pc.agentPoolName,
+	}
+	if err := uc.validate(cmd); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := uc.load(); err != nil {
+		return nil, nil, nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+	defer cancel()
+	sc, err := uc.newScaleCmd(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	result := &planResult{
+		Operation: pc.operation,
+		Nodes:     vmssCapacityChanges(sc.agentPool, sc.newDesiredAgentCount, sc.newDesiredAgentCount, nil),
+	}
+	template, parameters, err := sc.generateTemplate(sc.newDesiredAgentCount, 0, -1)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return result, template, parameters, nil
+}
+
+func (pc *planCmd) planAddPool(cmd *cobra.Command) (*planResult, map[string]interface{}, map[string]interface{}, error) {
+	apc := &addPoolCmd{
+		authArgs:          pc.authArgs,
+		apiModelPath:      pc.apiModelPath,
+		resourceGroupName: pc.resourceGroupName,
+		location:          pc.location,
+		nodePoolPath:      pc.nodePoolPath,
+	}
+	if err := apc.validate(cmd); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := apc.load(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	result := &planResult{Operation: pc.operation, Nodes: make([]planNodeChange, 0)}
+	if apc.nodePool.IsVirtualMachineScaleSets() {
+		result.Nodes = append(result.Nodes, planNodeChange{
+			Pool:   apc.nodePool.Name,
+			Name:   apc.nodePool.VMSSName,
+			Action: planNodeActionCreate,
+			Detail: fmt.Sprintf("new scale set with capacity %d (%s)", apc.nodePool.Count, apc.nodePool.VMSize),
+		})
+	} else {
+		prefix := apc.containerService.Properties.GetAgentVMPrefix(apc.nodePool, len(apc.containerService.Properties.AgentPoolProfiles))
+		for i := 0; i < apc.nodePool.Count; i++ {
+			result.Nodes = append(result.Nodes, planNodeChange{
+				Pool:   apc.nodePool.Name,
+				Name:   prefix + strconv.Itoa(i),
+				Action: planNodeActionCreate,
+				Detail: apc.nodePool.VMSize,
+			})
+		}
+	}
+
+	template, parameters, err := apc.generateTemplate()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return result, template, parameters, nil
+}
+
+func writePlanResult(out io.Writer, result *planResult, output string) error {
+	switch output {
+	case "json":
+		data, err := helpers.JSONMarshalIndent(result, "", "  ", false)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, string(data))
+	default:
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', tabwriter.FilterHTML)
+		fmt.Fprintf(w, "Planned %s operation\n\n", result.Operation)
+		if len(result.Nodes) == 0 {
+			fmt.Fprintln(w, "No VMs would be created, deleted or recreated")
+		} else {
+			fmt.Fprintln(w, "POOL\tVM\tACTION\tDETAIL")
+			for _, n := range result.Nodes {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", n.Pool, n.Name, n.Action, n.Detail)
+			}
+		}
+		fmt.Fprintln(w)
+		if len(result.Resources) == 0 {
+			fmt.Fprintln(w, "No ARM resources differ from the deployed template")
+		} else {
+			fmt.Fprintln(w, "RESOURCE TYPE\tNAME\tCHANGE\tPROPERTIES")
+			for _, r := range result.Resources {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Type, r.Name, r.Change, strings.Join(r.Paths, ", "))
+			}
+		}
+		fmt.Fprintln(w)
+		if len(result.Parameters) == 0 {
+			fmt.Fprintln(w, "No ARM parameters differ from the deployed parameters")
+		} else {
+			fmt.Fprintln(w, "PARAMETER\tCHANGE\tDEPLOYED\tTARGET")
+			for _, p := range result.Parameters {
+				fmt.Fprintf(w, "%s\t%s\t%v\t%v\n", p.Name, p.Change, planValue(p.Deployed), planValue(p.Target))
+			}
+		}
+		w.Flush()
+	}
+	return nil
+}
+
+// planValue keeps long parameter values (e.g. base64 custom data) from breaking the table layout
+func planValue(v interface{}) string {
+	if v == nil {
+		return "-"
+	}
+	var s string
+	switch t := v.(type) {
+	case string:
+		s = t
+	default:
+		b, err := json.Marshal(t)
+		if err != nil {
+			s = fmt.Sprintf("%v", t)
+		} else {
+			s = string(b)
+		}
+	}
+	const maxLen = 60
+	if len(s) > maxLen {
+		return s[:maxLen] + "..."
+	}
+	return s
+}
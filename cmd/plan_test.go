@@ -0,0 +1,282 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/Azure/aks-engine-azurestack/pkg/api"
+	"github.com/Azure/aks-engine-azurestack/pkg/engine/transform"
+	"github.com/Azure/aks-engine-azurestack/pkg/operations/kubernetesupgrade"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-12-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestNewPlanCmd(t *testing.T) {
+	command := newPlanCmd()
+	if command.Use != planName || command.Short != planShortDescription || command.Long != planLongDescription {
+		t.Fatalf("plan command should have use %s equal %s, short %s equal %s and long %s equal to %s", command.Use, planName, command.Short, planShortDescription, command.Long, planLongDescription)
+	}
+
+	expectedFlags := []string{"operation", "location", "resource-group", "api-model", "upgrade-version", "node-pool", "new-node-count", "node-pool-spec", "output"}
+	for _, f := range expectedFlags {
+		if command.Flags().Lookup(f) == nil {
+			t.Fatalf("plan command should have flag %s", f)
+		}
+	}
+
+	command.SetArgs([]string{})
+	if err := command.Execute(); err == nil {
+		t.Fatalf("expected an error when calling plan with no arguments")
+	}
+}
+
+func TestPlanCmdValidate(t *testing.T) {
+	r := &cobra.Command{}
+
+	cases := []struct {
+		pc          *planCmd
+		expectedErr error
+		name        string
+	}{
+		{
+			pc:          &planCmd{operation: "", apiModelPath: "./not/used", output: "human"},
+			expectedErr: errors.New("--operation must be one of: upgrade, scale, update, addpool"),
+			name:        "NoOperation",
+		},
+		{
+			pc:          &planCmd{operation: "delete", apiModelPath: "./not/used", output: "human"},
+			expectedErr: errors.New("--operation must be one of: upgrade, scale, update, addpool"),
+			name:        "InvalidOperation",
+		},
+		{
+			pc:          &planCmd{operation: "scale", apiModelPath: "./not/used", output: "yaml"},
+			expectedErr: errors.New("invalid output format: \"yaml\". Allowed values: human, json"),
+			name:        "InvalidOutput",
+		},
+		{
+			pc:          &planCmd{operation: "upgrade", apiModelPath: "", output: "json"},
+			expectedErr: errors.New("--api-model must be specified"),
+			name:        "NoAPIModel",
+		},
+		{
+			pc:          &planCmd{operation: "addpool", apiModelPath: "./not/used", output: "json"},
+			expectedErr: nil,
+			name:        "IsValid",
+		},
+	}
+
+	for _, tc := range cases {
+		c := tc
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			err := c.pc.validate(r)
+			if c.expectedErr != nil {
+				if err == nil || err.Error() != c.expectedErr.Error() {
+					t.Fatalf("expected validate plan command to return error %v, but instead got %v", c.expectedErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("expected validate plan command to return no error, but instead got %s", err.Error())
+			}
+		})
+	}
+}
+
+func TestVMASScaleDownChanges(t *testing.T) {
+	g := NewGomegaWithT(t)
+	pool := &api.AgentPoolProfile{Name: "agentpool1"}
+	indexes := []int{0, 1, 2, 3}
+	indexToVM := map[int]string{
+		0: "k8s-agentpool1-12345678-0",
+		1: "k8s-agentpool1-12345678-1",
+		2: "k8s-agentpool1-12345678-2",
+		3: "k8s-agentpool1-12345678-3",
+	}
+	names := func(changes []planNodeChange) []string {
+		n := []string{}
+		for _, c := range changes {
+			g.Expect(c.Action).To(Equal(planNodeActionDelete))
+			n = append(n, c.Name)
+		}
+		return n
+	}
+
+	changes, err := vmasScaleDownChanges(&scaleCmd{agentPool: pool, newDesiredAgentCount: 2}, indexes, indexToVM)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(names(changes)).To(Equal([]string{"k8s-agentpool1-12345678-3", "k8s-agentpool1-12345678-2"}))
+
+	changes, err = vmasScaleDownChanges(&scaleCmd{agentPool: pool, newDesiredAgentCount: 2, nodesToRemove: []string{"k8s-agentpool1-12345678-0", "k8s-agentpool1-12345678-2"}}, indexes, indexToVM)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(names(changes)).To(Equal([]string{"k8s-agentpool1-12345678-0", "k8s-agentpool1-12345678-2"}))
+
+	notReadyNode := v1.Node{}
+	notReadyNode.Name = "k8s-agentpool1-12345678-1"
+	notReadyNode.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionFalse}}
+	nodes := []v1.Node{notReadyNode}
+	for _, name := range []string{"k8s-agentpool1-12345678-0", "k8s-agentpool1-12345678-2", "k8s-agentpool1-12345678-3"} {
+		node := v1.Node{}
+		node.Name = name
+		node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}
+		nodes = append(nodes, node)
+	}
+	changes, err = vmasScaleDownChanges(&scaleCmd{agentPool: pool, newDesiredAgentCount: 2, preferUnhealthy: true, nodes: nodes}, indexes, indexToVM)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(names(changes)).To(Equal([]string{"k8s-agentpool1-12345678-1", "k8s-agentpool1-12345678-3"}))
+
+	_, err = vmasScaleDownChanges(&scaleCmd{agentPool: pool, agentPoolToScale: "agentpool1", nodesToRemove: []string{"k8s-agentpool2-12345678-0"}}, indexes, indexToVM)
+	g.Expect(err).To(MatchError("node k8s-agentpool2-12345678-0 was not found in node pool agentpool1"))
+}
+
+func TestVMSSCapacityChanges(t *testing.T) {
+	g := NewGomegaWithT(t)
+	pool := &api.AgentPoolProfile{Name: "agentpool1", VMSSName: "k8s-agentpool1-12345678-vmss", VMSize: "Standard_D2s_v3"}
+
+	changes := vmssCapacityChanges(pool, 3, 5, nil)
+	g.Expect(changes).To(HaveLen(2))
+	g.Expect(changes[0].Action).To(Equal(planNodeActionCreate))
+	g.Expect(changes[0].Detail).To(ContainSubstring("capacity 3 -> 5"))
+	g.Expect(changes[1].Action).To(Equal(planNodeActionUpdateModel))
+
+	changes = vmssCapacityChanges(pool, 3, 1, []string{"k8s-agentpool1-12345678-vmss000002", "k8s-agentpool1-12345678-vmss000001"})
+	g.Expect(changes).To(HaveLen(4))
+	g.Expect(changes[0]).To(Equal(planNodeChange{Pool: "agentpool1", Name: "k8s-agentpool1-12345678-vmss", Action: planNodeActionDelete, Detail: "capacity 3 -> 1, 2 instance(s) are cordoned, drained and deleted"}))
+	g.Expect(changes[1]).To(Equal(planNodeChange{Pool: "agentpool1", Name: "k8s-agentpool1-12345678-vmss000002", Action: planNodeActionDelete, Detail: "cordoned, drained and deleted"}))
+	g.Expect(changes[2]).To(Equal(planNodeChange{Pool: "agentpool1", Name: "k8s-agentpool1-12345678-vmss000001", Action: planNodeActionDelete, Detail: "cordoned, drained and deleted"}))
+	g.Expect(changes[3].Action).To(Equal(planNodeActionUpdateModel))
+
+	changes = vmssCapacityChanges(pool, 3, 3, nil)
+	g.Expect(changes).To(HaveLen(1))
+	g.Expect(changes[0].Action).To(Equal(planNodeActionUpdateModel))
+}
+
+func TestUpgradeNodeChanges(t *testing.T) {
+	g := NewGomegaWithT(t)
+	cs := api.CreateMockContainerService("testcluster", "1.24.7", 1, 3, false)
+	agentVM := func(name string) compute.VirtualMachine {
+		return compute.VirtualMachine{
+			Name: to.StringPtr(name),
+			Tags: map[string]*string{"orchestrator": to.StringPtr("Kubernetes:1.23.13")},
+			VirtualMachineProperties: &compute.VirtualMachineProperties{
+				StorageProfile: &compute.StorageProfile{OsDisk: &compute.OSDisk{OsType: compute.Linux}},
+			},
+		}
+	}
+	topology := &kubernetesupgrade.ClusterTopology{
+		DataModel:         cs,
+		MasterVMs:         &[]compute.VirtualMachine{},
+		UpgradedMasterVMs: &[]compute.VirtualMachine{agentVM("k8s-master-12345678-0")},
+		AgentPools: map[string]*kubernetesupgrade.AgentPoolTopology{
+			"agentpool1": {
+				Name: to.StringPtr("agentpool1"),
+				AgentVMs: &[]compute.VirtualMachine{
+					agentVM("k8s-agentpool1-12345678-2"),
+					agentVM("k8s-agentpool1-12345678-0"),
+					agentVM("k8s-agentpool1-12345678-1"),
+				},
+			},
+		},
+		AgentPoolScaleSetsToUpgrade: []kubernetesupgrade.AgentPoolScaleSet{
+			{
+				Name:         "k8s-agentpool2-12345678-vmss",
+				VMsToUpgrade: []kubernetesupgrade.AgentPoolScaleSetVM{{Name: "k8s-agentpool2-12345678-vmss000000", InstanceID: "0"}},
+			},
+		},
+	}
+	summary := func(changes []planNodeChange) []string {
+		s := []string{}
+		for _, c := range changes {
+			s = append(s, fmt.Sprintf("%s %s", c.Action, c.Name))
+		}
+		return s
+	}
+
+	// extra VMs take the place of the last VMs, VMSS instances are replaced
+	changes := getUpgradeNodeChanges(topology, "1.23.13", 1, 0, kubernetesupgrade.VMSSUpgradeStrategyReplace)
+	g.Expect(summary(changes)).To(Equal([]string{
+		"Create 1 extra VM(s)",
+		"Recreate k8s-agentpool1-12345678-0",
+		"Recreate k8s-agentpool1-12345678-1",
+		"Delete k8s-agentpool1-12345678-2",
+		"Recreate k8s-agentpool2-12345678-vmss000000",
+	}))
+	g.Expect(changes[4].Detail).To(Equal("instance 0 replaced by a new instance running Kubernetes 1.24.7"))
+
+	changes = getUpgradeNodeChanges(topology, "1.23.13", 2, 0, kubernetesupgrade.VMSSUpgradeStrategyReplace)
+	g.Expect(summary(changes)[:4]).To(Equal([]string{
+		"Create 2 extra VM(s)",
+		"Recreate k8s-agentpool1-12345678-0",
+		"Delete k8s-agentpool1-12345678-1",
+		"Delete k8s-agentpool1-12345678-2",
+	}))
+
+	// without surge all the VMs are recreated in place, VMSS instances updated in place are reimaged
+	changes = getUpgradeNodeChanges(topology, "1.23.13", 0, 1, kubernetesupgrade.VMSSUpgradeStrategyInPlace)
+	g.Expect(summary(changes)).To(Equal([]string{
+		"Recreate k8s-agentpool1-12345678-0",
+		"Recreate k8s-agentpool1-12345678-1",
+		"Recreate k8s-agentpool1-12345678-2",
+		"Reimage k8s-agentpool2-12345678-vmss000000",
+	}))
+	g.Expect(changes[3].Detail).To(Equal("instance 0 updated to the new VMSS model and reimaged to run Kubernetes 1.24.7"))
+}
+
+func TestUpgradeDetail(t *testing.T) {
+	g := NewGomegaWithT(t)
+	vm := compute.VirtualMachine{
+		Name: to.StringPtr("k8s-master-12345678-0"),
+		Tags: map[string]*string{"orchestrator": to.StringPtr("Kubernetes:1.23.13")},
+		VirtualMachineProperties: &compute.VirtualMachineProperties{
+			HardwareProfile: &compute.HardwareProfile{VMSize: compute.VirtualMachineSizeTypesStandardD2sV3},
+		},
+	}
+	g.Expect(upgradeDetail(vm, "1.23.0", "1.24.7", "Standard_D2s_v3")).To(Equal("Kubernetes 1.23.13 -> 1.24.7"))
+	g.Expect(upgradeDetail(vm, "1.23.0", "1.24.7", "Standard_D4s_v3")).To(Equal("Kubernetes 1.23.13 -> 1.24.7, resize Standard_D2s_v3 -> Standard_D4s_v3"))
+
+	vm.Tags = nil
+	g.Expect(upgradeDetail(vm, "1.23.0", "1.24.7", "")).To(Equal("Kubernetes 1.23.0 -> 1.24.7"))
+}
+
+func TestWritePlanResult(t *testing.T) {
+	g := NewGomegaWithT(t)
+	result := &planResult{
+		Operation: planOperationScale,
+		Nodes: []planNodeChange{
+			{Pool: "agentpool1", Name: "k8s-agentpool1-12345678-3", Action: planNodeActionCreate, Detail: "Standard_D2s_v3"},
+		},
+		Resources: []transform.ResourceChange{
+			{Type: "Microsoft.Compute/virtualMachines", Name: "[concat(variables('agentpool1VMNamePrefix'), copyIndex(variables('agentpool1Offset')))]", Change: transform.ChangeTypeModify, Paths: []string{"properties.hardwareProfile.vmSize"}},
+		},
+		Parameters: []transform.ParameterChange{
+			{Name: "agentpool1Count", Change: transform.ChangeTypeModify, Deployed: float64(3), Target: float64(4)},
+		},
+	}
+
+	var human bytes.Buffer
+	g.Expect(writePlanResult(&human, result, "human")).To(Succeed())
+	g.Expect(human.String()).To(ContainSubstring("k8s-agentpool1-12345678-3"))
+	g.Expect(human.String()).To(ContainSubstring("properties.hardwareProfile.vmSize"))
+	g.Expect(human.String()).To(ContainSubstring("agentpool1Count"))
+
+	var out bytes.Buffer
+	g.Expect(writePlanResult(&out, result, "json")).To(Succeed())
+	var decoded planResult
+	g.Expect(json.Unmarshal(out.Bytes(), &decoded)).To(Succeed())
+	g.Expect(decoded.Nodes).To(Equal(result.Nodes))
+	g.Expect(decoded.Resources).To(Equal(result.Resources))
+}
+
+func TestPlanValue(t *testing.T) {
+	g := NewGomegaWithT(t)
+	g.Expect(planValue(nil)).To(Equal("-"))
+	g.Expect(planValue("1.24.7")).To(Equal("1.24.7"))
+	g.Expect(planValue(float64(3))).To(Equal("3"))
+	g.Expect(planValue(string(make([]byte, 100)))).To(HaveLen(63))
+}
@@ -0,0 +1,103 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/Azure/aks-engine-azurestack/pkg/api"
+	"github.com/Azure/aks-engine-azurestack/pkg/i18n"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	redactAPIModelName             = "redact-apimodel"
+	redactAPIModelShortDescription = "Write a copy of an API model without secrets"
+	redactAPIModelLongDescription  = "Write a copy of an API model where the secrets, such as the service principal secret, the admin passwords and the certificate profile keys, are redacted so it can be safely shared."
+)
+
+type redactAPIModelCmd struct {
+	// user input
+	apiModelPath string
+	outputFile   string
+
+	// computed
+	cs         *api.ContainerService
+	apiVersion string
+}
+
+func newRedactAPIModelCmd() *cobra.Command {
+	rc := redactAPIModelCmd{}
+	command := &cobra.Command{
+		Use:   redactAPIModelName,
+		Short: redactAPIModelShortDescription,
+		Long:  redactAPIModelLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := rc.validateArgs(); err != nil {
+				return errors.Wrap(err, "validating redact-apimodel args")
+			}
+			if err := rc.loadAPIModel(); err != nil {
+				return errors.Wrap(err, "loading API model")
+			}
+			cmd.SilenceUsage = true
+			if rc.outputFile == "" {
+				return rc.run(os.Stdout)
+			}
+			f, err := os.OpenFile(rc.outputFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+			if err != nil {
+				return errors.Wrapf(err, "creating %s", rc.outputFile)
+			}
+			defer f.Close()
+			return rc.run(f)
+		},
+	}
+	f := command.Flags()
+	f.StringVarP(&rc.apiModelPath, "api-model", "m", "", "path to the apimodel.json file (required)")
+	f.StringVar(&rc.outputFile, "output-file", "", "path to the redacted apimodel.json file, written to stdout if missing")
+	_ = command.MarkFlagRequired("api-model")
+	return command
+}
+
+func (rc *redactAPIModelCmd) validateArgs() (err error) {
+	if rc.apiModelPath == "" {
+		return errors.New("--api-model must be specified")
+	} else if _, err = os.Stat(rc.apiModelPath); os.IsNotExist(err) {
+		return errors.Errorf("specified --api-model does not exist (%s)", rc.apiModelPath)
+	}
+	if rc.outputFile != "" && rc.outputFile == rc.apiModelPath {
+		return errors.New("--output-file cannot overwrite --api-model")
+	}
+	return nil
+}
+
+func (rc *redactAPIModelCmd) loadAPIModel() error {
+	locale, err := i18n.LoadTranslations()
+	if err != nil {
+		return errors.Wrap(err, "loading translation files")
+	}
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{
+			Locale: locale,
+		},
+	}
+	if rc.cs, rc.apiVersion, err = apiloader.LoadContainerServiceFromFile(rc.apiModelPath, false, false, nil); err != nil {
+		return errors.Wrap(err, "error parsing api-model")
+	}
+	return nil
+}
+
+func (rc *redactAPIModelCmd) run(out io.Writer) error {
+	rc.cs.Redact()
+	apiloader := &api.Apiloader{}
+	b, err := apiloader.SerializeContainerService(rc.cs, rc.apiVersion)
+	if err != nil {
+		return errors.Wrap(err, "serializing API model")
+	}
+	if _, err = out.Write(b); err != nil {
+		return errors.Wrap(err, "writing redacted API model")
+	}
+	return nil
+}
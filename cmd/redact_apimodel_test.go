@@ -0,0 +1,116 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/Azure/aks-engine-azurestack/pkg/api"
+	"github.com/Azure/aks-engine-azurestack/pkg/api/vlabs"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+func TestRedactAPIModelCmd(t *testing.T) {
+	t.Parallel()
+	g := NewGomegaWithT(t)
+
+	command := newRedactAPIModelCmd()
+	g.Expect(command.Use).Should(Equal(redactAPIModelName))
+	g.Expect(command.Short).Should(Equal(redactAPIModelShortDescription))
+	g.Expect(command.Long).Should(Equal(redactAPIModelLongDescription))
+	g.Expect(command.Flags().Lookup("api-model")).NotTo(BeNil())
+	g.Expect(command.Flags().Lookup("output-file")).NotTo(BeNil())
+
+	command.SetArgs([]string{})
+	err := command.Execute()
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestRedactAPIModelCmdValidateArgs(t *testing.T) {
+	t.Parallel()
+
+	existingFile := "../examples/kubernetes.json"
+	missingFile := "./random/file"
+
+	cases := []struct {
+		rc          *redactAPIModelCmd
+		expectedErr error
+		name        string
+	}{
+		{
+			rc:          &redactAPIModelCmd{},
+			expectedErr: errors.New("--api-model must be specified"),
+			name:        "NeedsAPIModel",
+		},
+		{
+			rc:          &redactAPIModelCmd{apiModelPath: missingFile},
+			expectedErr: errors.Errorf("specified --api-model does not exist (%s)", missingFile),
+			name:        "BadAPIModel",
+		},
+		{
+			rc:          &redactAPIModelCmd{apiModelPath: existingFile, outputFile: existingFile},
+			expectedErr: errors.New("--output-file cannot overwrite --api-model"),
+			name:        "OverwriteAPIModel",
+		},
+		{
+			rc:          &redactAPIModelCmd{apiModelPath: existingFile, outputFile: "redacted.json"},
+			expectedErr: nil,
+			name:        "IsValid",
+		},
+	}
+	for _, tc := range cases {
+		c := tc
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			g := NewGomegaWithT(t)
+			err := c.rc.validateArgs()
+			if c.expectedErr != nil {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(Equal(c.expectedErr.Error()))
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestRedactAPIModelRun(t *testing.T) {
+	t.Parallel()
+	g := NewGomegaWithT(t)
+
+	cs := api.CreateMockContainerService("testcluster", "", 1, 1, true)
+	cs.Properties.ServicePrincipalProfile = &api.ServicePrincipalProfile{
+		ClientID: "clientID",
+		Secret:   "secret-sp",
+	}
+	cs.Properties.CertificateProfile.CaPrivateKey = "secret-ca-key"
+	cs.Properties.CertificateProfile.APIServerPrivateKey = "secret-apiserver-key"
+	cs.Properties.CertificateProfile.EtcdPeerPrivateKeys = []string{"secret-etcd-peer-key"}
+	cs.Properties.WindowsProfile = &api.WindowsProfile{
+		AdminUsername: "azureuser",
+		AdminPassword: "secret-windows-password",
+	}
+	apiloader := &api.Apiloader{}
+	b, err := apiloader.SerializeContainerService(cs, vlabs.APIVersion)
+	g.Expect(err).NotTo(HaveOccurred())
+	apiModelPath := path.Join(t.TempDir(), "apimodel.json")
+	g.Expect(os.WriteFile(apiModelPath, b, 0600)).To(Succeed())
+
+	rc := &redactAPIModelCmd{apiModelPath: apiModelPath}
+	g.Expect(rc.loadAPIModel()).To(Succeed())
+	out := &bytes.Buffer{}
+	err = rc.run(out)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	redacted := out.String()
+	for _, secret := range []string{"secret-sp", "secret-ca-key", "secret-apiserver-key", "secret-etcd-peer-key", "secret-windows-password"} {
+		g.Expect(redacted).NotTo(ContainSubstring(secret))
+	}
+	g.Expect(redacted).To(ContainSubstring("clientID"))
+	g.Expect(redacted).To(ContainSubstring(api.RedactedValue))
+}
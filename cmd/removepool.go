@@ -0,0 +1,477 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Azure/aks-engine-azurestack/pkg/api"
+	"github.com/Azure/aks-engine-azurestack/pkg/api/common"
+	"github.com/Azure/aks-engine-azurestack/pkg/armhelpers"
+	"github.com/Azure/aks-engine-azurestack/pkg/armhelpers/utils"
+	"github.com/Azure/aks-engine-azurestack/pkg/engine"
+	"github.com/Azure/aks-engine-azurestack/pkg/helpers"
+	"github.com/Azure/aks-engine-azurestack/pkg/i18n"
+	"github.com/Azure/aks-engine-azurestack/pkg/kubernetes"
+	"github.com/Azure/aks-engine-azurestack/pkg/operations"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/leonelquinteros/gotext"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+)
+
+type removePoolCmd struct {
+	authArgs
+
+	// user input
+	apiModelPath      string
+	resourceGroupName string
+	nodePoolName      string
+	location          string
+
+	// derived
+	containerService *api.ContainerService
+	apiVersion       string
+	nodePool         *api.AgentPoolProfile
+	nodePoolIndex    int
+	availabilitySets []string
+	client           armhelpers.AKSEngineClient
+	kubeClient       kubernetes.Client
+	locale           *gotext.Locale
+	nameSuffix       string
+	logger           *log.Entry
+}
+
+const (
+	removePoolName             = "remove-pool"
+	removePoolShortDescription = "Remove a node pool from an existing AKS Engine-created Kubernetes cluster"
+	removePoolLongDescription  = "Remove a node pool from an existing AKS Engine-created Kubernetes cluster by cordoning and draining its nodes, deleting its Azure resources and removing it from the api model"
+)
+
+const (
+	removePoolDrainInterval = 1 * time.Second
+	removePoolDrainTimeout  = 60 * time.Minute
+)
+
+// newRemovePoolCmd run a command to remove an agent pool from a Kubernetes cluster
+func newRemovePoolCmd() *cobra.Command {
+	rpc := removePoolCmd{}
+
+	removePoolCmd := &cobra.Command{
+		Use:   removePoolName,
+		Short: removePoolShortDescription,
+		Long:  removePoolLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return rpc.run(cmd, args)
+		},
+	}
+
+	f := removePoolCmd.Flags()
+	f.StringVarP(&rpc.location, "location", "l", "", "location the cluster is deployed in")
+	f.StringVarP(&rpc.resourceGroupName, "resource-group", "g", "", "the resource group where the cluster is deployed")
+	f.StringVarP(&rpc.apiModelPath, "api-model", "m", "", "path to the generated apimodel.json file")
+	f.StringVar(&rpc.nodePoolName, "node-pool", "", "name of the node pool to remove")
+
+	addAuthFlags(&rpc.authArgs, f)
+
+	return removePoolCmd
+}
+
+func (rpc *removePoolCmd) validate(cmd *cobra.Command) error {
+	log.Debugln("validating remove-pool command line arguments...")
+	var err error
+
+	rpc.locale, err = i18n.LoadTranslations()
+	if err != nil {
+		return errors.Wrap(err, "error loading translation files")
+	}
+
+	if rpc.resourceGroupName == "" {
+		_ = cmd.Usage()
+		return errors.New("--resource-group must be specified")
+	}
+
+	if rpc.location == "" {
+		_ = cmd.Usage()
+		return errors.New("--location must be specified")
+	}
+
+	rpc.location = helpers.NormalizeAzureRegion(rpc.location)
+
+	if rpc.apiModelPath == "" {
+		_ = cmd.Usage()
+		return errors.New("--api-model must be specified")
+	}
+
+	if rpc.nodePoolName == "" {
+		_ = cmd.Usage()
+		return errors.New("--node-pool must be specified")
+	}
+	return nil
+}
+
+func (rpc *removePoolCmd) load() error {
+	rpc.logger = log.NewEntry(log.New())
+	var err error
+
+	if _, err = os.Stat(rpc.apiModelPath); os.IsNotExist(err) {
+		return errors.Errorf("specified api model does not exist (%s)", rpc.apiModelPath)
+	}
+
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{
+			Locale: rpc.locale,
+		},
+	}
+	rpc.containerService, rpc.apiVersion, err = apiloader.LoadContainerServiceFromFile(rpc.apiModelPath, true, true, nil)
+	if err != nil {
+		return errors.Wrap(err, "error parsing the api model")
+	}
+
+	if err = rpc.loadNodePool(); err != nil {
+		return err
+	}
+
+	if rpc.containerService.Properties.IsCustomCloudProfile() {
+		if err = writeCustomCloudProfile(rpc.containerService); err != nil {
+			return errors.Wrap(err, "error writing custom cloud profile")
+		}
+		if err = rpc.containerService.Properties.SetCustomCloudSpec(api.AzureCustomCloudSpecParams{IsUpgrade: false, IsScale: true}); err != nil {
+			return errors.Wrap(err, "error parsing the api model")
+		}
+	}
+
+	if err = rpc.authArgs.validateAuthArgs(); err != nil {
+		return err
+	}
+
+	if rpc.client, err = rpc.authArgs.getClient(); err != nil {
+		return errors.Wrap(err, "failed to get client")
+	}
+
+	if rpc.containerService.Location == "" {
+		rpc.containerService.Location = rpc.location
+	} else if rpc.containerService.Location != rpc.location {
+		return errors.New("--location does not match api model location")
+	}
+
+	//allows to identify VMs in the resource group that belong to this cluster.
+	rpc.nameSuffix = rpc.containerService.Properties.GetClusterID()
+	log.Debugf("Cluster ID used in all agent pools: %s", rpc.nameSuffix)
+
+	kubeconfig, err := engine.GenerateKubeConfig(rpc.containerService.Properties, rpc.location)
+	if err != nil {
+		return errors.New("Unable to derive kubeconfig from api model")
+	}
+	rpc.kubeClient, err = rpc.client.GetKubernetesClient("", kubeconfig, removePoolDrainInterval, removePoolDrainTimeout)
+	if err != nil {
+		return errors.Wrap(err, "failed to get a Kubernetes client")
+	}
+	return nil
+}
+
+// loadNodePool finds the node pool to remove in the api model
+func (rpc *removePoolCmd) loadNodePool() error {
+	rpc.nodePoolIndex = -1
+	for i, p := range rpc.containerService.Properties.AgentPoolProfiles {
+		if strings.EqualFold(p.Name, rpc.nodePoolName) {
+			rpc.nodePool = p
+			rpc.nodePoolIndex = i
+			break
+		}
+	}
+	if rpc.nodePoolIndex == -1 {
+		return errors.Errorf("node pool %s was not found in the api model", rpc.nodePoolName)
+	}
+	if len(rpc.containerService.Properties.AgentPoolProfiles) == 1 {
+		return errors.Errorf("node pool %s is the only node pool of the cluster and cannot be removed", rpc.nodePool.Name)
+	}
+	// the VM names of Windows availability set node pools are built from the index of the pool,
+	// removing a pool placed before one of them would change the names of its VMs
+	for _, p := range rpc.containerService.Properties.AgentPoolProfiles[rpc.nodePoolIndex+1:] {
+		if p.IsWindows() && p.IsAvailabilitySets() {
+			return errors.Errorf("node pool %s cannot be removed, the VM names of Windows node pool %s placed after it depend on its position in the api model", rpc.nodePool.Name, p.Name)
+		}
+	}
+
+	// Back-compat logic to populate the VMSSName property for clusters built prior to VMSSName being a part of the API model spec
+	if rpc.nodePool.IsVirtualMachineScaleSets() && rpc.nodePool.VMSSName == "" {
+		rpc.nodePool.VMSSName = rpc.containerService.Properties.GetAgentVMPrefix(rpc.nodePool, rpc.nodePoolIndex)
+	}
+	return nil
+}
+
+func (rpc *removePoolCmd) run(cmd *cobra.Command, args []string) error {
+	if err := rpc.validate(cmd); err != nil {
+		return errors.Wrap(err, "failed to validate remove-pool command")
+	}
+	if err := rpc.load(); err != nil {
+		return errors.Wrap(err, "failed to load existing container service")
+	}
+	return rpc.removePool()
+}
+
+// removePool drains the node pool nodes, deletes the node pool resources and nodes, then updates the api model
+func (rpc *removePoolCmd) removePool() error {
+	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+	defer cancel()
+
+	poolVMs, err := rpc.getNodePoolVMs(ctx)
+	if err != nil {
+		return err
+	}
+	nodes, err := rpc.getNodePoolNodes(poolVMs)
+	if err != nil {
+		return err
+	}
+	if len(poolVMs) == 0 && len(nodes) == 0 {
+		rpc.logger.Warnf("Found no VMs or nodes in node pool %s", rpc.nodePool.Name)
+	}
+
+	if err = rpc.drainNodes(nodes); err != nil {
+		return errors.Wrap(err, "Got error while draining the nodes to be deleted")
+	}
+	if err = rpc.deleteNodePoolResources(ctx, poolVMs); err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		rpc.logger.Infof("Deleting node %s from the Kubernetes cluster", node.Name)
+		if err = rpc.kubeClient.DeleteNode(node.Name); err != nil {
+			return errors.Wrapf(err, "failed to delete node %s", node.Name)
+		}
+	}
+
+	return rpc.saveAPIModel()
+}
+
+// getNodePoolVMs returns the names of the VMs, or the computer names of the VMSS instances, of the node pool
+// and records the availability sets of the VMs
+func (rpc *removePoolCmd) getNodePoolVMs(ctx context.Context) ([]string, error) {
+	vms := make([]string, 0)
+	if rpc.nodePool.IsVirtualMachineScaleSets() {
+		for vmPage, err := rpc.client.ListVirtualMachineScaleSetVMs(ctx, rpc.resourceGroupName, rpc.nodePool.VMSSName); vmPage.NotDone(); err = vmPage.NextWithContext(ctx) {
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to list the instances of VMSS %s", rpc.nodePool.VMSSName)
+			}
+			for _, vm := range vmPage.Values() {
+				if vm.VirtualMachineScaleSetVMProperties != nil && vm.OsProfile != nil && vm.OsProfile.ComputerName != nil {
+					vms = append(vms, to.String(vm.OsProfile.ComputerName))
+				}
+			}
+		}
+		return vms, nil
+	}
+	rpc.availabilitySets = nil
+	for vmPage, err := rpc.client.ListVirtualMachines(ctx, rpc.resourceGroupName); vmPage.NotDone(); err = vmPage.Next() {
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get VMs in the resource group")
+		}
+		for _, vm := range vmPage.Values() {
+			if !rpc.vmInNodePool(to.String(vm.Name), vm.Tags) {
+				continue
+			}
+			vms = append(vms, to.String(vm.Name))
+			if vm.VirtualMachineProperties != nil && vm.AvailabilitySet != nil {
+				availabilitySet, err := utils.ResourceName(to.String(vm.AvailabilitySet.ID))
+				if err != nil {
+					return nil, errors.Wrapf(err, "failed to get the availability set of VM %s", to.String(vm.Name))
+				}
+				if !containsFold(rpc.availabilitySets, availabilitySet) {
+					rpc.availabilitySets = append(rpc.availabilitySets, availabilitySet)
+				}
+			}
+		}
+	}
+	return vms, nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rpc *removePoolCmd) vmInNodePool(vmName string, tags map[string]*string) bool {
+	if tags != nil {
+		if poolName, ok := tags["poolName"]; ok {
+			if nameSuffix, ok := tags["resourceNameSuffix"]; ok {
+				// Windows Agent Pools use only a substring of the first 5 characters of the entire nameSuffix.
+				return strings.EqualFold(*poolName, rpc.nodePool.Name) && strings.Contains(rpc.nameSuffix, *nameSuffix)
+			}
+		}
+	}
+	vmPrefix := rpc.containerService.Properties.GetAgentVMPrefix(rpc.nodePool, rpc.nodePoolIndex)
+	return strings.HasPrefix(strings.ToLower(vmName), strings.ToLower(vmPrefix))
+}
+
+// getNodePoolNodes returns the Kubernetes nodes backed by the node pool VMs
+func (rpc *removePoolCmd) getNodePoolNodes(poolVMs []string) ([]v1.Node, error) {
+	nodeList, err := rpc.kubeClient.ListNodes()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list the Kubernetes nodes")
+	}
+	nodes := make([]v1.Node, 0)
+	for _, node := range nodeList.Items {
+		for _, vm := range poolVMs {
+			if strings.EqualFold(node.Name, vm) {
+				nodes = append(nodes, node)
+				break
+			}
+		}
+	}
+	return nodes, nil
+}
+
+func (rpc *removePoolCmd) drainNodes(nodes []v1.Node) error {
+	errChan := make(chan *operations.VMScalingErrorDetails, len(nodes))
+	defer close(errChan)
+	for _, node := range nodes {
+		go func(nodeName string) {
+			rpc.logger.Infof("Node %s will be cordoned and drained", nodeName)
+			err := operations.SafelyDrainNodeWithClient(rpc.kubeClient, rpc.logger, nodeName, removePoolDrainTimeout)
+			if err != nil {
+				log.Errorf("Failed to drain node %s, got error %v", nodeName, err)
+				errChan <- &operations.VMScalingErrorDetails{Error: err, Name: nodeName}
+				return
+			}
+			errChan <- nil
+		}(node.Name)
+	}
+
+	for i := 0; i < len(nodes); i++ {
+		errDetails := <-errChan
+		if errDetails != nil {
+			return errors.Wrapf(errDetails.Error, "Node %q failed to drain with error", errDetails.Name)
+		}
+	}
+	return nil
+}
+
+// deleteNodePoolResources deletes the VMSS of a VMSS node pool, or the VMs, NICs, disks and availability set of a VMAS node pool
+func (rpc *removePoolCmd) deleteNodePoolResources(ctx context.Context, poolVMs []string) error {
+	if rpc.nodePool.IsVirtualMachineScaleSets() {
+		rpc.logger.Infof("Deleting VMSS %s", rpc.nodePool.VMSSName)
+		if err := rpc.client.DeleteVirtualMachineScaleSet(ctx, rpc.resourceGroupName, rpc.nodePool.VMSSName); err != nil {
+			return errors.Wrapf(err, "failed to delete VMSS %s", rpc.nodePool.VMSSName)
+		}
+		return nil
+	}
+
+	errList := operations.ScaleDownVMs(rpc.client, rpc.logger, rpc.SubscriptionID.String(), rpc.resourceGroupName, poolVMs...)
+	if errList != nil {
+		var err error
+		format := "Node '%s' failed to delete with error: '%s'"
+		for element := errList.Front(); element != nil; element = element.Next() {
+			vmError, ok := element.Value.(*operations.VMScalingErrorDetails)
+			if ok {
+				if err == nil {
+					err = errors.Errorf(format, vmError.Name, vmError.Error.Error())
+				} else {
+					err = errors.Wrapf(err, format, vmError.Name, vmError.Error.Error())
+				}
+			}
+		}
+		return err
+	}
+
+	// the data disks are not deleted with the VMs
+	for diskPage, err := rpc.client.ListManagedDisksByResourceGroup(ctx, rpc.resourceGroupName); diskPage.NotDone(); err = diskPage.NextWithContext(ctx) {
+		if err != nil {
+			return errors.Wrap(err, "failed to list the managed disks in the resource group")
+		}
+		for _, disk := range diskPage.Values() {
+			diskName := to.String(disk.Name)
+			for _, vm := range poolVMs {
+				if strings.HasPrefix(strings.ToLower(diskName), strings.ToLower(vm)+"-datadisk") {
+					rpc.logger.Infof("Deleting managed disk %s", diskName)
+					if err = rpc.client.DeleteManagedDisk(ctx, rpc.resourceGroupName, diskName); err != nil {
+						return errors.Wrapf(err, "failed to delete managed disk %s", diskName)
+					}
+					break
+				}
+			}
+		}
+	}
+
+	// the availability sets are taken from the VMs, they are left behind if the node pool has no VMs
+	for _, availabilitySet := range rpc.availabilitySets {
+		rpc.logger.Infof("Deleting availability set %s", availabilitySet)
+		if err := rpc.client.DeleteAvailabilitySet(ctx, rpc.resourceGroupName, availabilitySet); err != nil {
+			return errors.Wrapf(err, "failed to delete availability set %s", availabilitySet)
+		}
+	}
+	return nil
+}
+
+func (rpc *removePoolCmd) saveAPIModel() error {
+	var err error
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{
+			Locale: rpc.locale,
+		},
+	}
+	var apiVersion string
+	rpc.containerService, apiVersion, err = apiloader.LoadContainerServiceFromFile(rpc.apiModelPath, false, true, nil)
+	if err != nil {
+		return err
+	}
+
+	removeNodePool(rpc.containerService.Properties, rpc.nodePool.Name)
+
+	b, err := apiloader.SerializeContainerService(rpc.containerService, apiVersion)
+
+	if err != nil {
+		return err
+	}
+
+	f := helpers.FileSaver{
+		Translator: &i18n.Translator{
+			Locale: rpc.locale,
+		},
+	}
+	dir, file := filepath.Split(rpc.apiModelPath)
+	return f.SaveFile(dir, file, b)
+}
+
+// removeNodePool removes the node pool from the agent pool profiles and from the cluster-autoscaler addon configuration
+func removeNodePool(p *api.Properties, nodePoolName string) {
+	pools := make([]*api.AgentPoolProfile, 0, len(p.AgentPoolProfiles))
+	for i, pool := range p.AgentPoolProfiles {
+		if strings.EqualFold(pool.Name, nodePoolName) {
+			continue
+		}
+		// pin the VMSS names computed from the pool index, which changes for the pools placed after the removed one
+		if pool.IsVirtualMachineScaleSets() && pool.VMSSName == "" {
+			pool.VMSSName = p.GetAgentVMPrefix(pool, i)
+		}
+		pools = append(pools, pool)
+	}
+	p.AgentPoolProfiles = pools
+
+	if p.OrchestratorProfile == nil || p.OrchestratorProfile.KubernetesConfig == nil {
+		return
+	}
+	addons := p.OrchestratorProfile.KubernetesConfig.Addons
+	for i := range addons {
+		if addons[i].Name != common.ClusterAutoscalerAddonName {
+			continue
+		}
+		addonPools := make([]api.AddonNodePoolsConfig, 0, len(addons[i].Pools))
+		for _, pool := range addons[i].Pools {
+			if !strings.EqualFold(pool.Name, nodePoolName) {
+				addonPools = append(addonPools, pool)
+			}
+		}
+		addons[i].Pools = addonPools
+	}
+}
@@ -0,0 +1,333 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/Azure/aks-engine-azurestack/pkg/api"
+	"github.com/Azure/aks-engine-azurestack/pkg/api/common"
+	"github.com/Azure/aks-engine-azurestack/pkg/api/vlabs"
+	"github.com/Azure/aks-engine-azurestack/pkg/armhelpers"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-12-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func TestNewRemovePoolCmd(t *testing.T) {
+	command := newRemovePoolCmd()
+	if command.Use != removePoolName || command.Short != removePoolShortDescription || command.Long != removePoolLongDescription {
+		t.Fatalf("remove-pool command should have use %s equal %s, short %s equal %s and long %s equal to %s", command.Use, removePoolName, command.Short, removePoolShortDescription, command.Long, removePoolLongDescription)
+	}
+
+	expectedFlags := []string{"location", "resource-group", "api-model", "node-pool"}
+	for _, f := range expectedFlags {
+		if command.Flags().Lookup(f) == nil {
+			t.Fatalf("remove-pool command should have flag %s", f)
+		}
+	}
+
+	command.SetArgs([]string{})
+	if err := command.Execute(); err == nil {
+		t.Fatalf("expected an error when calling remove-pool with no arguments")
+	}
+}
+
+func TestRemovePoolCmdValidate(t *testing.T) {
+	r := &cobra.Command{}
+
+	cases := []struct {
+		rpc         *removePoolCmd
+		expectedErr error
+		name        string
+	}{
+		{
+			rpc: &removePoolCmd{
+				apiModelPath:      "./not/used",
+				nodePoolName:      "agentpool1",
+				location:          "centralus",
+				resourceGroupName: "",
+			},
+			expectedErr: errors.New("--resource-group must be specified"),
+			name:        "NoResourceGroup",
+		},
+		{
+			rpc: &removePoolCmd{
+				apiModelPath:      "./not/used",
+				nodePoolName:      "agentpool1",
+				location:          "",
+				resourceGroupName: "testRG",
+			},
+			expectedErr: errors.New("--location must be specified"),
+			name:        "NoLocation",
+		},
+		{
+			rpc: &removePoolCmd{
+				apiModelPath:      "",
+				nodePoolName:      "agentpool1",
+				location:          "centralus",
+				resourceGroupName: "testRG",
+			},
+			expectedErr: errors.New("--api-model must be specified"),
+			name:        "NoAPIModel",
+		},
+		{
+			rpc: &removePoolCmd{
+				apiModelPath:      "./not/used",
+				location:          "centralus",
+				resourceGroupName: "testRG",
+			},
+			expectedErr: errors.New("--node-pool must be specified"),
+			name:        "NoNodePool",
+		},
+		{
+			rpc: &removePoolCmd{
+				apiModelPath:      "./not/used",
+				nodePoolName:      "agentpool1",
+				location:          "centralus",
+				resourceGroupName: "testRG",
+			},
+			expectedErr: nil,
+			name:        "IsValid",
+		},
+	}
+
+	for _, tc := range cases {
+		c := tc
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			err := c.rpc.validate(r)
+			if err != nil && c.expectedErr != nil {
+				if err.Error() != c.expectedErr.Error() {
+					t.Fatalf("expected validate remove-pool command to return error %s, but instead got %s", c.expectedErr.Error(), err.Error())
+				}
+			} else {
+				if c.expectedErr != nil {
+					t.Fatalf("expected validate remove-pool command to return error %s, but instead got no error", c.expectedErr.Error())
+				} else if err != nil {
+					t.Fatalf("expected validate remove-pool command to return no error, but instead got %s", err.Error())
+				}
+			}
+		})
+	}
+}
+
+// newMockRemovePoolCmd returns a remove-pool command for a cluster with node pools agentpool1 and agentpool3,
+// the mock Kubernetes client lists node k8s-agentpool3-1234
+func newMockRemovePoolCmd(t *testing.T) *removePoolCmd {
+	cs := api.CreateMockContainerService("testcluster", "1.18.8", 1, 1, false)
+	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &api.AgentPoolProfile{
+		Name:                "agentpool3",
+		Count:               1,
+		VMSize:              "Standard_D2_v2",
+		OSType:              api.Linux,
+		AvailabilityProfile: api.AvailabilitySet,
+	})
+	cs.Properties.OrchestratorProfile.KubernetesConfig = &api.KubernetesConfig{
+		Addons: []api.KubernetesAddon{
+			{
+				Name:    common.ClusterAutoscalerAddonName,
+				Enabled: to.BoolPtr(true),
+				Pools: []api.AddonNodePoolsConfig{
+					{Name: "agentpool1", Config: map[string]string{"min-nodes": "1"}},
+					{Name: "agentpool3", Config: map[string]string{"min-nodes": "1"}},
+				},
+			},
+		},
+	}
+	apiloader := &api.Apiloader{}
+	b, err := apiloader.SerializeContainerService(cs, vlabs.APIVersion)
+	if err != nil {
+		t.Fatalf("failed to serialize the api model: %s", err)
+	}
+	apiModelPath := path.Join(t.TempDir(), "apimodel.json")
+	if err = os.WriteFile(apiModelPath, b, 0600); err != nil {
+		t.Fatalf("failed to write the api model: %s", err)
+	}
+
+	client := &armhelpers.MockAKSEngineClient{MockKubernetesClient: &armhelpers.MockKubernetesClient{}}
+	clusterID := cs.Properties.GetClusterID()
+	client.FakeListVirtualMachineResult = func() []compute.VirtualMachine {
+		vms := make([]compute.VirtualMachine, 0)
+		for _, pool := range []string{"agentpool1", "agentpool3"} {
+			vm := client.MakeFakeVirtualMachine("k8s-"+pool+"-1234", "Kubernetes:1.18.8")
+			vm.Tags["poolName"] = to.StringPtr(pool)
+			vm.Tags["resourceNameSuffix"] = to.StringPtr(clusterID)
+			vm.AvailabilitySet = &compute.SubResource{
+				ID: to.StringPtr("/subscriptions/sub/resourceGroups/testRG/providers/Microsoft.Compute/availabilitySets/" + pool + "-availabilitySet-" + clusterID),
+			}
+			vms = append(vms, vm)
+		}
+		return vms
+	}
+	client.FakeListManagedDisksResult = func() []compute.Disk {
+		return []compute.Disk{
+			{Name: to.StringPtr("k8s-agentpool1-1234-datadisk0")},
+			{Name: to.StringPtr("k8s-agentpool3-1234-datadisk0")},
+		}
+	}
+
+	rpc := &removePoolCmd{
+		apiModelPath:      apiModelPath,
+		resourceGroupName: "testRG",
+		nodePoolName:      "agentpool3",
+		containerService:  cs,
+		client:            client,
+		kubeClient:        client.MockKubernetesClient,
+		nameSuffix:        clusterID,
+		logger:            log.NewEntry(log.New()),
+	}
+	if err = rpc.loadNodePool(); err != nil {
+		t.Fatalf("expected no error loading node pool agentpool3, got %s", err)
+	}
+	return rpc
+}
+
+func TestRemovePoolCmdLoadNodePool(t *testing.T) {
+	rpc := newMockRemovePoolCmd(t)
+	if rpc.nodePoolIndex != 1 || rpc.nodePool.Name != "agentpool3" {
+		t.Fatalf("expected node pool agentpool3 at index 1, got %s at index %d", rpc.nodePool.Name, rpc.nodePoolIndex)
+	}
+
+	rpc.nodePoolName = "agentpool2"
+	err := rpc.loadNodePool()
+	if err == nil || err.Error() != "node pool agentpool2 was not found in the api model" {
+		t.Fatalf("expected an error loading a missing node pool, got %v", err)
+	}
+
+	rpc.nodePoolName = "agentpool1"
+	rpc.containerService.Properties.AgentPoolProfiles = rpc.containerService.Properties.AgentPoolProfiles[:1]
+	err = rpc.loadNodePool()
+	if err == nil || err.Error() != "node pool agentpool1 is the only node pool of the cluster and cannot be removed" {
+		t.Fatalf("expected an error removing the only node pool, got %v", err)
+	}
+}
+
+func TestRemovePoolCmdLoadNodePoolVMSSName(t *testing.T) {
+	rpc := newMockRemovePoolCmd(t)
+	rpc.nodePool.AvailabilityProfile = api.VirtualMachineScaleSets
+	if err := rpc.loadNodePool(); err != nil {
+		t.Fatalf("expected no error loading VMSS node pool agentpool3, got %s", err)
+	}
+	expectedVMSSName := "k8s-agentpool3-" + rpc.nameSuffix + "-vmss"
+	if rpc.nodePool.VMSSName != expectedVMSSName {
+		t.Fatalf("expected the VMSS name of a node pool without one to be %s, got %s", expectedVMSSName, rpc.nodePool.VMSSName)
+	}
+}
+
+func TestRemovePoolCmdRemovePoolBeforeWindowsPool(t *testing.T) {
+	rpc := newMockRemovePoolCmd(t)
+	windowsPool := rpc.containerService.Properties.AgentPoolProfiles[1]
+	windowsPool.OSType = api.Windows
+	rpc.nodePoolName = "agentpool1"
+	err := rpc.loadNodePool()
+	expectedErr := "node pool agentpool1 cannot be removed, the VM names of Windows node pool agentpool3 placed after it depend on its position in the api model"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error %s removing a node pool placed before a Windows availability set node pool, got %v", expectedErr, err)
+	}
+
+	windowsPool.AvailabilityProfile = api.VirtualMachineScaleSets
+	if err = rpc.loadNodePool(); err != nil {
+		t.Fatalf("expected no error loading a node pool placed before a Windows VMSS node pool, got %s", err)
+	}
+	expectedVMSSName := rpc.containerService.Properties.GetAgentVMPrefix(windowsPool, 1)
+	removeNodePool(rpc.containerService.Properties, "agentpool1")
+	if len(rpc.containerService.Properties.AgentPoolProfiles) != 1 || windowsPool.VMSSName != expectedVMSSName {
+		t.Fatalf("expected the VMSS name of Windows node pool agentpool3 to be pinned to %s, got %s", expectedVMSSName, windowsPool.VMSSName)
+	}
+	if prefix := rpc.containerService.Properties.GetAgentVMPrefix(windowsPool, 0); prefix != expectedVMSSName {
+		t.Fatalf("expected the VM prefix of Windows node pool agentpool3 to stay %s after the removal, got %s", expectedVMSSName, prefix)
+	}
+}
+
+func TestRemovePoolCmdGetNodePoolVMs(t *testing.T) {
+	rpc := newMockRemovePoolCmd(t)
+	vms, err := rpc.getNodePoolVMs(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error listing the node pool VMs, got %s", err)
+	}
+	if len(vms) != 1 || vms[0] != "k8s-agentpool3-1234" {
+		t.Fatalf("expected node pool VMs [k8s-agentpool3-1234], got %v", vms)
+	}
+	nodes, err := rpc.getNodePoolNodes(vms)
+	if err != nil {
+		t.Fatalf("expected no error listing the node pool nodes, got %s", err)
+	}
+	if len(nodes) != 1 || nodes[0].Name != "k8s-agentpool3-1234" {
+		t.Fatalf("expected node k8s-agentpool3-1234, got %v", nodes)
+	}
+	expectedAvailabilitySet := "agentpool3-availabilitySet-" + rpc.nameSuffix
+	if len(rpc.availabilitySets) != 1 || rpc.availabilitySets[0] != expectedAvailabilitySet {
+		t.Fatalf("expected the availability sets of the node pool VMs to be [%s], got %v", expectedAvailabilitySet, rpc.availabilitySets)
+	}
+
+	rpc.nodePool.AvailabilityProfile = api.VirtualMachineScaleSets
+	rpc.nodePool.VMSSName = "k8s-agentpool3-12345678-vmss"
+	client := rpc.client.(*armhelpers.MockAKSEngineClient)
+	client.FakeListVirtualMachineScaleSetVMsResult = func() []compute.VirtualMachineScaleSetVM {
+		return []compute.VirtualMachineScaleSetVM{
+			client.MakeFakeVirtualMachineScaleSetVMWithGivenName("Kubernetes:1.18.8", "k8s-agentpool3-12345678-vmss000000"),
+		}
+	}
+	vms, err = rpc.getNodePoolVMs(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error listing the node pool VMSS instances, got %s", err)
+	}
+	if len(vms) != 1 || vms[0] != "k8s-agentpool3-12345678-vmss000000" {
+		t.Fatalf("expected node pool VMSS instances [k8s-agentpool3-12345678-vmss000000], got %v", vms)
+	}
+}
+
+func TestRemovePoolCmdRemovePool(t *testing.T) {
+	rpc := newMockRemovePoolCmd(t)
+	if err := rpc.removePool(); err != nil {
+		t.Fatalf("expected no error removing node pool agentpool3, got %s", err)
+	}
+
+	apiloader := &api.Apiloader{}
+	cs, _, err := apiloader.LoadContainerServiceFromFile(rpc.apiModelPath, false, true, nil)
+	if err != nil {
+		t.Fatalf("failed to load the saved api model: %s", err)
+	}
+	if len(cs.Properties.AgentPoolProfiles) != 1 || cs.Properties.AgentPoolProfiles[0].Name != "agentpool1" {
+		t.Fatalf("expected the saved api model to only have node pool agentpool1")
+	}
+	addon := cs.Properties.OrchestratorProfile.KubernetesConfig.GetAddonByName(common.ClusterAutoscalerAddonName)
+	if len(addon.Pools) != 1 || addon.Pools[0].Name != "agentpool1" {
+		t.Fatalf("expected the cluster-autoscaler addon to only configure node pool agentpool1, got %v", addon.Pools)
+	}
+}
+
+func TestRemovePoolCmdRemovePoolErrors(t *testing.T) {
+	rpc := newMockRemovePoolCmd(t)
+	rpc.kubeClient.(*armhelpers.MockKubernetesClient).FailListNodes = true
+	if err := rpc.removePool(); err == nil {
+		t.Fatalf("expected an error when the nodes can't be listed")
+	}
+
+	rpc = newMockRemovePoolCmd(t)
+	rpc.client.(*armhelpers.MockAKSEngineClient).FailDeleteAvailabilitySet = true
+	if err := rpc.removePool(); err == nil {
+		t.Fatalf("expected an error when the availability set can't be deleted")
+	}
+
+	rpc = newMockRemovePoolCmd(t)
+	rpc.kubeClient.(*armhelpers.MockKubernetesClient).FailDeleteNode = true
+	if err := rpc.removePool(); err == nil {
+		t.Fatalf("expected an error when the node can't be deleted")
+	}
+
+	rpc = newMockRemovePoolCmd(t)
+	rpc.nodePool.AvailabilityProfile = api.VirtualMachineScaleSets
+	rpc.nodePool.VMSSName = "k8s-agentpool3-12345678-vmss"
+	rpc.client.(*armhelpers.MockAKSEngineClient).FailDeleteVirtualMachineScaleSet = true
+	if err := rpc.removePool(); err == nil {
+		t.Fatalf("expected an error when the VMSS can't be deleted")
+	}
+}
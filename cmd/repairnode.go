@@ -0,0 +1,217 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/Azure/aks-engine-azurestack/pkg/api"
+	"github.com/Azure/aks-engine-azurestack/pkg/armhelpers"
+	"github.com/Azure/aks-engine-azurestack/pkg/engine"
+	"github.com/Azure/aks-engine-azurestack/pkg/helpers"
+	"github.com/Azure/aks-engine-azurestack/pkg/i18n"
+	"github.com/Azure/aks-engine-azurestack/pkg/operations/kubernetesupgrade"
+	"github.com/leonelquinteros/gotext"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	repairNodeName             = "repair-node"
+	repairNodeShortDescription = "Replace a broken node of an existing AKS Engine-created Kubernetes cluster"
+	repairNodeLongDescription  = "Replace a broken node of an existing AKS Engine-created Kubernetes cluster by cordoning and draining it, deleting its VM and recreating the VM at the same index from the api model"
+)
+
+type repairNodeCmd struct {
+	authArgs
+
+	// user input
+	apiModelPath                string
+	resourceGroupName           string
+	location                    string
+	nodeName                    string
+	timeoutInMinutes            int
+	cordonDrainTimeoutInMinutes int
+
+	// derived
+	containerService   *api.ContainerService
+	apiVersion         string
+	client             armhelpers.AKSEngineClient
+	locale             *gotext.Locale
+	timeout            *time.Duration
+	cordonDrainTimeout *time.Duration
+}
+
+// newRepairNodeCmd run a command to replace a single node of a Kubernetes cluster
+func newRepairNodeCmd() *cobra.Command {
+	rnc := repairNodeCmd{}
+
+	repairNodeCmd := &cobra.Command{
+		Use:   repairNodeName,
+		Short: repairNodeShortDescription,
+		Long:  repairNodeLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return rnc.run(cmd, args)
+		},
+	}
+
+	f := repairNodeCmd.Flags()
+	f.StringVarP(&rnc.location, "location", "l", "", "location the cluster is deployed in (required)")
+	f.StringVarP(&rnc.resourceGroupName, "resource-group", "g", "", "the resource group where the cluster is deployed (required)")
+	f.StringVarP(&rnc.apiModelPath, "api-model", "m", "", "path to the generated apimodel.json file (required)")
+	f.StringVar(&rnc.nodeName, "node", "", "name of the node to repair (required)")
+	f.IntVar(&rnc.timeoutInMinutes, "vm-timeout", -1, "how long to wait for the new vm to be ready in minutes")
+	f.IntVar(&rnc.cordonDrainTimeoutInMinutes, "cordon-drain-timeout", -1, "how long to wait for the node to be cordoned in minutes")
+
+	addAuthFlags(&rnc.authArgs, f)
+
+	return repairNodeCmd
+}
+
+func (rnc *repairNodeCmd) validate(cmd *cobra.Command) error {
+	log.Debugln("validating repair-node command line arguments...")
+	var err error
+
+	rnc.locale, err = i18n.LoadTranslations()
+	if err != nil {
+		return errors.Wrap(err, "error loading translation files")
+	}
+
+	if rnc.resourceGroupName == "" {
+		_ = cmd.Usage()
+		return errors.New("--resource-group must be specified")
+	}
+
+	if rnc.location == "" {
+		_ = cmd.Usage()
+		return errors.New("--location must be specified")
+	}
+
+	rnc.location = helpers.NormalizeAzureRegion(rnc.location)
+
+	if rnc.apiModelPath == "" {
+		_ = cmd.Usage()
+		return errors.New("--api-model must be specified")
+	}
+
+	if rnc.nodeName == "" {
+		_ = cmd.Usage()
+		return errors.New("--node must be specified")
+	}
+
+	if rnc.timeoutInMinutes != -1 {
+		timeout := time.Duration(rnc.timeoutInMinutes) * time.Minute
+		rnc.timeout = &timeout
+	}
+
+	if rnc.cordonDrainTimeoutInMinutes != -1 {
+		cordonDrainTimeout := time.Duration(rnc.cordonDrainTimeoutInMinutes) * time.Minute
+		rnc.cordonDrainTimeout = &cordonDrainTimeout
+	}
+	return nil
+}
+
+func (rnc *repairNodeCmd) load() error {
+	var err error
+
+	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+	defer cancel()
+
+	if _, err = os.Stat(rnc.apiModelPath); os.IsNotExist(err) {
+		return errors.Errorf("specified api model does not exist (%s)", rnc.apiModelPath)
+	}
+
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{
+			Locale: rnc.locale,
+		},
+	}
+	rnc.containerService, rnc.apiVersion, err = apiloader.LoadContainerServiceFromFile(rnc.apiModelPath, true, true, nil)
+	if err != nil {
+		return errors.Wrap(err, "error parsing the api model")
+	}
+
+	if rnc.containerService.Properties.MasterProfile != nil && rnc.containerService.Properties.MasterProfile.AvailabilityProfile == api.VirtualMachineScaleSets {
+		return errors.Errorf("clusters with a VMSS control plane are not supported by `aks-engine-azurestack repair-node`")
+	}
+
+	if rnc.containerService.Location == "" {
+		rnc.containerService.Location = rnc.location
+	} else if rnc.containerService.Location != rnc.location {
+		return errors.New("--location does not match api model location")
+	}
+
+	// Set 60 minutes cordonDrainTimeout for Azure Stack Cloud to give it enough time to move around resources during Node Drain,
+	// especially disk detach/attach operations. We still honor the user's input.
+	if rnc.cordonDrainTimeout == nil && rnc.containerService.Properties.IsAzureStackCloud() {
+		cordonDrainTimeout := time.Duration(60) * time.Minute
+		rnc.cordonDrainTimeout = &cordonDrainTimeout
+	}
+
+	if rnc.containerService.Properties.IsCustomCloudProfile() {
+		if err = writeCustomCloudProfile(rnc.containerService); err != nil {
+			return errors.Wrap(err, "error writing custom cloud profile")
+		}
+		if err = rnc.containerService.Properties.SetCustomCloudSpec(api.AzureCustomCloudSpecParams{IsUpgrade: true, IsScale: false}); err != nil {
+			return errors.Wrap(err, "error parsing the api model")
+		}
+	}
+
+	if err = rnc.authArgs.validateAuthArgs(); err != nil {
+		return err
+	}
+
+	if rnc.client, err = rnc.authArgs.getClient(); err != nil {
+		return errors.Wrap(err, "failed to get client")
+	}
+
+	if _, err = rnc.client.EnsureResourceGroup(ctx, rnc.resourceGroupName, rnc.location, nil); err != nil {
+		return errors.Wrap(err, "error ensuring resource group")
+	}
+
+	// the control plane nodes are provisioned with the CA private key
+	if err = loadKeyvaultCa(ctx, rnc.client, rnc.containerService.Properties.CertificateProfile); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (rnc *repairNodeCmd) run(cmd *cobra.Command, args []string) error {
+	if err := rnc.validate(cmd); err != nil {
+		return errors.Wrap(err, "failed to validate repair-node command")
+	}
+	if err := rnc.load(); err != nil {
+		return errors.Wrap(err, "failed to load existing container service")
+	}
+	return rnc.repairNode()
+}
+
+func (rnc *repairNodeCmd) repairNode() error {
+	kubeConfig, err := engine.GenerateKubeConfig(rnc.containerService.Properties, rnc.location)
+	if err != nil {
+		return errors.Wrap(err, "generating kubeconfig")
+	}
+
+	upgrader := &kubernetesupgrade.Upgrader{}
+	clusterTopology := kubernetesupgrade.ClusterTopology{
+		DataModel:      rnc.containerService,
+		SubscriptionID: rnc.SubscriptionID.String(),
+		Location:       rnc.location,
+		ResourceGroup:  rnc.resourceGroupName,
+		NameSuffix:     rnc.containerService.Properties.GetClusterID(),
+	}
+	translator := &i18n.Translator{
+		Locale: rnc.locale,
+	}
+	upgrader.Init(translator, log.NewEntry(log.New()), clusterTopology, rnc.client, kubeConfig, rnc.timeout, rnc.cordonDrainTimeout, BuildTag, false)
+
+	log.Infof("Repairing node %s", rnc.nodeName)
+	if err = upgrader.RepairNode(context.Background(), rnc.nodeName); err != nil {
+		return errors.Wrapf(err, "repairing node %s", rnc.nodeName)
+	}
+	return nil
+}
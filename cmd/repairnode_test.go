@@ -0,0 +1,159 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/Azure/aks-engine-azurestack/pkg/api"
+	"github.com/Azure/aks-engine-azurestack/pkg/armhelpers"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func TestNewRepairNodeCmd(t *testing.T) {
+	command := newRepairNodeCmd()
+	if command.Use != repairNodeName || command.Short != repairNodeShortDescription || command.Long != repairNodeLongDescription {
+		t.Fatalf("repair-node command should have use %s equal %s, short %s equal %s and long %s equal to %s", command.Use, repairNodeName, command.Short, repairNodeShortDescription, command.Long, repairNodeLongDescription)
+	}
+
+	expectedFlags := []string{"location", "resource-group", "api-model", "node", "vm-timeout", "cordon-drain-timeout"}
+	for _, f := range expectedFlags {
+		if command.Flags().Lookup(f) == nil {
+			t.Fatalf("repair-node command should have flag %s", f)
+		}
+	}
+
+	command.SetArgs([]string{})
+	if err := command.Execute(); err == nil {
+		t.Fatalf("expected an error when calling repair-node with no arguments")
+	}
+}
+
+func TestRepairNodeCmdValidate(t *testing.T) {
+	r := &cobra.Command{}
+
+	cases := []struct {
+		rnc         *repairNodeCmd
+		expectedErr error
+		name        string
+	}{
+		{
+			rnc: &repairNodeCmd{
+				apiModelPath:     "./not/used",
+				nodeName:         "k8s-agentpool1-12345678-0",
+				location:         "centralus",
+				timeoutInMinutes: -1,
+			},
+			expectedErr: errors.New("--resource-group must be specified"),
+			name:        "NoResourceGroup",
+		},
+		{
+			rnc: &repairNodeCmd{
+				apiModelPath:      "./not/used",
+				nodeName:          "k8s-agentpool1-12345678-0",
+				resourceGroupName: "testRG",
+			},
+			expectedErr: errors.New("--location must be specified"),
+			name:        "NoLocation",
+		},
+		{
+			rnc: &repairNodeCmd{
+				nodeName:          "k8s-agentpool1-12345678-0",
+				location:          "centralus",
+				resourceGroupName: "testRG",
+			},
+			expectedErr: errors.New("--api-model must be specified"),
+			name:        "NoAPIModel",
+		},
+		{
+			rnc: &repairNodeCmd{
+				apiModelPath:      "./not/used",
+				location:          "centralus",
+				resourceGroupName: "testRG",
+			},
+			expectedErr: errors.New("--node must be specified"),
+			name:        "NoNode",
+		},
+		{
+			rnc: &repairNodeCmd{
+				apiModelPath:                "./not/used",
+				nodeName:                    "k8s-agentpool1-12345678-0",
+				location:                    "centralus",
+				resourceGroupName:           "testRG",
+				timeoutInMinutes:            -1,
+				cordonDrainTimeoutInMinutes: 30,
+			},
+			expectedErr: nil,
+			name:        "IsValid",
+		},
+	}
+
+	for _, tc := range cases {
+		c := tc
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			err := c.rnc.validate(r)
+			if err != nil && c.expectedErr != nil {
+				if err.Error() != c.expectedErr.Error() {
+					t.Fatalf("expected validate repair-node command to return error %s, but instead got %s", c.expectedErr.Error(), err.Error())
+				}
+			} else {
+				if c.expectedErr != nil {
+					t.Fatalf("expected validate repair-node command to return error %s, but instead got no error", c.expectedErr.Error())
+				} else if err != nil {
+					t.Fatalf("expected validate repair-node command to return no error, but instead got %s", err.Error())
+				}
+			}
+		})
+	}
+}
+
+func TestRepairNodeCmdValidateTimeouts(t *testing.T) {
+	rnc := &repairNodeCmd{
+		apiModelPath:                "./not/used",
+		nodeName:                    "k8s-agentpool1-12345678-0",
+		location:                    "centralus",
+		resourceGroupName:           "testRG",
+		timeoutInMinutes:            -1,
+		cordonDrainTimeoutInMinutes: 30,
+	}
+	if err := rnc.validate(&cobra.Command{}); err != nil {
+		t.Fatalf("expected no error validating repair-node command, got %s", err)
+	}
+	if rnc.timeout != nil {
+		t.Fatalf("expected no vm timeout when --vm-timeout is not set, got %s", rnc.timeout)
+	}
+	if rnc.cordonDrainTimeout == nil || rnc.cordonDrainTimeout.Minutes() != 30 {
+		t.Fatalf("expected a 30 minutes cordon drain timeout, got %v", rnc.cordonDrainTimeout)
+	}
+}
+
+func TestRepairNodeCmdRepairNode(t *testing.T) {
+	defer os.RemoveAll("_output")
+	cs := api.CreateMockContainerService("testcluster", "", 1, 1, false)
+	client := &armhelpers.MockAKSEngineClient{MockKubernetesClient: &armhelpers.MockKubernetesClient{}}
+	rnc := &repairNodeCmd{
+		resourceGroupName: "testRG",
+		location:          "centralus",
+		nodeName:          fmt.Sprintf("k8s-agentpool1-%s-0", cs.Properties.GetClusterID()),
+		containerService:  cs,
+		client:            client,
+	}
+	if err := rnc.repairNode(); err != nil {
+		t.Fatalf("expected no error repairing node %s, got %s", rnc.nodeName, err)
+	}
+
+	client.FailDeleteVirtualMachine = true
+	if err := rnc.repairNode(); err == nil {
+		t.Fatalf("expected an error when the VM of node %s can't be deleted", rnc.nodeName)
+	}
+
+	rnc.nodeName = "k8s-unknownpool-12345678-0"
+	if err := rnc.repairNode(); err == nil {
+		t.Fatalf("expected an error repairing a node that is not part of the cluster")
+	}
+}
@@ -4,6 +4,7 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -77,8 +78,17 @@ func NewRootCmd() *cobra.Command {
 	rootCmd.AddCommand(newUpdateCmd())
 	rootCmd.AddCommand(newRotateCertsCmd())
 	rootCmd.AddCommand(newAddPoolCmd())
+	rootCmd.AddCommand(newPlanCmd())
+	rootCmd.AddCommand(newEtcdCmd())
+	rootCmd.AddCommand(newGetCertsCmd())
 	rootCmd.AddCommand(newGetLocationsCmd())
 	rootCmd.AddCommand(newGetSkusCmd())
+	rootCmd.AddCommand(newRedactAPIModelCmd())
+	rootCmd.AddCommand(newStatusCmd())
+	rootCmd.AddCommand(newOrphansCmd())
+	rootCmd.AddCommand(newRemovePoolCmd())
+	rootCmd.AddCommand(newRepairNodeCmd())
+	rootCmd.AddCommand(newNodeCmd())
 	rootCmd.AddCommand(getCompletionCmd(rootCmd))
 
 	return rootCmd
@@ -114,22 +124,24 @@ type authArgs struct {
 	AuthMethod          string
 	rawClientID         string
 
-	ClientID        uuid.UUID
-	ClientSecret    string
-	CertificatePath string
-	PrivateKeyPath  string
-	IdentitySystem  string
-	language        string
+	ClientID           uuid.UUID
+	ClientSecret       string
+	CertificatePath    string
+	PrivateKeyPath     string
+	FederatedTokenFile string
+	IdentitySystem     string
+	language           string
 }
 
 func addAuthFlags(authArgs *authArgs, f *flag.FlagSet) {
 	f.StringVar(&authArgs.RawAzureEnvironment, "azure-env", "AzurePublicCloud", "the target Azure cloud")
 	f.StringVarP(&authArgs.rawSubscriptionID, "subscription-id", "s", "", "azure subscription id (required)")
-	f.StringVar(&authArgs.AuthMethod, "auth-method", "cli", "auth method (default:`client_secret`, `cli`, `client_certificate`, `device`)")
-	f.StringVar(&authArgs.rawClientID, "client-id", "", "client id (used with --auth-method=[client_secret|client_certificate])")
+	f.StringVar(&authArgs.AuthMethod, "auth-method", "cli", "auth method (default:`client_secret`, `cli`, `client_certificate`, `device`, `msi`, `federated-token`)")
+	f.StringVar(&authArgs.rawClientID, "client-id", "", "client id (used with --auth-method=[client_secret|client_certificate|federated-token], or user-assigned identity client id with --auth-method=msi)")
 	f.StringVar(&authArgs.ClientSecret, "client-secret", "", "client secret (used with --auth-method=client_secret)")
 	f.StringVar(&authArgs.CertificatePath, "certificate-path", "", "path to client certificate (used with --auth-method=client_certificate)")
 	f.StringVar(&authArgs.PrivateKeyPath, "private-key-path", "", "path to private key (used with --auth-method=client_certificate)")
+	f.StringVar(&authArgs.FederatedTokenFile, "federated-token-file", "", "path to a federated token file, defaults to $AZURE_FEDERATED_TOKEN_FILE (used with --auth-method=federated-token)")
 	f.StringVar(&authArgs.IdentitySystem, "identity-system", "azure_ad", "identity system (default:`azure_ad`, `adfs`)")
 	f.StringVar(&authArgs.language, "language", "en-us", "language to return error messages in")
 }
@@ -168,6 +180,32 @@ func (authArgs *authArgs) validateAuthArgs() error {
 				return errors.New(`--certificate-path and --private-key-path must be specified when --auth-method="client_certificate"`)
 			}
 		}
+	} else if authArgs.AuthMethod == "msi" {
+		// the client id of a user-assigned identity is optional
+		if authArgs.rawClientID != "" {
+			authArgs.ClientID, err = uuid.Parse(authArgs.rawClientID)
+			if err != nil {
+				return errors.Wrap(err, "parsing --client-id")
+			}
+		}
+	} else if authArgs.AuthMethod == "federated-token" {
+		// same environment variables as the workload identity webhook
+		if authArgs.rawClientID == "" {
+			authArgs.rawClientID = os.Getenv("AZURE_CLIENT_ID")
+		}
+		authArgs.ClientID, err = uuid.Parse(authArgs.rawClientID)
+		if err != nil {
+			return errors.Wrap(err, "parsing --client-id")
+		}
+		if authArgs.FederatedTokenFile == "" {
+			authArgs.FederatedTokenFile = os.Getenv("AZURE_FEDERATED_TOKEN_FILE")
+		}
+		if authArgs.FederatedTokenFile == "" {
+			return errors.New(`--federated-token-file must be specified when --auth-method="federated-token"`)
+		}
+		if _, err = os.Stat(authArgs.FederatedTokenFile); err != nil {
+			return errors.Errorf("specified --federated-token-file does not exist (%s)", authArgs.FederatedTokenFile)
+		}
 	}
 
 	authArgs.SubscriptionID, _ = uuid.Parse(authArgs.rawSubscriptionID)
@@ -226,6 +264,14 @@ func getCloudSubFromAzConfig(cloud string, f *ini.File) (uuid.UUID, error) {
 	return uuid.Parse(sub.String())
 }
 
+// managedIdentityClientID returns the client id of the user-assigned identity, empty for the system-assigned identity
+func (authArgs *authArgs) managedIdentityClientID() string {
+	if authArgs.ClientID == uuid.Nil {
+		return ""
+	}
+	return authArgs.ClientID.String()
+}
+
 func (authArgs *authArgs) getClient() (armhelpers.AKSEngineClient, error) {
 	if authArgs.isAzureStackCloud() {
 		return authArgs.getAzureStackClient()
@@ -248,6 +294,10 @@ func (authArgs *authArgs) getAzureClient() (armhelpers.AKSEngineClient, error) {
 		client, err = armhelpers.NewAzureClientWithClientSecret(env, authArgs.SubscriptionID.String(), authArgs.ClientID.String(), authArgs.ClientSecret)
 	case "client_certificate":
 		client, err = armhelpers.NewAzureClientWithClientCertificateFile(env, authArgs.SubscriptionID.String(), authArgs.ClientID.String(), authArgs.CertificatePath, authArgs.PrivateKeyPath)
+	case "msi":
+		client, err = armhelpers.NewAzureClientWithMSI(env, authArgs.SubscriptionID.String(), authArgs.managedIdentityClientID())
+	case "federated-token":
+		client, err = armhelpers.NewAzureClientWithFederatedToken(env, authArgs.SubscriptionID.String(), authArgs.ClientID.String(), authArgs.FederatedTokenFile)
 	default:
 		return nil, errors.Errorf("--auth-method: ERROR: method unsupported. method=%q", authArgs.AuthMethod)
 	}
@@ -278,6 +328,24 @@ func (authArgs *authArgs) getAzureStackClient() (armhelpers.AKSEngineClient, err
 		} else {
 			return nil, errors.Errorf("--auth-method: ERROR: method unsupported. method=%q identitysystem=%q", authArgs.AuthMethod, authArgs.IdentitySystem)
 		}
+	case "msi":
+		if authArgs.IdentitySystem == "azure_ad" {
+			client, err = azurestack.NewAzureClientWithMSI(env, authArgs.SubscriptionID.String(), authArgs.managedIdentityClientID())
+		} else if authArgs.IdentitySystem == "adfs" {
+			// for ADFS environment, it is single tenant environment and the tenant id is always adfs
+			client, err = azurestack.NewAzureClientWithMSIExternalTenant(env, authArgs.SubscriptionID.String(), "adfs", authArgs.managedIdentityClientID())
+		} else {
+			return nil, errors.Errorf("--auth-method: ERROR: method unsupported. method=%q identitysystem=%q", authArgs.AuthMethod, authArgs.IdentitySystem)
+		}
+	case "federated-token":
+		if authArgs.IdentitySystem == "azure_ad" {
+			client, err = azurestack.NewAzureClientWithFederatedToken(env, authArgs.SubscriptionID.String(), authArgs.ClientID.String(), authArgs.FederatedTokenFile)
+		} else if authArgs.IdentitySystem == "adfs" {
+			// for ADFS environment, it is single tenant environment and the tenant id is always adfs
+			client, err = azurestack.NewAzureClientWithFederatedTokenExternalTenant(env, authArgs.SubscriptionID.String(), "adfs", authArgs.ClientID.String(), authArgs.FederatedTokenFile)
+		} else {
+			return nil, errors.Errorf("--auth-method: ERROR: method unsupported. method=%q identitysystem=%q", authArgs.AuthMethod, authArgs.IdentitySystem)
+		}
 	case "client_certificate":
 		if authArgs.IdentitySystem == "azure_ad" {
 			client, err = azurestack.NewAzureClientWithClientCertificateFile(env, authArgs.SubscriptionID.String(), authArgs.ClientID.String(), authArgs.CertificatePath, authArgs.PrivateKeyPath)
@@ -377,3 +445,49 @@ func writeArtifacts(outputDirectory string, cs *api.ContainerService, apiVersion
 	w := &engine.ArtifactWriter{Translator: translator}
 	return w.WriteTLSArtifacts(cs, apiVersion, tpl, params, outputDirectory, true, false)
 }
+
+// loadKeyvaultCa retrieves the external CA referenced by the certificate profile from keyvault
+// and stores its certificate, private key and chain in the certificate profile. The reference is kept
+// as the private key is never written to the api model, it has to be retrieved by every command that needs it
+func loadKeyvaultCa(ctx context.Context, client armhelpers.AKSEngineClient, p *api.CertificateProfile) error {
+	if p == nil || p.CaKeyvaultSecretRef == nil {
+		return nil
+	}
+	ref := p.CaKeyvaultSecretRef
+	log.Infof("Retrieving the cluster certificate authority from keyvault secret %s", ref.SecretName)
+	bundle, err := client.GetKeyVaultSecret(ctx, ref.VaultID, ref.SecretName, ref.SecretVersion)
+	if err != nil {
+		return errors.Wrap(err, "retrieving the certificate authority from keyvault")
+	}
+	caPair, chain, err := helpers.SplitCaBundle(bundle)
+	if err != nil {
+		return errors.Wrapf(err, "parsing keyvault secret %s", ref.SecretName)
+	}
+	if chain != "" {
+		if err = helpers.VerifyCaChain(caPair.CertificatePem, chain); err != nil {
+			return errors.Wrapf(err, "verifying the certificate chain of keyvault secret %s", ref.SecretName)
+		}
+	}
+	p.CaCertificate = caPair.CertificatePem
+	p.CaPrivateKey = caPair.PrivateKeyPem
+	p.CaCertificateChain = chain
+	return nil
+}
+
+// writeDeploymentDiagnostics writes a JSON document describing the failure of command to diagnosticsFile,
+// including the failed deployment operations if the command failed deploying an ARM template
+func writeDeploymentDiagnostics(diagnosticsFile, command string, err error) {
+	if diagnosticsFile == "" || err == nil {
+		return
+	}
+	b, marshalErr := json.MarshalIndent(armhelpers.NewDeploymentDiagnostics(command, err), "", "  ")
+	if marshalErr != nil {
+		log.Errorf("failed to encode the failure diagnostics: %s", marshalErr)
+		return
+	}
+	if writeErr := os.WriteFile(diagnosticsFile, b, 0600); writeErr != nil {
+		log.Errorf("failed to write the failure diagnostics to %s: %s", diagnosticsFile, writeErr)
+		return
+	}
+	log.Infof("wrote the failure diagnostics to %s", diagnosticsFile)
+}
@@ -4,9 +4,12 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -49,7 +52,7 @@ func TestNewRootCmd(t *testing.T) {
 		t.Fatalf("root command should have use %s equal %s, short %s equal %s and long %s equal to %s", command.Use, rootName, command.Short, rootShortDescription, command.Long, rootLongDescription)
 	}
 	// The commands need to be listed in alphabetical order
-	expectedCommands := []*cobra.Command{newAddPoolCmd(), getCompletionCmd(command), newDeployCmd(), newGenerateCmd(), newGetLocationsCmd(), newGetLogsCmd(), newGetSkusCmd(), newGetVersionsCmd(), newOrchestratorsCmd(), newRotateCertsCmd(), newScaleCmd(), newUpdateCmd(), newUpgradeCmd(), newVersionCmd()}
+	expectedCommands := []*cobra.Command{newAddPoolCmd(), getCompletionCmd(command), newDeployCmd(), newEtcdCmd(), newGenerateCmd(), newGetCertsCmd(), newGetLocationsCmd(), newGetLogsCmd(), newGetSkusCmd(), newGetVersionsCmd(), newNodeCmd(), newOrchestratorsCmd(), newOrphansCmd(), newPlanCmd(), newRedactAPIModelCmd(), newRemovePoolCmd(), newRepairNodeCmd(), newRotateCertsCmd(), newScaleCmd(), newStatusCmd(), newUpdateCmd(), newUpgradeCmd(), newVersionCmd()}
 	rc := command.Commands()
 
 	for i, c := range expectedCommands {
@@ -299,6 +302,54 @@ func TestGetAzureStackClientWithClientSecret(t *testing.T) {
 	}
 }
 
+func TestGetAzureStackClientWithFederatedToken(t *testing.T) {
+	cs, err := prepareCustomCloudProfile()
+	if err != nil {
+		t.Fatalf("failed to prepare custom cloud profile: %v", err)
+	}
+	subscriptionID, _ := uuid.Parse("cc6b141e-6afc-4786-9bf6-e3b9a5601460")
+	tokenFile, del := makeTmpFile(t, "_federated_token")
+	defer del()
+	if err = os.WriteFile(tokenFile, []byte("federated-token\n"), 0600); err != nil {
+		t.Fatalf("failed to write federated token: %v", err)
+	}
+
+	for _, identitySystem := range []string{"azure_ad", "adfs", "fake-system"} {
+		authArgs := authArgs{
+			AuthMethod:          "federated-token",
+			IdentitySystem:      identitySystem,
+			SubscriptionID:      subscriptionID,
+			RawAzureEnvironment: "AZURESTACKCLOUD",
+			ClientID:            subscriptionID,
+			FederatedTokenFile:  tokenFile,
+		}
+		t.Run(identitySystem, func(t *testing.T) {
+			mux := getMuxForIdentitySystem(&authArgs)
+			server, err := testserver.CreateAndStart(0, mux)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer server.Stop()
+
+			mockURI := fmt.Sprintf("http://localhost:%d/", server.Port)
+			cs.Properties.CustomCloudProfile.Environment.ResourceManagerEndpoint = mockURI
+			cs.Properties.CustomCloudProfile.Environment.ActiveDirectoryEndpoint = mockURI
+			if err = writeCustomCloudProfile(cs); err != nil {
+				t.Fatalf("failed to write custom cloud profile: %v", err)
+			}
+
+			client, err := authArgs.getAzureStackClient()
+			if isValidIdentitySystem(identitySystem) {
+				if client == nil {
+					t.Fatalf("azure client was not created. error=%v", err)
+				}
+			} else if err == nil || !strings.HasPrefix(err.Error(), "--auth-method") {
+				t.Fatalf("failed to return error with invalid identity-system")
+			}
+		})
+	}
+}
+
 func TestValidateAuthArgs(t *testing.T) {
 	t.Parallel()
 	g := NewGomegaWithT(t)
@@ -398,6 +449,57 @@ func TestValidateAuthArgs(t *testing.T) {
 			},
 			expected: nil,
 		},
+		{
+			name: "ValidSystemAssignedMSIAuth",
+			authArgs: authArgs{
+				rawSubscriptionID:   validID,
+				AuthMethod:          "msi",
+				RawAzureEnvironment: "AZUREPUBLICCLOUD",
+			},
+			expected: nil,
+		},
+		{
+			name: "ValidUserAssignedMSIAuth",
+			authArgs: authArgs{
+				rawSubscriptionID:   validID,
+				rawClientID:         validID,
+				AuthMethod:          "msi",
+				RawAzureEnvironment: "AZUREPUBLICCLOUD",
+			},
+			expected: nil,
+		},
+		{
+			name: "MSIAuthExpectsValidClientID",
+			authArgs: authArgs{
+				rawSubscriptionID:   validID,
+				rawClientID:         invalidID,
+				AuthMethod:          "msi",
+				RawAzureEnvironment: "AZUREPUBLICCLOUD",
+			},
+			expected: errors.New(`parsing --client-id: invalid UUID length: 9`),
+		},
+		{
+			name: "FederatedTokenAuthExpectsExistingTokenFile",
+			authArgs: authArgs{
+				rawSubscriptionID:   validID,
+				rawClientID:         validID,
+				FederatedTokenFile:  "/a/path",
+				AuthMethod:          "federated-token",
+				RawAzureEnvironment: "AZUREPUBLICCLOUD",
+			},
+			expected: errors.New(`specified --federated-token-file does not exist (/a/path)`),
+		},
+		{
+			name: "ValidFederatedTokenAuth",
+			authArgs: authArgs{
+				rawSubscriptionID:   validID,
+				rawClientID:         validID,
+				FederatedTokenFile:  "../examples/kubernetes.json",
+				AuthMethod:          "federated-token",
+				RawAzureEnvironment: "AZUREPUBLICCLOUD",
+			},
+			expected: nil,
+		},
 	} {
 		test := tc
 		t.Run(test.name, func(t *testing.T) {
@@ -602,6 +704,34 @@ func TestWriteArtifacts(t *testing.T) {
 	g.Expect(err).NotTo(HaveOccurred())
 }
 
+func TestLoadKeyvaultCa(t *testing.T) {
+	t.Parallel()
+	g := NewGomegaWithT(t)
+
+	caPair, err := helpers.CreatePkiKeyCertPair(helpers.PkiKeyCertPairParams{CommonName: "ca", PkiKeySize: helpers.DefaultPkiKeySize})
+	g.Expect(err).NotTo(HaveOccurred())
+	client := &armhelpers.MockAKSEngineClient{
+		FakeGetKeyVaultSecretResult: func(secretName string) string {
+			return caPair.PrivateKeyPem + caPair.CertificatePem
+		},
+	}
+
+	g.Expect(loadKeyvaultCa(context.Background(), client, nil)).To(Succeed())
+	p := &api.CertificateProfile{CaKeyvaultSecretRef: &api.KeyvaultSecretRef{VaultID: "vaultID", SecretName: "ca"}}
+	g.Expect(loadKeyvaultCa(context.Background(), client, p)).To(Succeed())
+	g.Expect(p.CaCertificate).To(Equal(caPair.CertificatePem))
+	g.Expect(p.CaPrivateKey).To(Equal(caPair.PrivateKeyPem))
+	g.Expect(p.CaCertificateChain).To(BeEmpty())
+	g.Expect(p.CaKeyvaultSecretRef).NotTo(BeNil())
+
+	p = &api.CertificateProfile{CaKeyvaultSecretRef: &api.KeyvaultSecretRef{VaultID: "vaultID", SecretName: "ca"}}
+	client.FakeGetKeyVaultSecretResult = func(secretName string) string { return caPair.CertificatePem }
+	g.Expect(loadKeyvaultCa(context.Background(), client, p)).To(MatchError("parsing keyvault secret ca: the bundle must hold a PEM encoded certificate and private key"))
+
+	client.FailGetKeyVaultSecret = true
+	g.Expect(loadKeyvaultCa(context.Background(), client, p)).To(MatchError("retrieving the certificate authority from keyvault: GetKeyVaultSecret failed"))
+}
+
 func makeTmpDir(t *testing.T) (string, func()) {
 	tmpDir, err := os.MkdirTemp(os.TempDir(), "_tmp_dir")
 	if err != nil {
@@ -609,3 +739,34 @@ func makeTmpDir(t *testing.T) (string, func()) {
 	}
 	return tmpDir, func() { defer os.RemoveAll(tmpDir) }
 }
+
+func TestWriteDeploymentDiagnostics(t *testing.T) {
+	t.Parallel()
+	g := NewGomegaWithT(t)
+
+	outDir, del := makeTmpDir(t)
+	defer del()
+	diagnosticsFile := filepath.Join(outDir, "diagnostics.json")
+
+	// no-op without a diagnostics file or an error
+	writeDeploymentDiagnostics("", deployName, errors.New("failed"))
+	writeDeploymentDiagnostics(diagnosticsFile, deployName, nil)
+	_, err := os.Stat(diagnosticsFile)
+	g.Expect(os.IsNotExist(err)).To(BeTrue())
+
+	deploymentErr := &armhelpers.DeploymentError{
+		DeploymentName: "deployment",
+		ResourceGroup:  "rg",
+		TopError:       errors.New("DeployTemplate failed"),
+	}
+	writeDeploymentDiagnostics(diagnosticsFile, scaleName, errors.Wrap(deploymentErr, "scaling"))
+	b, err := os.ReadFile(diagnosticsFile)
+	g.Expect(err).NotTo(HaveOccurred())
+	var diagnostics armhelpers.DeploymentDiagnostics
+	g.Expect(json.Unmarshal(b, &diagnostics)).To(Succeed())
+	g.Expect(diagnostics.Command).To(Equal(scaleName))
+	g.Expect(diagnostics.DeploymentName).To(Equal("deployment"))
+	g.Expect(diagnostics.ResourceGroup).To(Equal("rg"))
+	g.Expect(diagnostics.Error).To(HavePrefix("scaling: "))
+	g.Expect(diagnostics.FailedOperations).To(BeEmpty())
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,6 +19,7 @@ import (
 	ops "github.com/Azure/aks-engine-azurestack/cmd/rotatecerts"
 	"github.com/Azure/aks-engine-azurestack/pkg/api"
 	"github.com/Azure/aks-engine-azurestack/pkg/api/common"
+	"github.com/Azure/aks-engine-azurestack/pkg/armhelpers"
 	"github.com/Azure/aks-engine-azurestack/pkg/engine"
 	"github.com/Azure/aks-engine-azurestack/pkg/helpers"
 	"github.com/Azure/aks-engine-azurestack/pkg/helpers/ssh"
@@ -57,6 +59,18 @@ const (
 	vmssSSHPort = 50001
 )
 
+// leaf certificates that can be rotated without replacing the cluster CA
+const (
+	certAPIServer  = "apiserver"
+	certKubelet    = "kubelet"
+	certKubeConfig = "kubeconfig"
+	certEtcdServer = "etcd-server"
+	certEtcdClient = "etcd-client"
+	certEtcdPeer   = "etcd-peer"
+)
+
+var rotatableCerts = []string{certAPIServer, certKubelet, certKubeConfig, certEtcdServer, certEtcdClient, certEtcdPeer}
+
 type nodeMap = map[string]*ssh.RemoteHost
 type fileMap = map[string]*ssh.RemoteFile
 
@@ -72,6 +86,8 @@ type rotateCertsCmd struct {
 	linuxSSHPrivateKeyPath string
 	outputDirectory        string
 	force                  bool
+	only                   []string
+	expiringWithin         string
 
 	// computed
 	backupDirectory   string
@@ -87,6 +103,8 @@ type rotateCertsCmd struct {
 	windowsAuthConfig *ssh.AuthConfig
 	jumpbox           *ssh.JumpBox
 	sshPort           int
+	expiringDuration  time.Duration
+	certsToRotate     []string
 }
 
 func newRotateCertsCmd() *cobra.Command {
@@ -127,6 +145,8 @@ func newRotateCertsCmd() *cobra.Command {
 
 	f.StringVarP(&rcc.newCertsPath, "certificate-profile", "", "", "path to a JSON file containing the new set of certificates")
 	f.BoolVarP(&rcc.force, "force", "", false, "force execution even if API Server is not responsive")
+	f.StringSliceVar(&rcc.only, "only", nil, fmt.Sprintf("rotate only the specified certificates using the existing CA, supported values: %s", strings.Join(rotatableCerts, ", ")))
+	f.StringVar(&rcc.expiringWithin, "expiring-within", "", "rotate only the certificates that expire within the specified duration (e.g. 30d, 720h) using the existing CA")
 
 	addAuthFlags(rcc.getAuthArgs(), f)
 
@@ -167,6 +187,21 @@ func (rcc *rotateCertsCmd) validateArgs() (err error) {
 			return errors.Errorf("specified --certificate-profile does not exist (%s)", rcc.newCertsPath)
 		}
 	}
+	if rcc.isSelective() {
+		if rcc.newCertsPath != "" {
+			return errors.New("--certificate-profile cannot be combined with --only or --expiring-within")
+		}
+		for _, c := range rcc.only {
+			if !isRotatableCert(c) {
+				return errors.Errorf("invalid --only value %s, supported values are %s", c, strings.Join(rotatableCerts, ", "))
+			}
+		}
+		if rcc.expiringWithin != "" {
+			if rcc.expiringDuration, err = parseExpiringWithin(rcc.expiringWithin); err != nil {
+				return errors.Wrapf(err, "invalid --expiring-within value %s", rcc.expiringWithin)
+			}
+		}
+	}
 	if rcc.outputDirectory == "" {
 		rcc.outputDirectory = path.Join(filepath.Dir(rcc.apiModelPath), "_rotate_certs_output")
 		if err = os.MkdirAll(rcc.outputDirectory, 0755); err != nil {
@@ -202,6 +237,11 @@ func (rcc *rotateCertsCmd) loadAPIModel() (err error) {
 	} else if rcc.cs.Location != rcc.location {
 		return errors.New("--location flag does not match api-model location")
 	}
+	if rcc.isSelective() {
+		if p := rcc.cs.Properties.CertificateProfile; p == nil || (p.CaKeyvaultSecretRef == nil && (p.CaCertificate == "" || p.CaPrivateKey == "")) {
+			return errors.New("--only and --expiring-within require the API model to contain the cluster CA certificate and private key")
+		}
+	}
 	if rcc.cs.Properties.WindowsProfile != nil && !rcc.cs.Properties.WindowsProfile.GetSSHEnabled() {
 		return errors.New("SSH not enabled on Windows nodes. SSH is required in order to rotate agent nodes certificates")
 	}
@@ -213,6 +253,11 @@ func (rcc *rotateCertsCmd) loadAPIModel() (err error) {
 		return errors.Wrap(err, "failed to get ARM client")
 	}
 	rcc.armClient = ops.NewARMClientWrapper(armClient, rotateCertsDefaultInterval, rotateCertsDefaultTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+	defer cancel()
+	if err = loadKeyvaultCa(ctx, armClient, rcc.cs.Properties.CertificateProfile); err != nil {
+		return err
+	}
 	return
 }
 
@@ -241,6 +286,16 @@ func (rcc *rotateCertsCmd) init() (err error) {
 }
 
 func (rcc *rotateCertsCmd) run() (err error) {
+	if rcc.isSelective() {
+		if rcc.certsToRotate, err = rcc.selectCerts(time.Now()); err != nil {
+			return errors.Wrap(err, "selecting certificates to rotate")
+		}
+		if len(rcc.certsToRotate) == 0 {
+			log.Infof("No certificate expires within %s, nothing to rotate", rcc.expiringWithin)
+			return os.RemoveAll(rcc.outputDirectory)
+		}
+		log.Infof("Rotating certificates: %s", strings.Join(rcc.certsToRotate, ", "))
+	}
 	if err = rcc.backupCerts(); err != nil {
 		return errors.Wrap(err, "backing up current state")
 	}
@@ -273,11 +328,17 @@ func (rcc *rotateCertsCmd) run() (err error) {
 		}
 	}
 
-	if err = rcc.rotateMasterCerts(); err != nil {
-		return errors.Wrap(err, "rotating certificates")
-	}
-	if err = rcc.rotateAgentCerts(); err != nil {
-		return errors.Wrap(err, "rotating certificates")
+	if rcc.isSelective() {
+		if err = rcc.rotateSelectedCerts(); err != nil {
+			return errors.Wrap(err, "rotating certificates")
+		}
+	} else {
+		if err = rcc.rotateMasterCerts(); err != nil {
+			return errors.Wrap(err, "rotating certificates")
+		}
+		if err = rcc.rotateAgentCerts(); err != nil {
+			return errors.Wrap(err, "rotating certificates")
+		}
 	}
 
 	if err = rcc.updateAPIModel(); err != nil {
@@ -297,7 +358,12 @@ func (rcc *rotateCertsCmd) backupCerts() error {
 }
 
 func (rcc *rotateCertsCmd) updateCertificateProfile() error {
-	if rcc.generateCerts {
+	if rcc.isSelective() {
+		log.Infoln("Generating new certificates signed by the existing CA")
+		if err := rotateLeafCerts(rcc.cs, rcc.certsToRotate); err != nil {
+			return errors.Wrap(err, "generating artifacts")
+		}
+	} else if rcc.generateCerts {
 		if err := rcc.generateTLSArtifacts(); err != nil {
 			return errors.Wrap(err, "generating artifacts")
 		}
@@ -313,13 +379,34 @@ func (rcc *rotateCertsCmd) updateCertificateProfile() error {
 
 func (rcc *rotateCertsCmd) generateTLSArtifacts() error {
 	log.Infoln("Generating new certificates")
-	rcc.cs.Properties.CertificateProfile = &api.CertificateProfile{}
+	rcc.cs.Properties.CertificateProfile = certificateSettings(rcc.cs.Properties.CertificateProfile)
 	if ok, _, err := rcc.cs.SetDefaultCerts(api.DefaultCertParams{PkiKeySize: helpers.DefaultPkiKeySize}); !ok || err != nil {
 		return errors.Wrap(err, "generating new certificates")
 	}
 	return nil
 }
 
+// certificateSettings returns a certificate profile without certificates that keeps the key algorithm and validity settings of p.
+// An external CA is kept so that the new certificates are issued by the same authority
+func certificateSettings(p *api.CertificateProfile) *api.CertificateProfile {
+	if p == nil {
+		return &api.CertificateProfile{}
+	}
+	settings := &api.CertificateProfile{
+		KeyAlgorithm:       p.KeyAlgorithm,
+		CaValidityDays:     p.CaValidityDays,
+		ServerValidityDays: p.ServerValidityDays,
+		ClientValidityDays: p.ClientValidityDays,
+	}
+	if p.HasExternalCa() {
+		settings.CaCertificate = p.CaCertificate
+		settings.CaPrivateKey = p.CaPrivateKey
+		settings.CaCertificateChain = p.CaCertificateChain
+		settings.CaKeyvaultSecretRef = p.CaKeyvaultSecretRef
+	}
+	return settings
+}
+
 // getControlPlaneNodes ...
 func (rcc *rotateCertsCmd) getControlPlaneNodes() nodeMap {
 	nodes := make(nodeMap)
@@ -385,6 +472,9 @@ func (rcc *rotateCertsCmd) distributeCerts() (err error) {
 	if e != nil {
 		return errors.Wrap(e, "collecting files to distribute")
 	}
+	if rcc.isSelective() {
+		masterCerts = filterCertFiles(masterCerts, rcc.certsToRotate)
+	}
 	for _, node := range rcc.nodes {
 		log.Debugf("Uploading certificates to node %s", node.URI)
 		if isMaster(node) {
@@ -778,3 +868,264 @@ func keys(nodes nodeMap) []string {
 	}
 	return n
 }
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (rcc *rotateCertsCmd) isSelective() bool {
+	return len(rcc.only) > 0 || rcc.expiringWithin != ""
+}
+
+// selectCerts returns the certificates listed in --only (all of them if unset),
+// if --expiring-within is set only the ones expiring before now plus that duration are returned
+func (rcc *rotateCertsCmd) selectCerts(now time.Time) ([]string, error) {
+	candidates := rotatableCerts
+	if len(rcc.only) > 0 {
+		candidates = rcc.only
+	}
+	selected := []string{}
+	for _, c := range rotatableCerts {
+		if !contains(candidates, c) {
+			continue
+		}
+		if rcc.expiringWithin != "" {
+			expiring, err := certExpiresBefore(rcc.cs.Properties.CertificateProfile, c, rcc.cs.Properties.MasterProfile.Count, now.Add(rcc.expiringDuration))
+			if err != nil {
+				return nil, err
+			}
+			if !expiring {
+				continue
+			}
+		}
+		selected = append(selected, c)
+	}
+	return selected, nil
+}
+
+// rotateSelectedCerts replaces the selected certificates and restarts the components using them,
+// nodes are not rebooted and service account tokens are not recreated as the cluster CA does not change
+func (rcc *rotateCertsCmd) rotateSelectedCerts() (err error) {
+	rcc.nodes = rcc.getControlPlaneNodes()
+	log.Info("Distributing control plane certificates")
+	if err = rcc.distributeCerts(); err != nil {
+		return errors.Wrap(err, "distributing certificates")
+	}
+	if err = rcc.backupRemote(); err != nil {
+		return err
+	}
+	components := componentsToRestart(rcc.certsToRotate)
+	steps := []func(node *ssh.RemoteHost) error{execRemoteFunc(remoteBashScript("cp_leaf_certs"))}
+	if len(components) > 0 {
+		log.Infof("Restarting control plane components: %s", strings.Join(components, ", "))
+		steps = append(steps, execRemoteFunc(remoteBashScript(fmt.Sprintf("restart_components %s", strings.Join(components, " ")))))
+	}
+	// control plane nodes are updated one at a time so etcd keeps its quorum
+	for _, node := range rcc.nodes {
+		log.Debugf("Node: %s. Step: cp_leaf_certs", node.URI)
+		if err = execStepsSequence(isMaster, node, steps...); err != nil {
+			return errors.Wrapf(err, "rotating certificates on remote host %s", node.URI)
+		}
+	}
+	log.Infoln("Deleting temporary artifacts from control plane nodes")
+	if err = rcc.cleanupRemote(); err != nil {
+		return err
+	}
+	if err = rcc.waitForNodesReady(keys(rcc.nodes)); err != nil {
+		return err
+	}
+	if err = rcc.waitForControlPlaneReadiness(); err != nil {
+		return err
+	}
+	if !contains(rcc.certsToRotate, certKubelet) {
+		return nil
+	}
+
+	rcc.nodes, err = rcc.getAgentNodes()
+	if err != nil {
+		return errors.Wrap(err, "listing cluster nodes")
+	}
+	log.Info("Distributing agent certificates")
+	if err = rcc.distributeCerts(); err != nil {
+		return errors.Wrap(err, "distributing certificates")
+	}
+	if err = rcc.backupRemote(); err != nil {
+		return err
+	}
+	log.Info("Rotating agents certificates")
+	for _, node := range rcc.nodes {
+		if err := execStepsSequence(isLinuxAgent, node, execRemoteFunc(remoteBashScript("agent_certs"))); err != nil {
+			return errors.Wrapf(err, "executing agent_certs function on remote host %s", node.URI)
+		}
+		if err := execStepsSequence(isWindowsAgent, node, execRemoteFunc(remotePowershellScript("Start-CertRotation"))); err != nil {
+			return errors.Wrapf(err, "executing Start-CertRotation function on remote host %s", node.URI)
+		}
+	}
+	log.Infoln("Deleting temporary artifacts from agent nodes")
+	if err = rcc.cleanupRemote(); err != nil {
+		return err
+	}
+	return rcc.waitForNodesReady(keys(rcc.nodes))
+}
+
+// rotateLeafCerts replaces the selected certificates with new ones signed by the CA in the certificate profile
+func rotateLeafCerts(cs *api.ContainerService, certs []string) error {
+	p := cs.Properties.CertificateProfile
+	caPair := &helpers.PkiKeyCertPair{CertificatePem: p.CaCertificate, PrivateKeyPem: p.CaPrivateKey}
+	pkiParams, err := cs.GetMasterPkiParams(caPair, helpers.DefaultPkiKeySize)
+	if err != nil {
+		return errors.Wrap(err, "computing certificate parameters")
+	}
+	for _, c := range certs {
+		var pair *helpers.PkiKeyCertPair
+		switch c {
+		case certAPIServer:
+			if pair, err = helpers.CreateAPIServerPki(pkiParams); err == nil {
+				p.APIServerCertificate, p.APIServerPrivateKey = pair.CertificatePem, pair.PrivateKeyPem
+			}
+		case certKubelet:
+			if pair, err = helpers.CreateClientPki(pkiParams); err == nil {
+				p.ClientCertificate, p.ClientPrivateKey = pair.CertificatePem, pair.PrivateKeyPem
+			}
+		case certKubeConfig:
+			if pair, err = helpers.CreateKubeConfigPki(pkiParams); err == nil {
+				p.KubeConfigCertificate, p.KubeConfigPrivateKey = pair.CertificatePem, pair.PrivateKeyPem
+			}
+		case certEtcdServer:
+			if pair, err = helpers.CreateEtcdServerPki(pkiParams); err == nil {
+				p.EtcdServerCertificate, p.EtcdServerPrivateKey = pair.CertificatePem, pair.PrivateKeyPem
+			}
+		case certEtcdClient:
+			if pair, err = helpers.CreateEtcdClientPki(pkiParams); err == nil {
+				p.EtcdClientCertificate, p.EtcdClientPrivateKey = pair.CertificatePem, pair.PrivateKeyPem
+			}
+		case certEtcdPeer:
+			var pairs []*helpers.PkiKeyCertPair
+			if pairs, err = helpers.CreateEtcdPeerPki(pkiParams); err == nil {
+				p.EtcdPeerCertificates = make([]string, len(pairs))
+				p.EtcdPeerPrivateKeys = make([]string, len(pairs))
+				for i, pair := range pairs {
+					p.EtcdPeerCertificates[i], p.EtcdPeerPrivateKeys[i] = pair.CertificatePem, pair.PrivateKeyPem
+				}
+			}
+		default:
+			err = errors.Errorf("unsupported certificate %s", c)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "generating %s certificate", c)
+		}
+	}
+	return nil
+}
+
+// certExpiresBefore returns true if the certificate (any of the etcd peer certificates) expires before deadline
+func certExpiresBefore(p *api.CertificateProfile, cert string, masterCount int, deadline time.Time) (bool, error) {
+	var pems []string
+	switch cert {
+	case certAPIServer:
+		pems = []string{p.APIServerCertificate}
+	case certKubelet:
+		pems = []string{p.ClientCertificate}
+	case certKubeConfig:
+		pems = []string{p.KubeConfigCertificate}
+	case certEtcdServer:
+		pems = []string{p.EtcdServerCertificate}
+	case certEtcdClient:
+		pems = []string{p.EtcdClientCertificate}
+	case certEtcdPeer:
+		pems = p.EtcdPeerCertificates
+		if len(pems) != masterCount {
+			return true, nil
+		}
+	}
+	for _, pem := range pems {
+		// a missing certificate has to be issued
+		if pem == "" {
+			return true, nil
+		}
+		notAfter, err := helpers.GetCertificateNotAfter(pem)
+		if err != nil {
+			return false, errors.Wrapf(err, "parsing %s certificate", cert)
+		}
+		if notAfter.Before(deadline) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// filterCertFiles returns the script plus the control plane files that hold the selected certificates
+func filterCertFiles(files fileMap, certs []string) fileMap {
+	prefixes := map[string][]string{
+		certAPIServer:  {"apiserver."},
+		certKubelet:    {"client."},
+		certKubeConfig: {"kubectlClient.", "kubeconfig"},
+		certEtcdServer: {"etcdserver."},
+		certEtcdClient: {"etcdclient."},
+		certEtcdPeer:   {"etcdpeer"},
+	}
+	filtered := fileMap{"script": files["script"]}
+	for name, file := range files {
+		for _, c := range certs {
+			for _, prefix := range prefixes[c] {
+				if strings.HasPrefix(name, prefix) {
+					filtered[name] = file
+				}
+			}
+		}
+	}
+	return filtered
+}
+
+// componentsToRestart returns the control plane components that load the selected certificates,
+// etcd goes first so the API server reconnects to a member already serving the new certificates
+func componentsToRestart(certs []string) []string {
+	uses := map[string][]string{
+		"etcd":                {certEtcdServer, certEtcdPeer},
+		"kubelet":             {certKubelet},
+		kubeAPIServer:         {certAPIServer, certKubelet, certEtcdClient},
+		kubeControllerManager: {certKubelet},
+		kubeScheduler:         {certKubelet},
+		kubeAddonManager:      {certKubelet},
+	}
+	components := []string{}
+	for _, component := range []string{"etcd", "kubelet", kubeAPIServer, kubeControllerManager, kubeScheduler, kubeAddonManager} {
+		for _, c := range uses[component] {
+			if contains(certs, c) {
+				components = append(components, component)
+				break
+			}
+		}
+	}
+	return components
+}
+
+func isRotatableCert(cert string) bool {
+	return contains(rotatableCerts, cert)
+}
+
+// parseExpiringWithin parses a duration, on top of the time.ParseDuration units it accepts a number of days (e.g. 30d)
+func parseExpiringWithin(s string) (time.Duration, error) {
+	var d time.Duration
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, errors.Errorf("invalid number of days %s", s)
+		}
+		d = time.Duration(days) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, err
+		}
+	}
+	if d <= 0 {
+		return 0, errors.New("duration must be positive")
+	}
+	return d, nil
+}
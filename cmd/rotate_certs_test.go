@@ -5,8 +5,11 @@ package cmd
 
 import (
 	"testing"
+	"time"
 
+	"github.com/Azure/aks-engine-azurestack/pkg/api"
 	"github.com/Azure/aks-engine-azurestack/pkg/armhelpers"
+	"github.com/Azure/aks-engine-azurestack/pkg/helpers/ssh"
 	"github.com/google/uuid"
 	. "github.com/onsi/gomega"
 	"github.com/pkg/errors"
@@ -140,6 +143,54 @@ func TestRotateCertsCmdValidateArgs(t *testing.T) {
 			},
 			name: "Unset generateCerts if newCertsPath is set",
 		},
+		{
+			rcc: &rotateCertsCmd{
+				apiModelPath:           existingFile,
+				linuxSSHPrivateKeyPath: existingFile,
+				sshHostURI:             "server.example.com",
+				location:               "southcentralus",
+				only:                   []string{certAPIServer, "ca"},
+			},
+			expectedErr: errors.New("invalid --only value ca, supported values are apiserver, kubelet, kubeconfig, etcd-server, etcd-client, etcd-peer"),
+			name:        "Invalid --only value",
+		},
+		{
+			rcc: &rotateCertsCmd{
+				apiModelPath:           existingFile,
+				linuxSSHPrivateKeyPath: existingFile,
+				newCertsPath:           existingFile,
+				sshHostURI:             "server.example.com",
+				location:               "southcentralus",
+				only:                   []string{certAPIServer},
+			},
+			expectedErr: errors.New("--certificate-profile cannot be combined with --only or --expiring-within"),
+			name:        "Selective rotation with new certs profile",
+		},
+		{
+			rcc: &rotateCertsCmd{
+				apiModelPath:           existingFile,
+				linuxSSHPrivateKeyPath: existingFile,
+				sshHostURI:             "server.example.com",
+				location:               "southcentralus",
+				expiringWithin:         "a month",
+			},
+			expectedErr: errors.New("invalid --expiring-within value a month: time: invalid duration \"a month\""),
+			name:        "Invalid --expiring-within value",
+		},
+		{
+			rcc: &rotateCertsCmd{
+				apiModelPath:           existingFile,
+				linuxSSHPrivateKeyPath: existingFile,
+				sshHostURI:             "server.example.com",
+				location:               "southcentralus",
+				expiringWithin:         "30d",
+			},
+			expectedErr: nil,
+			assert: func(rcc *rotateCertsCmd) {
+				g.Expect(rcc.expiringDuration).To(Equal(30 * 24 * time.Hour))
+			},
+			name: "Valid --expiring-within value",
+		},
 	}
 	for _, tc := range cases {
 		c := tc
@@ -175,3 +226,151 @@ func TestRotateCertsCmdValidateArgs(t *testing.T) {
 		})
 	}
 }
+
+func TestRotateCertsSelectCerts(t *testing.T) {
+	t.Parallel()
+	g := NewGomegaWithT(t)
+
+	cs := api.CreateMockContainerService("testcluster", "", 1, 1, false)
+	cs.Properties.MasterProfile.FirstConsecutiveStaticIP = "10.239.255.239"
+	_, _, err := cs.SetDefaultCerts(api.DefaultCertParams{PkiKeySize: 2048})
+	g.Expect(err).NotTo(HaveOccurred())
+	now := time.Now()
+
+	rcc := &rotateCertsCmd{cs: cs, only: []string{certEtcdPeer, certAPIServer}}
+	g.Expect(rcc.selectCerts(now)).To(Equal([]string{certAPIServer, certEtcdPeer}))
+
+	rcc = &rotateCertsCmd{cs: cs, expiringWithin: "30d", expiringDuration: 30 * 24 * time.Hour}
+	g.Expect(rcc.selectCerts(now)).To(BeEmpty())
+
+	// certificates are valid for 30 years
+	rcc = &rotateCertsCmd{cs: cs, expiringWithin: "31y", expiringDuration: 31 * 365 * 24 * time.Hour}
+	g.Expect(rcc.selectCerts(now)).To(Equal(rotatableCerts))
+
+	rcc.only = []string{certKubelet}
+	g.Expect(rcc.selectCerts(now)).To(Equal([]string{certKubelet}))
+
+	cs.Properties.CertificateProfile.EtcdServerCertificate = "invalid"
+	rcc = &rotateCertsCmd{cs: cs, expiringWithin: "30d", expiringDuration: 30 * 24 * time.Hour}
+	_, err = rcc.selectCerts(now)
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestRotateLeafCerts(t *testing.T) {
+	t.Parallel()
+	g := NewGomegaWithT(t)
+
+	cs := api.CreateMockContainerService("testcluster", "", 3, 1, false)
+	cs.Properties.MasterProfile.FirstConsecutiveStaticIP = "10.239.255.239"
+	_, _, err := cs.SetDefaultCerts(api.DefaultCertParams{PkiKeySize: 2048})
+	g.Expect(err).NotTo(HaveOccurred())
+	before := *cs.Properties.CertificateProfile
+
+	g.Expect(rotateLeafCerts(cs, []string{certAPIServer, certEtcdPeer})).To(Succeed())
+	after := cs.Properties.CertificateProfile
+	g.Expect(after.CaCertificate).To(Equal(before.CaCertificate))
+	g.Expect(after.CaPrivateKey).To(Equal(before.CaPrivateKey))
+	g.Expect(after.ClientCertificate).To(Equal(before.ClientCertificate))
+	g.Expect(after.EtcdServerCertificate).To(Equal(before.EtcdServerCertificate))
+	g.Expect(after.APIServerCertificate).NotTo(Equal(before.APIServerCertificate))
+	g.Expect(after.APIServerPrivateKey).NotTo(Equal(before.APIServerPrivateKey))
+	g.Expect(after.EtcdPeerCertificates).To(HaveLen(3))
+	for i := range after.EtcdPeerCertificates {
+		g.Expect(after.EtcdPeerCertificates[i]).NotTo(Equal(before.EtcdPeerCertificates[i]))
+	}
+
+	cs.Properties.CertificateProfile.CaPrivateKey = "invalid"
+	g.Expect(rotateLeafCerts(cs, []string{certKubelet})).To(HaveOccurred())
+}
+
+func TestCertificateSettings(t *testing.T) {
+	t.Parallel()
+	g := NewGomegaWithT(t)
+
+	g.Expect(certificateSettings(nil)).To(Equal(&api.CertificateProfile{}))
+	p := &api.CertificateProfile{
+		CaCertificate:      "ca",
+		CaPrivateKey:       "key",
+		KeyAlgorithm:       "ECDSA",
+		CaValidityDays:     3650,
+		ServerValidityDays: 365,
+		ClientValidityDays: 90,
+	}
+	g.Expect(certificateSettings(p)).To(Equal(&api.CertificateProfile{
+		KeyAlgorithm:       "ECDSA",
+		CaValidityDays:     3650,
+		ServerValidityDays: 365,
+		ClientValidityDays: 90,
+	}))
+
+	p.CaCertificateChain = "chain"
+	g.Expect(certificateSettings(p)).To(Equal(&api.CertificateProfile{
+		CaCertificate:      "ca",
+		CaPrivateKey:       "key",
+		CaCertificateChain: "chain",
+		KeyAlgorithm:       "ECDSA",
+		CaValidityDays:     3650,
+		ServerValidityDays: 365,
+		ClientValidityDays: 90,
+	}))
+}
+
+func TestFilterCertFiles(t *testing.T) {
+	t.Parallel()
+	g := NewGomegaWithT(t)
+
+	files := fileMap{}
+	for _, name := range []string{"apiserver.crt", "apiserver.key", "ca.crt", "ca.key", "client.crt", "client.key", "etcdclient.crt", "etcdserver.key", "etcdpeer0.crt", "etcdpeer1.key", "kubectlClient.crt", "kubeconfig", "script"} {
+		files[name] = &ssh.RemoteFile{Path: name}
+	}
+
+	filtered := filterCertFiles(files, []string{certAPIServer, certEtcdPeer})
+	g.Expect(filtered).To(HaveLen(5))
+	for _, name := range []string{"apiserver.crt", "apiserver.key", "etcdpeer0.crt", "etcdpeer1.key", "script"} {
+		g.Expect(filtered).To(HaveKey(name))
+	}
+
+	filtered = filterCertFiles(files, []string{certKubelet, certKubeConfig})
+	g.Expect(filtered).To(HaveLen(5))
+	for _, name := range []string{"client.crt", "client.key", "kubectlClient.crt", "kubeconfig", "script"} {
+		g.Expect(filtered).To(HaveKey(name))
+	}
+}
+
+func TestComponentsToRestart(t *testing.T) {
+	t.Parallel()
+	g := NewGomegaWithT(t)
+
+	g.Expect(componentsToRestart([]string{certKubeConfig})).To(BeEmpty())
+	g.Expect(componentsToRestart([]string{certAPIServer})).To(Equal([]string{kubeAPIServer}))
+	g.Expect(componentsToRestart([]string{certEtcdClient, certEtcdPeer, certEtcdServer})).To(Equal([]string{"etcd", kubeAPIServer}))
+	g.Expect(componentsToRestart([]string{certKubelet})).To(Equal([]string{"kubelet", kubeAPIServer, kubeControllerManager, kubeScheduler, kubeAddonManager}))
+}
+
+func TestParseExpiringWithin(t *testing.T) {
+	t.Parallel()
+	g := NewGomegaWithT(t)
+
+	cases := []struct {
+		input       string
+		expected    time.Duration
+		expectedErr string
+	}{
+		{input: "30d", expected: 30 * 24 * time.Hour},
+		{input: "720h", expected: 720 * time.Hour},
+		{input: "1.5h", expected: 90 * time.Minute},
+		{input: "xd", expectedErr: "invalid number of days xd"},
+		{input: "0d", expectedErr: "duration must be positive"},
+		{input: "-1h", expectedErr: "duration must be positive"},
+		{input: "soon", expectedErr: `time: invalid duration "soon"`},
+	}
+	for _, c := range cases {
+		d, err := parseExpiringWithin(c.input)
+		if c.expectedErr != "" {
+			g.Expect(err).To(MatchError(c.expectedErr))
+		} else {
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(d).To(Equal(c.expected))
+		}
+	}
+}
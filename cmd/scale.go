@@ -11,6 +11,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -43,6 +44,9 @@ type scaleCmd struct {
 	location             string
 	agentPoolToScale     string
 	masterFQDN           string
+	diagnosticsFile      string
+	nodesToRemove        []string
+	preferUnhealthy      bool
 
 	// lib input
 	updateVMSSModel bool
@@ -71,6 +75,11 @@ const (
 	apiModelFilename      = "apimodel.json"
 )
 
+const (
+	scaleDrainInterval = 1 * time.Second
+	scaleDrainTimeout  = 60 * time.Minute
+)
+
 // NewScaleCmd run a command to upgrade a Kubernetes cluster
 func newScaleCmd() *cobra.Command {
 	sc := scaleCmd{
@@ -84,7 +93,11 @@ func newScaleCmd() *cobra.Command {
 		Use:   scaleName,
 		Short: scaleShortDescription,
 		Long:  scaleLongDescription,
-		RunE:  sc.run,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := sc.run(cmd, args)
+			writeDeploymentDiagnostics(sc.diagnosticsFile, scaleName, err)
+			return err
+		},
 	}
 
 	f := scaleCmd.Flags()
@@ -96,6 +109,9 @@ func newScaleCmd() *cobra.Command {
 	f.StringVar(&sc.agentPoolToScale, "node-pool", "", "node pool to scale")
 	f.StringVar(&sc.masterFQDN, "master-FQDN", "", "FQDN for the master load balancer that maps to the apiserver endpoint")
 	f.StringVar(&sc.masterFQDN, "apiserver", "", "apiserver endpoint (required to cordon and drain nodes)")
+	f.StringSliceVar(&sc.nodesToRemove, "remove-nodes", []string{}, "comma-separated list of the nodes to cordon, drain and remove from the node pool, the new node count is derived from it if --new-node-count is missing")
+	f.BoolVar(&sc.preferUnhealthy, "prefer-unhealthy", false, "when scaling down, remove the NotReady and cordoned nodes before the healthy ones")
+	f.StringVar(&sc.diagnosticsFile, "diagnostics-file", "", "path to a file to write a JSON document describing the failure to, including the failed deployment operations and the decoded CSE exit codes")
 
 	_ = f.MarkDeprecated("deployment-dir", "--deployment-dir is no longer required for scale or upgrade. Please use --api-model.")
 	_ = f.MarkDeprecated("master-FQDN", "--apiserver is preferred")
@@ -126,11 +142,16 @@ func (sc *scaleCmd) validate(cmd *cobra.Command) error {
 
 	sc.location = helpers.NormalizeAzureRegion(sc.location)
 
-	if sc.newDesiredAgentCount == 0 {
+	if sc.newDesiredAgentCount == 0 && len(sc.nodesToRemove) == 0 {
 		_ = cmd.Usage()
 		return errors.New("--new-node-count must be specified")
 	}
 
+	if len(sc.nodesToRemove) > 0 && sc.preferUnhealthy {
+		_ = cmd.Usage()
+		return errors.New("--remove-nodes and --prefer-unhealthy are mutually exclusive")
+	}
+
 	if sc.apiModelPath == "" && sc.deploymentDirectory == "" {
 		_ = cmd.Usage()
 		return errors.New("--api-model must be specified")
@@ -272,8 +293,7 @@ func (sc *scaleCmd) run(cmd *cobra.Command, args []string) error {
 
 	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
 	defer cancel()
-	orchestratorInfo := sc.containerService.Properties.OrchestratorProfile
-	var currentNodeCount, highestUsedIndex, index, winPoolIndex int
+	var currentNodeCount, highestUsedIndex, winPoolIndex int
 	winPoolIndex = -1
 	indexes := make([]int, 0)
 	indexToVM := make(map[int]string)
@@ -287,44 +307,15 @@ func (sc *scaleCmd) run(cmd *cobra.Command, args []string) error {
 	}
 
 	if sc.agentPool.IsAvailabilitySets() {
-		for i := 0; i < 10; i++ {
-			for vmsListPage, err := sc.client.ListVirtualMachines(ctx, sc.resourceGroupName); vmsListPage.NotDone(); err = vmsListPage.Next() {
-				if err != nil {
-					return errors.Wrap(err, "failed to get VMs in the resource group")
-				} else if len(vmsListPage.Values()) < 1 {
-					return errors.New("The provided resource group does not contain any VMs")
-				}
-				for _, vm := range vmsListPage.Values() {
-					vmName := *vm.Name
-					if !sc.vmInVMASAgentPool(vmName, vm.Tags) {
-						continue
-					}
-
-					if sc.agentPool.OSType == api.Windows {
-						_, _, winPoolIndex, index, err = utils.WindowsVMNameParts(vmName)
-					} else {
-						_, _, index, err = utils.K8sLinuxVMNameParts(vmName)
-					}
-					if err != nil {
-						return err
-					}
-
-					indexToVM[index] = vmName
-					indexes = append(indexes, index)
-				}
-			}
-			// If we get zero VMs that match our api model pool name, then
-			// Retry every 30 seconds for up to 5 minutes to accommodate temporary issues connecting to the VM API
-			if len(indexes) > 0 {
-				break
-			}
-			log.Warnf("Found no VMs in resource group %s that match pool name %s\n", sc.resourceGroupName, sc.agentPool.Name)
-			time.Sleep(30 * time.Second)
+		var err error
+		indexes, indexToVM, winPoolIndex, err = sc.getVMASAgentPoolVMs(ctx)
+		if err != nil {
+			return err
 		}
-		sortedIndexes := sort.IntSlice(indexes)
-		sortedIndexes.Sort()
-		indexes = sortedIndexes
 		currentNodeCount = len(indexes)
+		if err = sc.deriveNewNodeCount(currentNodeCount); err != nil {
+			return err
+		}
 
 		if currentNodeCount == sc.newDesiredAgentCount {
 			sc.printScaleTargetEqualsExisting(currentNodeCount)
@@ -363,16 +354,15 @@ func (sc *scaleCmd) run(cmd *cobra.Command, args []string) error {
 				}
 			}
 
-			vmsToDelete := make([]string, 0)
-			for i := currentNodeCount - 1; i >= sc.newDesiredAgentCount; i-- {
-				index = indexes[i]
-				vmsToDelete = append(vmsToDelete, indexToVM[index])
+			vmsToDelete, err := sc.selectNodesToRemove(vmasRemovalCandidates(indexes, indexToVM), currentNodeCount-sc.newDesiredAgentCount)
+			if err != nil {
+				return err
 			}
 
 			for _, node := range vmsToDelete {
 				sc.logger.Infof("Node %s will be cordoned and drained\n", node)
 			}
-			err := sc.drainNodes(vmsToDelete)
+			err = sc.drainNodes(vmsToDelete)
 			if err != nil {
 				return errors.Wrap(err, "Got error while draining the nodes to be deleted")
 			}
@@ -426,11 +416,14 @@ func (sc *scaleCmd) run(cmd *cobra.Command, args []string) error {
 
 				if vmss.Sku != nil {
 					currentNodeCount = int(*vmss.Sku.Capacity)
+					if err = sc.deriveNewNodeCount(currentNodeCount); err != nil {
+						return err
+					}
 					if int(*vmss.Sku.Capacity) == sc.newDesiredAgentCount && !sc.updateVMSSModel {
 						sc.printScaleTargetEqualsExisting(currentNodeCount)
 						return nil
 					} else if int(*vmss.Sku.Capacity) > sc.newDesiredAgentCount {
-						log.Warnf("VMSS scale down is an alpha feature: VMSS VM nodes will not be cordoned and drained before scaling down!")
+						return sc.scaleDownVMSS(cmd, vmssName, currentNodeCount)
 					}
 				} else {
 					// Fall back to comparing against the known count value in the api model
@@ -447,6 +440,102 @@ func (sc *scaleCmd) run(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	// Our templates generate a range of nodes based on a count and offset, it is possible for there to be holes in the template
+	// So we need to set the count in the template to get enough nodes for the range, if there are holes that number will be larger than the desired count
+	countForTemplate := sc.newDesiredAgentCount
+	if highestUsedIndex != 0 {
+		countForTemplate += highestUsedIndex + 1 - currentNodeCount
+	}
+	templateJSON, parametersJSON, err := sc.generateTemplate(countForTemplate, highestUsedIndex, winPoolIndex)
+	if err != nil {
+		return err
+	}
+
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	deploymentSuffix := random.Int31()
+
+	if sc.nodes != nil {
+		sc.logger.Infof("Nodes in pool '%s' before scaling:\n", sc.agentPoolToScale)
+		operations.PrintNodes(sc.nodes)
+	}
+	err = armhelpers.DeployTemplateSyncWithContext(
+		ctx,
+		sc.client,
+		sc.logger,
+		sc.resourceGroupName,
+		fmt.Sprintf("%s-%d", sc.resourceGroupName, deploymentSuffix),
+		templateJSON,
+		parametersJSON)
+	if err != nil {
+		return err
+	}
+	if sc.nodes != nil {
+		nodes, err := operations.GetNodes(sc.client, sc.logger, sc.apiserverURL, sc.kubeconfig, time.Duration(5)*time.Minute, sc.agentPoolToScale, sc.newDesiredAgentCount)
+		if err == nil && nodes != nil {
+			sc.nodes = nodes
+			sc.logger.Infof("Nodes in pool '%s' after scaling:\n", sc.agentPoolToScale)
+			operations.PrintNodes(sc.nodes)
+		} else {
+			sc.logger.Warningf("Unable to get nodes in pool %s after scaling:\n", sc.agentPoolToScale)
+		}
+	}
+
+	if sc.persistAPIModel {
+		return sc.saveAPIModel()
+	}
+	return nil
+}
+
+// getVMASAgentPoolVMs returns the sorted indexes of the VMs that belong to the VMAS agent pool being scaled,
+// a map from index to VM name and, for Windows pools, the pool index encoded in the VM names
+func (sc *scaleCmd) getVMASAgentPoolVMs(ctx context.Context) ([]int, map[int]string, int, error) {
+	var index int
+	winPoolIndex := -1
+	indexes := make([]int, 0)
+	indexToVM := make(map[int]string)
+	for i := 0; i < 10; i++ {
+		for vmsListPage, err := sc.client.ListVirtualMachines(ctx, sc.resourceGroupName); vmsListPage.NotDone(); err = vmsListPage.Next() {
+			if err != nil {
+				return nil, nil, -1, errors.Wrap(err, "failed to get VMs in the resource group")
+			} else if len(vmsListPage.Values()) < 1 {
+				return nil, nil, -1, errors.New("The provided resource group does not contain any VMs")
+			}
+			for _, vm := range vmsListPage.Values() {
+				vmName := *vm.Name
+				if !sc.vmInVMASAgentPool(vmName, vm.Tags) {
+					continue
+				}
+
+				if sc.agentPool.OSType == api.Windows {
+					_, _, winPoolIndex, index, err = utils.WindowsVMNameParts(vmName)
+				} else {
+					_, _, index, err = utils.K8sLinuxVMNameParts(vmName)
+				}
+				if err != nil {
+					return nil, nil, -1, err
+				}
+
+				indexToVM[index] = vmName
+				indexes = append(indexes, index)
+			}
+		}
+		// If we get zero VMs that match our api model pool name, then
+		// Retry every 30 seconds for up to 5 minutes to accommodate temporary issues connecting to the VM API
+		if len(indexes) > 0 {
+			break
+		}
+		log.Warnf("Found no VMs in resource group %s that match pool name %s\n", sc.resourceGroupName, sc.agentPool.Name)
+		time.Sleep(30 * time.Second)
+	}
+	sortedIndexes := sort.IntSlice(indexes)
+	sortedIndexes.Sort()
+	indexes = sortedIndexes
+	return indexes, indexToVM, winPoolIndex, nil
+}
+
+// generateTemplate generates the ARM template and parameters required to scale the agent pool
+// to countForTemplate nodes and applies the scale-specific template normalizations
+func (sc *scaleCmd) generateTemplate(countForTemplate, highestUsedIndex, winPoolIndex int) (map[string]interface{}, map[string]interface{}, error) {
 	translator := engine.Context{
 		Translator: &i18n.Translator{
 			Locale: sc.locale,
@@ -454,15 +543,9 @@ func (sc *scaleCmd) run(cmd *cobra.Command, args []string) error {
 	}
 	templateGenerator, err := engine.InitializeTemplateGenerator(translator)
 	if err != nil {
-		return errors.Wrap(err, "failed to initialize template generator")
+		return nil, nil, errors.Wrap(err, "failed to initialize template generator")
 	}
 
-	// Our templates generate a range of nodes based on a count and offset, it is possible for there to be holes in the template
-	// So we need to set the count in the template to get enough nodes for the range, if there are holes that number will be larger than the desired count
-	countForTemplate := sc.newDesiredAgentCount
-	if highestUsedIndex != 0 {
-		countForTemplate += highestUsedIndex + 1 - currentNodeCount
-	}
 	sc.agentPool.Count = countForTemplate
 	sc.containerService.Properties.AgentPoolProfiles = []*api.AgentPoolProfile{sc.agentPool}
 
@@ -472,15 +555,15 @@ func (sc *scaleCmd) run(cmd *cobra.Command, args []string) error {
 		PkiKeySize: helpers.DefaultPkiKeySize,
 	})
 	if err != nil {
-		return errors.Wrapf(err, "error in SetPropertiesDefaults template %s", sc.apiModelPath)
+		return nil, nil, errors.Wrapf(err, "error in SetPropertiesDefaults template %s", sc.apiModelPath)
 	}
 	template, parameters, err := templateGenerator.GenerateTemplateV2(sc.containerService, engine.DefaultGeneratorCode, BuildTag)
 	if err != nil {
-		return errors.Wrapf(err, "error generating template %s", sc.apiModelPath)
+		return nil, nil, errors.Wrapf(err, "error generating template %s", sc.apiModelPath)
 	}
 
 	if template, err = transform.PrettyPrintArmTemplate(template); err != nil {
-		return errors.Wrap(err, "error pretty printing template")
+		return nil, nil, errors.Wrap(err, "error pretty printing template")
 	}
 
 	templateJSON := make(map[string]interface{})
@@ -488,12 +571,12 @@ func (sc *scaleCmd) run(cmd *cobra.Command, args []string) error {
 
 	err = json.Unmarshal([]byte(template), &templateJSON)
 	if err != nil {
-		return errors.Wrap(err, "error unmarshaling template")
+		return nil, nil, errors.Wrap(err, "error unmarshaling template")
 	}
 
 	err = json.Unmarshal([]byte(parameters), &parametersJSON)
 	if err != nil {
-		return errors.Wrap(err, "error unmarshaling parameters")
+		return nil, nil, errors.Wrap(err, "error unmarshaling parameters")
 	}
 
 	transformer := transform.Transformer{Translator: translator.Translator}
@@ -505,15 +588,15 @@ func (sc *scaleCmd) run(cmd *cobra.Command, args []string) error {
 		templateJSON["variables"].(map[string]interface{})[sc.agentPool.Name+"Index"] = winPoolIndex
 		templateJSON["variables"].(map[string]interface{})[sc.agentPool.Name+"VMNamePrefix"] = sc.containerService.Properties.GetAgentVMPrefix(sc.agentPool, winPoolIndex)
 	}
-	if orchestratorInfo.KubernetesConfig.LoadBalancerSku == api.StandardLoadBalancerSku {
+	if sc.containerService.Properties.OrchestratorProfile.KubernetesConfig.LoadBalancerSku == api.StandardLoadBalancerSku {
 		err = transformer.NormalizeForK8sSLBScalingOrUpgrade(sc.logger, templateJSON)
 		if err != nil {
-			return errors.Wrapf(err, "error transforming the template for scaling with SLB %s", sc.apiModelPath)
+			return nil, nil, errors.Wrapf(err, "error transforming the template for scaling with SLB %s", sc.apiModelPath)
 		}
 	}
 	err = transformer.NormalizeForK8sVMASScalingUp(sc.logger, templateJSON)
 	if err != nil {
-		return errors.Wrapf(err, "error transforming the template for scaling template %s", sc.apiModelPath)
+		return nil, nil, errors.Wrapf(err, "error transforming the template for scaling template %s", sc.apiModelPath)
 	}
 
 	transformer.RemoveImmutableResourceProperties(sc.logger, templateJSON)
@@ -521,38 +604,7 @@ func (sc *scaleCmd) run(cmd *cobra.Command, args []string) error {
 	if sc.agentPool.IsAvailabilitySets() {
 		addValue(parametersJSON, fmt.Sprintf("%sOffset", sc.agentPool.Name), highestUsedIndex+1)
 	}
-
-	random := rand.New(rand.NewSource(time.Now().UnixNano()))
-	deploymentSuffix := random.Int31()
-
-	if sc.nodes != nil {
-		sc.logger.Infof("Nodes in pool '%s' before scaling:\n", sc.agentPoolToScale)
-		operations.PrintNodes(sc.nodes)
-	}
-	_, err = sc.client.DeployTemplate(
-		ctx,
-		sc.resourceGroupName,
-		fmt.Sprintf("%s-%d", sc.resourceGroupName, deploymentSuffix),
-		templateJSON,
-		parametersJSON)
-	if err != nil {
-		return err
-	}
-	if sc.nodes != nil {
-		nodes, err := operations.GetNodes(sc.client, sc.logger, sc.apiserverURL, sc.kubeconfig, time.Duration(5)*time.Minute, sc.agentPoolToScale, sc.newDesiredAgentCount)
-		if err == nil && nodes != nil {
-			sc.nodes = nodes
-			sc.logger.Infof("Nodes in pool '%s' after scaling:\n", sc.agentPoolToScale)
-			operations.PrintNodes(sc.nodes)
-		} else {
-			sc.logger.Warningf("Unable to get nodes in pool %s after scaling:\n", sc.agentPoolToScale)
-		}
-	}
-
-	if sc.persistAPIModel {
-		return sc.saveAPIModel()
-	}
-	return nil
+	return templateJSON, parametersJSON, nil
 }
 
 func (sc *scaleCmd) saveAPIModel() error {
@@ -615,14 +667,225 @@ func addValue(m paramsMap, k string, v interface{}) {
 	}
 }
 
+// deriveNewNodeCount sets the desired node count from the number of nodes to remove, if --remove-nodes is set
+func (sc *scaleCmd) deriveNewNodeCount(currentNodeCount int) error {
+	if len(sc.nodesToRemove) == 0 {
+		return nil
+	}
+	if len(sc.nodesToRemove) > currentNodeCount {
+		return errors.Errorf("cannot remove %d nodes from node pool %s, it has %d nodes", len(sc.nodesToRemove), sc.agentPoolToScale, currentNodeCount)
+	}
+	newNodeCount := currentNodeCount - len(sc.nodesToRemove)
+	if sc.newDesiredAgentCount != 0 && sc.newDesiredAgentCount != newNodeCount {
+		return errors.Errorf("--new-node-count %d does not match the %d nodes of node pool %s minus the %d nodes to remove", sc.newDesiredAgentCount, currentNodeCount, sc.agentPoolToScale, len(sc.nodesToRemove))
+	}
+	sc.newDesiredAgentCount = newNodeCount
+	return nil
+}
+
+// vmasRemovalCandidates returns the VMs of an availability set node pool in the default removal order, highest index first
+func vmasRemovalCandidates(indexes []int, indexToVM map[int]string) []string {
+	candidates := make([]string, 0, len(indexes))
+	for i := len(indexes) - 1; i >= 0; i-- {
+		candidates = append(candidates, indexToVM[indexes[i]])
+	}
+	return candidates
+}
+
+// selectNodesToRemove picks count nodes to remove among the pool nodes.
+// The candidates are ordered by the default removal policy, --remove-nodes and --prefer-unhealthy override it.
+func (sc *scaleCmd) selectNodesToRemove(candidates []string, count int) ([]string, error) {
+	if len(sc.nodesToRemove) > 0 {
+		selected := make([]string, 0, len(sc.nodesToRemove))
+		for _, name := range sc.nodesToRemove {
+			found := false
+			for _, candidate := range candidates {
+				if strings.EqualFold(candidate, name) {
+					for _, s := range selected {
+						if s == candidate {
+							return nil, errors.Errorf("node %s is listed more than once in --remove-nodes", name)
+						}
+					}
+					selected = append(selected, candidate)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, errors.Errorf("node %s was not found in node pool %s", name, sc.agentPoolToScale)
+			}
+		}
+		return selected, nil
+	}
+	if count > len(candidates) {
+		count = len(candidates)
+	}
+	if !sc.preferUnhealthy {
+		return candidates[:count], nil
+	}
+	ordered := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		if sc.isNodeUnhealthy(candidate) {
+			ordered = append(ordered, candidate)
+		}
+	}
+	for _, candidate := range candidates {
+		if !sc.isNodeUnhealthy(candidate) {
+			ordered = append(ordered, candidate)
+		}
+	}
+	return ordered[:count], nil
+}
+
+// isNodeUnhealthy returns true if the node is cordoned, not Ready, or not registered in the Kubernetes cluster
+func (sc *scaleCmd) isNodeUnhealthy(name string) bool {
+	if sc.nodes == nil {
+		return false
+	}
+	for _, node := range sc.nodes {
+		if !strings.EqualFold(node.Name, name) {
+			continue
+		}
+		if node.Spec.Unschedulable {
+			return true
+		}
+		for _, condition := range node.Status.Conditions {
+			if condition.Type == v1.NodeReady {
+				return condition.Status != v1.ConditionTrue
+			}
+		}
+		return true
+	}
+	return true
+}
+
+// getVMSSInstances returns the computer names of the VMSS instances, highest instance ID first,
+// and a map from computer name to instance ID
+func (sc *scaleCmd) getVMSSInstances(ctx context.Context, vmssName string) ([]string, map[string]string, error) {
+	names := make([]string, 0)
+	instanceIDs := make(map[string]string)
+	for vmPage, err := sc.client.ListVirtualMachineScaleSetVMs(ctx, sc.resourceGroupName, vmssName); vmPage.NotDone(); err = vmPage.NextWithContext(ctx) {
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to list the instances of VMSS %s", vmssName)
+		}
+		for _, vm := range vmPage.Values() {
+			if vm.VirtualMachineScaleSetVMProperties == nil || vm.OsProfile == nil || vm.OsProfile.ComputerName == nil {
+				log.Warnf("VMSS %s instance %s has no computer name", vmssName, to.String(vm.InstanceID))
+				continue
+			}
+			name := to.String(vm.OsProfile.ComputerName)
+			names = append(names, name)
+			instanceIDs[name] = to.String(vm.InstanceID)
+		}
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		a, errA := strconv.Atoi(instanceIDs[names[i]])
+		b, errB := strconv.Atoi(instanceIDs[names[j]])
+		if errA != nil || errB != nil {
+			return instanceIDs[names[i]] > instanceIDs[names[j]]
+		}
+		return a > b
+	})
+	return names, instanceIDs, nil
+}
+
+// scaleDownVMSS cordons and drains the VMSS instances to remove, then deletes those specific instances
+// instead of letting the VMSS pick the instances to delete when its capacity is lowered
+func (sc *scaleCmd) scaleDownVMSS(cmd *cobra.Command, vmssName string, currentNodeCount int) error {
+	if sc.apiserverURL == "" {
+		_ = cmd.Usage()
+		return errors.New("--apiserver is required to scale down a kubernetes cluster's agent pool")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+	defer cancel()
+	candidates, instanceIDs, err := sc.getVMSSInstances(ctx, vmssName)
+	if err != nil {
+		return err
+	}
+	if len(candidates) == 0 {
+		return errors.Errorf("found no instances in VMSS %s", vmssName)
+	}
+	if sc.nodes != nil {
+		sc.logger.Infof("Nodes in pool %s before scaling down to %d:\n", sc.agentPoolToScale, sc.newDesiredAgentCount)
+		operations.PrintNodes(sc.nodes)
+		if len(candidates) != len(sc.nodes) {
+			sc.logger.Warnf("There are %d instances in the VMSS %s, but there are %d nodes named \"*%s*\" in the Kubernetes cluster\n", len(candidates), vmssName, len(sc.nodes), sc.agentPoolToScale)
+		}
+	}
+	nodesToDelete, err := sc.selectNodesToRemove(candidates, currentNodeCount-sc.newDesiredAgentCount)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range nodesToDelete {
+		sc.logger.Infof("Node %s will be cordoned and drained\n", node)
+	}
+	if err = sc.drainNodes(nodesToDelete); err != nil {
+		return errors.Wrap(err, "Got error while draining the nodes to be deleted")
+	}
+	if err = sc.deleteVMSSInstances(vmssName, nodesToDelete, instanceIDs); err != nil {
+		return err
+	}
+
+	if sc.nodes != nil {
+		nodes, err := operations.GetNodes(sc.client, sc.logger, sc.apiserverURL, sc.kubeconfig, time.Duration(5)*time.Minute, sc.agentPoolToScale, sc.newDesiredAgentCount)
+		if err == nil && nodes != nil {
+			sc.nodes = nodes
+			sc.logger.Infof("Nodes in pool %s after scaling:\n", sc.agentPoolToScale)
+			operations.PrintNodes(sc.nodes)
+		} else {
+			sc.logger.Warningf("Unable to get nodes in pool %s after scaling:\n", sc.agentPoolToScale)
+		}
+	}
+	if sc.persistAPIModel {
+		return sc.saveAPIModel()
+	}
+	return nil
+}
+
+// deleteVMSSInstances concurrently deletes the VMSS instances backing the given nodes
+func (sc *scaleCmd) deleteVMSSInstances(vmssName string, nodes []string, instanceIDs map[string]string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+	defer cancel()
+	errChan := make(chan *operations.VMScalingErrorDetails, len(nodes))
+	defer close(errChan)
+	for _, node := range nodes {
+		go func(node string) {
+			sc.logger.Infof("Node %s's VMSS instance %s will be deleted\n", node, instanceIDs[node])
+			if err := sc.client.DeleteVirtualMachineScaleSetVM(ctx, sc.resourceGroupName, vmssName, instanceIDs[node]); err != nil {
+				errChan <- &operations.VMScalingErrorDetails{Name: node, Error: err}
+				return
+			}
+			errChan <- nil
+		}(node)
+	}
+	var err error
+	format := "Node '%s' failed to delete with error: '%s'"
+	for i := 0; i < len(nodes); i++ {
+		vmError := <-errChan
+		if vmError == nil {
+			continue
+		}
+		if err == nil {
+			err = errors.Errorf(format, vmError.Name, vmError.Error.Error())
+		} else {
+			err = errors.Wrapf(err, format, vmError.Name, vmError.Error.Error())
+		}
+	}
+	return err
+}
+
 func (sc *scaleCmd) drainNodes(vmsToDelete []string) error {
+	kubeClient, err := sc.client.GetKubernetesClient(sc.apiserverURL, sc.kubeconfig, scaleDrainInterval, scaleDrainTimeout)
+	if err != nil {
+		return errors.Wrap(err, "failed to get a Kubernetes client")
+	}
 	numVmsToDrain := len(vmsToDelete)
 	errChan := make(chan *operations.VMScalingErrorDetails, numVmsToDrain)
 	defer close(errChan)
 	for _, vmName := range vmsToDelete {
 		go func(vmName string) {
-			err := operations.SafelyDrainNode(sc.client, sc.logger,
-				sc.apiserverURL, sc.kubeconfig, vmName, time.Duration(60)*time.Minute)
+			err := operations.SafelyDrainNodeWithClient(kubeClient, sc.logger, vmName, scaleDrainTimeout)
 			if err != nil {
 				log.Errorf("Failed to drain node %s, got error %v", vmName, err)
 				errChan <- &operations.VMScalingErrorDetails{Error: err, Name: vmName}
@@ -4,11 +4,18 @@
 package cmd
 
 import (
+	"context"
+	"reflect"
 	"testing"
 
 	"github.com/Azure/aks-engine-azurestack/pkg/api"
+	"github.com/Azure/aks-engine-azurestack/pkg/armhelpers"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-12-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
 )
 
 func TestNewScaleCmd(t *testing.T) {
@@ -17,7 +24,7 @@ func TestNewScaleCmd(t *testing.T) {
 		t.Fatalf("scale command should have use %s equal %s, short %s equal %s and long %s equal to %s", command.Use, scaleName, command.Short, scaleShortDescription, command.Long, scaleLongDescription)
 	}
 
-	expectedFlags := []string{"location", "resource-group", "api-model", "new-node-count", "node-pool", "master-FQDN"}
+	expectedFlags := []string{"location", "resource-group", "api-model", "new-node-count", "node-pool", "master-FQDN", "remove-nodes", "prefer-unhealthy"}
 	for _, f := range expectedFlags {
 		if command.Flags().Lookup(f) == nil {
 			t.Fatalf("scale command should have flag %s", f)
@@ -76,6 +83,31 @@ func TestScaleCmdValidate(t *testing.T) {
 			expectedErr: errors.New("--new-node-count must be specified"),
 			name:        "NoNewNodeCount",
 		},
+		{
+			sc: &scaleCmd{
+				apiModelPath:      "./not/used",
+				location:          "centralus",
+				resourceGroupName: "testRG",
+				agentPoolToScale:  "agentpool1",
+				masterFQDN:        "test",
+				nodesToRemove:     []string{"k8s-agentpool1-12345678-0"},
+				preferUnhealthy:   true,
+			},
+			expectedErr: errors.New("--remove-nodes and --prefer-unhealthy are mutually exclusive"),
+			name:        "RemoveNodesAndPreferUnhealthy",
+		},
+		{
+			sc: &scaleCmd{
+				apiModelPath:      "./not/used",
+				location:          "centralus",
+				resourceGroupName: "testRG",
+				agentPoolToScale:  "agentpool1",
+				masterFQDN:        "test",
+				nodesToRemove:     []string{"k8s-agentpool1-12345678-0"},
+			},
+			expectedErr: nil,
+			name:        "RemoveNodesWithoutNewNodeCount",
+		},
 		{
 			sc: &scaleCmd{
 				apiModelPath:         "",
@@ -239,3 +271,202 @@ func TestVmInVMASAgentPool(t *testing.T) {
 		})
 	}
 }
+
+func TestScaleCmdDeriveNewNodeCount(t *testing.T) {
+	sc := &scaleCmd{agentPoolToScale: "agentpool1"}
+	if err := sc.deriveNewNodeCount(3); err != nil || sc.newDesiredAgentCount != 0 {
+		t.Fatalf("expected the new node count to be left unset without --remove-nodes, got %d and error %v", sc.newDesiredAgentCount, err)
+	}
+
+	sc.nodesToRemove = []string{"node-a", "node-b"}
+	if err := sc.deriveNewNodeCount(3); err != nil || sc.newDesiredAgentCount != 1 {
+		t.Fatalf("expected the new node count to be 1, got %d and error %v", sc.newDesiredAgentCount, err)
+	}
+
+	sc.newDesiredAgentCount = 2
+	if err := sc.deriveNewNodeCount(3); err == nil {
+		t.Fatalf("expected an error when --new-node-count does not match --remove-nodes")
+	}
+
+	sc.newDesiredAgentCount = 0
+	if err := sc.deriveNewNodeCount(1); err == nil {
+		t.Fatalf("expected an error when removing more nodes than the pool has")
+	}
+}
+
+func TestScaleCmdSelectNodesToRemove(t *testing.T) {
+	candidates := []string{"k8s-agentpool1-12345678-3", "k8s-agentpool1-12345678-2", "k8s-agentpool1-12345678-1", "k8s-agentpool1-12345678-0"}
+	readyNode := func(name string) v1.Node {
+		node := v1.Node{}
+		node.Name = name
+		node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}
+		return node
+	}
+	cordonedNode := readyNode("k8s-agentpool1-12345678-1")
+	cordonedNode.Spec.Unschedulable = true
+	notReadyNode := readyNode("k8s-agentpool1-12345678-0")
+	notReadyNode.Status.Conditions[0].Status = v1.ConditionFalse
+	nodes := []v1.Node{readyNode("k8s-agentpool1-12345678-3"), readyNode("k8s-agentpool1-12345678-2"), cordonedNode, notReadyNode}
+
+	cases := []struct {
+		sc          *scaleCmd
+		count       int
+		expected    []string
+		expectedErr error
+		name        string
+	}{
+		{
+			sc:       &scaleCmd{nodes: nodes},
+			count:    2,
+			expected: []string{"k8s-agentpool1-12345678-3", "k8s-agentpool1-12345678-2"},
+			name:     "HighestIndexesByDefault",
+		},
+		{
+			sc:       &scaleCmd{nodes: nodes, preferUnhealthy: true},
+			count:    3,
+			expected: []string{"k8s-agentpool1-12345678-1", "k8s-agentpool1-12345678-0", "k8s-agentpool1-12345678-3"},
+			name:     "PreferUnhealthy",
+		},
+		{
+			sc:       &scaleCmd{nodes: nodes[:3], preferUnhealthy: true},
+			count:    2,
+			expected: []string{"k8s-agentpool1-12345678-1", "k8s-agentpool1-12345678-0"},
+			name:     "PreferUnregistered",
+		},
+		{
+			sc:       &scaleCmd{nodes: nodes, nodesToRemove: []string{"K8S-AGENTPOOL1-12345678-0", "k8s-agentpool1-12345678-2"}},
+			count:    2,
+			expected: []string{"k8s-agentpool1-12345678-0", "k8s-agentpool1-12345678-2"},
+			name:     "RemoveNodes",
+		},
+		{
+			sc:          &scaleCmd{nodes: nodes, agentPoolToScale: "agentpool1", nodesToRemove: []string{"k8s-agentpool2-12345678-0"}},
+			count:       1,
+			expectedErr: errors.New("node k8s-agentpool2-12345678-0 was not found in node pool agentpool1"),
+			name:        "RemoveNodesNotInPool",
+		},
+		{
+			sc:          &scaleCmd{nodes: nodes, nodesToRemove: []string{"k8s-agentpool1-12345678-0", "k8s-agentpool1-12345678-0"}},
+			count:       2,
+			expectedErr: errors.New("node k8s-agentpool1-12345678-0 is listed more than once in --remove-nodes"),
+			name:        "RemoveNodesDuplicate",
+		},
+	}
+
+	for _, tc := range cases {
+		c := tc
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			selected, err := c.sc.selectNodesToRemove(candidates, c.count)
+			if c.expectedErr != nil {
+				if err == nil || err.Error() != c.expectedErr.Error() {
+					t.Fatalf("expected error %v, got %v", c.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(selected, c.expected) {
+				t.Fatalf("expected nodes %v to be selected, got %v", c.expected, selected)
+			}
+		})
+	}
+}
+
+func TestScaleCmdScaleDownVMSS(t *testing.T) {
+	client := &armhelpers.MockAKSEngineClient{}
+	client.FakeListVirtualMachineScaleSetVMsResult = func() []compute.VirtualMachineScaleSetVM {
+		vms := make([]compute.VirtualMachineScaleSetVM, 0)
+		for _, id := range []string{"2", "10", "1"} {
+			vm := client.MakeFakeVirtualMachineScaleSetVMWithGivenName("Kubernetes:1.18.8", "k8s-agentpool1-12345678-vmss00000"+id)
+			vm.InstanceID = to.StringPtr(id)
+			vms = append(vms, vm)
+		}
+		return vms
+	}
+	sc := &scaleCmd{
+		client:               client,
+		logger:               log.NewEntry(log.New()),
+		resourceGroupName:    "testRG",
+		agentPoolToScale:     "agentpool1",
+		newDesiredAgentCount: 2,
+	}
+
+	if err := sc.scaleDownVMSS(&cobra.Command{}, "k8s-agentpool1-12345678-vmss", 3); err == nil {
+		t.Fatalf("expected an error when scaling down a VMSS without --apiserver")
+	}
+
+	sc.apiserverURL = "https://apiserver"
+	names, instanceIDs, err := sc.getVMSSInstances(context.Background(), "k8s-agentpool1-12345678-vmss")
+	if err != nil {
+		t.Fatalf("expected no error listing the VMSS instances, got %v", err)
+	}
+	expectedNames := []string{"k8s-agentpool1-12345678-vmss0000010", "k8s-agentpool1-12345678-vmss000002", "k8s-agentpool1-12345678-vmss000001"}
+	if !reflect.DeepEqual(names, expectedNames) {
+		t.Fatalf("expected the VMSS instances to be sorted by instance ID %v, got %v", expectedNames, names)
+	}
+	if instanceIDs["k8s-agentpool1-12345678-vmss0000010"] != "10" {
+		t.Fatalf("expected instance ID 10, got %s", instanceIDs["k8s-agentpool1-12345678-vmss0000010"])
+	}
+
+	if err = sc.scaleDownVMSS(&cobra.Command{}, "k8s-agentpool1-12345678-vmss", 3); err != nil {
+		t.Fatalf("expected no error scaling down the VMSS, got %v", err)
+	}
+
+	client.FailGetKubernetesClient = true
+	if err = sc.scaleDownVMSS(&cobra.Command{}, "k8s-agentpool1-12345678-vmss", 3); err == nil {
+		t.Fatalf("expected an error when the nodes can't be drained")
+	}
+}
+
+func TestScaleCmdRunVMSSScaleDown(t *testing.T) {
+	cs := api.CreateMockContainerService("testcluster", "1.18.8", 3, 3, false)
+	agentPool := cs.Properties.AgentPoolProfiles[0]
+	agentPool.AvailabilityProfile = api.VirtualMachineScaleSets
+	agentPool.VMSSName = "k8s-agentpool1-12345678-vmss"
+	client := &armhelpers.MockAKSEngineClient{MockKubernetesClient: &armhelpers.MockKubernetesClient{}}
+	client.FakeListVirtualMachineScaleSetsResult = func() []compute.VirtualMachineScaleSet {
+		return []compute.VirtualMachineScaleSet{
+			{
+				Name: to.StringPtr(agentPool.VMSSName),
+				Sku:  &compute.Sku{Capacity: to.Int64Ptr(3)},
+			},
+		}
+	}
+	client.FakeListVirtualMachineScaleSetVMsResult = func() []compute.VirtualMachineScaleSetVM {
+		vms := make([]compute.VirtualMachineScaleSetVM, 0)
+		for _, id := range []string{"0", "1", "2"} {
+			vm := client.MakeFakeVirtualMachineScaleSetVMWithGivenName("Kubernetes:1.18.8", "k8s-agentpool1-12345678-vmss00000"+id)
+			vm.InstanceID = to.StringPtr(id)
+			vms = append(vms, vm)
+		}
+		return vms
+	}
+	sc := &scaleCmd{
+		containerService:     cs,
+		agentPool:            agentPool,
+		client:               client,
+		logger:               log.NewEntry(log.New()),
+		resourceGroupName:    "testRG",
+		agentPoolToScale:     agentPool.Name,
+		newDesiredAgentCount: 1,
+	}
+
+	// VMSS nodes are always cordoned and drained before scaling down
+	err := sc.run(&cobra.Command{}, []string{})
+	if err == nil || err.Error() != "--apiserver is required to scale down a kubernetes cluster's agent pool" {
+		t.Fatalf("expected an error when scaling down a VMSS without --apiserver, got %v", err)
+	}
+
+	sc.apiserverURL = "https://apiserver"
+	if err = sc.run(&cobra.Command{}, []string{}); err != nil {
+		t.Fatalf("expected no error scaling down the VMSS, got %v", err)
+	}
+
+	// the mock fails to list the VMSS instances when FailDeleteVirtualMachineScaleSetVM is set
+	client.FailDeleteVirtualMachineScaleSetVM = true
+	if err = sc.run(&cobra.Command{}, []string{}); err == nil {
+		t.Fatalf("expected an error when the VMSS instances can't be listed")
+	}
+}
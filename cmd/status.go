@@ -0,0 +1,386 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Azure/aks-engine-azurestack/pkg/api"
+	"github.com/Azure/aks-engine-azurestack/pkg/armhelpers"
+	"github.com/Azure/aks-engine-azurestack/pkg/engine"
+	"github.com/Azure/aks-engine-azurestack/pkg/helpers"
+	"github.com/Azure/aks-engine-azurestack/pkg/i18n"
+	"github.com/Azure/aks-engine-azurestack/pkg/kubernetes"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-12-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	statusName             = "status"
+	statusShortDescription = "Show the status of the nodes of a cluster"
+	statusLongDescription  = "Show the power state, provisioning state, Kubernetes version and readiness of every node of an AKS Engine-created Kubernetes cluster, combining the Azure Resource Manager and Kubernetes API server views of the cluster"
+)
+
+const (
+	statusDefaultInterval = 10 * time.Second
+	statusDefaultTimeout  = 1 * time.Minute
+
+	statusOutputYAML = "yaml"
+	// statusUnknown is displayed when a value could not be retrieved
+	statusUnknown = "Unknown"
+)
+
+var statusOutputFormatOptions = append(outputFormatOptions, statusOutputYAML)
+
+// nodeStatus is the combined ARM and Kubernetes view of a single cluster node
+type nodeStatus struct {
+	Pool              string `json:"pool"`
+	Name              string `json:"name"`
+	PowerState        string `json:"powerState"`
+	ProvisioningState string `json:"provisioningState"`
+	TagVersion        string `json:"tagVersion"`
+	KubeletVersion    string `json:"kubeletVersion"`
+	Ready             string `json:"ready"`
+	OSImage           string `json:"osImage"`
+	Drift             bool   `json:"drift"`
+}
+
+type statusCmd struct {
+	authArgs
+
+	// user input
+	resourceGroupName string
+	apiModelPath      string
+	location          string
+	output            string
+
+	// derived
+	cs         *api.ContainerService
+	client     armhelpers.AKSEngineClient
+	kubeClient kubernetes.Client
+}
+
+func newStatusCmd() *cobra.Command {
+	sc := statusCmd{}
+
+	command := &cobra.Command{
+		Use:   statusName,
+		Short: statusShortDescription,
+		Long:  statusLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := sc.validate(cmd); err != nil {
+				return errors.Wrap(err, "validating status command")
+			}
+			if err := sc.load(); err != nil {
+				return errors.Wrap(err, "loading cluster")
+			}
+			cmd.SilenceUsage = true
+			return sc.run(cmd.OutOrStdout())
+		},
+	}
+
+	f := command.Flags()
+	f.StringVarP(&sc.location, "location", "l", "", "location the cluster is deployed in (required)")
+	f.StringVarP(&sc.resourceGroupName, "resource-group", "g", "", "the resource group where the cluster is deployed (required)")
+	f.StringVarP(&sc.apiModelPath, "api-model", "m", "", "path to the generated apimodel.json file (required)")
+	f.StringVarP(&sc.output, "output", "o", "human", fmt.Sprintf("Output format. Allowed values: %s", strings.Join(statusOutputFormatOptions, ", ")))
+	addAuthFlags(&sc.authArgs, f)
+
+	return command
+}
+
+func (sc *statusCmd) validate(cmd *cobra.Command) error {
+	log.Debugln("validating status command line arguments...")
+	validOutput := false
+	for _, opt := range statusOutputFormatOptions {
+		if sc.output == opt {
+			validOutput = true
+			break
+		}
+	}
+	if !validOutput {
+		return errors.Errorf("invalid output format: \"%s\". Allowed values: %s", sc.output, strings.Join(statusOutputFormatOptions, ", "))
+	}
+	if sc.resourceGroupName == "" {
+		_ = cmd.Usage()
+		return errors.New("--resource-group must be specified")
+	}
+	if sc.location == "" {
+		_ = cmd.Usage()
+		return errors.New("--location must be specified")
+	}
+	sc.location = helpers.NormalizeAzureRegion(sc.location)
+	if sc.apiModelPath == "" {
+		_ = cmd.Usage()
+		return errors.New("--api-model must be specified")
+	}
+	if _, err := os.Stat(sc.apiModelPath); os.IsNotExist(err) {
+		return errors.Errorf("specified --api-model does not exist (%s)", sc.apiModelPath)
+	}
+	return nil
+}
+
+func (sc *statusCmd) load() error {
+	locale, err := i18n.LoadTranslations()
+	if err != nil {
+		return errors.Wrap(err, "loading translation files")
+	}
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{
+			Locale: locale,
+		},
+	}
+	if sc.cs, _, err = apiloader.LoadContainerServiceFromFile(sc.apiModelPath, true, true, nil); err != nil {
+		return errors.Wrap(err, "error parsing the api model")
+	}
+	if sc.cs.Location == "" {
+		sc.cs.Location = sc.location
+	} else if sc.cs.Location != sc.location {
+		return errors.New("--location does not match api model location")
+	}
+
+	if sc.cs.Properties.IsCustomCloudProfile() {
+		if err = writeCustomCloudProfile(sc.cs); err != nil {
+			return errors.Wrap(err, "error writing custom cloud profile")
+		}
+		if err = sc.cs.Properties.SetCustomCloudSpec(api.AzureCustomCloudSpecParams{IsUpgrade: false, IsScale: true}); err != nil {
+			return errors.Wrap(err, "error parsing the api model")
+		}
+	}
+
+	if err = sc.authArgs.validateAuthArgs(); err != nil {
+		return err
+	}
+	if sc.client, err = sc.authArgs.getClient(); err != nil {
+		return errors.Wrap(err, "failed to get client")
+	}
+
+	kubeConfig, err := engine.GenerateKubeConfig(sc.cs.Properties, sc.location)
+	if err != nil {
+		return errors.Wrap(err, "generating kubeconfig")
+	}
+	if sc.kubeClient, err = sc.client.GetKubernetesClient("", kubeConfig, statusDefaultInterval, statusDefaultTimeout); err != nil {
+		log.Warnf("Failed to get a Kubernetes client, node status will be read from Azure Resource Manager only: %v", err)
+		sc.kubeClient = nil
+	}
+	return nil
+}
+
+func (sc *statusCmd) run(out io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+	defer cancel()
+
+	nodes, err := sc.getNodeStatus(ctx)
+	if err != nil {
+		return err
+	}
+	return writeNodeStatus(out, nodes, sc.output)
+}
+
+// getNodeStatus lists the cluster VMs and VMSS instances and joins them with the Kubernetes nodes
+func (sc *statusCmd) getNodeStatus(ctx context.Context) ([]nodeStatus, error) {
+	nodes := make(map[string]*nodeStatus)
+
+	for page, err := sc.client.ListVirtualMachines(ctx, sc.resourceGroupName); page.NotDone(); err = page.Next() {
+		if err != nil {
+			return nil, errors.Wrap(err, "listing virtual machines")
+		}
+		for _, vm := range page.Values() {
+			if vm.Tags == nil || vm.Tags["orchestrator"] == nil {
+				continue
+			}
+			name := to.String(vm.Name)
+			if vm.VirtualMachineProperties != nil && vm.OsProfile != nil && vm.OsProfile.ComputerName != nil {
+				name = to.String(vm.OsProfile.ComputerName)
+			}
+			ns := &nodeStatus{
+				Pool:              to.String(vm.Tags["poolName"]),
+				Name:              name,
+				PowerState:        statusUnknown,
+				ProvisioningState: statusUnknown,
+				TagVersion:        getTagVersion(vm.Tags),
+			}
+			if vm.VirtualMachineProperties != nil && vm.ProvisioningState != nil {
+				ns.ProvisioningState = to.String(vm.ProvisioningState)
+			}
+			if state, err := sc.client.GetVirtualMachinePowerState(ctx, sc.resourceGroupName, to.String(vm.Name)); err != nil {
+				log.Warnf("Failed to get the power state of VM %s: %v", to.String(vm.Name), err)
+			} else if state != "" {
+				ns.PowerState = strings.TrimPrefix(state, "PowerState/")
+			}
+			nodes[strings.ToLower(ns.Name)] = ns
+		}
+	}
+
+	for page, err := sc.client.ListVirtualMachineScaleSets(ctx, sc.resourceGroupName); page.NotDone(); err = page.Next() {
+		if err != nil {
+			return nil, errors.Wrap(err, "listing virtual machine scale sets")
+		}
+		for _, vmss := range page.Values() {
+			if vmss.Tags == nil || vmss.Tags["orchestrator"] == nil {
+				continue
+			}
+			vmssName := to.String(vmss.Name)
+			for vmPage, err := sc.client.ListVirtualMachineScaleSetVMs(ctx, sc.resourceGroupName, vmssName); vmPage.NotDone(); err = vmPage.Next() {
+				if err != nil {
+					return nil, errors.Wrapf(err, "listing virtual machine scale set %s instances", vmssName)
+				}
+				for _, vm := range vmPage.Values() {
+					name := to.String(vm.Name)
+					if vm.VirtualMachineScaleSetVMProperties != nil && vm.OsProfile != nil && vm.OsProfile.ComputerName != nil {
+						name = to.String(vm.OsProfile.ComputerName)
+					}
+					tags := vm.Tags
+					if tags == nil || tags["orchestrator"] == nil {
+						tags = vmss.Tags
+					}
+					ns := &nodeStatus{
+						Pool:              to.String(tags["poolName"]),
+						Name:              name,
+						PowerState:        statusUnknown,
+						ProvisioningState: statusUnknown,
+						TagVersion:        getTagVersion(tags),
+					}
+					if vm.VirtualMachineScaleSetVMProperties != nil && vm.ProvisioningState != nil {
+						ns.ProvisioningState = to.String(vm.ProvisioningState)
+					}
+					instanceID := to.String(vm.InstanceID)
+					if vm.VirtualMachineScaleSetVMProperties != nil && vm.InstanceView != nil {
+						if state := getPowerState(vm.InstanceView.Statuses); state != "" {
+							ns.PowerState = state
+						}
+					} else if !sc.cs.Properties.IsAzureStackCloud() {
+						// Azure Stack does not support reading the instance view of a single VMSS instance
+						if state, err := sc.client.GetVirtualMachineScaleSetInstancePowerState(ctx, sc.resourceGroupName, vmssName, instanceID); err != nil {
+							log.Warnf("Failed to get the power state of VMSS %s instance %s: %v", vmssName, instanceID, err)
+						} else if state != "" {
+							ns.PowerState = strings.TrimPrefix(state, "PowerState/")
+						}
+					}
+					nodes[strings.ToLower(ns.Name)] = ns
+				}
+			}
+		}
+	}
+
+	if sc.kubeClient != nil {
+		nodeList, err := sc.kubeClient.ListNodes()
+		if err != nil {
+			log.Warnf("Failed to list the Kubernetes nodes, node status will be read from Azure Resource Manager only: %v", err)
+		} else {
+			for _, node := range nodeList.Items {
+				ns, ok := nodes[strings.ToLower(node.Name)]
+				if !ok {
+					ns = &nodeStatus{
+						Pool:              node.Labels["agentpool"],
+						Name:              node.Name,
+						PowerState:        statusUnknown,
+						ProvisioningState: statusUnknown,
+					}
+					nodes[strings.ToLower(node.Name)] = ns
+				}
+				ns.KubeletVersion = node.Status.NodeInfo.KubeletVersion
+				ns.OSImage = node.Status.NodeInfo.OSImage
+				ns.Ready = getNodeReadyStatus(node)
+			}
+		}
+	}
+
+	goalVersion := sc.cs.Properties.OrchestratorProfile.OrchestratorVersion
+	result := make([]nodeStatus, 0, len(nodes))
+	for _, ns := range nodes {
+		if ns.Ready == "" {
+			ns.Ready = statusUnknown
+		}
+		ns.Drift = isVersionDrift(ns.TagVersion, goalVersion) || isVersionDrift(ns.KubeletVersion, goalVersion)
+		result = append(result, *ns)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Pool != result[j].Pool {
+			return result[i].Pool < result[j].Pool
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// getTagVersion returns the Kubernetes version from the "orchestrator" tag, formatted as "Kubernetes:1.x.y"
+// getPowerState returns the power state found in the statuses of an instance view, without its "PowerState/" prefix
+func getPowerState(statuses *[]compute.InstanceViewStatus) string {
+	if statuses == nil {
+		return ""
+	}
+	for _, status := range *statuses {
+		if code := to.String(status.Code); strings.HasPrefix(code, "PowerState/") {
+			return strings.TrimPrefix(code, "PowerState/")
+		}
+	}
+	return ""
+}
+
+func getTagVersion(tags map[string]*string) string {
+	parts := strings.Split(to.String(tags["orchestrator"]), ":")
+	if len(parts) != 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// getNodeReadyStatus returns the status of the node's Ready condition
+func getNodeReadyStatus(node v1.Node) string {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return string(condition.Status)
+		}
+	}
+	return statusUnknown
+}
+
+// isVersionDrift returns true if a known node version is not the api model's orchestrator version
+func isVersionDrift(version, goalVersion string) bool {
+	if version == "" {
+		return false
+	}
+	return strings.TrimPrefix(version, "v") != goalVersion
+}
+
+func writeNodeStatus(out io.Writer, nodes []nodeStatus, output string) error {
+	switch output {
+	case "json":
+		b, err := helpers.JSONMarshalIndent(nodes, "", "  ", false)
+		if err != nil {
+			return errors.Wrap(err, "marshaling node status")
+		}
+		_, err = fmt.Fprintln(out, string(b))
+		return err
+	case statusOutputYAML:
+		b, err := yaml.Marshal(nodes)
+		if err != nil {
+			return errors.Wrap(err, "marshaling node status")
+		}
+		_, err = out.Write(b)
+		return err
+	default:
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', tabwriter.FilterHTML)
+		fmt.Fprintln(w, "POOL\tNAME\tPOWER STATE\tPROVISIONING STATE\tTAG VERSION\tKUBELET VERSION\tREADY\tOS IMAGE\tDRIFT")
+		for _, n := range nodes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", n.Pool, n.Name, n.PowerState, n.ProvisioningState,
+				n.TagVersion, n.KubeletVersion, n.Ready, n.OSImage, strconv.FormatBool(n.Drift))
+		}
+		return w.Flush()
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/Azure/aks-engine-azurestack/pkg/api"
+	"github.com/Azure/aks-engine-azurestack/pkg/api/common"
+	"github.com/Azure/aks-engine-azurestack/pkg/armhelpers"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-12-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+func TestNewStatusCmd(t *testing.T) {
+	g := NewGomegaWithT(t)
+	command := newStatusCmd()
+	g.Expect(command.Use).Should(Equal(statusName))
+	g.Expect(command.Short).Should(Equal(statusShortDescription))
+	g.Expect(command.Long).Should(Equal(statusLongDescription))
+	for _, f := range []string{"location", "resource-group", "api-model", "output"} {
+		g.Expect(command.Flags().Lookup(f)).NotTo(BeNil())
+	}
+
+	command.SetArgs([]string{})
+	err := command.Execute()
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestStatusCmdValidate(t *testing.T) {
+	r := &cobra.Command{}
+	existingFile := "../examples/kubernetes.json"
+	missingFile := "./random/file"
+
+	cases := []struct {
+		sc          *statusCmd
+		expectedErr error
+		name        string
+	}{
+		{
+			sc:          &statusCmd{resourceGroupName: "rg", location: "westus", apiModelPath: existingFile, output: "table"},
+			expectedErr: errors.New("invalid output format: \"table\". Allowed values: human, json, yaml"),
+			name:        "InvalidOutput",
+		},
+		{
+			sc:          &statusCmd{location: "westus", apiModelPath: existingFile, output: "human"},
+			expectedErr: errors.New("--resource-group must be specified"),
+			name:        "NoResourceGroup",
+		},
+		{
+			sc:          &statusCmd{resourceGroupName: "rg", apiModelPath: existingFile, output: "human"},
+			expectedErr: errors.New("--location must be specified"),
+			name:        "NoLocation",
+		},
+		{
+			sc:          &statusCmd{resourceGroupName: "rg", location: "westus", output: "human"},
+			expectedErr: errors.New("--api-model must be specified"),
+			name:        "NoAPIModel",
+		},
+		{
+			sc:          &statusCmd{resourceGroupName: "rg", location: "westus", apiModelPath: missingFile, output: "human"},
+			expectedErr: errors.Errorf("specified --api-model does not exist (%s)", missingFile),
+			name:        "BadAPIModel",
+		},
+		{
+			sc:          &statusCmd{resourceGroupName: "rg", location: "West US", apiModelPath: existingFile, output: "yaml"},
+			expectedErr: nil,
+			name:        "IsValid",
+		},
+	}
+
+	for _, tc := range cases {
+		c := tc
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			g := NewGomegaWithT(t)
+			err := c.sc.validate(r)
+			if c.expectedErr != nil {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(Equal(c.expectedErr.Error()))
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+		})
+	}
+}
+
+func newMockStatusCmd() *statusCmd {
+	cs := api.CreateMockContainerService("testcluster", "1.9.10", 1, 1, false)
+	client := &armhelpers.MockAKSEngineClient{
+		MockKubernetesClient:         &armhelpers.MockKubernetesClient{},
+		FakeVirtualMachinePowerState: "PowerState/running",
+	}
+	client.FakeListVirtualMachineScaleSetsResult = func() []compute.VirtualMachineScaleSet {
+		return []compute.VirtualMachineScaleSet{
+			{
+				Name: to.StringPtr("k8s-agentpool2-12345678-vmss"),
+				Tags: map[string]*string{
+					"orchestrator": to.StringPtr("Kubernetes:1.9.10"),
+					"poolName":     to.StringPtr("agentpool2"),
+				},
+			},
+		}
+	}
+	client.FakeListVirtualMachineScaleSetVMsResult = func() []compute.VirtualMachineScaleSetVM {
+		vm := client.MakeFakeVirtualMachineScaleSetVMWithGivenName("Kubernetes:1.9.10", "k8s-agentpool2-12345678-vmss000000")
+		vm.Tags = nil
+		vm.ProvisioningState = to.StringPtr("Succeeded")
+		return []compute.VirtualMachineScaleSetVM{vm}
+	}
+	return &statusCmd{
+		resourceGroupName: "rg",
+		output:            "human",
+		cs:                cs,
+		client:            client,
+		kubeClient:        client.MockKubernetesClient,
+	}
+}
+
+func TestStatusCmdGetNodeStatus(t *testing.T) {
+	g := NewGomegaWithT(t)
+	sc := newMockStatusCmd()
+
+	nodes, err := sc.getNodeStatus(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(nodes).To(HaveLen(4))
+	byName := make(map[string]nodeStatus)
+	for _, n := range nodes {
+		byName[n.Name] = n
+	}
+
+	vm := byName[armhelpers.DefaultFakeVMName]
+	g.Expect(vm.Pool).To(Equal("agentpool1"))
+	g.Expect(vm.PowerState).To(Equal("running"))
+	g.Expect(vm.ProvisioningState).To(Equal(statusUnknown))
+	g.Expect(vm.Ready).To(Equal(statusUnknown))
+	g.Expect(vm.Drift).To(BeTrue())
+
+	vmssVM := byName["k8s-agentpool2-12345678-vmss000000"]
+	g.Expect(vmssVM.Pool).To(Equal("agentpool2"))
+	g.Expect(vmssVM.PowerState).To(Equal("running"))
+	g.Expect(vmssVM.ProvisioningState).To(Equal("Succeeded"))
+	g.Expect(vmssVM.TagVersion).To(Equal("1.9.10"))
+	g.Expect(vmssVM.Drift).To(BeFalse())
+
+	master := byName[fmt.Sprintf("%s-1234", common.LegacyControlPlaneVMPrefix)]
+	g.Expect(master.PowerState).To(Equal(statusUnknown))
+	g.Expect(master.KubeletVersion).To(Equal("1.9.10"))
+	g.Expect(master.Ready).To(Equal("True"))
+	g.Expect(master.Drift).To(BeFalse())
+
+	agent := byName["k8s-agentpool3-1234"]
+	g.Expect(agent.KubeletVersion).To(Equal("1.9.9"))
+	g.Expect(agent.Ready).To(Equal(statusUnknown))
+	g.Expect(agent.Drift).To(BeTrue())
+}
+
+func TestStatusCmdGetNodeStatusAzureStack(t *testing.T) {
+	g := NewGomegaWithT(t)
+	sc := newMockStatusCmd()
+	sc.cs.Properties.CustomCloudProfile = &api.CustomCloudProfile{}
+	client := sc.client.(*armhelpers.MockAKSEngineClient)
+
+	// the power state of a single VMSS instance cannot be read on Azure Stack
+	nodes, err := sc.getNodeStatus(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	for _, n := range nodes {
+		if n.Name == "k8s-agentpool2-12345678-vmss000000" {
+			g.Expect(n.PowerState).To(Equal(statusUnknown))
+		}
+	}
+
+	// it is read from the instance view listed with the instance
+	client.FakeListVirtualMachineScaleSetVMsResult = func() []compute.VirtualMachineScaleSetVM {
+		vm := client.MakeFakeVirtualMachineScaleSetVMWithGivenName("Kubernetes:1.9.10", "k8s-agentpool2-12345678-vmss000000")
+		vm.InstanceView = &compute.VirtualMachineScaleSetVMInstanceView{
+			Statuses: &[]compute.InstanceViewStatus{
+				{Code: to.StringPtr("ProvisioningState/succeeded")},
+				{Code: to.StringPtr("PowerState/deallocated")},
+			},
+		}
+		return []compute.VirtualMachineScaleSetVM{vm}
+	}
+	nodes, err = sc.getNodeStatus(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	found := false
+	for _, n := range nodes {
+		if n.Name == "k8s-agentpool2-12345678-vmss000000" {
+			g.Expect(n.PowerState).To(Equal("deallocated"))
+			found = true
+		}
+	}
+	g.Expect(found).To(BeTrue())
+}
+
+func TestStatusCmdGetNodeStatusWithoutKubernetes(t *testing.T) {
+	g := NewGomegaWithT(t)
+	sc := newMockStatusCmd()
+	sc.kubeClient.(*armhelpers.MockKubernetesClient).FailListNodes = true
+
+	nodes, err := sc.getNodeStatus(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(nodes).To(HaveLen(2))
+	for _, n := range nodes {
+		g.Expect(n.KubeletVersion).To(BeEmpty())
+		g.Expect(n.Ready).To(Equal(statusUnknown))
+	}
+
+	sc.client.(*armhelpers.MockAKSEngineClient).FailListVirtualMachines = true
+	_, err = sc.getNodeStatus(context.Background())
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestWriteNodeStatus(t *testing.T) {
+	g := NewGomegaWithT(t)
+	nodes := []nodeStatus{
+		{Pool: "agentpool1", Name: "k8s-agentpool1-12345678-0", PowerState: "running", ProvisioningState: "Succeeded", TagVersion: "1.9.10", KubeletVersion: "v1.9.10", Ready: "True", OSImage: "Ubuntu 18.04.5 LTS"},
+	}
+
+	out := &bytes.Buffer{}
+	g.Expect(writeNodeStatus(out, nodes, "human")).To(Succeed())
+	g.Expect(out.String()).To(ContainSubstring("POWER STATE"))
+	g.Expect(out.String()).To(ContainSubstring("k8s-agentpool1-12345678-0"))
+
+	for _, output := range []string{"json", statusOutputYAML} {
+		out.Reset()
+		g.Expect(writeNodeStatus(out, nodes, output)).To(Succeed())
+		var decoded []nodeStatus
+		if output == "json" {
+			g.Expect(json.Unmarshal(out.Bytes(), &decoded)).To(Succeed())
+		} else {
+			g.Expect(yaml.Unmarshal(out.Bytes(), &decoded)).To(Succeed())
+		}
+		g.Expect(decoded).To(Equal(nodes))
+	}
+}
+
+func TestIsVersionDrift(t *testing.T) {
+	g := NewGomegaWithT(t)
+	g.Expect(isVersionDrift("", "1.9.10")).To(BeFalse())
+	g.Expect(isVersionDrift("v1.9.10", "1.9.10")).To(BeFalse())
+	g.Expect(isVersionDrift("1.9.10", "1.9.10")).To(BeFalse())
+	g.Expect(isVersionDrift("v1.9.9", "1.9.10")).To(BeTrue())
+}
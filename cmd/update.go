@@ -5,7 +5,6 @@ package cmd
 
 import (
 	"context"
-	"fmt"
 	"os"
 
 	"github.com/Azure/aks-engine-azurestack/pkg/api"
@@ -197,6 +196,22 @@ func (uc *updateCmd) run(cmd *cobra.Command, args []string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
 	defer cancel()
 
+	sc, err := uc.newScaleCmd(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = sc.run(cmd, args)
+	if err != nil {
+		return errors.Wrap(err, "aks-engine update failed")
+	}
+
+	return nil
+}
+
+// newScaleCmd returns a scale command that updates the VMSS model of the node pool
+// without changing its current capacity
+func (uc *updateCmd) newScaleCmd(ctx context.Context) (*scaleCmd, error) {
 	sc := scaleCmd{
 		location:          uc.location,
 		apiModelPath:      uc.apiModelPath,
@@ -216,6 +231,7 @@ func (uc *updateCmd) run(cmd *cobra.Command, args []string) error {
 	sc.ClientSecret = uc.ClientSecret
 	sc.CertificatePath = uc.CertificatePath
 	sc.PrivateKeyPath = uc.PrivateKeyPath
+	sc.FederatedTokenFile = uc.FederatedTokenFile
 	sc.IdentitySystem = uc.IdentitySystem
 	sc.language = uc.language
 	sc.logger = uc.logger
@@ -229,7 +245,7 @@ func (uc *updateCmd) run(cmd *cobra.Command, args []string) error {
 
 	for vmssListPage, err := sc.client.ListVirtualMachineScaleSets(ctx, sc.resourceGroupName); vmssListPage.NotDone(); err = vmssListPage.NextWithContext(ctx) {
 		if err != nil {
-			return errors.Wrap(err, "failed to get VMSS list in the resource group")
+			return nil, errors.Wrap(err, "failed to get VMSS list in the resource group")
 		}
 		for _, vmss := range vmssListPage.Values() {
 			vmssName := to.String(vmss.Name)
@@ -244,15 +260,9 @@ func (uc *updateCmd) run(cmd *cobra.Command, args []string) error {
 				uc.agentPool.Count = sc.newDesiredAgentCount
 				break
 			} else {
-				return errors.Wrap(err, fmt.Sprintf("failed to find VMSS matching node pool %s in resource group %s", sc.agentPoolToScale, sc.resourceGroupName))
+				return nil, errors.Errorf("failed to find VMSS matching node pool %s in resource group %s", sc.agentPoolToScale, sc.resourceGroupName)
 			}
 		}
 	}
-
-	err := sc.run(cmd, args)
-	if err != nil {
-		return errors.Wrap(err, "aks-engine update failed")
-	}
-
-	return nil
+	return &sc, nil
 }
@@ -6,11 +6,13 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
 	"regexp"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/Azure/aks-engine-azurestack/pkg/api"
@@ -19,7 +21,9 @@ import (
 	"github.com/Azure/aks-engine-azurestack/pkg/armhelpers/utils"
 	"github.com/Azure/aks-engine-azurestack/pkg/engine"
 	"github.com/Azure/aks-engine-azurestack/pkg/helpers"
+	"github.com/Azure/aks-engine-azurestack/pkg/helpers/ssh"
 	"github.com/Azure/aks-engine-azurestack/pkg/i18n"
+	"github.com/Azure/aks-engine-azurestack/pkg/operations/etcd"
 	"github.com/Azure/aks-engine-azurestack/pkg/operations/kubernetesupgrade"
 	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/blang/semver"
@@ -36,6 +40,8 @@ const (
 	upgradeLongDescription          = "Upgrade an existing AKS Engine-created Kubernetes cluster, one node at a time"
 	smalldiskWindowsImageIdentifier = "smalldisk"
 	ctrdWindowsImageIdentifier      = "ctrd"
+	preflightDefaultInterval        = 10 * time.Second
+	preflightDefaultTimeout         = 1 * time.Minute
 )
 
 type upgradeCmd struct {
@@ -55,6 +61,14 @@ type upgradeCmd struct {
 	controlPlaneOnly                         bool
 	disableClusterInitComponentDuringUpgrade bool
 	upgradeWindowsVHD                        bool
+	resume                                   bool
+	skipEtcdBackup                           bool
+	maxSurge                                 int
+	maxUnavailable                           int
+	vmssUpgradeStrategy                      string
+	sshHostURI                               string
+	linuxSSHPrivateKeyPath                   string
+	diagnosticsFile                          string
 
 	// derived
 	containerService    *api.ContainerService
@@ -65,6 +79,7 @@ type upgradeCmd struct {
 	agentPoolsToUpgrade map[string]bool
 	timeout             *time.Duration
 	cordonDrainTimeout  *time.Duration
+	upgradeState        *kubernetesupgrade.UpgradeState
 }
 
 func newUpgradeCmd() *cobra.Command {
@@ -76,7 +91,11 @@ func newUpgradeCmd() *cobra.Command {
 		Use:   upgradeName,
 		Short: upgradeShortDescription,
 		Long:  upgradeLongDescription,
-		RunE:  uc.run,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := uc.run(cmd, args)
+			writeDeploymentDiagnostics(uc.diagnosticsFile, upgradeName, err)
+			return err
+		},
 	}
 
 	f := upgradeCmd.Flags()
@@ -91,6 +110,14 @@ func newUpgradeCmd() *cobra.Command {
 	f.BoolVarP(&uc.force, "force", "f", false, "force upgrading the cluster to desired version. Allows same version upgrades and downgrades.")
 	f.BoolVarP(&uc.controlPlaneOnly, "control-plane-only", "", false, "upgrade control plane VMs only, do not upgrade node pools")
 	f.BoolVarP(&uc.upgradeWindowsVHD, "upgrade-windows-vhd", "", true, "upgrade image reference of the Windows nodes")
+	f.IntVar(&uc.maxSurge, "max-surge", 1, "maximum number of extra nodes created in each availability set node pool to take on the workload of the nodes being upgraded")
+	f.IntVar(&uc.maxUnavailable, "max-unavailable", 0, "maximum number of nodes of each availability set node pool, or of each VMSS node pool updated in place, that can be unavailable during the upgrade")
+	f.StringVar(&uc.vmssUpgradeStrategy, "vmss-upgrade-strategy", kubernetesupgrade.VMSSUpgradeStrategyReplace, fmt.Sprintf("how VMSS node pools are upgraded: %q replaces each instance with a new one, %q updates and reimages the existing instances", kubernetesupgrade.VMSSUpgradeStrategyReplace, kubernetesupgrade.VMSSUpgradeStrategyInPlace))
+	f.StringVar(&uc.sshHostURI, "ssh-host", "", "FQDN, or IP address, of an SSH listener that can reach the control plane nodes, used by the pre-upgrade checks and the etcd backup (defaults to the control plane FQDN)")
+	f.StringVar(&uc.linuxSSHPrivateKeyPath, "linux-ssh-private-key", "", "path to a valid private SSH key to access the control plane nodes, the pre-upgrade etcd and disk space checks and the etcd snapshot taken before upgrading the control plane are skipped if not set")
+	f.BoolVar(&uc.resume, "resume", false, fmt.Sprintf("resume an interrupted upgrade from the %s file stored next to the api model", kubernetesupgrade.UpgradeStateFilename))
+	f.BoolVar(&uc.skipEtcdBackup, "skip-etcd-backup", false, "upgrade the control plane without taking an etcd snapshot first")
+	f.StringVar(&uc.diagnosticsFile, "diagnostics-file", "", "path to a file to write a JSON document describing the failure to, including the failed deployment operations and the decoded CSE exit codes")
 	addAuthFlags(uc.getAuthArgs(), f)
 
 	_ = f.MarkDeprecated("deployment-dir", "deployment-dir is no longer required for scale or upgrade. Please use --api-model.")
@@ -127,7 +154,7 @@ func (uc *upgradeCmd) validate(cmd *cobra.Command) error {
 		uc.cordonDrainTimeout = &cordonDrainTimeout
 	}
 
-	if uc.upgradeVersion == "" {
+	if uc.upgradeVersion == "" && !uc.resume {
 		_ = cmd.Usage()
 		return errors.New("--upgrade-version must be specified")
 	}
@@ -142,6 +169,70 @@ func (uc *upgradeCmd) validate(cmd *cobra.Command) error {
 		return errors.New("ambiguous, please specify only one of --api-model and --deployment-dir")
 	}
 
+	if uc.maxSurge < 0 || uc.maxUnavailable < 0 {
+		_ = cmd.Usage()
+		return errors.New("--max-surge and --max-unavailable cannot be negative")
+	}
+
+	if uc.maxSurge+uc.maxUnavailable < 1 {
+		_ = cmd.Usage()
+		return errors.New("at least one of --max-surge and --max-unavailable must be greater than 0")
+	}
+
+	if uc.linuxSSHPrivateKeyPath != "" {
+		if _, err = os.Stat(uc.linuxSSHPrivateKeyPath); os.IsNotExist(err) {
+			return errors.Errorf("specified --linux-ssh-private-key does not exist (%s)", uc.linuxSSHPrivateKeyPath)
+		}
+	}
+
+	switch uc.vmssUpgradeStrategy {
+	case "", kubernetesupgrade.VMSSUpgradeStrategyReplace, kubernetesupgrade.VMSSUpgradeStrategyInPlace:
+	default:
+		_ = cmd.Usage()
+		return errors.Errorf("--vmss-upgrade-strategy must be one of: %s, %s", kubernetesupgrade.VMSSUpgradeStrategyReplace, kubernetesupgrade.VMSSUpgradeStrategyInPlace)
+	}
+
+	return nil
+}
+
+func (uc *upgradeCmd) upgradeStatePath() string {
+	if uc.apiModelPath == "" {
+		return filepath.Join(uc.deploymentDirectory, kubernetesupgrade.UpgradeStateFilename)
+	}
+	return filepath.Join(filepath.Dir(uc.apiModelPath), kubernetesupgrade.UpgradeStateFilename)
+}
+
+// loadUpgradeState starts a new upgrade journal or, if --resume is set, loads the journal of the interrupted upgrade.
+// A new journal is only saved by run once the cluster has been loaded and validated, so that a later --resume
+// never trusts the journal of an upgrade that did not start
+func (uc *upgradeCmd) loadUpgradeState() error {
+	path := uc.upgradeStatePath()
+	if !uc.resume {
+		if _, err := os.Stat(path); err == nil {
+			log.Warnf("Found the state of an interrupted upgrade in %s, starting a new upgrade. Use --resume to continue the interrupted upgrade instead", path)
+		}
+		uc.upgradeState = kubernetesupgrade.NewUpgradeState(path, uc.upgradeVersion, uc.force, uc.controlPlaneOnly)
+		return nil
+	}
+
+	state, err := kubernetesupgrade.LoadUpgradeState(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errors.Errorf("--resume was specified but no upgrade state file was found at %s", path)
+		}
+		return err
+	}
+	if uc.upgradeVersion == "" {
+		uc.upgradeVersion = state.GoalVersion
+	} else if uc.upgradeVersion != state.GoalVersion {
+		return errors.Errorf("--upgrade-version %s does not match the version of the interrupted upgrade (%s)", uc.upgradeVersion, state.GoalVersion)
+	}
+	uc.force = uc.force || state.Force
+	uc.controlPlaneOnly = uc.controlPlaneOnly || state.ControlPlaneOnly
+	state.Force = uc.force
+	state.ControlPlaneOnly = uc.controlPlaneOnly
+	log.Infof("Resuming the upgrade to Kubernetes version %s started at %s", state.GoalVersion, state.StartedAt.Format(time.RFC3339))
+	uc.upgradeState = state
 	return nil
 }
 
@@ -272,6 +363,11 @@ func (uc *upgradeCmd) loadCluster() error {
 		return errors.Wrap(err, "error ensuring resource group")
 	}
 
+	// the control plane nodes are provisioned with the CA private key
+	if err = loadKeyvaultCa(ctx, uc.client, uc.containerService.Properties.CertificateProfile); err != nil {
+		return err
+	}
+
 	err = uc.initialize()
 	if err != nil {
 		return errors.Wrap(err, "error validating the api model")
@@ -340,6 +436,11 @@ func (uc *upgradeCmd) run(cmd *cobra.Command, args []string) error {
 		return errors.Wrap(err, "validating upgrade command")
 	}
 
+	err = uc.loadUpgradeState()
+	if err != nil {
+		return errors.Wrap(err, "loading upgrade state")
+	}
+
 	err = uc.loadCluster()
 	if err != nil {
 		return errors.Wrap(err, "loading existing cluster")
@@ -369,6 +470,11 @@ func (uc *upgradeCmd) run(cmd *cobra.Command, args []string) error {
 	upgradeCluster.AgentPoolsToUpgrade = uc.agentPoolsToUpgrade
 	upgradeCluster.Force = uc.force
 	upgradeCluster.ControlPlaneOnly = uc.controlPlaneOnly
+	upgradeCluster.State = uc.upgradeState
+	upgradeCluster.MaxSurge = uc.maxSurge
+	upgradeCluster.MaxUnavailable = uc.maxUnavailable
+	upgradeCluster.VMSSUpgradeStrategy = uc.vmssUpgradeStrategy
+	upgradeCluster.BackupEtcd = uc.getBackupEtcdFunc(upgradeCluster.Logger)
 
 	var kubeConfig string
 	if uc.kubeconfigPath != "" {
@@ -393,6 +499,14 @@ func (uc *upgradeCmd) run(cmd *cobra.Command, args []string) error {
 	upgradeCluster.IsVMSSToBeUpgraded = isVMSSNameInAgentPoolsArray
 	upgradeCluster.CurrentVersion = uc.currentVersion
 
+	if err = uc.runPreflightChecks(kubeConfig, os.Stdout); err != nil {
+		return err
+	}
+
+	if err = uc.upgradeState.Save(); err != nil {
+		return errors.Wrap(err, "saving upgrade state")
+	}
+
 	if err = upgradeCluster.UpgradeCluster(uc.client, kubeConfig, BuildTag); err != nil {
 		return errors.Wrap(err, "upgrading cluster")
 	}
@@ -420,7 +534,105 @@ func (uc *upgradeCmd) run(cmd *cobra.Command, args []string) error {
 		},
 	}
 	dir, file := filepath.Split(uc.apiModelPath)
-	return f.SaveFile(dir, file, b)
+	if err = f.SaveFile(dir, file, b); err != nil {
+		return err
+	}
+	return uc.upgradeState.Remove()
+}
+
+// runPreflightChecks checks the cluster is healthy enough to be upgraded, prints the results
+// and fails if any check failed, unless --force is specified. The checks are skipped when resuming
+// an interrupted upgrade, as a partially upgraded cluster is expected to fail them
+func (uc *upgradeCmd) runPreflightChecks(kubeConfig string, out io.Writer) error {
+	if uc.resume {
+		log.Infoln("Skipping pre-upgrade checks, resuming an interrupted upgrade")
+		return nil
+	}
+	kubeClient, err := uc.client.GetKubernetesClient("", kubeConfig, preflightDefaultInterval, preflightDefaultTimeout)
+	if err != nil {
+		if uc.force {
+			log.Warnf("Skipping pre-upgrade checks, failed to get a Kubernetes client: %v", err)
+			return nil
+		}
+		return errors.Wrap(err, "getting Kubernetes client for pre-upgrade checks")
+	}
+	checker := &kubernetesupgrade.PreflightChecker{
+		Client:  kubeClient,
+		Masters: uc.getControlPlaneHosts(),
+	}
+	log.Infoln("Running pre-upgrade checks")
+	results := checker.Run(context.Background())
+	if err = writePreflightResults(out, results); err != nil {
+		return errors.Wrap(err, "printing pre-upgrade check results")
+	}
+	if kubernetesupgrade.PreflightFailed(results) {
+		if uc.force {
+			log.Warnln("Pre-upgrade checks failed, proceeding because --force was specified")
+			return nil
+		}
+		return errors.New("pre-upgrade checks failed, fix the failures above or use --force to upgrade anyway")
+	}
+	return nil
+}
+
+// getControlPlaneHosts returns the control plane nodes the pre-upgrade checks and the etcd backup reach through SSH,
+// or nil if no SSH private key was provided
+func (uc *upgradeCmd) getControlPlaneHosts() []*ssh.RemoteHost {
+	if uc.linuxSSHPrivateKeyPath == "" {
+		return nil
+	}
+	authConfig := &ssh.AuthConfig{
+		User:           uc.containerService.Properties.LinuxProfile.AdminUsername,
+		PrivateKeyPath: uc.linuxSSHPrivateKeyPath,
+	}
+	jumpbox := &ssh.JumpBox{URI: uc.sshHostURI, Port: vmssSSHPort, OperatingSystem: api.Linux, AuthConfig: authConfig}
+	if jumpbox.URI == "" {
+		jumpbox.URI = uc.containerService.Properties.MasterProfile.FQDN
+	}
+	if uc.containerService.Properties.MasterProfile.IsAvailabilitySet() {
+		jumpbox.Port = vmasSSHPort
+	}
+	return getMasterHosts(uc.containerService, authConfig, jumpbox)
+}
+
+// getBackupEtcdFunc returns the function that takes an etcd snapshot before the control plane is upgraded,
+// or nil if the snapshot is skipped or the control plane nodes cannot be reached through SSH
+func (uc *upgradeCmd) getBackupEtcdFunc(logger *log.Entry) func() error {
+	if uc.containerService.Properties.MasterProfile.HasCosmosEtcd() {
+		return nil
+	}
+	if uc.skipEtcdBackup {
+		log.Warnln("The etcd snapshot taken before upgrading the control plane will be skipped, --skip-etcd-backup was specified")
+		return nil
+	}
+	masters := uc.getControlPlaneHosts()
+	if masters == nil {
+		log.Warnln("The etcd snapshot taken before upgrading the control plane will be skipped, --linux-ssh-private-key was not specified")
+		return nil
+	}
+	return func() error {
+		dir := filepath.Join(filepath.Dir(uc.upgradeStatePath()), etcdBackupDirectoryName)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return errors.Wrapf(err, "creating directory %s", dir)
+		}
+		snapshotPath := filepath.Join(dir, etcdSnapshotFileName(time.Now()))
+		ctx, cancel := context.WithTimeout(context.Background(), etcdBackupTimeout)
+		defer cancel()
+		if _, err := etcd.NewSnapshotter(masters, logger).Save(ctx, snapshotPath); err != nil {
+			return err
+		}
+		logger.Infof("etcd snapshot saved to %s", snapshotPath)
+		return nil
+	}
+}
+
+func writePreflightResults(out io.Writer, results []kubernetesupgrade.PreflightResult) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', tabwriter.FilterHTML)
+	fmt.Fprintln(w, "STATUS\tCHECK\tTARGET\tMESSAGE")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", strings.ToUpper(string(r.Status)), r.Check, r.Target, r.Message)
+	}
+	return w.Flush()
 }
 
 // isVMSSNameInAgentPoolsArray is a helper func to filter out any VMSS in the cluster resource group
@@ -4,16 +4,22 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/Azure/aks-engine-azurestack/pkg/api/common"
 
 	"github.com/Azure/aks-engine-azurestack/pkg/api"
 	"github.com/Azure/aks-engine-azurestack/pkg/armhelpers"
+	"github.com/Azure/aks-engine-azurestack/pkg/operations/kubernetesupgrade"
+	"github.com/Azure/go-autorest/autorest/to"
 
 	. "github.com/onsi/gomega"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
@@ -109,10 +115,89 @@ func TestUpgradeCommandShouldBeValidated(t *testing.T) {
 				deploymentDirectory: "",
 				upgradeVersion:      "1.9.0",
 				location:            "southcentralus",
+				maxSurge:            1,
 			},
 			expectedErr: nil,
 			name:        "IsValid",
 		},
+		{
+			uc: &upgradeCmd{
+				resourceGroupName:   "test",
+				apiModelPath:        "./not/used",
+				deploymentDirectory: "",
+				upgradeVersion:      "1.9.0",
+				location:            "southcentralus",
+				maxSurge:            0,
+				maxUnavailable:      0,
+			},
+			expectedErr: errors.New("at least one of --max-surge and --max-unavailable must be greater than 0"),
+			name:        "NeedsSurgeOrUnavailable",
+		},
+		{
+			uc: &upgradeCmd{
+				resourceGroupName:   "test",
+				apiModelPath:        "./not/used",
+				deploymentDirectory: "",
+				upgradeVersion:      "1.9.0",
+				location:            "southcentralus",
+				maxSurge:            -1,
+				maxUnavailable:      2,
+			},
+			expectedErr: errors.New("--max-surge and --max-unavailable cannot be negative"),
+			name:        "NeedsNonNegativeSurge",
+		},
+		{
+			uc: &upgradeCmd{
+				resourceGroupName:   "test",
+				apiModelPath:        "./not/used",
+				deploymentDirectory: "",
+				upgradeVersion:      "1.9.0",
+				location:            "southcentralus",
+				maxSurge:            0,
+				maxUnavailable:      3,
+			},
+			expectedErr: nil,
+			name:        "IsValidWithMaxUnavailableOnly",
+		},
+		{
+			uc: &upgradeCmd{
+				resourceGroupName:   "test",
+				apiModelPath:        "./not/used",
+				deploymentDirectory: "",
+				upgradeVersion:      "1.9.0",
+				location:            "southcentralus",
+				maxSurge:            1,
+				vmssUpgradeStrategy: "rolling",
+			},
+			expectedErr: errors.New("--vmss-upgrade-strategy must be one of: replace, in-place"),
+			name:        "InvalidVMSSUpgradeStrategy",
+		},
+		{
+			uc: &upgradeCmd{
+				resourceGroupName:   "test",
+				apiModelPath:        "./not/used",
+				deploymentDirectory: "",
+				upgradeVersion:      "1.9.0",
+				location:            "southcentralus",
+				maxSurge:            1,
+				vmssUpgradeStrategy: "in-place",
+			},
+			expectedErr: nil,
+			name:        "IsValidWithInPlaceVMSSUpgradeStrategy",
+		},
+		{
+			uc: &upgradeCmd{
+				resourceGroupName:   "test",
+				apiModelPath:        "./not/used",
+				deploymentDirectory: "",
+				upgradeVersion:      "",
+				location:            "southcentralus",
+				resume:              true,
+				maxSurge:            1,
+			},
+			expectedErr: nil,
+			name:        "ResumeDoesNotNeedUpgradeVersion",
+		},
 	}
 
 	for _, tc := range cases {
@@ -503,3 +588,103 @@ func TestIsVMSSNameInAgentPoolsArray(t *testing.T) {
 		})
 	}
 }
+
+func TestUpgradeLoadUpgradeState(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir := t.TempDir()
+	apiModelPath := filepath.Join(dir, "apimodel.json")
+	statePath := filepath.Join(dir, kubernetesupgrade.UpgradeStateFilename)
+
+	uc := &upgradeCmd{apiModelPath: apiModelPath, upgradeVersion: "1.24.7", resume: true}
+	err := uc.loadUpgradeState()
+	g.Expect(err).To(MatchError(fmt.Sprintf("--resume was specified but no upgrade state file was found at %s", statePath)))
+
+	// a new journal is not saved until the cluster has been validated
+	uc = &upgradeCmd{apiModelPath: apiModelPath, upgradeVersion: "1.24.7", force: true}
+	g.Expect(uc.loadUpgradeState()).To(Succeed())
+	_, err = os.Stat(statePath)
+	g.Expect(os.IsNotExist(err)).To(BeTrue())
+	g.Expect(uc.upgradeState.Save()).To(Succeed())
+	_, err = os.Stat(statePath)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(uc.upgradeState.SetNodeStep("k8s-master-12345678-0", kubernetesupgrade.MasterPoolName, 0, kubernetesupgrade.NodeUpgradeStepCompleted)).To(Succeed())
+
+	uc = &upgradeCmd{apiModelPath: apiModelPath, upgradeVersion: "1.25.3", resume: true}
+	err = uc.loadUpgradeState()
+	g.Expect(err).To(MatchError("--upgrade-version 1.25.3 does not match the version of the interrupted upgrade (1.24.7)"))
+
+	uc = &upgradeCmd{apiModelPath: apiModelPath, resume: true}
+	g.Expect(uc.loadUpgradeState()).To(Succeed())
+	g.Expect(uc.upgradeVersion).To(Equal("1.24.7"))
+	g.Expect(uc.force).To(BeTrue())
+	g.Expect(uc.upgradeState.NodeStep("k8s-master-12345678-0")).To(Equal(kubernetesupgrade.NodeUpgradeStepCompleted))
+
+	uc = &upgradeCmd{deploymentDirectory: dir}
+	g.Expect(uc.upgradeStatePath()).To(Equal(statePath))
+}
+
+func TestUpgradeRunPreflightChecks(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// the mock Kubernetes client lists a node that is not Ready
+	uc := &upgradeCmd{client: &armhelpers.MockAKSEngineClient{}}
+	var out bytes.Buffer
+	err := uc.runPreflightChecks("kubeconfig", &out)
+	g.Expect(err).To(MatchError("pre-upgrade checks failed, fix the failures above or use --force to upgrade anyway"))
+	g.Expect(out.String()).To(ContainSubstring("STATUS"))
+	g.Expect(out.String()).To(MatchRegexp(`FAIL\s+node ready\s+k8s-agentpool3-1234\s+node is not Ready`))
+	g.Expect(out.String()).To(MatchRegexp(`WARN\s+etcd health\s+control plane`))
+
+	// --force reports the failures but proceeds anyway
+	uc.force = true
+	out.Reset()
+	g.Expect(uc.runPreflightChecks("kubeconfig", &out)).To(Succeed())
+	g.Expect(out.String()).To(ContainSubstring("FAIL"))
+
+	uc = &upgradeCmd{client: &armhelpers.MockAKSEngineClient{FailGetKubernetesClient: true}}
+	g.Expect(uc.runPreflightChecks("kubeconfig", &out)).To(MatchError("getting Kubernetes client for pre-upgrade checks: GetKubernetesClient failed"))
+	uc.force = true
+	g.Expect(uc.runPreflightChecks("kubeconfig", &out)).To(Succeed())
+	uc.force = false
+
+	// a partially upgraded cluster is expected to fail the checks
+	uc.resume = true
+	g.Expect(uc.runPreflightChecks("kubeconfig", &out)).To(Succeed())
+}
+
+func TestUpgradeGetControlPlaneHosts(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	cs := api.CreateMockContainerService("testcluster", "1.23.13", 3, 1, false)
+	uc := &upgradeCmd{containerService: cs}
+	g.Expect(uc.getControlPlaneHosts()).To(BeNil())
+
+	uc.linuxSSHPrivateKeyPath = "id_rsa"
+	masters := uc.getControlPlaneHosts()
+	g.Expect(masters).To(HaveLen(3))
+	g.Expect(masters[0].URI).To(Equal(cs.Properties.GetMasterVMNameList()[0]))
+	g.Expect(masters[0].Jumpbox.URI).To(Equal(cs.Properties.MasterProfile.FQDN))
+	g.Expect(masters[0].AuthConfig.PrivateKeyPath).To(Equal("id_rsa"))
+
+	uc.sshHostURI = "jumpbox.example.com"
+	g.Expect(uc.getControlPlaneHosts()[0].Jumpbox.URI).To(Equal("jumpbox.example.com"))
+}
+
+func TestUpgradeGetBackupEtcdFunc(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	cs := api.CreateMockContainerService("testcluster", "1.23.13", 3, 1, false)
+	uc := &upgradeCmd{containerService: cs}
+	logger := log.NewEntry(log.New())
+	g.Expect(uc.getBackupEtcdFunc(logger)).To(BeNil())
+
+	uc.linuxSSHPrivateKeyPath = "id_rsa"
+	g.Expect(uc.getBackupEtcdFunc(logger)).NotTo(BeNil())
+
+	uc.skipEtcdBackup = true
+	g.Expect(uc.getBackupEtcdFunc(logger)).To(BeNil())
+	uc.skipEtcdBackup = false
+
+	cs.Properties.MasterProfile.CosmosEtcd = to.BoolPtr(true)
+	g.Expect(uc.getBackupEtcdFunc(logger)).To(BeNil())
+}
@@ -38,6 +38,7 @@ require (
 	k8s.io/api v0.21.10
 	k8s.io/apimachinery v0.21.10
 	k8s.io/client-go v0.21.10
+	sigs.k8s.io/yaml v1.2.0
 )
 
 require (
@@ -84,5 +85,4 @@ require (
 	k8s.io/klog/v2 v2.9.0 // indirect
 	k8s.io/utils v0.0.0-20210521133846-da695404a2bc // indirect
 	sigs.k8s.io/structured-merge-diff/v4 v4.2.1 // indirect
-	sigs.k8s.io/yaml v1.2.0 // indirect
 )
@@ -35,6 +35,44 @@ cp_certs() {
   rm -f /var/lib/kubelet/pki/kubelet-client-current.pem
 }
 
+cp_leaf_certs() {
+  for f in ${NEW_CERTS_DIR}/*.crt ${NEW_CERTS_DIR}/*.key; do
+    if [ -f "$f" ]; then
+      cp -p "$f" /etc/kubernetes/certs/
+    fi
+  done
+  if [ -f ${NEW_CERTS_DIR}/kubeconfig ]; then
+    cp -p ${NEW_CERTS_DIR}/kubeconfig /home/$(logname)/.kube/config
+  fi
+  if [ -f ${NEW_CERTS_DIR}/client.crt ]; then
+    rm -f /var/lib/kubelet/pki/kubelet-client-current.pem
+  fi
+}
+
+# the kubelet stops a static pod once its manifest is removed and starts it again when the manifest is back
+restart_static_pod() {
+  local manifest=/etc/kubernetes/manifests/$1.yaml
+  if [ ! -f ${manifest} ]; then
+    return 0
+  fi
+  mv ${manifest} ${WD}/$1.yaml
+  sleep 30
+  mv ${WD}/$1.yaml ${manifest}
+}
+
+restart_components() {
+  for component in "$@"; do
+    case ${component} in
+      etcd|kubelet)
+        systemctl_restart 10 5 30 ${component}
+        ;;
+      *)
+        restart_static_pod ${component}
+        ;;
+    esac
+  done
+}
+
 cp_proxy() {
   source /etc/environment
   local NODE_INDEX
@@ -636,7 +636,12 @@ func convertServicePrincipalProfileToVLabs(api *ServicePrincipalProfile, v *vlab
 
 func convertCertificateProfileToVLabs(api *CertificateProfile, vlabs *vlabs.CertificateProfile) {
 	vlabs.CaCertificate = api.CaCertificate
-	vlabs.CaPrivateKey = api.CaPrivateKey
+	// the private key of a CA stored in keyvault is not persisted
+	if api.CaKeyvaultSecretRef == nil {
+		vlabs.CaPrivateKey = api.CaPrivateKey
+	}
+	vlabs.CaCertificateChain = api.CaCertificateChain
+	vlabs.CaKeyvaultSecretRef = convertKeyvaultSecretRefToVLabs(api.CaKeyvaultSecretRef)
 	vlabs.APIServerCertificate = api.APIServerCertificate
 	vlabs.APIServerPrivateKey = api.APIServerPrivateKey
 	vlabs.ClientCertificate = api.ClientCertificate
@@ -649,6 +654,21 @@ func convertCertificateProfileToVLabs(api *CertificateProfile, vlabs *vlabs.Cert
 	vlabs.EtcdClientPrivateKey = api.EtcdClientPrivateKey
 	vlabs.EtcdPeerCertificates = api.EtcdPeerCertificates
 	vlabs.EtcdPeerPrivateKeys = api.EtcdPeerPrivateKeys
+	vlabs.KeyAlgorithm = api.KeyAlgorithm
+	vlabs.CaValidityDays = api.CaValidityDays
+	vlabs.ServerValidityDays = api.ServerValidityDays
+	vlabs.ClientValidityDays = api.ClientValidityDays
+}
+
+func convertKeyvaultSecretRefToVLabs(api *KeyvaultSecretRef) *vlabs.KeyvaultSecretRef {
+	if api == nil {
+		return nil
+	}
+	return &vlabs.KeyvaultSecretRef{
+		VaultID:       api.VaultID,
+		SecretName:    api.SecretName,
+		SecretVersion: api.SecretVersion,
+	}
 }
 
 func convertAADProfileToVLabs(api *AADProfile, vlabs *vlabs.AADProfile) {
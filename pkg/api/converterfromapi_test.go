@@ -728,6 +728,25 @@ func TestConvertTelemetryProfileToVLabs(t *testing.T) {
 	}
 }
 
+func TestConvertKeyvaultCaToVLabs(t *testing.T) {
+	cs := getDefaultContainerService()
+	cs.Properties.CertificateProfile = &CertificateProfile{
+		CaCertificate:       "cert",
+		CaPrivateKey:        "key",
+		CaCertificateChain:  "chain",
+		CaKeyvaultSecretRef: &KeyvaultSecretRef{VaultID: "vaultID", SecretName: "ca"},
+	}
+
+	p := ConvertContainerServiceToVLabs(cs).Properties.CertificateProfile
+
+	if p.CaPrivateKey != "" {
+		t.Error("expected ConvertContainerServiceToVLabs not to persist the private key of the keyvault CA")
+	}
+	if p.CaCertificate != "cert" || p.CaCertificateChain != "chain" || p.CaKeyvaultSecretRef == nil || p.CaKeyvaultSecretRef.SecretName != "ca" {
+		t.Errorf("expected ConvertContainerServiceToVLabs to keep the keyvault CA certificate, chain and reference, got %+v", p)
+	}
+}
+
 func TestConvertWindowsProfileToVlabs(t *testing.T) {
 	falseVar := false
 
@@ -684,6 +684,14 @@ func convertVLabsServicePrincipalProfile(vlabs *vlabs.ServicePrincipalProfile, a
 func convertVLabsCertificateProfile(vlabs *vlabs.CertificateProfile, api *CertificateProfile) {
 	api.CaCertificate = vlabs.CaCertificate
 	api.CaPrivateKey = vlabs.CaPrivateKey
+	api.CaCertificateChain = vlabs.CaCertificateChain
+	if vlabs.CaKeyvaultSecretRef != nil {
+		api.CaKeyvaultSecretRef = &KeyvaultSecretRef{
+			VaultID:       vlabs.CaKeyvaultSecretRef.VaultID,
+			SecretName:    vlabs.CaKeyvaultSecretRef.SecretName,
+			SecretVersion: vlabs.CaKeyvaultSecretRef.SecretVersion,
+		}
+	}
 	api.APIServerCertificate = vlabs.APIServerCertificate
 	api.APIServerPrivateKey = vlabs.APIServerPrivateKey
 	api.ClientCertificate = vlabs.ClientCertificate
@@ -696,6 +704,10 @@ func convertVLabsCertificateProfile(vlabs *vlabs.CertificateProfile, api *Certif
 	api.EtcdClientPrivateKey = vlabs.EtcdClientPrivateKey
 	api.EtcdPeerCertificates = vlabs.EtcdPeerCertificates
 	api.EtcdPeerPrivateKeys = vlabs.EtcdPeerPrivateKeys
+	api.KeyAlgorithm = vlabs.KeyAlgorithm
+	api.CaValidityDays = vlabs.CaValidityDays
+	api.ServerValidityDays = vlabs.ServerValidityDays
+	api.ClientValidityDays = vlabs.ClientValidityDays
 }
 
 func convertVLabsAADProfile(vlabs *vlabs.AADProfile, api *AADProfile) {
@@ -963,46 +963,23 @@ func (cs *ContainerService) SetDefaultCerts(params DefaultCertParams) (bool, []n
 
 	provided := certsAlreadyPresent(p.CertificateProfile, p.MasterProfile.Count)
 
-	if areAllTrue(provided) {
-		return false, nil, nil
-	}
-
-	var azureProdFQDNs []string
-	for _, location := range cs.GetLocations() {
-		azureProdFQDNs = append(azureProdFQDNs, FormatProdFQDNByLocation(p.MasterProfile.DNSPrefix, location, p.GetCustomCloudName()))
-	}
-
-	masterExtraFQDNs := append(azureProdFQDNs, p.MasterProfile.SubjectAltNames...)
-	masterExtraFQDNs = append(masterExtraFQDNs, "localhost")
-	firstMasterIP := net.ParseIP(p.MasterProfile.FirstConsecutiveStaticIP).To4()
-	localhostIP := net.ParseIP("127.0.0.1").To4()
-
-	if firstMasterIP == nil {
-		return false, nil, errors.Errorf("MasterProfile.FirstConsecutiveStaticIP '%s' is an invalid IP address", p.MasterProfile.FirstConsecutiveStaticIP)
+	// the private key of a CA stored in keyvault is not persisted in the api model,
+	// it is only needed when certificates have to be issued
+	if p.CertificateProfile != nil && p.CertificateProfile.CaKeyvaultSecretRef != nil && p.CertificateProfile.CaPrivateKey == "" {
+		provided["ca"] = true
+		if areAllTrue(provided) {
+			return false, nil, nil
+		}
+		return false, nil, errors.New("the certificate authority referenced by certificateProfile.caKeyvaultSecretRef has not been retrieved from keyvault")
 	}
 
-	ips := []net.IP{firstMasterIP, localhostIP}
-
-	// Include the Internal load balancer as well
-	if p.MasterProfile.IsVirtualMachineScaleSets() {
-		ips = append(ips, net.IP{firstMasterIP[0], firstMasterIP[1], byte(255), byte(DefaultInternalLbStaticIPOffset)})
-	} else {
-		// Add the Internal Loadbalancer IP which is always at p known offset from the firstMasterIP
-		ips = append(ips, net.IP{firstMasterIP[0], firstMasterIP[1], firstMasterIP[2], firstMasterIP[3] + byte(DefaultInternalLbStaticIPOffset)})
+	if areAllTrue(provided) {
+		return false, nil, nil
 	}
 
-	var offsetMultiplier int
-	if p.MasterProfile.IsVirtualMachineScaleSets() {
-		offsetMultiplier = p.MasterProfile.IPAddressCount
-	} else {
-		offsetMultiplier = 1
-	}
-	addr := binary.BigEndian.Uint32(firstMasterIP)
-	for i := 1; i < p.MasterProfile.Count; i++ {
-		newAddr := getNewAddr(addr, i, offsetMultiplier)
-		ip := make(net.IP, 4)
-		binary.BigEndian.PutUint32(ip, newAddr)
-		ips = append(ips, ip)
+	masterExtraFQDNs, ips, err := cs.getMasterExtraSANs()
+	if err != nil {
+		return false, nil, err
 	}
 	if p.CertificateProfile == nil {
 		p.CertificateProfile = &CertificateProfile{}
@@ -1013,10 +990,11 @@ func (cs *ContainerService) SetDefaultCerts(params DefaultCertParams) (bool, []n
 	if provided["ca"] {
 		caPair = &helpers.PkiKeyCertPair{CertificatePem: p.CertificateProfile.CaCertificate, PrivateKeyPem: p.CertificateProfile.CaPrivateKey}
 	} else {
-		var err error
 		pkiKeyCertPairParams := helpers.PkiKeyCertPairParams{
-			CommonName: "ca",
-			PkiKeySize: params.PkiKeySize,
+			CommonName:   "ca",
+			PkiKeySize:   params.PkiKeySize,
+			KeyAlgorithm: p.CertificateProfile.GetKeyAlgorithm(),
+			Validity:     p.CertificateProfile.GetCaValidity(),
 		}
 
 		caPair, err = helpers.CreatePkiKeyCertPair(pkiKeyCertPairParams)
@@ -1028,17 +1006,7 @@ func (cs *ContainerService) SetDefaultCerts(params DefaultCertParams) (bool, []n
 		p.CertificateProfile.CaPrivateKey = caPair.PrivateKeyPem
 	}
 
-	serviceCIDR := p.OrchestratorProfile.KubernetesConfig.ServiceCIDR
-
-	// all validation for dual stack done with primary service cidr as that is considered
-	// the default ip family for cluster.
-	if cs.Properties.FeatureFlags.IsFeatureEnabled("EnableIPv6DualStack") {
-		// split service cidrs
-		serviceCIDRs := strings.Split(serviceCIDR, ",")
-		serviceCIDR = serviceCIDRs[0]
-	}
-
-	cidrFirstIP, err := common.CidrStringFirstIP(serviceCIDR)
+	cidrFirstIP, err := cs.getFirstServiceIP()
 	if err != nil {
 		return false, ips, err
 	}
@@ -1051,6 +1019,9 @@ func (cs *ContainerService) SetDefaultCerts(params DefaultCertParams) (bool, []n
 	pkiParams.ExtraIPs = ips
 	pkiParams.MasterCount = p.MasterProfile.Count
 	pkiParams.PkiKeySize = params.PkiKeySize
+	pkiParams.KeyAlgorithm = p.CertificateProfile.GetKeyAlgorithm()
+	pkiParams.ServerValidity = p.CertificateProfile.GetServerValidity()
+	pkiParams.ClientValidity = p.CertificateProfile.GetClientValidity()
 	apiServerPair, clientPair, kubeConfigPair, etcdServerPair, etcdClientPair, etcdPeerPairs, err :=
 		helpers.CreatePki(pkiParams)
 	if err != nil {
@@ -1086,6 +1057,91 @@ func (cs *ContainerService) SetDefaultCerts(params DefaultCertParams) (bool, []n
 	return true, ips, nil
 }
 
+// GetMasterPkiParams returns the parameters used to issue the control plane certificates signed by caPair
+func (cs *ContainerService) GetMasterPkiParams(caPair *helpers.PkiKeyCertPair, pkiKeySize int) (helpers.PkiParams, error) {
+	p := cs.Properties
+	if p.MasterProfile == nil {
+		return helpers.PkiParams{}, errors.New("MasterProfile is not set")
+	}
+	masterExtraFQDNs, ips, err := cs.getMasterExtraSANs()
+	if err != nil {
+		return helpers.PkiParams{}, err
+	}
+	cidrFirstIP, err := cs.getFirstServiceIP()
+	if err != nil {
+		return helpers.PkiParams{}, err
+	}
+	return helpers.PkiParams{
+		CaPair:         caPair,
+		ClusterDomain:  DefaultKubernetesClusterDomain,
+		ExtraFQDNs:     masterExtraFQDNs,
+		ExtraIPs:       append(ips, cidrFirstIP),
+		MasterCount:    p.MasterProfile.Count,
+		PkiKeySize:     pkiKeySize,
+		KeyAlgorithm:   p.CertificateProfile.GetKeyAlgorithm(),
+		ServerValidity: p.CertificateProfile.GetServerValidity(),
+		ClientValidity: p.CertificateProfile.GetClientValidity(),
+	}, nil
+}
+
+// getMasterExtraSANs returns the DNS names and IP addresses the control plane certificates are issued for
+func (cs *ContainerService) getMasterExtraSANs() ([]string, []net.IP, error) {
+	p := cs.Properties
+	var azureProdFQDNs []string
+	for _, location := range cs.GetLocations() {
+		azureProdFQDNs = append(azureProdFQDNs, FormatProdFQDNByLocation(p.MasterProfile.DNSPrefix, location, p.GetCustomCloudName()))
+	}
+
+	masterExtraFQDNs := append(azureProdFQDNs, p.MasterProfile.SubjectAltNames...)
+	masterExtraFQDNs = append(masterExtraFQDNs, "localhost")
+	firstMasterIP := net.ParseIP(p.MasterProfile.FirstConsecutiveStaticIP).To4()
+	localhostIP := net.ParseIP("127.0.0.1").To4()
+
+	if firstMasterIP == nil {
+		return nil, nil, errors.Errorf("MasterProfile.FirstConsecutiveStaticIP '%s' is an invalid IP address", p.MasterProfile.FirstConsecutiveStaticIP)
+	}
+
+	ips := []net.IP{firstMasterIP, localhostIP}
+
+	// Include the Internal load balancer as well
+	if p.MasterProfile.IsVirtualMachineScaleSets() {
+		ips = append(ips, net.IP{firstMasterIP[0], firstMasterIP[1], byte(255), byte(DefaultInternalLbStaticIPOffset)})
+	} else {
+		// Add the Internal Loadbalancer IP which is always at p known offset from the firstMasterIP
+		ips = append(ips, net.IP{firstMasterIP[0], firstMasterIP[1], firstMasterIP[2], firstMasterIP[3] + byte(DefaultInternalLbStaticIPOffset)})
+	}
+
+	var offsetMultiplier int
+	if p.MasterProfile.IsVirtualMachineScaleSets() {
+		offsetMultiplier = p.MasterProfile.IPAddressCount
+	} else {
+		offsetMultiplier = 1
+	}
+	addr := binary.BigEndian.Uint32(firstMasterIP)
+	for i := 1; i < p.MasterProfile.Count; i++ {
+		newAddr := getNewAddr(addr, i, offsetMultiplier)
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, newAddr)
+		ips = append(ips, ip)
+	}
+	return masterExtraFQDNs, ips, nil
+}
+
+// getFirstServiceIP returns the first IP address of the (primary) service CIDR
+func (cs *ContainerService) getFirstServiceIP() (net.IP, error) {
+	serviceCIDR := cs.Properties.OrchestratorProfile.KubernetesConfig.ServiceCIDR
+
+	// all validation for dual stack done with primary service cidr as that is considered
+	// the default ip family for cluster.
+	if cs.Properties.FeatureFlags.IsFeatureEnabled("EnableIPv6DualStack") {
+		// split service cidrs
+		serviceCIDRs := strings.Split(serviceCIDR, ",")
+		serviceCIDR = serviceCIDRs[0]
+	}
+
+	return common.CidrStringFirstIP(serviceCIDR)
+}
+
 func areAllTrue(m map[string]bool) bool {
 	for _, v := range m {
 		if !v {
@@ -4,6 +4,7 @@
 package api
 
 import (
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/binary"
 	"fmt"
@@ -13,6 +14,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-12-01/compute"
 	"github.com/Azure/go-autorest/autorest/azure"
@@ -3933,6 +3935,105 @@ func TestSetCertDefaultsVMSS(t *testing.T) {
 	}
 }
 
+func TestSetCertDefaultsKeyAlgorithmAndValidity(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", "1.18.2", 1, 1, false)
+	cs.Properties.MasterProfile.FirstConsecutiveStaticIP = "10.239.255.239"
+	cs.Properties.CertificateProfile = &CertificateProfile{
+		KeyAlgorithm:       helpers.PkiKeyAlgorithmECDSA,
+		CaValidityDays:     3650,
+		ServerValidityDays: 365,
+		ClientValidityDays: 90,
+	}
+	if _, _, err := cs.SetDefaultCerts(DefaultCertParams{PkiKeySize: helpers.DefaultPkiKeySize}); err != nil {
+		t.Fatalf("unexpected error thrown while executing SetDefaultCerts %s", err.Error())
+	}
+
+	p := cs.Properties.CertificateProfile
+	for certificate, days := range map[string]int{
+		p.CaCertificate:         3650,
+		p.APIServerCertificate:  365,
+		p.EtcdServerCertificate: 365,
+		p.ClientCertificate:     90,
+		p.KubeConfigCertificate: 90,
+		p.EtcdClientCertificate: 90,
+	} {
+		c, err := helpers.ParseCertificate(certificate)
+		if err != nil {
+			t.Fatalf("unexpected error parsing certificate %s", err.Error())
+		}
+		if c.PublicKeyAlgorithm != x509.ECDSA {
+			t.Errorf("expected an ECDSA key for %s, got %s", c.Subject.CommonName, c.PublicKeyAlgorithm)
+		}
+		if expected := time.Duration(days) * 24 * time.Hour; c.NotAfter.Sub(c.NotBefore) != expected {
+			t.Errorf("expected %s to be valid for %s, got %s", c.Subject.CommonName, expected, c.NotAfter.Sub(c.NotBefore))
+		}
+	}
+
+	pkiParams, err := cs.GetMasterPkiParams(&helpers.PkiKeyCertPair{CertificatePem: p.CaCertificate, PrivateKeyPem: p.CaPrivateKey}, helpers.DefaultPkiKeySize)
+	if err != nil {
+		t.Fatalf("unexpected error thrown while executing GetMasterPkiParams %s", err.Error())
+	}
+	if pkiParams.KeyAlgorithm != helpers.PkiKeyAlgorithmECDSA || pkiParams.ServerValidity != 365*24*time.Hour || pkiParams.ClientValidity != 90*24*time.Hour {
+		t.Errorf("expected GetMasterPkiParams to honor the certificate profile settings, got %+v", pkiParams)
+	}
+}
+
+func TestSetCertDefaultsExternalCa(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", "1.18.2", 1, 1, false)
+	cs.Properties.MasterProfile.FirstConsecutiveStaticIP = "10.239.255.239"
+	cs.Properties.CertificateProfile = &CertificateProfile{
+		CaKeyvaultSecretRef: &KeyvaultSecretRef{VaultID: "vaultID", SecretName: "ca"},
+	}
+	if _, _, err := cs.SetDefaultCerts(DefaultCertParams{PkiKeySize: helpers.DefaultPkiKeySize}); err == nil {
+		t.Fatalf("expected SetDefaultCerts to fail when the keyvault CA has not been retrieved")
+	}
+	if cs.Properties.CertificateProfile.CaCertificate != "" {
+		t.Fatalf("expected SetDefaultCerts not to generate a CA in place of the keyvault CA")
+	}
+
+	caPair, err := helpers.CreatePkiKeyCertPair(helpers.PkiKeyCertPairParams{CommonName: "intermediate", PkiKeySize: helpers.DefaultPkiKeySize})
+	if err != nil {
+		t.Fatalf("unexpected error generating the CA %s", err.Error())
+	}
+	cs.Properties.CertificateProfile = &CertificateProfile{
+		CaCertificate:      caPair.CertificatePem,
+		CaPrivateKey:       caPair.PrivateKeyPem,
+		CaCertificateChain: "chain\n",
+	}
+	if _, _, err = cs.SetDefaultCerts(DefaultCertParams{PkiKeySize: helpers.DefaultPkiKeySize}); err != nil {
+		t.Fatalf("unexpected error thrown while executing SetDefaultCerts %s", err.Error())
+	}
+	p := cs.Properties.CertificateProfile
+	if p.CaCertificate != caPair.CertificatePem || p.CaCertificateChain != "chain\n" {
+		t.Fatalf("expected SetDefaultCerts to keep the external CA and its chain")
+	}
+	c, err := helpers.ParseCertificate(p.APIServerCertificate)
+	if err != nil {
+		t.Fatalf("unexpected error parsing certificate %s", err.Error())
+	}
+	if c.Issuer.CommonName != "intermediate" {
+		t.Errorf("expected the apiserver certificate to be issued by the external CA, got %s", c.Issuer.CommonName)
+	}
+	if expected := strings.TrimSuffix(caPair.CertificatePem, "\n") + "\nchain\n"; p.GetCaCertificateBundle() != expected {
+		t.Errorf("expected the CA certificate bundle %q, got %q", expected, p.GetCaCertificateBundle())
+	}
+
+	// the api model of a deployed cluster holds the certificates but not the keyvault CA private key
+	p.CaPrivateKey = ""
+	p.CaKeyvaultSecretRef = &KeyvaultSecretRef{VaultID: "vaultID", SecretName: "ca"}
+	generated, _, err := cs.SetDefaultCerts(DefaultCertParams{PkiKeySize: helpers.DefaultPkiKeySize})
+	if err != nil {
+		t.Fatalf("unexpected error thrown while executing SetDefaultCerts %s", err.Error())
+	}
+	if generated {
+		t.Errorf("expected SetDefaultCerts not to generate certificates when they are all present")
+	}
+	p.APIServerCertificate = ""
+	if _, _, err = cs.SetDefaultCerts(DefaultCertParams{PkiKeySize: helpers.DefaultPkiKeySize}); err == nil {
+		t.Errorf("expected SetDefaultCerts to fail issuing a certificate without the keyvault CA private key")
+	}
+}
+
 func TestProxyModeDefaults(t *testing.T) {
 	// Test that default is what we expect
 	mockCS := getMockBaseContainerService("1.10.12")
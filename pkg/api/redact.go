@@ -0,0 +1,89 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package api
+
+import (
+	"reflect"
+)
+
+const (
+	// RedactedValue replaces the value of the redacted fields
+	RedactedValue = "REDACTED"
+	// redactTagKey is the struct tag key used to flag the fields that should be redacted
+	redactTagKey = "conform"
+	// redactTagValue is the struct tag value used to flag the fields that should be redacted
+	redactTagValue = "redact"
+)
+
+// redactedAddonConfigKeys are the addon config entries holding secrets, map entries can't be tagged
+var redactedAddonConfigKeys = []string{"workspaceKey"}
+
+// Redact replaces with RedactedValue the non-empty values of the fields tagged `conform:"redact"`
+// and of the addon config entries listed in redactedAddonConfigKeys
+func (cs *ContainerService) Redact() {
+	redact(reflect.ValueOf(cs))
+	if cs.Properties == nil || cs.Properties.OrchestratorProfile == nil || cs.Properties.OrchestratorProfile.KubernetesConfig == nil {
+		return
+	}
+	for _, addon := range cs.Properties.OrchestratorProfile.KubernetesConfig.Addons {
+		for _, key := range redactedAddonConfigKeys {
+			if addon.Config[key] != "" {
+				addon.Config[key] = RedactedValue
+			}
+		}
+	}
+}
+
+// redact walks v and replaces the non-empty values of the redactable string and []string fields
+func redact(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			redact(v.Elem())
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Field(i)
+			if !f.CanSet() {
+				continue
+			}
+			if t.Field(i).Tag.Get(redactTagKey) == redactTagValue {
+				redactValue(f)
+				continue
+			}
+			redact(f)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			redact(v.Index(i))
+		}
+	case reflect.Map:
+		// map values are not addressable, only the values referenced by pointers can be walked
+		iter := v.MapRange()
+		for iter.Next() {
+			if iter.Value().Kind() == reflect.Ptr {
+				redact(iter.Value())
+			}
+		}
+	}
+}
+
+func redactValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		if v.String() != "" {
+			v.SetString(RedactedValue)
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			if v.Index(i).String() != "" {
+				v.Index(i).SetString(RedactedValue)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package api
+
+import (
+	"testing"
+)
+
+func TestContainerServiceRedact(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", "", 3, 2, true)
+	cs.Properties.ServicePrincipalProfile = &ServicePrincipalProfile{
+		ClientID: "clientID",
+		Secret:   "secret",
+	}
+	cs.Properties.CertificateProfile.CaPrivateKey = "caKey"
+	cs.Properties.CertificateProfile.APIServerPrivateKey = ""
+	cs.Properties.CertificateProfile.EtcdPeerPrivateKeys = []string{"peer0", "", "peer2"}
+	cs.Properties.WindowsProfile = &WindowsProfile{
+		AdminUsername: "azureuser",
+		AdminPassword: "password",
+	}
+	cs.Properties.LinuxProfile.CustomSearchDomain = &CustomSearchDomain{
+		Name:          "example.com",
+		RealmUser:     "user",
+		RealmPassword: "password",
+	}
+	cs.Properties.AADProfile = &AADProfile{
+		ServerAppID:     "serverAppID",
+		ServerAppSecret: "serverAppSecret",
+	}
+	cs.Properties.OrchestratorProfile.KubernetesConfig.EtcdEncryptionKey = "etcdEncryptionKey"
+	cs.Properties.TelemetryProfile = &TelemetryProfile{
+		ApplicationInsightsKey: "applicationInsightsKey",
+	}
+	cs.Properties.OrchestratorProfile.KubernetesConfig.Addons = []KubernetesAddon{
+		{
+			Name: "container-monitoring",
+			Config: map[string]string{
+				"workspaceGuid": "workspaceGuid",
+				"workspaceKey":  "workspaceKey",
+			},
+		},
+	}
+
+	cs.Redact()
+
+	if cs.Properties.ServicePrincipalProfile.Secret != RedactedValue {
+		t.Errorf("expected ServicePrincipalProfile.Secret to be redacted, got %s", cs.Properties.ServicePrincipalProfile.Secret)
+	}
+	if cs.Properties.ServicePrincipalProfile.ClientID != "clientID" {
+		t.Errorf("expected ServicePrincipalProfile.ClientID to be left unchanged, got %s", cs.Properties.ServicePrincipalProfile.ClientID)
+	}
+	if cs.Properties.CertificateProfile.CaPrivateKey != RedactedValue {
+		t.Errorf("expected CertificateProfile.CaPrivateKey to be redacted, got %s", cs.Properties.CertificateProfile.CaPrivateKey)
+	}
+	if cs.Properties.CertificateProfile.APIServerPrivateKey != "" {
+		t.Errorf("expected empty CertificateProfile.APIServerPrivateKey to be left empty, got %s", cs.Properties.CertificateProfile.APIServerPrivateKey)
+	}
+	expectedPeerKeys := []string{RedactedValue, "", RedactedValue}
+	for i, k := range cs.Properties.CertificateProfile.EtcdPeerPrivateKeys {
+		if k != expectedPeerKeys[i] {
+			t.Errorf("expected CertificateProfile.EtcdPeerPrivateKeys[%d] to be %q, got %q", i, expectedPeerKeys[i], k)
+		}
+	}
+	if cs.Properties.WindowsProfile.AdminPassword != RedactedValue {
+		t.Errorf("expected WindowsProfile.AdminPassword to be redacted, got %s", cs.Properties.WindowsProfile.AdminPassword)
+	}
+	if cs.Properties.LinuxProfile.CustomSearchDomain.RealmPassword != RedactedValue {
+		t.Errorf("expected CustomSearchDomain.RealmPassword to be redacted, got %s", cs.Properties.LinuxProfile.CustomSearchDomain.RealmPassword)
+	}
+	if cs.Properties.AADProfile.ServerAppSecret != RedactedValue {
+		t.Errorf("expected AADProfile.ServerAppSecret to be redacted, got %s", cs.Properties.AADProfile.ServerAppSecret)
+	}
+	if cs.Properties.AADProfile.ServerAppID != "serverAppID" {
+		t.Errorf("expected AADProfile.ServerAppID to be left unchanged, got %s", cs.Properties.AADProfile.ServerAppID)
+	}
+	if cs.Properties.OrchestratorProfile.KubernetesConfig.EtcdEncryptionKey != RedactedValue {
+		t.Errorf("expected KubernetesConfig.EtcdEncryptionKey to be redacted, got %s", cs.Properties.OrchestratorProfile.KubernetesConfig.EtcdEncryptionKey)
+	}
+	if cs.Properties.TelemetryProfile.ApplicationInsightsKey != RedactedValue {
+		t.Errorf("expected TelemetryProfile.ApplicationInsightsKey to be redacted, got %s", cs.Properties.TelemetryProfile.ApplicationInsightsKey)
+	}
+	addonConfig := cs.Properties.OrchestratorProfile.KubernetesConfig.Addons[0].Config
+	if addonConfig["workspaceKey"] != RedactedValue {
+		t.Errorf("expected the workspaceKey addon config to be redacted, got %s", addonConfig["workspaceKey"])
+	}
+	if addonConfig["workspaceGuid"] != "workspaceGuid" {
+		t.Errorf("expected the workspaceGuid addon config to be left unchanged, got %s", addonConfig["workspaceGuid"])
+	}
+}
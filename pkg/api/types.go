@@ -13,6 +13,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Azure/aks-engine-azurestack/pkg/api/common"
 	"github.com/Azure/aks-engine-azurestack/pkg/api/vlabs"
@@ -103,6 +104,10 @@ type CertificateProfile struct {
 	CaCertificate string `json:"caCertificate,omitempty" conform:"redact"`
 	// CaPrivateKey is the certificate authority key.
 	CaPrivateKey string `json:"caPrivateKey,omitempty" conform:"redact"`
+	// CaCertificateChain is the certificate chain of the authorities that issued the CA, when the CA is an intermediate of an external PKI
+	CaCertificateChain string `json:"caCertificateChain,omitempty"`
+	// CaKeyvaultSecretRef is a reference to a keyvault secret holding the CA private key, certificate and chain
+	CaKeyvaultSecretRef *KeyvaultSecretRef `json:"caKeyvaultSecretRef,omitempty"`
 	// ApiServerCertificate is the rest api server certificate, and signed by the CA
 	APIServerCertificate string `json:"apiServerCertificate,omitempty" conform:"redact"`
 	// ApiServerPrivateKey is the rest api server private key, and signed by the CA
@@ -127,6 +132,14 @@ type CertificateProfile struct {
 	EtcdPeerCertificates []string `json:"etcdPeerCertificates,omitempty" conform:"redact"`
 	// EtcdPeerPrivateKeys is list of etcd peer private keys, and signed by the CA
 	EtcdPeerPrivateKeys []string `json:"etcdPeerPrivateKeys,omitempty" conform:"redact"`
+	// KeyAlgorithm is the algorithm of the generated private keys, RSA (default) or ECDSA
+	KeyAlgorithm string `json:"keyAlgorithm,omitempty"`
+	// CaValidityDays is the validity in days of a generated CA certificate
+	CaValidityDays int `json:"caValidityDays,omitempty"`
+	// ServerValidityDays is the validity in days of the apiserver, etcd server and etcd peer certificates
+	ServerValidityDays int `json:"serverValidityDays,omitempty"`
+	// ClientValidityDays is the validity in days of the client, kubeconfig and etcd client certificates
+	ClientValidityDays int `json:"clientValidityDays,omitempty"`
 }
 
 // LinuxProfile represents the linux parameters passed to the cluster
@@ -155,7 +168,7 @@ type PublicKey struct {
 type CustomSearchDomain struct {
 	Name          string `json:"name,omitempty"`
 	RealmUser     string `json:"realmUser,omitempty"`
-	RealmPassword string `json:"realmPassword,omitempty"`
+	RealmPassword string `json:"realmPassword,omitempty" conform:"redact"`
 }
 
 // CustomNodesDNS represents the Search Domain when the custom vnet for a custom DNS as a nameserver.
@@ -435,7 +448,7 @@ type KubernetesConfig struct {
 	EtcdVersion                         string                `json:"etcdVersion,omitempty"`
 	EtcdDiskSizeGB                      string                `json:"etcdDiskSizeGB,omitempty"`
 	EtcdStorageLimitGB                  int                   `json:"etcdStorageLimitGB,omitempty"`
-	EtcdEncryptionKey                   string                `json:"etcdEncryptionKey,omitempty"`
+	EtcdEncryptionKey                   string                `json:"etcdEncryptionKey,omitempty" conform:"redact"`
 	EnableDataEncryptionAtRest          *bool                 `json:"enableDataEncryptionAtRest,omitempty"`
 	EnableEncryptionWithExternalKms     *bool                 `json:"enableEncryptionWithExternalKms,omitempty"`
 	EnablePodSecurityPolicy             *bool                 `json:"enablePodSecurityPolicy,omitempty"`
@@ -733,7 +746,7 @@ type CustomCloudProfile struct {
 // TelemetryProfile contains settings for collecting telemtry.
 // Note telemtry is currently enabled/disabled with the 'EnableTelemetry' feature flag.
 type TelemetryProfile struct {
-	ApplicationInsightsKey string `json:"applicationInsightsKey,omitempty"`
+	ApplicationInsightsKey string `json:"applicationInsightsKey,omitempty" conform:"redact"`
 }
 
 // HasFlatcar returns true if the cluster contains flatcar nodes
@@ -1385,6 +1398,61 @@ func (m *MasterProfile) HasMultipleNodes() bool {
 	return m.Count > 1
 }
 
+// HasExternalCa returns true if the CA is an intermediate issued by an external PKI
+func (c *CertificateProfile) HasExternalCa() bool {
+	return c != nil && (c.CaCertificateChain != "" || c.CaKeyvaultSecretRef != nil)
+}
+
+// GetCaCertificateBundle returns the CA certificate followed by the chain of the authorities that issued it
+func (c *CertificateProfile) GetCaCertificateBundle() string {
+	if c == nil {
+		return ""
+	}
+	if c.CaCertificateChain == "" {
+		return c.CaCertificate
+	}
+	return strings.TrimSuffix(c.CaCertificate, "\n") + "\n" + c.CaCertificateChain
+}
+
+// GetKeyAlgorithm returns the algorithm of the generated private keys, RSA if not set
+func (c *CertificateProfile) GetKeyAlgorithm() string {
+	if c == nil || c.KeyAlgorithm == "" {
+		return helpers.PkiKeyAlgorithmRSA
+	}
+	return c.KeyAlgorithm
+}
+
+// GetCaValidity returns the validity of a generated CA certificate, helpers.ValidityDuration if not set
+func (c *CertificateProfile) GetCaValidity() time.Duration {
+	if c == nil {
+		return helpers.ValidityDuration
+	}
+	return validityDaysToDuration(c.CaValidityDays)
+}
+
+// GetServerValidity returns the validity of the apiserver, etcd server and etcd peer certificates, helpers.ValidityDuration if not set
+func (c *CertificateProfile) GetServerValidity() time.Duration {
+	if c == nil {
+		return helpers.ValidityDuration
+	}
+	return validityDaysToDuration(c.ServerValidityDays)
+}
+
+// GetClientValidity returns the validity of the client, kubeconfig and etcd client certificates, helpers.ValidityDuration if not set
+func (c *CertificateProfile) GetClientValidity() time.Duration {
+	if c == nil {
+		return helpers.ValidityDuration
+	}
+	return validityDaysToDuration(c.ClientValidityDays)
+}
+
+func validityDaysToDuration(days int) time.Duration {
+	if days <= 0 {
+		return helpers.ValidityDuration
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
 // HasCosmosEtcd returns true if cosmos etcd configuration is enabled
 func (m *MasterProfile) HasCosmosEtcd() bool {
 	return to.Bool(m.CosmosEtcd)
@@ -105,6 +105,10 @@ type CertificateProfile struct {
 	CaCertificate string `json:"caCertificate,omitempty"`
 	// CaPrivateKey is the certificate authority key.
 	CaPrivateKey string `json:"caPrivateKey,omitempty"`
+	// CaCertificateChain is the certificate chain of the authorities that issued the CA, when the CA is an intermediate of an external PKI
+	CaCertificateChain string `json:"caCertificateChain,omitempty"`
+	// CaKeyvaultSecretRef is a reference to a keyvault secret holding the CA private key, certificate and chain
+	CaKeyvaultSecretRef *KeyvaultSecretRef `json:"caKeyvaultSecretRef,omitempty"`
 	// ApiServerCertificate is the rest api server certificate, and signed by the CA
 	APIServerCertificate string `json:"apiServerCertificate,omitempty"`
 	// ApiServerPrivateKey is the rest api server private key, and signed by the CA
@@ -129,6 +133,14 @@ type CertificateProfile struct {
 	EtcdPeerCertificates []string `json:"etcdPeerCertificates,omitempty"`
 	// EtcdPeerPrivateKeys is list of etcd peer private keys, and signed by the CA
 	EtcdPeerPrivateKeys []string `json:"etcdPeerPrivateKeys,omitempty"`
+	// KeyAlgorithm is the algorithm of the generated private keys, RSA (default) or ECDSA
+	KeyAlgorithm string `json:"keyAlgorithm,omitempty"`
+	// CaValidityDays is the validity in days of a generated CA certificate
+	CaValidityDays int `json:"caValidityDays,omitempty"`
+	// ServerValidityDays is the validity in days of the apiserver, etcd server and etcd peer certificates
+	ServerValidityDays int `json:"serverValidityDays,omitempty"`
+	// ClientValidityDays is the validity in days of the client, kubeconfig and etcd client certificates
+	ClientValidityDays int `json:"clientValidityDays,omitempty"`
 }
 
 // LinuxProfile represents the linux parameters passed to the cluster
@@ -163,6 +163,10 @@ func (a *Properties) validate(isUpdate bool) error {
 		return e
 	}
 
+	if e := a.validateCertificateProfile(); e != nil {
+		return e
+	}
+
 	if e := a.validateCustomKubeComponent(); e != nil {
 		return e
 	}
@@ -953,6 +957,67 @@ func (a *Properties) validateServicePrincipalProfile() error {
 	return nil
 }
 
+func (a *Properties) validateCertificateProfile() error {
+	p := a.CertificateProfile
+	if p == nil {
+		return nil
+	}
+	switch p.KeyAlgorithm {
+	case "", helpers.PkiKeyAlgorithmRSA, helpers.PkiKeyAlgorithmECDSA:
+	default:
+		return errors.Errorf("certificateProfile.keyAlgorithm '%s' is invalid. Allowed values: %s, %s", p.KeyAlgorithm, helpers.PkiKeyAlgorithmRSA, helpers.PkiKeyAlgorithmECDSA)
+	}
+	validities := []struct {
+		name string
+		days int
+	}{
+		{"caValidityDays", p.CaValidityDays},
+		{"serverValidityDays", p.ServerValidityDays},
+		{"clientValidityDays", p.ClientValidityDays},
+	}
+	for _, v := range validities {
+		if v.days < 0 {
+			return errors.Errorf("certificateProfile.%s must be a positive number of days", v.name)
+		}
+	}
+	if p.CaKeyvaultSecretRef != nil {
+		// the CA certificate and chain retrieved from keyvault are kept in the api model, the private key is not
+		if p.CaPrivateKey != "" {
+			return errors.New("certificateProfile.caKeyvaultSecretRef is mutually exclusive with caPrivateKey")
+		}
+		if e := validate.Var(p.CaKeyvaultSecretRef.SecretName, "required"); e != nil {
+			return errors.New("certificateProfile.caKeyvaultSecretRef.secretName must be specified")
+		}
+		if !keyvaultIDRegex.MatchString(p.CaKeyvaultSecretRef.VaultID) {
+			return errors.Errorf("certificateProfile.caKeyvaultSecretRef.vaultID '%s' is of incorrect format", p.CaKeyvaultSecretRef.VaultID)
+		}
+	}
+	if p.CaCertificateChain != "" {
+		if p.CaCertificate == "" || (p.CaPrivateKey == "" && p.CaKeyvaultSecretRef == nil) {
+			return errors.New("certificateProfile.caCertificateChain requires caCertificate and caPrivateKey")
+		}
+		// keyvault references are resolved at deployment time
+		if _, err := helpers.ParseCertificate(p.CaCertificate); err == nil {
+			if err = helpers.VerifyCaChain(p.CaCertificate, p.CaCertificateChain); err != nil {
+				return errors.Wrap(err, "certificateProfile.caCertificate was not issued by caCertificateChain")
+			}
+		}
+	}
+	// a generated CA has to outlive the certificates it signs
+	if p.CaCertificate == "" && p.CaKeyvaultSecretRef == nil {
+		caDays := p.CaValidityDays
+		if caDays == 0 {
+			caDays = int(helpers.ValidityDuration.Hours() / 24)
+		}
+		for _, v := range validities[1:] {
+			if v.days > caDays {
+				return errors.Errorf("certificateProfile.%s (%d) must not exceed the CA validity of %d days", v.name, v.days, caDays)
+			}
+		}
+	}
+	return nil
+}
+
 func (a *Properties) validateAADProfile() error {
 	if profile := a.AADProfile; profile != nil {
 		if _, err := uuid.Parse(profile.ClientAppID); err != nil {
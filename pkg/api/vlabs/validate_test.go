@@ -1732,6 +1732,121 @@ func Test_AadProfile_Validate(t *testing.T) {
 	})
 }
 
+func Test_CertificateProfile_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		profile     *CertificateProfile
+		expectedErr string
+	}{
+		{
+			name:    "nil profile",
+			profile: nil,
+		},
+		{
+			name:    "ECDSA with one year leaf certificates",
+			profile: &CertificateProfile{KeyAlgorithm: "ECDSA", CaValidityDays: 3650, ServerValidityDays: 365, ClientValidityDays: 365},
+		},
+		{
+			name:    "RSA with default CA validity",
+			profile: &CertificateProfile{KeyAlgorithm: "RSA", ServerValidityDays: 365},
+		},
+		{
+			name:        "unsupported key algorithm",
+			profile:     &CertificateProfile{KeyAlgorithm: "DSA"},
+			expectedErr: "certificateProfile.keyAlgorithm 'DSA' is invalid. Allowed values: RSA, ECDSA",
+		},
+		{
+			name:        "negative validity",
+			profile:     &CertificateProfile{ClientValidityDays: -1},
+			expectedErr: "certificateProfile.clientValidityDays must be a positive number of days",
+		},
+		{
+			name:        "leaf validity exceeds CA validity",
+			profile:     &CertificateProfile{CaValidityDays: 365, ServerValidityDays: 730},
+			expectedErr: "certificateProfile.serverValidityDays (730) must not exceed the CA validity of 365 days",
+		},
+		{
+			name:        "leaf validity exceeds default CA validity",
+			profile:     &CertificateProfile{ClientValidityDays: 20000},
+			expectedErr: "certificateProfile.clientValidityDays (20000) must not exceed the CA validity of 10950 days",
+		},
+		{
+			name:    "leaf validity is not bound by a provided CA",
+			profile: &CertificateProfile{CaCertificate: "cert", CaPrivateKey: "key", CaValidityDays: 365, ServerValidityDays: 730},
+		},
+		{
+			name:    "CA from keyvault",
+			profile: &CertificateProfile{CaKeyvaultSecretRef: &KeyvaultSecretRef{VaultID: "/subscriptions/11111111-1111-1111-1111-111111111111/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/cluster-pki", SecretName: "ca"}, ServerValidityDays: 20000},
+		},
+		{
+			name:        "CA from keyvault and inline",
+			profile:     &CertificateProfile{CaPrivateKey: "key", CaKeyvaultSecretRef: &KeyvaultSecretRef{VaultID: "/subscriptions/11111111-1111-1111-1111-111111111111/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/cluster-pki", SecretName: "ca"}},
+			expectedErr: "certificateProfile.caKeyvaultSecretRef is mutually exclusive with caPrivateKey",
+		},
+		{
+			name:    "CA from keyvault with the certificate and chain of a deployed cluster",
+			profile: &CertificateProfile{CaCertificate: "cert", CaCertificateChain: "chain", CaKeyvaultSecretRef: &KeyvaultSecretRef{VaultID: "/subscriptions/11111111-1111-1111-1111-111111111111/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/cluster-pki", SecretName: "ca"}},
+		},
+		{
+			name:        "CA from keyvault without secret name",
+			profile:     &CertificateProfile{CaKeyvaultSecretRef: &KeyvaultSecretRef{VaultID: "/subscriptions/11111111-1111-1111-1111-111111111111/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/cluster-pki"}},
+			expectedErr: "certificateProfile.caKeyvaultSecretRef.secretName must be specified",
+		},
+		{
+			name:        "CA from keyvault with invalid vault ID",
+			profile:     &CertificateProfile{CaKeyvaultSecretRef: &KeyvaultSecretRef{VaultID: "cluster-pki", SecretName: "ca"}},
+			expectedErr: "certificateProfile.caKeyvaultSecretRef.vaultID 'cluster-pki' is of incorrect format",
+		},
+		{
+			name:        "chain without CA",
+			profile:     &CertificateProfile{CaCertificateChain: "chain"},
+			expectedErr: "certificateProfile.caCertificateChain requires caCertificate and caPrivateKey",
+		},
+		{
+			name:    "chain with CA referenced from keyvault secrets",
+			profile: &CertificateProfile{CaCertificate: "cert", CaPrivateKey: "key", CaCertificateChain: "chain"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			cs := getK8sDefaultContainerService(false)
+			cs.Properties.CertificateProfile = test.profile
+			err := cs.Properties.validateCertificateProfile()
+			if test.expectedErr == "" {
+				if err != nil {
+					t.Errorf("should not error %v", err)
+				}
+			} else if err == nil || err.Error() != test.expectedErr {
+				t.Errorf("expected error %q, got %v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func Test_CertificateProfile_ValidateChain(t *testing.T) {
+	rootPair, err := helpers.CreatePkiKeyCertPair(helpers.PkiKeyCertPairParams{CommonName: "root", PkiKeySize: helpers.DefaultPkiKeySize})
+	if err != nil {
+		t.Fatalf("failed to generate root certificate authority: %s", err)
+	}
+	caPair, err := helpers.CreatePkiKeyCertPair(helpers.PkiKeyCertPairParams{CommonName: "ca", PkiKeySize: helpers.DefaultPkiKeySize})
+	if err != nil {
+		t.Fatalf("failed to generate certificate authority: %s", err)
+	}
+	cs := getK8sDefaultContainerService(false)
+	cs.Properties.CertificateProfile = &CertificateProfile{
+		CaCertificate:      caPair.CertificatePem,
+		CaPrivateKey:       caPair.PrivateKeyPem,
+		CaCertificateChain: rootPair.CertificatePem,
+	}
+	err = cs.Properties.validateCertificateProfile()
+	if err == nil || !strings.HasPrefix(err.Error(), "certificateProfile.caCertificate was not issued by caCertificateChain") {
+		t.Errorf("expected a chain verification error, got %v", err)
+	}
+}
+
 func getK8sDefaultContainerService(hasWindows bool) *ContainerService {
 	p := &Properties{
 		OrchestratorProfile: &OrchestratorProfile{
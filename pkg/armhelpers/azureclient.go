@@ -10,6 +10,7 @@ import (
 	"encoding/pem"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -77,6 +78,8 @@ type AzureClient struct {
 
 	applicationsClient      graphrbac.ApplicationsClient
 	servicePrincipalsClient graphrbac.ServicePrincipalsClient
+
+	keyVaultClient autorest.Client
 }
 
 // GetKubernetesClient returns a KubernetesClient hooked up to the api server at the apiserverURL.
@@ -101,7 +104,19 @@ func NewAzureClientWithCLI(env azure.Environment, subscriptionID string) (*Azure
 		return nil, err
 	}
 
-	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(&adalToken), autorest.NewBearerAuthorizer(&adalToken)), nil
+	kvAuthorizer := NewKeyVaultAuthorizer(func(resource string) (adal.OAuthTokenProvider, error) {
+		kvToken, err := cli.GetTokenFromCLI(resource)
+		if err != nil {
+			return nil, err
+		}
+		kvADALToken, err := kvToken.ToADALToken()
+		if err != nil {
+			return nil, err
+		}
+		return &kvADALToken, nil
+	})
+
+	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(&adalToken), autorest.NewBearerAuthorizer(&adalToken), kvAuthorizer), nil
 }
 
 // NewAzureClientWithDeviceAuth returns an AzureClient by having a user complete a device authentication flow
@@ -126,6 +141,14 @@ func NewAzureClientWithDeviceAuth(env azure.Environment, subscriptionID string)
 	}
 
 	var armSpt *adal.ServicePrincipalToken
+	// keyvault tokens are requested with the ARM refresh token when a secret is read
+	kvAuthorizer := NewKeyVaultAuthorizer(func(resource string) (adal.OAuthTokenProvider, error) {
+		kvSpt, err := adal.NewServicePrincipalTokenFromManualToken(*oauthConfig, aksEngineClientID, resource, armSpt.Token())
+		if err != nil {
+			return nil, err
+		}
+		return kvSpt, kvSpt.Refresh()
+	})
 	if rawToken != nil {
 		armSpt, err = adal.NewServicePrincipalTokenFromManualToken(*oauthConfig, aksEngineClientID, env.ServiceManagementEndpoint, *rawToken, tokenCallback(cachePath))
 		if err != nil {
@@ -145,7 +168,7 @@ func NewAzureClientWithDeviceAuth(env azure.Environment, subscriptionID string)
 				return nil, err
 			}
 
-			return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt)), nil
+			return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt), kvAuthorizer), nil
 		}
 	}
 
@@ -181,7 +204,7 @@ func NewAzureClientWithDeviceAuth(env azure.Environment, subscriptionID string)
 		log.Error(err)
 	}
 
-	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt)), nil
+	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt), kvAuthorizer), nil
 }
 
 // NewAzureClientWithClientSecret returns an AzureClient via client_id and client_secret
@@ -202,8 +225,11 @@ func NewAzureClientWithClientSecret(env azure.Environment, subscriptionID, clien
 	if err = graphSpt.Refresh(); err != nil {
 		log.Error(err)
 	}
+	kvAuthorizer := NewKeyVaultAuthorizer(func(resource string) (adal.OAuthTokenProvider, error) {
+		return adal.NewServicePrincipalToken(*oauthConfig, clientID, clientSecret, resource)
+	})
 
-	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt)), nil
+	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt), kvAuthorizer), nil
 }
 
 // NewAzureClientWithClientSecretExternalTenant returns an AzureClient via client_id and client_secret from a tenant
@@ -224,8 +250,11 @@ func NewAzureClientWithClientSecretExternalTenant(env azure.Environment, subscri
 	if err = graphSpt.Refresh(); err != nil {
 		log.Error(err)
 	}
+	kvAuthorizer := NewKeyVaultAuthorizer(func(resource string) (adal.OAuthTokenProvider, error) {
+		return adal.NewServicePrincipalToken(*oauthConfig, clientID, clientSecret, resource)
+	})
 
-	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt)), nil
+	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt), kvAuthorizer), nil
 }
 
 // NewAzureClientWithClientCertificateFile returns an AzureClient via client_id and jwt certificate assertion
@@ -293,8 +322,114 @@ func newAzureClientWithCertificate(env azure.Environment, oauthConfig *adal.OAut
 	if err = graphSpt.Refresh(); err != nil {
 		log.Error(err)
 	}
+	kvAuthorizer := NewKeyVaultAuthorizer(func(resource string) (adal.OAuthTokenProvider, error) {
+		return adal.NewServicePrincipalTokenFromCertificate(*oauthConfig, clientID, certificate, privateKey, resource)
+	})
+
+	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt), kvAuthorizer), nil
+}
+
+// NewAzureClientWithMSI returns an AzureClient via the managed identity of the host,
+// or via the user-assigned identity with the given client_id if not empty
+func NewAzureClientWithMSI(env azure.Environment, subscriptionID, clientID string) (*AzureClient, error) {
+	_, tenantID, err := getOAuthConfig(env, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAzureClientWithMSIExternalTenant(env, subscriptionID, tenantID, clientID)
+}
+
+// NewAzureClientWithMSIExternalTenant returns an AzureClient via the managed identity of the host against a 3rd party tenant
+func NewAzureClientWithMSIExternalTenant(env azure.Environment, subscriptionID, tenantID, clientID string) (*AzureClient, error) {
+	msiEndpoint, err := adal.GetMSIEndpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	armSpt, err := NewMSIServicePrincipalToken(msiEndpoint, env.ServiceManagementEndpoint, clientID)
+	if err != nil {
+		return nil, err
+	}
+	graphSpt, err := NewMSIServicePrincipalToken(msiEndpoint, env.GraphEndpoint, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if err = graphSpt.Refresh(); err != nil {
+		log.Error(err)
+	}
+	kvAuthorizer := NewKeyVaultAuthorizer(func(resource string) (adal.OAuthTokenProvider, error) {
+		return NewMSIServicePrincipalToken(msiEndpoint, resource, clientID)
+	})
 
-	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt)), nil
+	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt), kvAuthorizer), nil
+}
+
+// NewMSIServicePrincipalToken returns a token for resource from the managed identity endpoint,
+// issued to the user-assigned identity with the given client_id if not empty
+func NewMSIServicePrincipalToken(msiEndpoint, resource, clientID string) (*adal.ServicePrincipalToken, error) {
+	if clientID == "" {
+		return adal.NewServicePrincipalTokenFromMSI(msiEndpoint, resource)
+	}
+	return adal.NewServicePrincipalTokenFromMSIWithUserAssignedID(msiEndpoint, resource, clientID)
+}
+
+// NewAzureClientWithFederatedToken returns an AzureClient via client_id and a federated token,
+// such as a projected Kubernetes service account token, read from tokenFilePath
+func NewAzureClientWithFederatedToken(env azure.Environment, subscriptionID, clientID, tokenFilePath string) (*AzureClient, error) {
+	oauthConfig, tenantID, err := getOAuthConfig(env, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return newAzureClientWithFederatedToken(env, oauthConfig, subscriptionID, clientID, tenantID, tokenFilePath)
+}
+
+// NewAzureClientWithFederatedTokenExternalTenant returns an AzureClient via client_id and a federated token against a 3rd party tenant
+func NewAzureClientWithFederatedTokenExternalTenant(env azure.Environment, subscriptionID, tenantID, clientID, tokenFilePath string) (*AzureClient, error) {
+	oauthConfig, err := adal.NewOAuthConfig(env.ActiveDirectoryEndpoint, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	return newAzureClientWithFederatedToken(env, oauthConfig, subscriptionID, clientID, tenantID, tokenFilePath)
+}
+
+func newAzureClientWithFederatedToken(env azure.Environment, oauthConfig *adal.OAuthConfig, subscriptionID, clientID, tenantID, tokenFilePath string) (*AzureClient, error) {
+	secret := &FederatedTokenSecret{TokenFilePath: tokenFilePath}
+	armSpt, err := adal.NewServicePrincipalTokenWithSecret(*oauthConfig, clientID, env.ServiceManagementEndpoint, secret)
+	if err != nil {
+		return nil, err
+	}
+	graphSpt, err := adal.NewServicePrincipalTokenWithSecret(*oauthConfig, clientID, env.GraphEndpoint, secret)
+	if err != nil {
+		return nil, err
+	}
+	if err = graphSpt.Refresh(); err != nil {
+		log.Error(err)
+	}
+	kvAuthorizer := NewKeyVaultAuthorizer(func(resource string) (adal.OAuthTokenProvider, error) {
+		return adal.NewServicePrincipalTokenWithSecret(*oauthConfig, clientID, resource, secret)
+	})
+
+	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt), kvAuthorizer), nil
+}
+
+// FederatedTokenSecret implements adal.ServicePrincipalSecret with a federated token used as client assertion.
+// The token file is read on every refresh as the token issuer rotates it
+type FederatedTokenSecret struct {
+	TokenFilePath string
+}
+
+// SetAuthenticationValues sets the federated token as client assertion of the token request
+func (secret *FederatedTokenSecret) SetAuthenticationValues(spt *adal.ServicePrincipalToken, v *url.Values) error {
+	token, err := os.ReadFile(secret.TokenFilePath)
+	if err != nil {
+		return errors.Wrap(err, "reading federated token")
+	}
+	v.Set("client_assertion", strings.TrimSpace(string(token)))
+	v.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+	return nil
 }
 
 func tokenCallback(path string) func(t adal.Token) error {
@@ -351,7 +486,7 @@ func getAksEngineClientID(envName string) string {
 	}
 }
 
-func getClient(env azure.Environment, subscriptionID, tenantID string, armAuthorizer autorest.Authorizer, graphAuthorizer autorest.Authorizer) *AzureClient {
+func getClient(env azure.Environment, subscriptionID, tenantID string, armAuthorizer autorest.Authorizer, graphAuthorizer autorest.Authorizer, keyVaultAuthorizer autorest.Authorizer) *AzureClient {
 	c := &AzureClient{
 		environment:    env,
 		subscriptionID: subscriptionID,
@@ -403,6 +538,8 @@ func getClient(env azure.Environment, subscriptionID, tenantID string, armAuthor
 	c.applicationsClient.Authorizer = graphAuthorizer
 	c.servicePrincipalsClient.Authorizer = graphAuthorizer
 
+	c.keyVaultClient.Authorizer = keyVaultAuthorizer
+
 	c.deploymentsClient.PollingDelay = time.Second * 5
 	c.resourcesClient.PollingDelay = time.Second * 5
 
@@ -6,6 +6,9 @@ package armhelpers
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/Azure/go-autorest/autorest"
@@ -33,3 +36,41 @@ func TestAzureClientAuxToken(t *testing.T) {
 	g.Expect(err).To(BeNil())
 	g.Expect(request.Header.Get("x-ms-authorization-auxiliary")).To(Equal(fmt.Sprintf("Bearer %s", token)))
 }
+
+func TestFederatedTokenSecret(t *testing.T) {
+	t.Parallel()
+	g := NewGomegaWithT(t)
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	g.Expect(os.WriteFile(tokenFile, []byte("federated-token\n"), 0600)).To(Succeed())
+
+	secret := &FederatedTokenSecret{TokenFilePath: tokenFile}
+	values := url.Values{}
+	g.Expect(secret.SetAuthenticationValues(nil, &values)).To(Succeed())
+	g.Expect(values.Get("client_assertion")).To(Equal("federated-token"))
+	g.Expect(values.Get("client_assertion_type")).To(Equal("urn:ietf:params:oauth:client-assertion-type:jwt-bearer"))
+
+	// the token is read again on every refresh
+	g.Expect(os.WriteFile(tokenFile, []byte("rotated-token"), 0600)).To(Succeed())
+	g.Expect(secret.SetAuthenticationValues(nil, &values)).To(Succeed())
+	g.Expect(values.Get("client_assertion")).To(Equal("rotated-token"))
+
+	secret.TokenFilePath = filepath.Join(t.TempDir(), "missing")
+	g.Expect(secret.SetAuthenticationValues(nil, &values)).To(HaveOccurred())
+}
+
+func TestNewMSIServicePrincipalToken(t *testing.T) {
+	t.Parallel()
+	g := NewGomegaWithT(t)
+
+	const msiEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+	spt, err := NewMSIServicePrincipalToken(msiEndpoint, "https://management.azure.com/", "")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(spt).NotTo(BeNil())
+
+	_, err = NewMSIServicePrincipalToken(msiEndpoint, "https://management.azure.com/", "cc6b141e-6afc-4786-9bf6-e3b9a5601460")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	_, err = NewMSIServicePrincipalToken(msiEndpoint, "", "")
+	g.Expect(err).To(HaveOccurred())
+}
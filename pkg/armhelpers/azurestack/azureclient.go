@@ -14,6 +14,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Azure/aks-engine-azurestack/pkg/armhelpers"
 	"github.com/Azure/aks-engine-azurestack/pkg/engine"
 	"github.com/Azure/aks-engine-azurestack/pkg/kubernetes"
 	"github.com/Azure/azure-sdk-for-go/services/apimanagement/mgmt/2017-03-01/apimanagement"
@@ -73,6 +74,8 @@ type AzureClient struct {
 
 	applicationsClient      graphrbac.ApplicationsClient
 	servicePrincipalsClient graphrbac.ServicePrincipalsClient
+
+	keyVaultClient autorest.Client
 }
 
 // GetKubernetesClient returns a KubernetesClient hooked up to the api server at the apiserverURL.
@@ -98,8 +101,11 @@ func NewAzureClientWithClientSecret(env azure.Environment, subscriptionID, clien
 	if err = graphSpt.Refresh(); err != nil {
 		log.Error(err)
 	}
+	kvAuthorizer := armhelpers.NewKeyVaultAuthorizer(func(resource string) (adal.OAuthTokenProvider, error) {
+		return adal.NewServicePrincipalToken(*oauthConfig, clientID, clientSecret, resource)
+	})
 
-	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt)), nil
+	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt), kvAuthorizer), nil
 }
 
 // NewAzureClientWithClientSecretExternalTenant returns an AzureClient via client_id and client_secret from a tenant
@@ -120,8 +126,11 @@ func NewAzureClientWithClientSecretExternalTenant(env azure.Environment, subscri
 	if err = graphSpt.Refresh(); err != nil {
 		log.Error(err)
 	}
+	kvAuthorizer := armhelpers.NewKeyVaultAuthorizer(func(resource string) (adal.OAuthTokenProvider, error) {
+		return adal.NewServicePrincipalToken(*oauthConfig, clientID, clientSecret, resource)
+	})
 
-	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt)), nil
+	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt), kvAuthorizer), nil
 }
 
 // NewAzureClientWithClientCertificateFile returns an AzureClient via client_id and jwt certificate assertion
@@ -194,8 +203,87 @@ func newAzureClientWithCertificate(env azure.Environment, oauthConfig *adal.OAut
 	if err = graphSpt.Refresh(); err != nil {
 		log.Error(err)
 	}
+	kvAuthorizer := armhelpers.NewKeyVaultAuthorizer(func(resource string) (adal.OAuthTokenProvider, error) {
+		return adal.NewServicePrincipalTokenFromCertificate(*oauthConfig, clientID, certificate, privateKey, resource)
+	})
+
+	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt), kvAuthorizer), nil
+}
+
+// NewAzureClientWithMSI returns an AzureClient via the managed identity of the host,
+// or via the user-assigned identity with the given client_id if not empty
+func NewAzureClientWithMSI(env azure.Environment, subscriptionID, clientID string) (*AzureClient, error) {
+	_, tenantID, err := getOAuthConfig(env, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAzureClientWithMSIExternalTenant(env, subscriptionID, tenantID, clientID)
+}
+
+// NewAzureClientWithMSIExternalTenant returns an AzureClient via the managed identity of the host against a 3rd party tenant
+func NewAzureClientWithMSIExternalTenant(env azure.Environment, subscriptionID, tenantID, clientID string) (*AzureClient, error) {
+	msiEndpoint, err := adal.GetMSIEndpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	armSpt, err := armhelpers.NewMSIServicePrincipalToken(msiEndpoint, env.ServiceManagementEndpoint, clientID)
+	if err != nil {
+		return nil, err
+	}
+	graphSpt, err := armhelpers.NewMSIServicePrincipalToken(msiEndpoint, env.GraphEndpoint, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if err = graphSpt.Refresh(); err != nil {
+		log.Error(err)
+	}
+	kvAuthorizer := armhelpers.NewKeyVaultAuthorizer(func(resource string) (adal.OAuthTokenProvider, error) {
+		return armhelpers.NewMSIServicePrincipalToken(msiEndpoint, resource, clientID)
+	})
+
+	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt), kvAuthorizer), nil
+}
+
+// NewAzureClientWithFederatedToken returns an AzureClient via client_id and a federated token read from tokenFilePath
+func NewAzureClientWithFederatedToken(env azure.Environment, subscriptionID, clientID, tokenFilePath string) (*AzureClient, error) {
+	oauthConfig, tenantID, err := getOAuthConfig(env, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return newAzureClientWithFederatedToken(env, oauthConfig, subscriptionID, clientID, tenantID, tokenFilePath)
+}
+
+// NewAzureClientWithFederatedTokenExternalTenant returns an AzureClient via client_id and a federated token against a 3rd party tenant
+func NewAzureClientWithFederatedTokenExternalTenant(env azure.Environment, subscriptionID, tenantID, clientID, tokenFilePath string) (*AzureClient, error) {
+	oauthConfig, err := adal.NewOAuthConfig(env.ActiveDirectoryEndpoint, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	return newAzureClientWithFederatedToken(env, oauthConfig, subscriptionID, clientID, tenantID, tokenFilePath)
+}
+
+func newAzureClientWithFederatedToken(env azure.Environment, oauthConfig *adal.OAuthConfig, subscriptionID, clientID, tenantID, tokenFilePath string) (*AzureClient, error) {
+	secret := &armhelpers.FederatedTokenSecret{TokenFilePath: tokenFilePath}
+	armSpt, err := adal.NewServicePrincipalTokenWithSecret(*oauthConfig, clientID, env.ServiceManagementEndpoint, secret)
+	if err != nil {
+		return nil, err
+	}
+	graphSpt, err := adal.NewServicePrincipalTokenWithSecret(*oauthConfig, clientID, env.GraphEndpoint, secret)
+	if err != nil {
+		return nil, err
+	}
+	if err = graphSpt.Refresh(); err != nil {
+		log.Error(err)
+	}
+	kvAuthorizer := armhelpers.NewKeyVaultAuthorizer(func(resource string) (adal.OAuthTokenProvider, error) {
+		return adal.NewServicePrincipalTokenWithSecret(*oauthConfig, clientID, resource, secret)
+	})
 
-	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt)), nil
+	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt), kvAuthorizer), nil
 }
 
 func getOAuthConfig(env azure.Environment, subscriptionID string) (*adal.OAuthConfig, string, error) {
@@ -212,7 +300,7 @@ func getOAuthConfig(env azure.Environment, subscriptionID string) (*adal.OAuthCo
 	return oauthConfig, tenantID, nil
 }
 
-func getClient(env azure.Environment, subscriptionID, tenantID string, armAuthorizer autorest.Authorizer, graphAuthorizer autorest.Authorizer) *AzureClient {
+func getClient(env azure.Environment, subscriptionID, tenantID string, armAuthorizer autorest.Authorizer, graphAuthorizer autorest.Authorizer, keyVaultAuthorizer autorest.Authorizer) *AzureClient {
 	c := &AzureClient{
 		environment:    env,
 		subscriptionID: subscriptionID,
@@ -281,6 +369,8 @@ func getClient(env azure.Environment, subscriptionID, tenantID string, armAuthor
 	c.applicationsClient.Authorizer = graphAuthorizer
 	c.servicePrincipalsClient.Authorizer = graphAuthorizer
 
+	c.keyVaultClient.Authorizer = keyVaultAuthorizer
+
 	return c
 }
 
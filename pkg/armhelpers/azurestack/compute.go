@@ -54,6 +54,12 @@ func (az *AzureClient) RestartVirtualMachine(ctx context.Context, resourceGroup,
 	return err
 }
 
+// ReimageVirtualMachine reimages the OS disk of the specified virtual machine
+func (az *AzureClient) ReimageVirtualMachine(ctx context.Context, resourceGroup, name string) error {
+	// TODO Implement once we upgrade azure stack compute's api version, it has no virtual machine reimage operation
+	return errors.Errorf("operation not supported")
+}
+
 // DeleteVirtualMachine handles deletion of a CRP/VMAS VM (aka, not a VMSS VM).
 func (az *AzureClient) DeleteVirtualMachine(ctx context.Context, resourceGroup, name string) error {
 	future, err := az.virtualMachinesClient.Delete(ctx, resourceGroup, name)
@@ -164,6 +170,61 @@ func (az *AzureClient) SetVirtualMachineScaleSetCapacity(ctx context.Context, re
 	return err
 }
 
+// GetVirtualMachineScaleSet retrieves the specified VMSS, including its VM model
+func (az *AzureClient) GetVirtualMachineScaleSet(ctx context.Context, resourceGroup, virtualMachineScaleSet string) (azcompute.VirtualMachineScaleSet, error) {
+	azVMSS := azcompute.VirtualMachineScaleSet{}
+	vmss, err := az.virtualMachineScaleSetsClient.Get(ctx, resourceGroup, virtualMachineScaleSet)
+	if err != nil {
+		return azVMSS, err
+	}
+	if err = DeepCopy(&azVMSS, vmss); err != nil {
+		return azVMSS, fmt.Errorf("fail to convert virtual machine scale set, %v", err)
+	}
+	return azVMSS, nil
+}
+
+// UpdateVirtualMachineScaleSetVMs upgrades the specified VMSS instances to the latest VMSS model
+func (az *AzureClient) UpdateVirtualMachineScaleSetVMs(ctx context.Context, resourceGroup, virtualMachineScaleSet string, instanceIDs []string) error {
+	future, err := az.virtualMachineScaleSetsClient.UpdateInstances(
+		ctx,
+		resourceGroup,
+		virtualMachineScaleSet,
+		compute.VirtualMachineScaleSetVMInstanceRequiredIDs{
+			InstanceIds: &instanceIDs,
+		})
+	if err != nil {
+		return err
+	}
+
+	if err = future.WaitForCompletionRef(ctx, az.virtualMachineScaleSetsClient.Client); err != nil {
+		return err
+	}
+
+	_, err = future.Result(az.virtualMachineScaleSetsClient)
+	return err
+}
+
+// ReimageVirtualMachineScaleSetVMs reimages the OS disk of the specified VMSS instances
+func (az *AzureClient) ReimageVirtualMachineScaleSetVMs(ctx context.Context, resourceGroup, virtualMachineScaleSet string, instanceIDs []string) error {
+	future, err := az.virtualMachineScaleSetsClient.Reimage(
+		ctx,
+		resourceGroup,
+		virtualMachineScaleSet,
+		&compute.VirtualMachineScaleSetVMInstanceIDs{
+			InstanceIds: &instanceIDs,
+		})
+	if err != nil {
+		return err
+	}
+
+	if err = future.WaitForCompletionRef(ctx, az.virtualMachineScaleSetsClient.Client); err != nil {
+		return err
+	}
+
+	_, err = future.Result(az.virtualMachineScaleSetsClient)
+	return err
+}
+
 // GetAvailabilitySet retrieves the specified VM availability set.
 func (az *AzureClient) GetAvailabilitySet(ctx context.Context, resourceGroup, availabilitySetName string) (azcompute.AvailabilitySet, error) {
 	azVMAS := azcompute.AvailabilitySet{}
@@ -179,6 +240,12 @@ func (az *AzureClient) GetAvailabilitySet(ctx context.Context, resourceGroup, av
 	return azVMAS, nil
 }
 
+// DeleteAvailabilitySet deletes the specified VM availability set.
+func (az *AzureClient) DeleteAvailabilitySet(ctx context.Context, resourceGroup, availabilitySetName string) error {
+	_, err := az.availabilitySetsClient.Delete(ctx, resourceGroup, availabilitySetName)
+	return err
+}
+
 // GetAvailabilitySetFaultDomainCount returns the first existing fault domain count it finds from the IDs provided.
 func (az *AzureClient) GetAvailabilitySetFaultDomainCount(ctx context.Context, resourceGroup string, vmasIDs []string) (int, error) {
 	var count int
@@ -0,0 +1,22 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package azurestack
+
+import (
+	"context"
+
+	"github.com/Azure/aks-engine-azurestack/pkg/armhelpers"
+)
+
+// GetKeyVaultSecret returns the value of a secret stored in the keyvault identified by its resource ID,
+// the latest version of the secret if secretVersion is empty
+func (az *AzureClient) GetKeyVaultSecret(ctx context.Context, vaultID, secretName, secretVersion string) (string, error) {
+	return armhelpers.GetSecretFromKeyVault(ctx, az.keyVaultClient, az.environment, vaultID, secretName, secretVersion)
+}
+
+// SetKeyVaultSecret stores value as a new version of a secret in the keyvault identified by its resource ID
+// and returns the version
+func (az *AzureClient) SetKeyVaultSecret(ctx context.Context, vaultID, secretName, value string) (string, error) {
+	return armhelpers.SetSecretInKeyVault(ctx, az.keyVaultClient, az.environment, vaultID, secretName, value)
+}
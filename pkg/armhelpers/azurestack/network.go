@@ -5,6 +5,8 @@ package azurestack
 
 import (
 	"context"
+
+	"github.com/Azure/aks-engine-azurestack/pkg/armhelpers"
 )
 
 // DeleteNetworkInterface deletes the specified network interface.
@@ -21,3 +23,12 @@ func (az *AzureClient) DeleteNetworkInterface(ctx context.Context, resourceGroup
 	_, err = future.Result(az.interfacesClient)
 	return err
 }
+
+// ListNetworkInterfaces lists the network interfaces in the resource group
+func (az *AzureClient) ListNetworkInterfaces(ctx context.Context, resourceGroup string) (armhelpers.InterfaceListResultPage, error) {
+	page, err := az.interfacesClient.List(ctx, resourceGroup)
+	return &InterfaceListResultPageClient{
+		ilrp: page,
+		err:  err,
+	}, err
+}
@@ -9,6 +9,8 @@ import (
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2017-03-30/compute"
 	azcompute "github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-12-01/compute"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2017-10-01/network"
+	aznetwork "github.com/Azure/azure-sdk-for-go/services/network/mgmt/2018-08-01/network"
 )
 
 // VirtualMachineListResultPageClient Virtual Machine List Result Page Client
@@ -183,3 +185,46 @@ func (page DiskListPageClient) Values() []azcompute.Disk {
 	}
 	return l
 }
+
+// InterfaceListResultPageClient contains a page of network Interface values.
+type InterfaceListResultPageClient struct {
+	ilrp network.InterfaceListResultPage
+	err  error
+}
+
+// NextWithContext advances to the next page of values.  If there was an error making
+// the request the page does not advance and the error is returned.
+func (page *InterfaceListResultPageClient) NextWithContext(ctx context.Context) (err error) {
+	return page.ilrp.NextWithContext(ctx)
+}
+
+// Next advances to the next page of values.  If there was an error making
+// the request the page does not advance and the error is returned.
+func (page *InterfaceListResultPageClient) Next() error {
+	return page.ilrp.Next()
+}
+
+// NotDone returns true if the page enumeration should be started or is not yet complete.
+func (page InterfaceListResultPageClient) NotDone() bool {
+	return page.ilrp.NotDone()
+}
+
+// Response returns the raw server response from the last page request.
+func (page InterfaceListResultPageClient) Response() aznetwork.InterfaceListResult {
+	l := aznetwork.InterfaceListResult{}
+	err := DeepCopy(&l, page.ilrp.Response())
+	if err != nil {
+		page.err = fmt.Errorf("fail to get network interface list result, %s", err) //nolint:staticcheck
+	}
+	return l
+}
+
+// Values returns the slice of values for the current page or nil if there are no values.
+func (page InterfaceListResultPageClient) Values() []aznetwork.Interface {
+	l := []aznetwork.Interface{}
+	err := DeepCopy(&l, page.ilrp.Values())
+	if err != nil {
+		page.err = fmt.Errorf("fail to get network interface list, %s", err) //nolint:staticcheck
+	}
+	return l
+}
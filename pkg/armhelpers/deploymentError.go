@@ -8,10 +8,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Azure/aks-engine-azurestack/pkg/api"
+	"github.com/Azure/aks-engine-azurestack/pkg/engine"
 	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2018-05-01/resources"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -40,7 +45,11 @@ func (e *DeploymentError) Error() string {
 		for _, operation := range *operationsList.Value {
 			if operation.Properties != nil && *operation.Properties.ProvisioningState == string(api.Failed) && operation.Properties.StatusMessage != nil {
 				if b, err := json.MarshalIndent(operation.Properties.StatusMessage, "", "  "); err == nil {
-					ops = append(ops, string(b))
+					op := string(b)
+					if cseErr, ok := getCSEError(b); ok {
+						op = fmt.Sprintf("%s CSE[exit code %d %s while %s, likely causes: %s, inspect %s on the node]", op, cseErr.Code, cseErr.Name, cseErr.Step, cseErr.Causes, cseErr.LogFile)
+					}
+					ops = append(ops, op)
 				}
 			}
 		}
@@ -49,6 +58,178 @@ func (e *DeploymentError) Error() string {
 		e.DeploymentName, e.ResourceGroup, str, e.StatusCode, e.Response, e.ProvisioningState, strings.Join(ops, " | "))
 }
 
+// DeploymentDiagnostics is the machine-readable description of a failed deployment
+type DeploymentDiagnostics struct {
+	// Command is the aks-engine-azurestack command that ran the deployment
+	Command           string                           `json:"command,omitempty"`
+	DeploymentName    string                           `json:"deploymentName,omitempty"`
+	ResourceGroup     string                           `json:"resourceGroup,omitempty"`
+	Error             string                           `json:"error"`
+	StatusCode        int                              `json:"statusCode,omitempty"`
+	ProvisioningState string                           `json:"provisioningState,omitempty"`
+	Response          string                           `json:"response,omitempty"`
+	Timestamp         time.Time                        `json:"timestamp"`
+	FailedOperations  []DeploymentOperationDiagnostics `json:"failedOperations"`
+}
+
+// DeploymentOperationDiagnostics is the machine-readable description of a failed deployment operation
+type DeploymentOperationDiagnostics struct {
+	OperationID       string     `json:"operationId,omitempty"`
+	ResourceType      string     `json:"resourceType,omitempty"`
+	ResourceName      string     `json:"resourceName,omitempty"`
+	StatusCode        string     `json:"statusCode,omitempty"`
+	ProvisioningState string     `json:"provisioningState,omitempty"`
+	Timestamp         *time.Time `json:"timestamp,omitempty"`
+	ErrorCode         string     `json:"errorCode,omitempty"`
+	ErrorMessage      string     `json:"errorMessage,omitempty"`
+	// CSEExitCode is the exit code of the custom script extension, if the operation failed provisioning it
+	CSEExitCode *int `json:"cseExitCode,omitempty"`
+	// CSEError is the name of the error constant of CSEExitCode
+	CSEError string `json:"cseError,omitempty"`
+	// CSEStep is the provisioning step that exits with CSEExitCode
+	CSEStep string `json:"cseStep,omitempty"`
+	// CSECauses are the likely causes of CSEExitCode
+	CSECauses string `json:"cseCauses,omitempty"`
+	// CSELogFile is the file of the node to inspect
+	CSELogFile string `json:"cseLogFile,omitempty"`
+}
+
+// deploymentOperationError is the error of a deployment operation status message
+type deploymentOperationError struct {
+	Code    string                     `json:"code"`
+	Message string                     `json:"message"`
+	Details []deploymentOperationError `json:"details"`
+}
+
+// deploymentOperationStatus is a deployment operation status message, which has the error either at the top level or in an error property
+type deploymentOperationStatus struct {
+	deploymentOperationError
+	Error *deploymentOperationError `json:"error"`
+}
+
+var cseExitCodeRegexp = regexp.MustCompile(`exit status=(\d+)`)
+
+// NewDeploymentDiagnostics returns the diagnostics of an error returned by command,
+// which describe the failed deployment operations if err is or wraps a DeploymentError
+func NewDeploymentDiagnostics(command string, err error) *DeploymentDiagnostics {
+	var d *DeploymentDiagnostics
+	var deploymentErr *DeploymentError
+	if errors.As(err, &deploymentErr) {
+		d = deploymentErr.Diagnostics()
+	} else {
+		d = &DeploymentDiagnostics{
+			Timestamp:        time.Now().UTC(),
+			FailedOperations: []DeploymentOperationDiagnostics{},
+		}
+	}
+	d.Command = command
+	d.Error = err.Error()
+	return d
+}
+
+// Diagnostics returns the machine-readable description of the deployment error
+func (e *DeploymentError) Diagnostics() *DeploymentDiagnostics {
+	d := &DeploymentDiagnostics{
+		DeploymentName:    e.DeploymentName,
+		ResourceGroup:     e.ResourceGroup,
+		StatusCode:        e.StatusCode,
+		ProvisioningState: e.ProvisioningState,
+		Response:          string(e.Response),
+		Timestamp:         time.Now().UTC(),
+		FailedOperations:  []DeploymentOperationDiagnostics{},
+	}
+	if e.TopError != nil {
+		d.Error = e.TopError.Error()
+	}
+	for _, operationsList := range e.OperationsLists {
+		if operationsList.Value == nil {
+			continue
+		}
+		for _, operation := range *operationsList.Value {
+			p := operation.Properties
+			if p == nil || p.ProvisioningState == nil || *p.ProvisioningState != string(api.Failed) {
+				continue
+			}
+			d.FailedOperations = append(d.FailedOperations, newDeploymentOperationDiagnostics(operation))
+		}
+	}
+	return d
+}
+
+func newDeploymentOperationDiagnostics(operation resources.DeploymentOperation) DeploymentOperationDiagnostics {
+	p := operation.Properties
+	o := DeploymentOperationDiagnostics{
+		ProvisioningState: *p.ProvisioningState,
+	}
+	if operation.OperationID != nil {
+		o.OperationID = *operation.OperationID
+	}
+	if p.TargetResource != nil {
+		if p.TargetResource.ResourceType != nil {
+			o.ResourceType = *p.TargetResource.ResourceType
+		}
+		if p.TargetResource.ResourceName != nil {
+			o.ResourceName = *p.TargetResource.ResourceName
+		}
+	}
+	if p.StatusCode != nil {
+		o.StatusCode = *p.StatusCode
+	}
+	if p.Timestamp != nil {
+		timestamp := p.Timestamp.ToTime().UTC()
+		o.Timestamp = &timestamp
+	}
+	if p.StatusMessage == nil {
+		return o
+	}
+	b, err := json.Marshal(p.StatusMessage)
+	if err != nil {
+		return o
+	}
+	var status deploymentOperationStatus
+	if err = json.Unmarshal(b, &status); err == nil {
+		operationErr := &status.deploymentOperationError
+		if status.Error != nil {
+			operationErr = status.Error
+		}
+		// the innermost error is the most specific, e.g. VMExtensionProvisioningError
+		for len(operationErr.Details) > 0 {
+			operationErr = &operationErr.Details[0]
+		}
+		o.ErrorCode = operationErr.Code
+		o.ErrorMessage = operationErr.Message
+	}
+	if exitCode, ok := getCSEExitCode(b); ok {
+		o.CSEExitCode = &exitCode
+		if cseErr, ok := engine.GetCSEError(exitCode); ok {
+			o.CSEError = cseErr.Name
+			o.CSEStep = cseErr.Step
+			o.CSECauses = cseErr.Causes
+			o.CSELogFile = cseErr.LogFile
+		}
+	}
+	return o
+}
+
+// getCSEExitCode returns the exit code of the custom script extension reported by a deployment operation status message
+func getCSEExitCode(statusMessage []byte) (int, bool) {
+	m := cseExitCodeRegexp.FindSubmatch(statusMessage)
+	if m == nil {
+		return 0, false
+	}
+	exitCode, err := strconv.Atoi(string(m[1]))
+	return exitCode, err == nil
+}
+
+// getCSEError returns the description of the custom script extension exit code reported by a deployment operation status message
+func getCSEError(statusMessage []byte) (engine.CSEError, bool) {
+	exitCode, ok := getCSEExitCode(statusMessage)
+	if !ok {
+		return engine.CSEError{}, false
+	}
+	return engine.GetCSEError(exitCode)
+}
+
 // DeploymentValidationError contains validation error
 type DeploymentValidationError struct {
 	Err error
@@ -63,6 +244,11 @@ func (e *DeploymentValidationError) Error() string {
 func DeployTemplateSync(az AKSEngineClient, logger *logrus.Entry, resourceGroupName, deploymentName string, template map[string]interface{}, parameters map[string]interface{}) error {
 	ctx, cancel := context.WithTimeout(context.Background(), DefaultARMOperationTimeout)
 	defer cancel()
+	return DeployTemplateSyncWithContext(ctx, az, logger, resourceGroupName, deploymentName, template, parameters)
+}
+
+// DeployTemplateSyncWithContext deploys the template and returns a DeploymentError describing the failed deployment operations
+func DeployTemplateSyncWithContext(ctx context.Context, az AKSEngineClient, logger *logrus.Entry, resourceGroupName, deploymentName string, template map[string]interface{}, parameters map[string]interface{}) error {
 	deploymentExtended, err := az.DeployTemplate(ctx, resourceGroupName, deploymentName, template, parameters)
 	if err == nil {
 		return nil
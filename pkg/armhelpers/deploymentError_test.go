@@ -5,11 +5,14 @@ package armhelpers
 
 import (
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/types"
 
 	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2018-05-01/resources"
+	"github.com/Azure/go-autorest/autorest/date"
+	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
@@ -150,3 +153,113 @@ func TestDeploymentError_Error(t *testing.T) {
 		t.Errorf("expected error with message %s, but got %s", expected, errString)
 	}
 }
+
+func TestDeploymentError_Diagnostics(t *testing.T) {
+	t.Parallel()
+	g := NewGomegaWithT(t)
+
+	timestamp := date.Time{Time: time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)}
+	cseStatus := map[string]interface{}{
+		"status": "Failed",
+		"error": map[string]interface{}{
+			"code":    "ResourceDeploymentFailure",
+			"message": "The resource operation completed with terminal provisioning state 'Failed'.",
+			"details": []interface{}{
+				map[string]interface{}{
+					"code":    "VMExtensionProvisioningError",
+					"message": "VM has reported a failure when processing extension 'cse-master-0'. Error message: \"Enable failed: failed to execute command: command terminated with exit status=50\"",
+				},
+			},
+		},
+	}
+	quotaStatus := map[string]interface{}{
+		"code":    "QuotaExceeded",
+		"message": "Operation could not be completed as it results in exceeding approved quota.",
+	}
+	deploymentErr := &DeploymentError{
+		DeploymentName:    "agentvm",
+		ResourceGroup:     "rg1",
+		TopError:          errors.New("sample error"),
+		ProvisioningState: "Failed",
+		StatusCode:        200,
+		OperationsLists: []resources.DeploymentOperationsListResult{
+			{
+				Value: &[]resources.DeploymentOperation{
+					{
+						OperationID: to.StringPtr("1"),
+						Properties: &resources.DeploymentOperationProperties{
+							ProvisioningState: to.StringPtr("Failed"),
+							Timestamp:         &timestamp,
+							StatusCode:        to.StringPtr("Conflict"),
+							StatusMessage:     cseStatus,
+							TargetResource: &resources.TargetResource{
+								ResourceType: to.StringPtr("Microsoft.Compute/virtualMachines/extensions"),
+								ResourceName: to.StringPtr("k8s-master-12345678-0/cse-master-0"),
+							},
+						},
+					},
+					{
+						OperationID: to.StringPtr("2"),
+						Properties: &resources.DeploymentOperationProperties{
+							ProvisioningState: to.StringPtr("Succeeded"),
+						},
+					},
+				},
+			},
+			{
+				Value: &[]resources.DeploymentOperation{
+					{
+						OperationID: to.StringPtr("3"),
+						Properties: &resources.DeploymentOperationProperties{
+							ProvisioningState: to.StringPtr("Failed"),
+							StatusCode:        to.StringPtr("BadRequest"),
+							StatusMessage:     quotaStatus,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	d := deploymentErr.Diagnostics()
+	g.Expect(d.DeploymentName).To(Equal("agentvm"))
+	g.Expect(d.ResourceGroup).To(Equal("rg1"))
+	g.Expect(d.Error).To(Equal("sample error"))
+	g.Expect(d.ProvisioningState).To(Equal("Failed"))
+	g.Expect(d.StatusCode).To(Equal(200))
+	g.Expect(d.FailedOperations).To(HaveLen(2))
+
+	cse := d.FailedOperations[0]
+	g.Expect(cse.OperationID).To(Equal("1"))
+	g.Expect(cse.ResourceType).To(Equal("Microsoft.Compute/virtualMachines/extensions"))
+	g.Expect(cse.ResourceName).To(Equal("k8s-master-12345678-0/cse-master-0"))
+	g.Expect(cse.StatusCode).To(Equal("Conflict"))
+	g.Expect(cse.ProvisioningState).To(Equal("Failed"))
+	g.Expect(*cse.Timestamp).To(Equal(timestamp.Time))
+	g.Expect(cse.ErrorCode).To(Equal("VMExtensionProvisioningError"))
+	g.Expect(cse.ErrorMessage).To(ContainSubstring("exit status=50"))
+	g.Expect(*cse.CSEExitCode).To(Equal(50))
+	g.Expect(cse.CSEError).To(Equal("ERR_OUTBOUND_CONN_FAIL"))
+	g.Expect(cse.CSEStep).To(Equal("checking the outbound connectivity of the node"))
+	g.Expect(cse.CSECauses).NotTo(BeEmpty())
+	g.Expect(cse.CSELogFile).To(Equal("/var/log/azure/cluster-provision.log"))
+
+	g.Expect(deploymentErr.Error()).To(ContainSubstring("CSE[exit code 50 ERR_OUTBOUND_CONN_FAIL while checking the outbound connectivity of the node, likely causes: "))
+	g.Expect(deploymentErr.Error()).To(ContainSubstring("inspect /var/log/azure/cluster-provision.log on the node]"))
+
+	quota := d.FailedOperations[1]
+	g.Expect(quota.ErrorCode).To(Equal("QuotaExceeded"))
+	g.Expect(quota.CSEExitCode).To(BeNil())
+	g.Expect(quota.CSEStep).To(BeEmpty())
+	g.Expect(quota.Timestamp).To(BeNil())
+
+	wrapped := NewDeploymentDiagnostics("deploy", errors.Wrap(deploymentErr, "deploying"))
+	g.Expect(wrapped.Command).To(Equal("deploy"))
+	g.Expect(wrapped.Error).To(HavePrefix("deploying: DeploymentName[agentvm]"))
+	g.Expect(wrapped.FailedOperations).To(HaveLen(2))
+
+	other := NewDeploymentDiagnostics("scale", errors.New("invalid api model"))
+	g.Expect(other.Command).To(Equal("scale"))
+	g.Expect(other.Error).To(Equal("invalid api model"))
+	g.Expect(other.FailedOperations).To(BeEmpty())
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/Azure/azure-sdk-for-go/services/authorization/mgmt/2015-07-01/authorization"
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-12-01/compute"
 	"github.com/Azure/azure-sdk-for-go/services/graphrbac/1.6/graphrbac"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2018-08-01/network"
 	"github.com/Azure/azure-sdk-for-go/services/preview/msi/mgmt/2015-08-31-preview/msi"
 	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2016-06-01/subscriptions"
 	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2018-05-01/resources"
@@ -88,6 +89,15 @@ type DiskListPage interface {
 	Values() []compute.Disk
 }
 
+// InterfaceListResultPage is an interface for network.InterfaceListResultPage to aid in mocking
+type InterfaceListResultPage interface {
+	Next() error
+	NextWithContext(ctx context.Context) (err error)
+	NotDone() bool
+	Response() network.InterfaceListResult
+	Values() []network.Interface
+}
+
 // VMImageFetcher is an extension of AKSEngine client allows us to operate on the virtual machine images in the environment
 type VMImageFetcher interface {
 
@@ -135,6 +145,9 @@ type AKSEngineClient interface {
 	// RestartVirtualMachine restarts the specified virtual machine.
 	RestartVirtualMachine(ctx context.Context, resourceGroup, name string) error
 
+	// ReimageVirtualMachine reimages the OS disk of the specified virtual machine, which must have an ephemeral OS disk.
+	ReimageVirtualMachine(ctx context.Context, resourceGroup, name string) error
+
 	// DeleteVirtualMachine deletes the specified virtual machine.
 	DeleteVirtualMachine(ctx context.Context, resourceGroup, name string) error
 
@@ -150,12 +163,27 @@ type AKSEngineClient interface {
 	// DeleteVirtualMachineScaleSetVM deletes a VM in a VMSS
 	DeleteVirtualMachineScaleSetVM(ctx context.Context, resourceGroup, virtualMachineScaleSet, instanceID string) error
 
+	// DeleteVirtualMachineScaleSet deletes an entire VMSS
+	DeleteVirtualMachineScaleSet(ctx context.Context, resourceGroup, vmssName string) error
+
 	// SetVirtualMachineScaleSetCapacity sets the VMSS capacity
 	SetVirtualMachineScaleSetCapacity(ctx context.Context, resourceGroup, virtualMachineScaleSet string, sku compute.Sku, location string) error
 
+	// GetVirtualMachineScaleSet retrieves the specified VMSS, including its VM model
+	GetVirtualMachineScaleSet(ctx context.Context, resourceGroup, virtualMachineScaleSet string) (compute.VirtualMachineScaleSet, error)
+
+	// UpdateVirtualMachineScaleSetVMs upgrades the specified VMSS instances to the latest VMSS model
+	UpdateVirtualMachineScaleSetVMs(ctx context.Context, resourceGroup, virtualMachineScaleSet string, instanceIDs []string) error
+
+	// ReimageVirtualMachineScaleSetVMs reimages the OS disk of the specified VMSS instances
+	ReimageVirtualMachineScaleSetVMs(ctx context.Context, resourceGroup, virtualMachineScaleSet string, instanceIDs []string) error
+
 	// GetAvailabilitySet retrieves the specified VM availability set.
 	GetAvailabilitySet(ctx context.Context, resourceGroup, availabilitySet string) (compute.AvailabilitySet, error)
 
+	// DeleteAvailabilitySet deletes the specified VM availability set.
+	DeleteAvailabilitySet(ctx context.Context, resourceGroup, availabilitySet string) error
+
 	// GetAvailabilitySetFaultDomainCount returns the first platform fault domain count it finds from the
 	// VM availability set IDs provided.
 	GetAvailabilitySetFaultDomainCount(ctx context.Context, resourceGroup string, vmasIDs []string) (int, error)
@@ -179,6 +207,9 @@ type AKSEngineClient interface {
 	// DeleteNetworkInterface deletes the specified network interface.
 	DeleteNetworkInterface(ctx context.Context, resourceGroup, nicName string) error
 
+	// ListNetworkInterfaces lists the network interfaces in the resource group
+	ListNetworkInterfaces(ctx context.Context, resourceGroup string) (InterfaceListResultPage, error)
+
 	// GRAPH
 
 	// CreateGraphAppliction creates an application via the graphrbac client
@@ -213,6 +244,14 @@ type AKSEngineClient interface {
 	// ListDeploymentOperations gets all deployments operations for a deployment.
 	ListDeploymentOperations(ctx context.Context, resourceGroupName string, deploymentName string, top *int32) (result DeploymentOperationsListResultPage, err error)
 
+	// KEYVAULT
+
+	// GetKeyVaultSecret returns the value of a secret stored in the keyvault identified by its resource ID
+	GetKeyVaultSecret(ctx context.Context, vaultID, secretName, secretVersion string) (string, error)
+
+	// SetKeyVaultSecret stores a new version of a keyvault secret and returns the version
+	SetKeyVaultSecret(ctx context.Context, vaultID, secretName, value string) (string, error)
+
 	// Log Analytics
 
 	// EnsureDefaultLogAnalyticsWorkspace ensures the default log analytics exists corresponding to specified location in current subscription
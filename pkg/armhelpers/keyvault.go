@@ -0,0 +1,135 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package armhelpers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/pkg/errors"
+)
+
+const keyVaultAPIVersion = "7.0"
+
+// NewKeyVaultAuthorizer returns an authorizer that gets a token for the keyvault resource
+// advertised in the authentication challenge of the first request sent to a vault
+func NewKeyVaultAuthorizer(newToken func(resource string) (adal.OAuthTokenProvider, error)) autorest.Authorizer {
+	return autorest.NewBearerAuthorizerCallback(nil, func(tenantID, resource string) (*autorest.BearerAuthorizer, error) {
+		token, err := newToken(resource)
+		if err != nil {
+			return nil, err
+		}
+		return autorest.NewBearerAuthorizer(token), nil
+	})
+}
+
+// GetKeyVaultSecret returns the value of a secret stored in the keyvault identified by its resource ID,
+// the latest version of the secret if secretVersion is empty
+func (az *AzureClient) GetKeyVaultSecret(ctx context.Context, vaultID, secretName, secretVersion string) (string, error) {
+	return GetSecretFromKeyVault(ctx, az.keyVaultClient, az.environment, vaultID, secretName, secretVersion)
+}
+
+// GetSecretFromKeyVault returns the value of a secret using a client authorized by NewKeyVaultAuthorizer
+func GetSecretFromKeyVault(ctx context.Context, client autorest.Client, env azure.Environment, vaultID, secretName, secretVersion string) (string, error) {
+	vaultURL, err := keyVaultURL(env, vaultID)
+	if err != nil {
+		return "", err
+	}
+	req, err := autorest.Prepare((&http.Request{}).WithContext(ctx),
+		autorest.AsGet(),
+		autorest.WithBaseURL(vaultURL),
+		autorest.WithPathParameters("/secrets/{secret-name}/{secret-version}", map[string]interface{}{
+			"secret-name":    autorest.Encode("path", secretName),
+			"secret-version": autorest.Encode("path", secretVersion),
+		}),
+		autorest.WithQueryParameters(map[string]interface{}{"api-version": keyVaultAPIVersion}),
+		client.WithAuthorization())
+	if err != nil {
+		return "", errors.Wrapf(err, "preparing the request for secret %s", secretName)
+	}
+	resp, err := client.Send(req)
+	if err != nil {
+		return "", errors.Wrapf(err, "getting secret %s from %s", secretName, vaultURL)
+	}
+	var bundle keyVaultSecretBundle
+	err = autorest.Respond(resp,
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&bundle),
+		autorest.ByClosing())
+	if err != nil {
+		return "", errors.Wrapf(err, "getting secret %s from %s", secretName, vaultURL)
+	}
+	if bundle.Value == nil {
+		return "", errors.Errorf("secret %s from %s has no value", secretName, vaultURL)
+	}
+	return *bundle.Value, nil
+}
+
+// SetKeyVaultSecret stores value as a new version of a secret in the keyvault identified by its resource ID
+// and returns the version
+func (az *AzureClient) SetKeyVaultSecret(ctx context.Context, vaultID, secretName, value string) (string, error) {
+	return SetSecretInKeyVault(ctx, az.keyVaultClient, az.environment, vaultID, secretName, value)
+}
+
+// SetSecretInKeyVault stores a secret using a client authorized by NewKeyVaultAuthorizer and returns the new version
+func SetSecretInKeyVault(ctx context.Context, client autorest.Client, env azure.Environment, vaultID, secretName, value string) (string, error) {
+	vaultURL, err := keyVaultURL(env, vaultID)
+	if err != nil {
+		return "", err
+	}
+	req, err := autorest.Prepare((&http.Request{}).WithContext(ctx),
+		autorest.AsContentType("application/json; charset=utf-8"),
+		autorest.AsPut(),
+		autorest.WithBaseURL(vaultURL),
+		autorest.WithPathParameters("/secrets/{secret-name}", map[string]interface{}{
+			"secret-name": autorest.Encode("path", secretName),
+		}),
+		autorest.WithJSON(keyVaultSecretBundle{Value: &value}),
+		autorest.WithQueryParameters(map[string]interface{}{"api-version": keyVaultAPIVersion}),
+		client.WithAuthorization())
+	if err != nil {
+		return "", errors.Wrapf(err, "preparing the request for secret %s", secretName)
+	}
+	resp, err := client.Send(req)
+	if err != nil {
+		return "", errors.Wrapf(err, "setting secret %s in %s", secretName, vaultURL)
+	}
+	var bundle keyVaultSecretBundle
+	err = autorest.Respond(resp,
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&bundle),
+		autorest.ByClosing())
+	if err != nil {
+		return "", errors.Wrapf(err, "setting secret %s in %s", secretName, vaultURL)
+	}
+	if bundle.ID == nil {
+		return "", errors.Errorf("secret %s from %s has no identifier", secretName, vaultURL)
+	}
+	// the identifier of a secret version is https://<vault>/secrets/<name>/<version>
+	return path.Base(*bundle.ID), nil
+}
+
+// keyVaultSecretBundle is the representation of a secret in the keyvault data plane API
+type keyVaultSecretBundle struct {
+	ID    *string `json:"id,omitempty"`
+	Value *string `json:"value,omitempty"`
+}
+
+// keyVaultURL returns the data plane endpoint of the keyvault identified by its resource ID
+func keyVaultURL(env azure.Environment, vaultID string) (string, error) {
+	parts := strings.Split(strings.TrimSuffix(vaultID, "/"), "/")
+	if len(parts) < 2 || !strings.EqualFold(parts[len(parts)-2], "vaults") {
+		return "", errors.Errorf("invalid keyvault resource ID %s", vaultID)
+	}
+	if env.KeyVaultDNSSuffix == "" {
+		return "", errors.Errorf("the keyvault DNS suffix of cloud %s is not set", env.Name)
+	}
+	return fmt.Sprintf("https://%s.%s", parts[len(parts)-1], env.KeyVaultDNSSuffix), nil
+}
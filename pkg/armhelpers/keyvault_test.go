@@ -0,0 +1,84 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package armhelpers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	. "github.com/onsi/gomega"
+)
+
+const testVaultID = "/subscriptions/11111111-1111-1111-1111-111111111111/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/cluster-pki"
+
+func TestKeyVaultURL(t *testing.T) {
+	t.Parallel()
+	g := NewGomegaWithT(t)
+
+	url, err := keyVaultURL(azure.PublicCloud, testVaultID)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(url).To(Equal("https://cluster-pki.vault.azure.net"))
+
+	_, err = keyVaultURL(azure.PublicCloud, "/subscriptions/11111111-1111-1111-1111-111111111111/resourceGroups/rg")
+	g.Expect(err).To(MatchError("invalid keyvault resource ID /subscriptions/11111111-1111-1111-1111-111111111111/resourceGroups/rg"))
+
+	_, err = keyVaultURL(azure.Environment{Name: "custom"}, testVaultID)
+	g.Expect(err).To(MatchError("the keyvault DNS suffix of cloud custom is not set"))
+}
+
+func TestGetSecretFromKeyVault(t *testing.T) {
+	t.Parallel()
+	g := NewGomegaWithT(t)
+
+	var requestURL string
+	client := autorest.NewClientWithUserAgent("test")
+	client.Sender = autorest.SenderFunc(func(req *http.Request) (*http.Response, error) {
+		requestURL = req.URL.String()
+		if strings.Contains(req.URL.Path, "missing") {
+			return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(strings.NewReader(`{"error":{"code":"SecretNotFound"}}`)), Request: req}, nil
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`{"value":"bundle"}`)), Request: req}, nil
+	})
+
+	value, err := GetSecretFromKeyVault(context.Background(), client, azure.PublicCloud, testVaultID, "ca", "v1")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(value).To(Equal("bundle"))
+	g.Expect(requestURL).To(Equal("https://cluster-pki.vault.azure.net/secrets/ca/v1?api-version=7.0"))
+
+	_, err = GetSecretFromKeyVault(context.Background(), client, azure.PublicCloud, testVaultID, "missing", "")
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(requestURL).To(Equal("https://cluster-pki.vault.azure.net/secrets/missing/?api-version=7.0"))
+}
+
+func TestSetSecretInKeyVault(t *testing.T) {
+	t.Parallel()
+	g := NewGomegaWithT(t)
+
+	var requestMethod, requestURL, requestBody string
+	client := autorest.NewClientWithUserAgent("test")
+	client.Sender = autorest.SenderFunc(func(req *http.Request) (*http.Response, error) {
+		requestMethod, requestURL = req.Method, req.URL.String()
+		b, _ := io.ReadAll(req.Body)
+		requestBody = string(b)
+		if strings.Contains(req.URL.Path, "forbidden") {
+			return &http.Response{StatusCode: http.StatusForbidden, Body: io.NopCloser(strings.NewReader(`{"error":{"code":"Forbidden"}}`)), Request: req}, nil
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`{"id":"https://cluster-pki.vault.azure.net/secrets/sp/v2"}`)), Request: req}, nil
+	})
+
+	version, err := SetSecretInKeyVault(context.Background(), client, azure.PublicCloud, testVaultID, "sp", "secret")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(version).To(Equal("v2"))
+	g.Expect(requestMethod).To(Equal(http.MethodPut))
+	g.Expect(requestURL).To(Equal("https://cluster-pki.vault.azure.net/secrets/sp?api-version=7.0"))
+	g.Expect(requestBody).To(Equal(`{"value":"secret"}`))
+
+	_, err = SetSecretInKeyVault(context.Background(), client, azure.PublicCloud, testVaultID, "forbidden", "secret")
+	g.Expect(err).To(HaveOccurred())
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/Azure/azure-sdk-for-go/services/authorization/mgmt/2015-07-01/authorization"
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-12-01/compute"
 	"github.com/Azure/azure-sdk-for-go/services/graphrbac/1.6/graphrbac"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2018-08-01/network"
 	"github.com/Azure/azure-sdk-for-go/services/preview/msi/mgmt/2015-08-31-preview/msi"
 	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2016-06-01/subscriptions"
 	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2018-05-01/resources"
@@ -57,23 +58,41 @@ type MockAKSEngineClient struct {
 	FailRestartVirtualMachineScaleSets      bool
 	FailGetVirtualMachine                   bool
 	FailRestartVirtualMachine               bool
+	FailReimageVirtualMachine               bool
 	FailDeleteVirtualMachine                bool
 	FailDeleteVirtualMachineScaleSetVM      bool
+	FailDeleteVirtualMachineScaleSet        bool
 	FailSetVirtualMachineScaleSetCapacity   bool
+	FailGetVirtualMachineScaleSet           bool
+	FailUpdateVirtualMachineScaleSetVMs     bool
+	FailReimageVirtualMachineScaleSetVMs    bool
 	FailListVirtualMachineScaleSetVMs       bool
+	FailDeleteAvailabilitySet               bool
 	FailGetStorageClient                    bool
 	FailDeleteNetworkInterface              bool
+	FailListNetworkInterfaces               bool
+	FailDeleteManagedDisk                   bool
+	FailListManagedDisks                    bool
 	FailGetKubernetesClient                 bool
 	FailListProviders                       bool
 	ShouldSupportVMIdentity                 bool
 	FailDeleteRoleAssignment                bool
+	FailListRoleAssignmentsForPrincipal     bool
 	FailEnsureDefaultLogAnalyticsWorkspace  bool
 	FailAddContainerInsightsSolution        bool
 	FailGetLogAnalyticsWorkspaceInfo        bool
+	FailGetKeyVaultSecret                   bool
+	FailSetKeyVaultSecret                   bool
 	MockKubernetesClient                    *MockKubernetesClient
 	FakeListVirtualMachineScaleSetsResult   func() []compute.VirtualMachineScaleSet
 	FakeListVirtualMachineResult            func() []compute.VirtualMachine
 	FakeListVirtualMachineScaleSetVMsResult func() []compute.VirtualMachineScaleSetVM
+	FakeGetVirtualMachineScaleSetResult     func(name string) compute.VirtualMachineScaleSet
+	ReimagedVirtualMachineScaleSetVMs       []string
+	FakeGetKeyVaultSecretResult             func(secretName string) string
+	FakeVirtualMachinePowerState            string
+	FakeListNetworkInterfacesResult         func() []network.Interface
+	FakeListManagedDisksResult              func() []compute.Disk
 }
 
 // MockStorageClient mock implementation of StorageClient
@@ -84,29 +103,40 @@ type MockStorageClient struct {
 
 // MockKubernetesClient mock implementation of KubernetesClient
 type MockKubernetesClient struct {
-	FailListPods              bool
-	FailListNodes             bool
-	FailListServiceAccounts   bool
-	FailListPodSecurityPolicy bool
-	FailGetNode               bool
-	UpdateNodeFunc            func(*v1.Node) (*v1.Node, error)
-	GetNodeFunc               func(name string) (*v1.Node, error)
-	FailUpdateNode            bool
-	FailDeleteNode            bool
-	FailDeleteServiceAccount  bool
-	FailSupportEviction       bool
-	FailDeletePod             bool
-	FailDeleteClusterRole     bool
-	FailDeleteDaemonSet       bool
-	FailDeleteDeployment      bool
-	FailEvictPod              bool
-	FailWaitForDelete         bool
-	ShouldSupportEviction     bool
-	PodsList                  *v1.PodList
-	ServiceAccountList        *v1.ServiceAccountList
-	PodSecurityPolicyList     *policyv1beta1.PodSecurityPolicyList
-	FailGetDeploymentCount    int
-	FailUpdateDeploymentCount int
+	FailListPods                 bool
+	FailListNodes                bool
+	FailListServiceAccounts      bool
+	FailListPodSecurityPolicy    bool
+	FailGetNode                  bool
+	UpdateNodeFunc               func(*v1.Node) (*v1.Node, error)
+	GetNodeFunc                  func(name string) (*v1.Node, error)
+	DeleteNodeFunc               func(name string) error
+	FailUpdateNode               bool
+	FailDeleteNode               bool
+	FailDeleteServiceAccount     bool
+	FailSupportEviction          bool
+	FailDeletePod                bool
+	FailDeleteClusterRole        bool
+	FailDeleteDaemonSet          bool
+	FailDeleteDeployment         bool
+	FailEvictPod                 bool
+	FailWaitForDelete            bool
+	ShouldSupportEviction        bool
+	PodsList                     *v1.PodList
+	ServiceAccountList           *v1.ServiceAccountList
+	PodSecurityPolicyList        *policyv1beta1.PodSecurityPolicyList
+	FailListDeployments          bool
+	FailListDaemonSets           bool
+	FailListPodDisruptionBudgets bool
+	DeploymentList               *appsv1.DeploymentList
+	DaemonSetList                *appsv1.DaemonSetList
+	PodDisruptionBudgetList      *policyv1beta1.PodDisruptionBudgetList
+	FailGetDeploymentCount       int
+	FailUpdateDeploymentCount    int
+	FailListEvents               bool
+	FailGetPodLogs               bool
+	FailGetRaw                   bool
+	EventList                    *v1.EventList
 }
 
 // MockVirtualMachineListResultPage contains a page of VirtualMachine values.
@@ -226,6 +256,88 @@ func (page MockVirtualMachineScaleSetVMListResultPage) Values() []compute.Virtua
 	return *page.Vmssvlr.Value
 }
 
+// MockInterfaceListResultPage contains a page of network Interface values.
+type MockInterfaceListResultPage struct {
+	Fn  func(network.InterfaceListResult) (network.InterfaceListResult, error)
+	Ilr network.InterfaceListResult
+}
+
+// NextWithContext advances to the next page of values.  If there was an error making
+// the request the page does not advance and the error is returned. Context is ignored for the mock implementation
+func (page *MockInterfaceListResultPage) NextWithContext(ctx context.Context) error {
+	return page.Next()
+}
+
+// Next advances to the next page of values.  If there was an error making
+// the request the page does not advance and the error is returned.
+func (page *MockInterfaceListResultPage) Next() error {
+	next, err := page.Fn(page.Ilr)
+	if err != nil {
+		return err
+	}
+	page.Ilr = next
+	return nil
+}
+
+// NotDone returns true if the page enumeration should be started or is not yet complete.
+func (page MockInterfaceListResultPage) NotDone() bool {
+	return !page.Ilr.IsEmpty()
+}
+
+// Response returns the raw server response from the last page request.
+func (page MockInterfaceListResultPage) Response() network.InterfaceListResult {
+	return page.Ilr
+}
+
+// Values returns the slice of values for the current page or nil if there are no values.
+func (page MockInterfaceListResultPage) Values() []network.Interface {
+	if page.Ilr.IsEmpty() {
+		return nil
+	}
+	return *page.Ilr.Value
+}
+
+// MockDiskListPage contains a page of Disk values.
+type MockDiskListPage struct {
+	Fn func(compute.DiskList) (compute.DiskList, error)
+	Dl compute.DiskList
+}
+
+// NextWithContext advances to the next page of values.  If there was an error making
+// the request the page does not advance and the error is returned. Context is ignored for the mock implementation
+func (page *MockDiskListPage) NextWithContext(ctx context.Context) error {
+	return page.Next()
+}
+
+// Next advances to the next page of values.  If there was an error making
+// the request the page does not advance and the error is returned.
+func (page *MockDiskListPage) Next() error {
+	next, err := page.Fn(page.Dl)
+	if err != nil {
+		return err
+	}
+	page.Dl = next
+	return nil
+}
+
+// NotDone returns true if the page enumeration should be started or is not yet complete.
+func (page MockDiskListPage) NotDone() bool {
+	return !page.Dl.IsEmpty()
+}
+
+// Response returns the raw server response from the last page request.
+func (page MockDiskListPage) Response() compute.DiskList {
+	return page.Dl
+}
+
+// Values returns the slice of values for the current page or nil if there are no values.
+func (page MockDiskListPage) Values() []compute.Disk {
+	if page.Dl.IsEmpty() {
+		return nil
+	}
+	return *page.Dl.Value
+}
+
 // MockDeploymentOperationsListResultPage contains a page of DeploymentOperation values.
 type MockDeploymentOperationsListResultPage struct {
 	Fn   func(resources.DeploymentOperationsListResult) (resources.DeploymentOperationsListResult, error)
@@ -318,6 +430,47 @@ func (mkc *MockKubernetesClient) ListAllPods() (*v1.PodList, error) {
 	return &v1.PodList{}, nil
 }
 
+// ListPodsByOptions returns Pods based on the passed in list options
+func (mkc *MockKubernetesClient) ListPodsByOptions(namespace string, opts metav1.ListOptions) (*v1.PodList, error) {
+	if mkc.FailListPods {
+		return nil, errors.New("ListPodsByOptions failed")
+	}
+	if mkc.PodsList != nil {
+		return mkc.PodsList, nil
+	}
+	return &v1.PodList{}, nil
+}
+
+// ListEvents returns a list of events in the provided namespace
+func (mkc *MockKubernetesClient) ListEvents(namespace string, opts metav1.ListOptions) (*v1.EventList, error) {
+	if mkc.FailListEvents {
+		return nil, errors.New("ListEvents failed")
+	}
+	if mkc.EventList != nil {
+		return mkc.EventList, nil
+	}
+	return &v1.EventList{}, nil
+}
+
+// GetPodLogs returns the logs of a pod container
+func (mkc *MockKubernetesClient) GetPodLogs(namespace, name string, opts *v1.PodLogOptions) ([]byte, error) {
+	if mkc.FailGetPodLogs {
+		return nil, errors.New("GetPodLogs failed")
+	}
+	if opts.Previous {
+		return []byte(fmt.Sprintf("previous %s/%s/%s logs", namespace, name, opts.Container)), nil
+	}
+	return []byte(fmt.Sprintf("%s/%s/%s logs", namespace, name, opts.Container)), nil
+}
+
+// GetRaw returns the response body of a GET request to the passed in api server path
+func (mkc *MockKubernetesClient) GetRaw(path string) ([]byte, error) {
+	if mkc.FailGetRaw {
+		return nil, errors.New("GetRaw failed")
+	}
+	return []byte(path), nil
+}
+
 // ListNodes returns a list of Nodes registered in the api server
 func (mkc *MockKubernetesClient) ListNodes() (*v1.NodeList, error) {
 	if mkc.FailListNodes {
@@ -407,6 +560,9 @@ func (mkc *MockKubernetesClient) UpdateNode(node *v1.Node) (*v1.Node, error) {
 
 // DeleteNode deregisters node in the api server
 func (mkc *MockKubernetesClient) DeleteNode(name string) error {
+	if mkc.DeleteNodeFunc != nil {
+		return mkc.DeleteNodeFunc(name)
+	}
 	if mkc.FailDeleteNode {
 		return errors.New("DeleteNode failed")
 	}
@@ -480,6 +636,39 @@ func (mkc *MockKubernetesClient) WaitForDelete(logger *log.Entry, pods []v1.Pod,
 	return []v1.Pod{}, nil
 }
 
+// ListDeployments returns the DeploymentList of the mock, or an empty list
+func (mkc *MockKubernetesClient) ListDeployments(namespace string, opts metav1.ListOptions) (*appsv1.DeploymentList, error) {
+	if mkc.FailListDeployments {
+		return nil, errors.New("ListDeployments failed")
+	}
+	if mkc.DeploymentList != nil {
+		return mkc.DeploymentList, nil
+	}
+	return &appsv1.DeploymentList{}, nil
+}
+
+// ListDaemonSets returns the DaemonSetList of the mock, or an empty list
+func (mkc *MockKubernetesClient) ListDaemonSets(namespace string, opts metav1.ListOptions) (*appsv1.DaemonSetList, error) {
+	if mkc.FailListDaemonSets {
+		return nil, errors.New("ListDaemonSets failed")
+	}
+	if mkc.DaemonSetList != nil {
+		return mkc.DaemonSetList, nil
+	}
+	return &appsv1.DaemonSetList{}, nil
+}
+
+// ListPodDisruptionBudgets returns the PodDisruptionBudgetList of the mock, or an empty list
+func (mkc *MockKubernetesClient) ListPodDisruptionBudgets(namespace string, opts metav1.ListOptions) (*policyv1beta1.PodDisruptionBudgetList, error) {
+	if mkc.FailListPodDisruptionBudgets {
+		return nil, errors.New("ListPodDisruptionBudgets failed")
+	}
+	if mkc.PodDisruptionBudgetList != nil {
+		return mkc.PodDisruptionBudgetList, nil
+	}
+	return &policyv1beta1.PodDisruptionBudgetList{}, nil
+}
+
 // DaemonSet returns a given daemonset in a namespace.
 func (mkc *MockKubernetesClient) GetDaemonSet(namespace, name string) (*appsv1.DaemonSet, error) {
 	return &appsv1.DaemonSet{
@@ -710,6 +899,14 @@ func (mc *MockAKSEngineClient) RestartVirtualMachine(ctx context.Context, resour
 	return nil
 }
 
+// ReimageVirtualMachine mock
+func (mc *MockAKSEngineClient) ReimageVirtualMachine(ctx context.Context, resourceGroup, name string) error {
+	if mc.FailReimageVirtualMachine {
+		return errors.New("ReimageVirtualMachine failed")
+	}
+	return nil
+}
+
 // MakeFakeVirtualMachineScaleSetVM creates a fake VMSS VM
 func (mc *MockAKSEngineClient) MakeFakeVirtualMachineScaleSetVM(orchestratorTag string) compute.VirtualMachineScaleSetVM {
 	return mc.MakeFakeVirtualMachineScaleSetVMWithGivenName(orchestratorTag, "computerName")
@@ -838,6 +1035,15 @@ func (mc *MockAKSEngineClient) DeleteVirtualMachineScaleSetVM(ctx context.Contex
 	return nil
 }
 
+// DeleteVirtualMachineScaleSet mock
+func (mc *MockAKSEngineClient) DeleteVirtualMachineScaleSet(ctx context.Context, resourceGroup, vmssName string) error {
+	if mc.FailDeleteVirtualMachineScaleSet {
+		return errors.New("DeleteVirtualMachineScaleSet failed")
+	}
+
+	return nil
+}
+
 // SetVirtualMachineScaleSetCapacity mock
 func (mc *MockAKSEngineClient) SetVirtualMachineScaleSetCapacity(ctx context.Context, resourceGroup, virtualMachineScaleSet string, sku compute.Sku, location string) error {
 	if mc.FailSetVirtualMachineScaleSetCapacity {
@@ -847,6 +1053,37 @@ func (mc *MockAKSEngineClient) SetVirtualMachineScaleSetCapacity(ctx context.Con
 	return nil
 }
 
+// GetVirtualMachineScaleSet mock
+func (mc *MockAKSEngineClient) GetVirtualMachineScaleSet(ctx context.Context, resourceGroup, virtualMachineScaleSet string) (compute.VirtualMachineScaleSet, error) {
+	if mc.FailGetVirtualMachineScaleSet {
+		return compute.VirtualMachineScaleSet{}, errors.New("GetVirtualMachineScaleSet failed")
+	}
+	if mc.FakeGetVirtualMachineScaleSetResult != nil {
+		return mc.FakeGetVirtualMachineScaleSetResult(virtualMachineScaleSet), nil
+	}
+	return compute.VirtualMachineScaleSet{
+		Name: &virtualMachineScaleSet,
+	}, nil
+}
+
+// UpdateVirtualMachineScaleSetVMs mock
+func (mc *MockAKSEngineClient) UpdateVirtualMachineScaleSetVMs(ctx context.Context, resourceGroup, virtualMachineScaleSet string, instanceIDs []string) error {
+	if mc.FailUpdateVirtualMachineScaleSetVMs {
+		return errors.New("UpdateVirtualMachineScaleSetVMs failed")
+	}
+
+	return nil
+}
+
+// ReimageVirtualMachineScaleSetVMs mock
+func (mc *MockAKSEngineClient) ReimageVirtualMachineScaleSetVMs(ctx context.Context, resourceGroup, virtualMachineScaleSet string, instanceIDs []string) error {
+	if mc.FailReimageVirtualMachineScaleSetVMs {
+		return errors.New("ReimageVirtualMachineScaleSetVMs failed")
+	}
+	mc.ReimagedVirtualMachineScaleSetVMs = append(mc.ReimagedVirtualMachineScaleSetVMs, instanceIDs...)
+	return nil
+}
+
 // ListVirtualMachineScaleSetVMs mock
 func (mc *MockAKSEngineClient) ListVirtualMachineScaleSetVMs(ctx context.Context, resourceGroup, virtualMachineScaleSet string) (VirtualMachineScaleSetVMListResultPage, error) {
 	if mc.FailDeleteVirtualMachineScaleSetVM {
@@ -877,6 +1114,14 @@ func (mc *MockAKSEngineClient) GetAvailabilitySet(ctx context.Context, resourceG
 	return compute.AvailabilitySet{}, nil
 }
 
+// DeleteAvailabilitySet mock
+func (mc *MockAKSEngineClient) DeleteAvailabilitySet(ctx context.Context, resourceGroup, availabilitySetName string) error {
+	if mc.FailDeleteAvailabilitySet {
+		return errors.New("DeleteAvailabilitySet failed")
+	}
+	return nil
+}
+
 // GetAvailabilitySetFaultDomainCount mock
 func (mc *MockAKSEngineClient) GetAvailabilitySetFaultDomainCount(ctx context.Context, resourceGroup string, vmasIDs []string) (int, error) {
 	return 3, nil
@@ -900,6 +1145,30 @@ func (mc *MockAKSEngineClient) DeleteNetworkInterface(ctx context.Context, resou
 	return nil
 }
 
+// ListNetworkInterfaces mock
+func (mc *MockAKSEngineClient) ListNetworkInterfaces(ctx context.Context, resourceGroup string) (InterfaceListResultPage, error) {
+	if mc.FailListNetworkInterfaces {
+		return &MockInterfaceListResultPage{
+			Ilr: network.InterfaceListResult{
+				Value: &[]network.Interface{{}},
+			},
+		}, errors.New("ListNetworkInterfaces failed")
+	}
+	if mc.FakeListNetworkInterfacesResult == nil {
+		//return 0 network interfaces by default
+		mc.FakeListNetworkInterfacesResult = func() []network.Interface {
+			return []network.Interface{}
+		}
+	}
+	nics := mc.FakeListNetworkInterfacesResult()
+	return &MockInterfaceListResultPage{
+		Fn: func(network.InterfaceListResult) (network.InterfaceListResult, error) {
+			return network.InterfaceListResult{}, nil
+		},
+		Ilr: network.InterfaceListResult{Value: &nics},
+	}, nil
+}
+
 var validOSDiskResourceName = "https://00k71r4u927seqiagnt0.blob.core.windows.net/osdisk/k8s-agentpool1-12345678-0-osdisk.vhd"
 var validNicResourceName = "/subscriptions/DEC923E3-1EF1-4745-9516-37906D56DEC4/resourceGroups/acsK8sTest/providers/Microsoft.Network/networkInterfaces/k8s-agent-12345678-nic-0"
 
@@ -951,12 +1220,34 @@ func (mc *MockAKSEngineClient) CreateRoleAssignmentSimple(ctx context.Context, a
 
 // DeleteManagedDisk is a wrapper around disksClient.Delete
 func (mc *MockAKSEngineClient) DeleteManagedDisk(ctx context.Context, resourceGroupName string, diskName string) error {
+	if mc.FailDeleteManagedDisk {
+		return errors.New("DeleteManagedDisk failed")
+	}
 	return nil
 }
 
 // ListManagedDisksByResourceGroup is a wrapper around disksClient.ListManagedDisksByResourceGroup
 func (mc *MockAKSEngineClient) ListManagedDisksByResourceGroup(ctx context.Context, resourceGroupName string) (result DiskListPage, err error) {
-	return &compute.DiskListPage{}, nil
+	if mc.FailListManagedDisks {
+		return &MockDiskListPage{
+			Dl: compute.DiskList{
+				Value: &[]compute.Disk{{}},
+			},
+		}, errors.New("ListManagedDisksByResourceGroup failed")
+	}
+	if mc.FakeListManagedDisksResult == nil {
+		//return 0 disks by default
+		mc.FakeListManagedDisksResult = func() []compute.Disk {
+			return []compute.Disk{}
+		}
+	}
+	disks := mc.FakeListManagedDisksResult()
+	return &MockDiskListPage{
+		Fn: func(compute.DiskList) (compute.DiskList, error) {
+			return compute.DiskList{}, nil
+		},
+		Dl: compute.DiskList{Value: &disks},
+	}, nil
 }
 
 // GetKubernetesClient mock
@@ -1059,6 +1350,10 @@ func (mc *MockAKSEngineClient) DeleteRoleAssignmentByID(ctx context.Context, rol
 
 // ListRoleAssignmentsForPrincipal (e.g. a VM) via the scope and the unique identifier of the principal
 func (mc *MockAKSEngineClient) ListRoleAssignmentsForPrincipal(ctx context.Context, scope string, principalID string) (RoleAssignmentListResultPage, error) {
+	if mc.FailListRoleAssignmentsForPrincipal {
+		return nil, errors.New("ListRoleAssignmentsForPrincipal failed")
+	}
+
 	roleAssignments := []authorization.RoleAssignment{}
 
 	if mc.ShouldSupportVMIdentity {
@@ -1075,6 +1370,25 @@ func (mc *MockAKSEngineClient) ListRoleAssignmentsForPrincipal(ctx context.Conte
 	}, nil
 }
 
+// GetKeyVaultSecret mock
+func (mc *MockAKSEngineClient) GetKeyVaultSecret(ctx context.Context, vaultID, secretName, secretVersion string) (string, error) {
+	if mc.FailGetKeyVaultSecret {
+		return "", errors.New("GetKeyVaultSecret failed")
+	}
+	if mc.FakeGetKeyVaultSecretResult != nil {
+		return mc.FakeGetKeyVaultSecretResult(secretName), nil
+	}
+	return "", nil
+}
+
+// SetKeyVaultSecret mock
+func (mc *MockAKSEngineClient) SetKeyVaultSecret(ctx context.Context, vaultID, secretName, value string) (string, error) {
+	if mc.FailSetKeyVaultSecret {
+		return "", errors.New("SetKeyVaultSecret failed")
+	}
+	return "version", nil
+}
+
 // EnsureDefaultLogAnalyticsWorkspace mock
 func (mc *MockAKSEngineClient) EnsureDefaultLogAnalyticsWorkspace(ctx context.Context, resourceGroup, location string) (workspaceResourceID string, err error) {
 	if mc.FailEnsureDefaultLogAnalyticsWorkspace {
@@ -1104,10 +1418,10 @@ func (mc *MockAKSEngineClient) GetLogAnalyticsWorkspaceInfo(ctx context.Context,
 
 // GetVirtualMachinePowerState returns the virtual machine's PowerState status code
 func (mc *MockAKSEngineClient) GetVirtualMachinePowerState(ctx context.Context, resourceGroup, name string) (string, error) {
-	return "", nil
+	return mc.FakeVirtualMachinePowerState, nil
 }
 
 // GetVirtualMachineScaleSetInstancePowerState returns the virtual machine's PowerState status code
 func (mc *MockAKSEngineClient) GetVirtualMachineScaleSetInstancePowerState(ctx context.Context, resourceGroup, name, instanceID string) (string, error) {
-	return "", nil
+	return mc.FakeVirtualMachinePowerState, nil
 }
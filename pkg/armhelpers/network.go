@@ -21,3 +21,9 @@ func (az *AzureClient) DeleteNetworkInterface(ctx context.Context, resourceGroup
 	_, err = future.Result(az.interfacesClient)
 	return err
 }
+
+// ListNetworkInterfaces lists the network interfaces in the resource group
+func (az *AzureClient) ListNetworkInterfaces(ctx context.Context, resourceGroup string) (InterfaceListResultPage, error) {
+	page, err := az.interfacesClient.List(ctx, resourceGroup)
+	return &page, err
+}
@@ -3,88 +3,597 @@
 
 package engine
 
-var cseErrorCodes = map[string]int{
-	"ERR_SYSTEMCTL_STOP_FAIL":                    3,
-	"ERR_SYSTEMCTL_START_FAIL":                   4,
-	"ERR_CLOUD_INIT_TIMEOUT":                     5, // Deprecated
-	"ERR_FILE_WATCH_TIMEOUT":                     6,
-	"ERR_HOLD_WALINUXAGENT":                      7,
-	"ERR_RELEASE_HOLD_WALINUXAGENT":              8,
-	"ERR_APT_INSTALL_TIMEOUT":                    9,
-	"ERR_ETCD_DATA_DIR_NOT_FOUND":                10, // Deprecated
-	"ERR_ETCD_RUNNING_TIMEOUT":                   11,
-	"ERR_ETCD_DOWNLOAD_TIMEOUT":                  12, // Deprecated
-	"ERR_ETCD_VOL_MOUNT_FAIL":                    13,
-	"ERR_ETCD_START_TIMEOUT":                     14,
-	"ERR_ETCD_CONFIG_FAIL":                       15,
-	"ERR_DOCKER_INSTALL_TIMEOUT":                 20, // Deprecated
-	"ERR_DOCKER_DOWNLOAD_TIMEOUT":                21, // Deprecated
-	"ERR_DOCKER_KEY_DOWNLOAD_TIMEOUT":            22, // Deprecated
-	"ERR_DOCKER_APT_KEY_TIMEOUT":                 23, // Deprecated
-	"ERR_DOCKER_START_FAIL":                      24,
-	"ERR_MOBY_APT_LIST_TIMEOUT":                  25,
-	"ERR_MS_GPG_KEY_DOWNLOAD_TIMEOUT":            26,
-	"ERR_MOBY_INSTALL_TIMEOUT":                   27,
-	"ERR_K8S_RUNNING_TIMEOUT":                    30,
-	"ERR_K8S_DOWNLOAD_TIMEOUT":                   31,
-	"ERR_KUBECTL_NOT_FOUND":                      32, // Deprecated
-	"ERR_IMG_DOWNLOAD_TIMEOUT":                   33,
-	"ERR_KUBELET_START_FAIL":                     34,
-	"ERR_CONTAINER_IMG_PULL_TIMEOUT":             35,
-	"ERR_ADDONS_START_FAIL":                      36,
-	"ERR_CNI_DOWNLOAD_TIMEOUT":                   41,
-	"ERR_MS_PROD_DEB_DOWNLOAD_TIMEOUT":           42,
-	"ERR_MS_PROD_DEB_PKG_ADD_FAIL":               43,
-	"ERR_SYSTEMD_INSTALL_FAIL":                   48, // Deprecated
-	"ERR_MODPROBE_FAIL":                          49,
-	"ERR_OUTBOUND_CONN_FAIL":                     50,
-	"ERR_K8S_API_SERVER_CONN_FAIL":               51,
-	"ERR_K8S_API_SERVER_DNS_LOOKUP_FAIL":         52,
-	"ERR_K8S_API_SERVER_AZURE_DNS_LOOKUP_FAIL":   53,
-	"ERR_KATA_KEY_DOWNLOAD_TIMEOUT":              60,
-	"ERR_KATA_APT_KEY_TIMEOUT":                   61,
-	"ERR_KATA_INSTALL_TIMEOUT":                   62,
-	"ERR_CONTAINERD_DOWNLOAD_TIMEOUT":            70, // Deprecated
-	"ERR_CUSTOM_SEARCH_DOMAINS_FAIL":             80,
-	"ERR_GPU_DRIVERS_START_FAIL":                 84,
-	"ERR_GPU_DRIVERS_INSTALL_TIMEOUT":            85,
-	"ERR_GPU_DRIVERS_CONFIG":                     86,
-	"ERR_SGX_DRIVERS_INSTALL_TIMEOUT":            90,
-	"ERR_SGX_DRIVERS_START_FAIL":                 91,
-	"ERR_SGX_DRIVERS_NOT_SUPPORTED":              92,
-	"ERR_SGX_DRIVERS_CHECKSUM_MISMATCH":          93,
-	"ERR_APT_DAILY_TIMEOUT":                      98, // Deprecated
-	"ERR_APT_UPDATE_TIMEOUT":                     99,
-	"ERR_CSE_PROVISION_SCRIPT_NOT_READY_TIMEOUT": 100,
-	"ERR_APT_DIST_UPGRADE_TIMEOUT":               101,
-	"ERR_APT_PURGE_FAIL":                         102, // Deprecated
-	"ERR_SYSCTL_RELOAD":                          103,
-	"ERR_CIS_ASSIGN_ROOT_PW":                     111, // Deprecated
-	"ERR_CIS_ASSIGN_FILE_PERMISSION":             112,
-	"ERR_PACKER_COPY_FILE":                       113,
-	"ERR_CIS_APPLY_PASSWORD_CONFIG":              115,
-	"ERR_AZURE_STACK_GET_ARM_TOKEN":              120,
-	"ERR_AZURE_STACK_GET_NETWORK_CONFIGURATION":  121,
-	"ERR_AZURE_STACK_GET_SUBNET_PREFIX":          122,
-	"ERR_AZURE_STACK_GET_SDN_INTERFACES":         123,
-	"ERR_VHD_BUILD_ERROR":                        125, // Deprecated
-	"ERR_IOVISOR_KEY_DOWNLOAD_TIMEOUT":           166,
-	"ERR_IOVISOR_APT_KEY_TIMEOUT":                167,
-	"ERR_BCC_INSTALL_TIMEOUT":                    168,
-	"ERR_BPFTRACE_BIN_DOWNLOAD_FAIL":             169,
-	"ERR_BPFTRACE_TOOLS_DOWNLOAD_FAIL":           170,
-	"ERR_CLUSTER_INIT_FAIL":                      180,
-	"ERR_KUBERESERVED_SLICE_SETUP_FAIL":          181,
-	"ERR_KUBELET_SLICE_SETUP_FAIL":               182,
-	"ERR_CRI_SLICE_SETUP_FAIL":                   183,
-	"ERR_DEB_DOWNLOAD_TIMEOUT":                   184,
-	"ERR_DEB_PKG_ADD_FAIL":                       185,
-	"ERR_VHD_FILE_NOT_FOUND":                     186,
+// CSEError describes an exit code of the Linux custom script extension,
+// as referenced by the ERR_* constants of the provisioning scripts in parts/k8s/cloud-init/artifacts
+type CSEError struct {
+	Name string
+	Code int
+	// Step is the provisioning step that exits with the code
+	Step string
+	// Causes are the likely causes of the failure
+	Causes string
+	// LogFile is the file of the node to inspect
+	LogFile    string
+	Deprecated bool
 }
 
+// cseErrors is the catalog of the CSE exit codes, keep it in sync with the provisioning scripts
+var cseErrors = []CSEError{
+	{
+		Name:    "ERR_SYSTEMCTL_STOP_FAIL",
+		Code:    3,
+		Step:    "stopping and disabling sshd or systemd-timesyncd",
+		Causes:  "systemd could not stop the service within the retries",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_SYSTEMCTL_START_FAIL",
+		Code:    4,
+		Step:    "starting a systemd service (chrony, rpcbind, auditd, containerd, docker-monitor, label-nodes, etcd-monitor...)",
+		Causes:  "the service unit or its configuration file is invalid, or a dependency of the service failed to start",
+		LogFile: "/var/log/azure/<service>-status.log",
+	},
+	{
+		Name:       "ERR_CLOUD_INIT_TIMEOUT",
+		Code:       5,
+		Step:       "waiting for cloud-init to complete",
+		Causes:     "cloud-init did not complete in time",
+		LogFile:    "/var/log/cloud-init-output.log",
+		Deprecated: true,
+	},
+	{
+		Name:    "ERR_FILE_WATCH_TIMEOUT",
+		Code:    6,
+		Step:    "waiting for a file written by cloud-init",
+		Causes:  "cloud-init failed to write the file, check the custom data of the VM and the cloud-init output",
+		LogFile: "/var/log/cloud-init-output.log",
+	},
+	{
+		Name:    "ERR_HOLD_WALINUXAGENT",
+		Code:    7,
+		Step:    "holding the walinuxagent package",
+		Causes:  "the apt lock is held by another process, or apt-mark failed",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_RELEASE_HOLD_WALINUXAGENT",
+		Code:    8,
+		Step:    "releasing the hold on the walinuxagent package",
+		Causes:  "the apt lock is held by another process, or apt-mark failed",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_APT_INSTALL_TIMEOUT",
+		Code:    9,
+		Step:    "installing apt packages",
+		Causes:  "the apt repositories are unreachable from the node, or a package is not available in the configured repositories",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:       "ERR_ETCD_DATA_DIR_NOT_FOUND",
+		Code:       10,
+		Step:       "mounting the etcd data directory",
+		Causes:     "the etcd data disk is not attached to the control plane VM",
+		LogFile:    linuxCSELogPath,
+		Deprecated: true,
+	},
+	{
+		Name:    "ERR_ETCD_RUNNING_TIMEOUT",
+		Code:    11,
+		Step:    "waiting for etcd to be healthy",
+		Causes:  "etcd could not reach the other etcd members, check the etcd peer certificates and the network connectivity between control plane nodes",
+		LogFile: "/var/log/syslog",
+	},
+	{
+		Name:       "ERR_ETCD_DOWNLOAD_TIMEOUT",
+		Code:       12,
+		Step:       "downloading etcd",
+		Causes:     "the etcd download URL is unreachable from the node",
+		LogFile:    linuxCSELogPath,
+		Deprecated: true,
+	},
+	{
+		Name:    "ERR_ETCD_VOL_MOUNT_FAIL",
+		Code:    13,
+		Step:    "mounting the etcd data disk",
+		Causes:  "the etcd data disk is not attached or could not be formatted",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_ETCD_START_TIMEOUT",
+		Code:    14,
+		Step:    "starting etcd",
+		Causes:  "etcd failed to start, check the etcd certificates, the etcd data disk and the etcd configuration",
+		LogFile: "/var/log/syslog",
+	},
+	{
+		Name:    "ERR_ETCD_CONFIG_FAIL",
+		Code:    15,
+		Step:    "configuring etcd",
+		Causes:  "the etcd configuration files were not written by cloud-init, or the etcd member could not be updated",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:       "ERR_DOCKER_INSTALL_TIMEOUT",
+		Code:       20,
+		Step:       "installing docker",
+		Causes:     "the docker packages could not be downloaded",
+		LogFile:    linuxCSELogPath,
+		Deprecated: true,
+	},
+	{
+		Name:       "ERR_DOCKER_DOWNLOAD_TIMEOUT",
+		Code:       21,
+		Step:       "downloading docker",
+		Causes:     "the docker download URL is unreachable from the node",
+		LogFile:    linuxCSELogPath,
+		Deprecated: true,
+	},
+	{
+		Name:       "ERR_DOCKER_KEY_DOWNLOAD_TIMEOUT",
+		Code:       22,
+		Step:       "downloading the docker apt key",
+		Causes:     "the docker apt key URL is unreachable from the node",
+		LogFile:    linuxCSELogPath,
+		Deprecated: true,
+	},
+	{
+		Name:       "ERR_DOCKER_APT_KEY_TIMEOUT",
+		Code:       23,
+		Step:       "adding the docker apt key",
+		Causes:     "the docker apt key is invalid",
+		LogFile:    linuxCSELogPath,
+		Deprecated: true,
+	},
+	{
+		Name:    "ERR_DOCKER_START_FAIL",
+		Code:    24,
+		Step:    "starting docker",
+		Causes:  "the docker daemon configuration is invalid, check the docker systemd drop-ins",
+		LogFile: "/var/log/azure/docker-status.log",
+	},
+	{
+		Name:    "ERR_MOBY_APT_LIST_TIMEOUT",
+		Code:    25,
+		Step:    "adding the Microsoft apt repository",
+		Causes:  "the Microsoft apt repository is unreachable from the node",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_MS_GPG_KEY_DOWNLOAD_TIMEOUT",
+		Code:    26,
+		Step:    "downloading the Microsoft apt key",
+		Causes:  "the Microsoft apt key URL is unreachable from the node",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_MOBY_INSTALL_TIMEOUT",
+		Code:    27,
+		Step:    "installing the moby container runtime packages",
+		Causes:  "the Microsoft apt repository is unreachable from the node, or the requested moby version is not available",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_K8S_RUNNING_TIMEOUT",
+		Code:    30,
+		Step:    "waiting for the Kubernetes API server",
+		Causes:  "the API server did not start, check the control plane static pods, the certificates and the kubelet logs",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_K8S_DOWNLOAD_TIMEOUT",
+		Code:    31,
+		Step:    "downloading the Kubernetes binaries",
+		Causes:  "the Kubernetes binaries URL (kubernetesConfig.customKubeBinaryURL or the default) is unreachable from the node",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:       "ERR_KUBECTL_NOT_FOUND",
+		Code:       32,
+		Step:       "installing kubectl",
+		Causes:     "the Kubernetes binaries do not contain kubectl",
+		LogFile:    linuxCSELogPath,
+		Deprecated: true,
+	},
+	{
+		Name:    "ERR_IMG_DOWNLOAD_TIMEOUT",
+		Code:    33,
+		Step:    "downloading img",
+		Causes:  "the img download URL is unreachable from the node",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_KUBELET_START_FAIL",
+		Code:    34,
+		Step:    "starting kubelet or kubelet-monitor",
+		Causes:  "the kubelet configuration is invalid, or the container runtime is not running",
+		LogFile: "/var/log/syslog",
+	},
+	{
+		Name:    "ERR_CONTAINER_IMG_PULL_TIMEOUT",
+		Code:    35,
+		Step:    "pulling a container image",
+		Causes:  "the container registry is unreachable from the node, or the image does not exist",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_ADDONS_START_FAIL",
+		Code:    36,
+		Step:    "starting the addon manager and the addons",
+		Causes:  "the kube-addon-manager pod is not ready, or an addon manifest is invalid",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_CNI_DOWNLOAD_TIMEOUT",
+		Code:    41,
+		Step:    "downloading the CNI plugins",
+		Causes:  "the CNI plugins URL is unreachable from the node",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_MS_PROD_DEB_DOWNLOAD_TIMEOUT",
+		Code:    42,
+		Step:    "downloading the packages-microsoft-prod package",
+		Causes:  "the Microsoft apt repository is unreachable from the node",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_MS_PROD_DEB_PKG_ADD_FAIL",
+		Code:    43,
+		Step:    "installing the packages-microsoft-prod package",
+		Causes:  "the dpkg lock is held by another process, or the package is corrupted",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:       "ERR_SYSTEMD_INSTALL_FAIL",
+		Code:       48,
+		Step:       "installing systemd",
+		Causes:     "the systemd packages could not be installed",
+		LogFile:    linuxCSELogPath,
+		Deprecated: true,
+	},
+	{
+		Name:    "ERR_MODPROBE_FAIL",
+		Code:    49,
+		Step:    "loading a kernel module (br_netfilter or ip6_tables)",
+		Causes:  "the kernel module is not available in the image",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_OUTBOUND_CONN_FAIL",
+		Code:    50,
+		Step:    "checking the outbound connectivity of the node",
+		Causes:  "the node cannot reach the internet or the configured proxy, check the network security groups, the route tables and the firewall",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_K8S_API_SERVER_CONN_FAIL",
+		Code:    51,
+		Step:    "checking the connectivity to the Kubernetes API server",
+		Causes:  "the node cannot reach the API server, check the load balancer and the network security groups",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_K8S_API_SERVER_DNS_LOOKUP_FAIL",
+		Code:    52,
+		Step:    "resolving the Kubernetes API server FQDN",
+		Causes:  "the DNS servers of the virtual network cannot resolve the API server FQDN",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_K8S_API_SERVER_AZURE_DNS_LOOKUP_FAIL",
+		Code:    53,
+		Step:    "resolving the Kubernetes API server FQDN with Azure DNS",
+		Causes:  "Azure DNS cannot resolve the API server FQDN",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_KATA_KEY_DOWNLOAD_TIMEOUT",
+		Code:    60,
+		Step:    "downloading the kata containers apt key",
+		Causes:  "the kata containers apt key URL is unreachable from the node",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_KATA_APT_KEY_TIMEOUT",
+		Code:    61,
+		Step:    "adding the kata containers apt key",
+		Causes:  "the kata containers apt key is invalid",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_KATA_INSTALL_TIMEOUT",
+		Code:    62,
+		Step:    "installing kata containers",
+		Causes:  "the kata containers packages could not be downloaded",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:       "ERR_CONTAINERD_DOWNLOAD_TIMEOUT",
+		Code:       70,
+		Step:       "downloading containerd",
+		Causes:     "the containerd download URL is unreachable from the node",
+		LogFile:    linuxCSELogPath,
+		Deprecated: true,
+	},
+	{
+		Name:    "ERR_CUSTOM_SEARCH_DOMAINS_FAIL",
+		Code:    80,
+		Step:    "configuring the custom search domains",
+		Causes:  "the custom search domain script failed, check linuxProfile.customSearchDomain",
+		LogFile: "/opt/azure/containers/setup-custom-search-domain.log",
+	},
+	{
+		Name:    "ERR_GPU_DRIVERS_START_FAIL",
+		Code:    84,
+		Step:    "starting the NVIDIA drivers",
+		Causes:  "the NVIDIA drivers do not support the GPU or the kernel of the node",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_GPU_DRIVERS_INSTALL_TIMEOUT",
+		Code:    85,
+		Step:    "downloading the NVIDIA drivers and container runtime",
+		Causes:  "the NVIDIA download URLs are unreachable from the node",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_GPU_DRIVERS_CONFIG",
+		Code:    86,
+		Step:    "configuring the NVIDIA drivers and container runtime",
+		Causes:  "the downloaded NVIDIA packages could not be installed",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_SGX_DRIVERS_INSTALL_TIMEOUT",
+		Code:    90,
+		Step:    "installing the SGX drivers",
+		Causes:  "the SGX driver download URLs are unreachable from the node",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_SGX_DRIVERS_START_FAIL",
+		Code:    91,
+		Step:    "starting the SGX drivers",
+		Causes:  "the SGX drivers do not support the VM size",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_SGX_DRIVERS_NOT_SUPPORTED",
+		Code:    92,
+		Step:    "installing the SGX drivers",
+		Causes:  "the SGX drivers are only supported on Ubuntu 18.04 and 20.04",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_SGX_DRIVERS_CHECKSUM_MISMATCH",
+		Code:    93,
+		Step:    "verifying the SGX drivers",
+		Causes:  "the downloaded SGX driver is corrupted",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:       "ERR_APT_DAILY_TIMEOUT",
+		Code:       98,
+		Step:       "waiting for the apt daily update",
+		Causes:     "the apt daily update did not complete in time",
+		LogFile:    linuxCSELogPath,
+		Deprecated: true,
+	},
+	{
+		Name:    "ERR_APT_UPDATE_TIMEOUT",
+		Code:    99,
+		Step:    "updating the apt package lists",
+		Causes:  "the apt repositories are unreachable from the node, or the apt lock is held by another process",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_CSE_PROVISION_SCRIPT_NOT_READY_TIMEOUT",
+		Code:    100,
+		Step:    "waiting for the provisioning script written by cloud-init",
+		Causes:  "cloud-init did not write /opt/azure/containers/provision.sh within 20 minutes, check the custom data of the VM",
+		LogFile: "/var/log/cloud-init-output.log",
+	},
+	{
+		Name:    "ERR_APT_DIST_UPGRADE_TIMEOUT",
+		Code:    101,
+		Step:    "upgrading the apt packages",
+		Causes:  "the apt repositories are unreachable from the node, or a package upgrade failed",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:       "ERR_APT_PURGE_FAIL",
+		Code:       102,
+		Step:       "removing apt packages",
+		Causes:     "the apt lock is held by another process",
+		LogFile:    linuxCSELogPath,
+		Deprecated: true,
+	},
+	{
+		Name:    "ERR_SYSCTL_RELOAD",
+		Code:    103,
+		Step:    "reloading the sysctl settings",
+		Causes:  "a sysctl setting in linuxProfile or kubernetesConfig is invalid for the kernel of the node",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:       "ERR_CIS_ASSIGN_ROOT_PW",
+		Code:       111,
+		Step:       "assigning the root password",
+		Causes:     "chpasswd failed",
+		LogFile:    linuxCSELogPath,
+		Deprecated: true,
+	},
+	{
+		Name:    "ERR_CIS_ASSIGN_FILE_PERMISSION",
+		Code:    112,
+		Step:    "assigning CIS file permissions",
+		Causes:  "a file expected by the CIS hardening is missing",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_PACKER_COPY_FILE",
+		Code:    113,
+		Step:    "copying a file while building the VHD",
+		Causes:  "the file is missing from the VHD build",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_CIS_APPLY_PASSWORD_CONFIG",
+		Code:    115,
+		Step:    "applying the CIS password configuration",
+		Causes:  "/etc/login.defs or /etc/default/useradd could not be updated",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_AZURE_STACK_GET_ARM_TOKEN",
+		Code:    120,
+		Step:    "getting an Azure Resource Manager token on Azure Stack Hub",
+		Causes:  "the service principal credentials are invalid, or the Azure Stack Hub identity endpoint is unreachable from the node",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_AZURE_STACK_GET_NETWORK_CONFIGURATION",
+		Code:    121,
+		Step:    "getting the network interfaces of the node on Azure Stack Hub",
+		Causes:  "the Azure Resource Manager endpoint is unreachable from the node, or the service principal cannot read the network interfaces",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_AZURE_STACK_GET_SUBNET_PREFIX",
+		Code:    122,
+		Step:    "getting the subnet prefix of the node on Azure Stack Hub",
+		Causes:  "the service principal cannot read the virtual network",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_AZURE_STACK_GET_SDN_INTERFACES",
+		Code:    123,
+		Step:    "getting the SDN interfaces of the node on Azure Stack Hub",
+		Causes:  "the network interfaces of the node have no IP configuration",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:       "ERR_VHD_BUILD_ERROR",
+		Code:       125,
+		Step:       "building the VHD",
+		Causes:     "the VHD build failed",
+		LogFile:    linuxCSELogPath,
+		Deprecated: true,
+	},
+	{
+		Name:    "ERR_IOVISOR_KEY_DOWNLOAD_TIMEOUT",
+		Code:    166,
+		Step:    "downloading the iovisor apt key",
+		Causes:  "the iovisor apt key URL is unreachable from the node",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_IOVISOR_APT_KEY_TIMEOUT",
+		Code:    167,
+		Step:    "adding the iovisor apt key",
+		Causes:  "the iovisor apt key is invalid",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_BCC_INSTALL_TIMEOUT",
+		Code:    168,
+		Step:    "installing bcc",
+		Causes:  "the bcc packages could not be downloaded",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_BPFTRACE_BIN_DOWNLOAD_FAIL",
+		Code:    169,
+		Step:    "downloading bpftrace",
+		Causes:  "the bpftrace download URL is unreachable from the node",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_BPFTRACE_TOOLS_DOWNLOAD_FAIL",
+		Code:    170,
+		Step:    "downloading the bpftrace tools",
+		Causes:  "the bpftrace tools download URL is unreachable from the node",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_CLUSTER_INIT_FAIL",
+		Code:    180,
+		Step:    "applying the cluster-init specification",
+		Causes:  "the cluster-init component specification is invalid, or the API server is not ready",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_KUBERESERVED_SLICE_SETUP_FAIL",
+		Code:    181,
+		Step:    "setting up the kubereserved systemd slice",
+		Causes:  "cloud-init did not write the kubereserved slice unit",
+		LogFile: "/var/log/cloud-init-output.log",
+	},
+	{
+		Name:    "ERR_KUBELET_SLICE_SETUP_FAIL",
+		Code:    182,
+		Step:    "setting up the kubelet systemd slice",
+		Causes:  "cloud-init did not write the kubelet slice drop-in",
+		LogFile: "/var/log/cloud-init-output.log",
+	},
+	{
+		Name:    "ERR_CRI_SLICE_SETUP_FAIL",
+		Code:    183,
+		Step:    "setting up the container runtime systemd slice",
+		Causes:  "cloud-init did not write the container runtime slice drop-in",
+		LogFile: "/var/log/cloud-init-output.log",
+	},
+	{
+		Name:    "ERR_DEB_DOWNLOAD_TIMEOUT",
+		Code:    184,
+		Step:    "downloading the moby, containerd or runc package",
+		Causes:  "the package URL (LINUX_MOBY_URL, LINUX_CONTAINERD_URL or LINUX_RUNC_URL) is unreachable from the node",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_DEB_PKG_ADD_FAIL",
+		Code:    185,
+		Step:    "installing the moby, containerd or runc package",
+		Causes:  "the dpkg lock is held by another process, or the downloaded package is corrupted",
+		LogFile: linuxCSELogPath,
+	},
+	{
+		Name:    "ERR_VHD_FILE_NOT_FOUND",
+		Code:    186,
+		Step:    "checking the VHD release notes",
+		Causes:  "the node does not run an AKS Engine VHD, check the image reference of the node pool",
+		LogFile: linuxCSELogPath,
+	},
+}
+
+var cseErrorCodes = func() map[string]int {
+	codes := make(map[string]int, len(cseErrors))
+	for _, e := range cseErrors {
+		codes[e.Name] = e.Code
+	}
+	return codes
+}()
+
 func GetCSEErrorCode(errorType string) int {
 	if code, ok := cseErrorCodes[errorType]; ok {
 		return code
 	}
 	return -1
 }
+
+// GetCSEError returns the description of a CSE exit code, false if the exit code is unknown
+func GetCSEError(code int) (CSEError, bool) {
+	for _, e := range cseErrors {
+		if e.Code == code {
+			return e, true
+		}
+	}
+	return CSEError{}, false
+}
+
+// GetCSEErrorName returns the name of the error constant for a CSE exit code, or an empty string if the exit code is unknown
+func GetCSEErrorName(code int) string {
+	e, _ := GetCSEError(code)
+	return e.Name
+}
@@ -4,6 +4,9 @@
 package engine
 
 import (
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -114,3 +117,72 @@ func TestGetCSEErrorCode(t *testing.T) {
 		})
 	}
 }
+
+func TestGetCSEErrorName(t *testing.T) {
+	for name, code := range cseErrorCodes {
+		if ret := GetCSEErrorName(code); ret != name {
+			t.Errorf("unexpected error name %s for exit code %d, expected: %s", ret, code, name)
+		}
+	}
+	if ret := GetCSEErrorName(124); ret != "" {
+		t.Errorf("expected no error name for an unknown exit code, got: %s", ret)
+	}
+}
+
+func TestGetCSEError(t *testing.T) {
+	e, ok := GetCSEError(50)
+	if !ok {
+		t.Fatalf("expected exit code 50 to be in the catalog")
+	}
+	if e.Name != "ERR_OUTBOUND_CONN_FAIL" || e.Step == "" || e.Causes == "" || e.LogFile != linuxCSELogPath {
+		t.Errorf("unexpected description of exit code 50: %+v", e)
+	}
+	if _, ok = GetCSEError(124); ok {
+		t.Errorf("expected exit code 124 not to be in the catalog")
+	}
+
+	names := map[string]bool{}
+	codes := map[int]bool{}
+	for _, e := range cseErrors {
+		if names[e.Name] || codes[e.Code] {
+			t.Errorf("duplicated CSE error %s (%d)", e.Name, e.Code)
+		}
+		names[e.Name], codes[e.Code] = true, true
+		if e.Step == "" || e.Causes == "" || e.LogFile == "" {
+			t.Errorf("CSE error %s has no step, causes or log file", e.Name)
+		}
+	}
+}
+
+// TestCSEErrorsInSyncWithScripts checks that every exit code of the provisioning scripts is in the catalog
+func TestCSEErrorsInSyncWithScripts(t *testing.T) {
+	nameRegexp := regexp.MustCompile(`GetCSEErrorCode "(ERR_[A-Z0-9_]+)"`)
+	constantRegexp := regexp.MustCompile(`(ERR_[A-Z0-9_]+)=([0-9]+)`)
+	exitRegexp := regexp.MustCompile(`exit ([0-9]+)`)
+	for _, asset := range AssetNames() {
+		if !strings.HasPrefix(asset, "k8s/cloud-init/artifacts/") || !strings.HasSuffix(asset, ".sh") {
+			continue
+		}
+		b, err := Asset(asset)
+		if err != nil {
+			t.Fatalf("unexpected error reading %s: %s", asset, err)
+		}
+		script := string(b)
+		for _, m := range nameRegexp.FindAllStringSubmatch(script, -1) {
+			if GetCSEErrorCode(m[1]) == -1 {
+				t.Errorf("%s exits with %s, which is not in the catalog", asset, m[1])
+			}
+		}
+		for _, m := range constantRegexp.FindAllStringSubmatch(script, -1) {
+			if code, _ := strconv.Atoi(m[2]); GetCSEErrorCode(m[1]) != code {
+				t.Errorf("%s defines %s=%d, which does not match the catalog", asset, m[1], code)
+			}
+		}
+		for _, m := range exitRegexp.FindAllStringSubmatch(script, -1) {
+			// 0 is success, 1 and 2 are generic shell errors
+			if code, _ := strconv.Atoi(m[1]); code > 2 && GetCSEErrorName(code) == "" {
+				t.Errorf("%s exits with %d, which is not in the catalog", asset, code)
+			}
+		}
+	}
+}
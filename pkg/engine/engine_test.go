@@ -5,6 +5,7 @@ package engine
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -603,6 +604,16 @@ func TestGenerateKubeConfig(t *testing.T) {
 	if err != nil {
 		t.Errorf("Failed to call GenerateKubeConfig with simple Kubernetes config from file: %v", testData)
 	}
+
+	containerService.Properties.CertificateProfile.CaCertificateChain = "chain\n"
+	kubeConfig, err = GenerateKubeConfig(containerService.Properties, "westus2")
+	if err != nil {
+		t.Errorf("Failed to call GenerateKubeConfig with a CA certificate chain: %v", err)
+	}
+	bundle := base64.StdEncoding.EncodeToString([]byte(containerService.Properties.CertificateProfile.GetCaCertificateBundle()))
+	if !strings.Contains(kubeConfig, bundle) {
+		t.Errorf("expected the kubeconfig certificate-authority-data to hold the CA certificate chain")
+	}
 }
 
 func TestMakeMasterExtensionScriptCommands(t *testing.T) {
@@ -79,12 +79,19 @@ func (w *ArtifactWriter) WriteTLSArtifacts(containerService *api.ContainerServic
 		}
 	}
 
-	if e := f.SaveFileString(artifactsDir, "ca.key", properties.CertificateProfile.CaPrivateKey); e != nil {
-		return e
+	if properties.CertificateProfile.CaKeyvaultSecretRef == nil {
+		if e := f.SaveFileString(artifactsDir, "ca.key", properties.CertificateProfile.CaPrivateKey); e != nil {
+			return e
+		}
 	}
 	if e := f.SaveFileString(artifactsDir, "ca.crt", properties.CertificateProfile.CaCertificate); e != nil {
 		return e
 	}
+	if properties.CertificateProfile.CaCertificateChain != "" {
+		if e := f.SaveFileString(artifactsDir, "ca-chain.crt", properties.CertificateProfile.GetCaCertificateBundle()); e != nil {
+			return e
+		}
+	}
 	if e := f.SaveFileString(artifactsDir, "apiserver.key", properties.CertificateProfile.APIServerPrivateKey); e != nil {
 		return e
 	}
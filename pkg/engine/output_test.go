@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"strings"
 	"testing"
 
 	"github.com/Azure/go-autorest/autorest/azure"
@@ -141,4 +142,22 @@ func TestWriteTLSArtifacts(t *testing.T) {
 			t.Fatalf("expected kubeconfig for region %s to be generated by WriteTLSArtifacts", region)
 		}
 	}
+	os.RemoveAll(defaultDir)
+
+	// The private key of a CA stored in keyvault is not written
+	cs.Properties.CertificateProfile.CaKeyvaultSecretRef = &api.KeyvaultSecretRef{VaultID: "vaultID", SecretName: "ca"}
+	err = writer.WriteTLSArtifacts(cs, "vlabs", "fake template", "fake parameters", dir, true, false)
+	if err != nil {
+		t.Fatalf("unexpected error trying to write TLS artifacts: %s", err.Error())
+	}
+	if _, err = os.Stat(dir + "/ca.key"); !os.IsNotExist(err) {
+		t.Fatalf("expected file %s/ca.key not to be generated by WriteTLSArtifacts for a keyvault CA", dir)
+	}
+	b, err := os.ReadFile(dir + "/apimodel.json")
+	if err != nil {
+		t.Fatalf("unexpected error reading apimodel.json: %s", err.Error())
+	}
+	if strings.Contains(string(b), "caPrivateKey") {
+		t.Fatalf("expected apimodel.json not to hold the private key of a keyvault CA")
+	}
 }
@@ -0,0 +1,215 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package transform
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ChangeType describes how a template item differs from its previously deployed counterpart
+type ChangeType string
+
+const (
+	// ChangeTypeCreate means the item is not part of the deployed template
+	ChangeTypeCreate ChangeType = "Create"
+	// ChangeTypeModify means the item is part of the deployed template but its definition changed
+	ChangeTypeModify ChangeType = "Modify"
+)
+
+const (
+	parametersFieldName = "parameters"
+	valueFieldName      = "value"
+	maskedValue         = "<redacted>"
+)
+
+// ResourceChange describes an ARM resource that would be created or modified by a template deployment
+type ResourceChange struct {
+	Type   string     `json:"type"`
+	Name   string     `json:"name"`
+	Change ChangeType `json:"change"`
+	Paths  []string   `json:"paths,omitempty"`
+}
+
+// ParameterChange describes an ARM parameter whose value differs from the deployed value
+type ParameterChange struct {
+	Name     string      `json:"name"`
+	Change   ChangeType  `json:"change"`
+	Deployed interface{} `json:"deployed,omitempty"`
+	Target   interface{} `json:"target,omitempty"`
+}
+
+// DiffTemplateResources compares the resources of the target template with the resources of the deployed template.
+//
+// Since AKS Engine deploys templates in incremental mode, resources that are only present in the deployed template
+// (usually because a normalization step removed them from the target template) are left untouched by ARM and are not reported.
+func DiffTemplateResources(deployed, target map[string]interface{}) []ResourceChange {
+	deployedResources := make(map[string]map[string]interface{})
+	for _, r := range templateResources(deployed) {
+		deployedResources[resourceKey(r)] = r
+	}
+	changes := make([]ResourceChange, 0)
+	for _, r := range templateResources(target) {
+		rType, _ := r[typeFieldName].(string)
+		rName, _ := r[nameFieldName].(string)
+		d, ok := deployedResources[resourceKey(r)]
+		if !ok {
+			changes = append(changes, ResourceChange{Type: rType, Name: rName, Change: ChangeTypeCreate})
+			continue
+		}
+		if paths := diffPaths("", d, r); len(paths) > 0 {
+			changes = append(changes, ResourceChange{Type: rType, Name: rName, Change: ChangeTypeModify, Paths: paths})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Type != changes[j].Type {
+			return changes[i].Type < changes[j].Type
+		}
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+// DiffTemplateParameters compares the target parameter values with the deployed parameter values.
+//
+// Both parameter maps can either be the raw output of the template generator or the content of an azuredeploy.parameters.json file.
+// Values of parameters declared as secure in the target template are redacted.
+func DiffTemplateParameters(deployed, target, targetTemplate map[string]interface{}) []ParameterChange {
+	deployedValues := parameterValues(deployed)
+	targetValues := parameterValues(target)
+	secure := secureParameters(targetTemplate)
+
+	changes := make([]ParameterChange, 0)
+	for name, tv := range targetValues {
+		dv, ok := deployedValues[name]
+		if ok && reflect.DeepEqual(dv, tv) {
+			continue
+		}
+		change := ParameterChange{Name: name, Change: ChangeTypeModify, Deployed: dv, Target: tv}
+		if !ok {
+			change.Change = ChangeTypeCreate
+			change.Deployed = nil
+		}
+		if secure[name] {
+			if change.Deployed != nil {
+				change.Deployed = maskedValue
+			}
+			change.Target = maskedValue
+		}
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+func templateResources(template map[string]interface{}) []map[string]interface{} {
+	resources := make([]map[string]interface{}, 0)
+	if template == nil {
+		return resources
+	}
+	items, ok := template[resourcesFieldName].([]interface{})
+	if !ok {
+		return resources
+	}
+	for _, item := range items {
+		if r, ok := item.(map[string]interface{}); ok {
+			resources = append(resources, r)
+		}
+	}
+	return resources
+}
+
+func resourceKey(r map[string]interface{}) string {
+	return fmt.Sprintf("%v/%v", r[typeFieldName], r[nameFieldName])
+}
+
+func parameterValues(parameters map[string]interface{}) map[string]interface{} {
+	values := make(map[string]interface{})
+	if parameters == nil {
+		return values
+	}
+	if inner, ok := parameters[parametersFieldName].(map[string]interface{}); ok {
+		parameters = inner
+	}
+	for name, p := range parameters {
+		if pm, ok := p.(map[string]interface{}); ok {
+			values[name] = pm[valueFieldName]
+		}
+	}
+	return values
+}
+
+func secureParameters(template map[string]interface{}) map[string]bool {
+	secure := make(map[string]bool)
+	if template == nil {
+		return secure
+	}
+	parameters, ok := template[parametersFieldName].(map[string]interface{})
+	if !ok {
+		return secure
+	}
+	for name, p := range parameters {
+		if pm, ok := p.(map[string]interface{}); ok {
+			if pType, ok := pm[typeFieldName].(string); ok && strings.HasPrefix(strings.ToLower(pType), "secure") {
+				secure[name] = true
+			}
+		}
+	}
+	return secure
+}
+
+// diffPaths returns the JSON paths where the two values differ
+func diffPaths(prefix string, a, b interface{}) []string {
+	if reflect.DeepEqual(a, b) {
+		return nil
+	}
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make(map[string]bool)
+		for k := range av {
+			keys[k] = true
+		}
+		for k := range bv {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		paths := make([]string, 0)
+		for _, k := range sorted {
+			paths = append(paths, diffPaths(join(k), av[k], bv[k])...)
+		}
+		return paths
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			break
+		}
+		paths := make([]string, 0)
+		for i := range av {
+			paths = append(paths, diffPaths(fmt.Sprintf("%s[%d]", prefix, i), av[i], bv[i])...)
+		}
+		return paths
+	}
+	if prefix == "" {
+		return []string{"."}
+	}
+	return []string{prefix}
+}
@@ -0,0 +1,95 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package transform
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+)
+
+func TestDiffTemplateResources(t *testing.T) {
+	RegisterTestingT(t)
+	logger := logrus.New().WithField("testName", "TestDiffTemplateResources")
+
+	deployed := loadTemplateMap(t, "./transformtestfiles/k8s_template.json")
+	Expect(DiffTemplateResources(deployed, loadTemplateMap(t, "./transformtestfiles/k8s_template.json"))).To(BeEmpty())
+
+	target := loadTemplateMap(t, "./transformtestfiles/k8s_template.json")
+	transformer := Transformer{}
+	Expect(transformer.NormalizeForK8sVMASScalingUp(logger, target)).To(Succeed())
+	for _, r := range tMap(target).Resources(logger) {
+		if r.Type() == vmResourceType {
+			r.Properties()[hardwareProfileFieldName] = map[string]interface{}{vmSizeFieldName: "Standard_D4s_v3"}
+		}
+	}
+	target[resourcesFieldName] = append(target[resourcesFieldName].([]interface{}), map[string]interface{}{
+		typeFieldName: nicResourceType,
+		nameFieldName: "new-nic",
+	})
+
+	changes := DiffTemplateResources(deployed, target)
+	Expect(changes).NotTo(BeEmpty())
+	var created, resized bool
+	for _, c := range changes {
+		if c.Type == nicResourceType && c.Name == "new-nic" {
+			Expect(c.Change).To(Equal(ChangeTypeCreate))
+			created = true
+		}
+		if c.Type == vmResourceType {
+			Expect(c.Change).To(Equal(ChangeTypeModify))
+			Expect(c.Paths).To(ContainElement("properties.hardwareProfile.vmSize"))
+			resized = true
+		}
+	}
+	Expect(created).To(BeTrue())
+	Expect(resized).To(BeTrue())
+}
+
+func TestDiffTemplateParameters(t *testing.T) {
+	RegisterTestingT(t)
+
+	template := map[string]interface{}{
+		"parameters": map[string]interface{}{
+			"agentpool1Count":     map[string]interface{}{"type": "int"},
+			"apiServerPrivateKey": map[string]interface{}{"type": "securestring"},
+			"kubernetesVersion":   map[string]interface{}{"type": "string"},
+			"newParameter":        map[string]interface{}{"type": "string"},
+		},
+	}
+	deployed := map[string]interface{}{
+		"$schema":        "http://schema.management.azure.com/schemas/2015-01-01/deploymentParameters.json#",
+		"contentVersion": "1.0.0.0",
+		"parameters": map[string]interface{}{
+			"agentpool1Count":     map[string]interface{}{"value": float64(3)},
+			"apiServerPrivateKey": map[string]interface{}{"value": "old-key"},
+			"kubernetesVersion":   map[string]interface{}{"value": "1.23.13"},
+		},
+	}
+	target := map[string]interface{}{
+		"agentpool1Count":     map[string]interface{}{"value": float64(3)},
+		"apiServerPrivateKey": map[string]interface{}{"value": "new-key"},
+		"kubernetesVersion":   map[string]interface{}{"value": "1.24.7"},
+		"newParameter":        map[string]interface{}{"value": "foo"},
+	}
+
+	changes := DiffTemplateParameters(deployed, target, template)
+	Expect(changes).To(Equal([]ParameterChange{
+		{Name: "apiServerPrivateKey", Change: ChangeTypeModify, Deployed: maskedValue, Target: maskedValue},
+		{Name: "kubernetesVersion", Change: ChangeTypeModify, Deployed: "1.23.13", Target: "1.24.7"},
+		{Name: "newParameter", Change: ChangeTypeCreate, Target: "foo"},
+	}))
+}
+
+func loadTemplateMap(t *testing.T, path string) map[string]interface{} {
+	t.Helper()
+	contents, err := os.ReadFile(path)
+	Expect(err).NotTo(HaveOccurred())
+	var template map[string]interface{}
+	Expect(json.Unmarshal(contents, &template)).To(Succeed())
+	return template
+}
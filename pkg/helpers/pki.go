@@ -5,6 +5,9 @@ package helpers
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -14,6 +17,7 @@ import (
 	"fmt"
 	"math/big"
 	"net"
+	"strings"
 	"time"
 
 	"golang.org/x/sync/errgroup"
@@ -24,6 +28,11 @@ import (
 const (
 	// ValidityDuration specifies the duration an TLS certificate is valid
 	ValidityDuration = time.Hour * 24 * 365 * 30
+
+	// PkiKeyAlgorithmRSA generates RSA keys of the requested size, the default
+	PkiKeyAlgorithmRSA = "RSA"
+	// PkiKeyAlgorithmECDSA generates ECDSA P-256 keys, the requested key size is ignored
+	PkiKeyAlgorithmECDSA = "ECDSA"
 )
 
 // PkiParams is used when we create Pki
@@ -34,12 +43,22 @@ type PkiParams struct {
 	CaPair        *PkiKeyCertPair
 	MasterCount   int
 	PkiKeySize    int
+	// KeyAlgorithm is either PkiKeyAlgorithmRSA (if empty) or PkiKeyAlgorithmECDSA
+	KeyAlgorithm string
+	// ServerValidity is the validity of the apiserver, etcd server and etcd peer certificates, ValidityDuration if zero
+	ServerValidity time.Duration
+	// ClientValidity is the validity of the client, kubeconfig and etcd client certificates, ValidityDuration if zero
+	ClientValidity time.Duration
 }
 
 // PkiKeyCertPairParams is the params when we create the pki key cert pair.
 type PkiKeyCertPairParams struct {
 	CommonName string
 	PkiKeySize int
+	// KeyAlgorithm is either PkiKeyAlgorithmRSA (if empty) or PkiKeyAlgorithmECDSA
+	KeyAlgorithm string
+	// Validity of the certificate, ValidityDuration if zero
+	Validity time.Duration
 }
 
 // PkiKeyCertPair represents an PKI public and private cert pair
@@ -60,6 +79,8 @@ func CreatePkiKeyCertPair(params PkiKeyCertPairParams) (*PkiKeyCertPair, error)
 		extraIPs:      nil,
 		organization:  nil,
 		keySize:       params.PkiKeySize,
+		keyAlgorithm:  params.KeyAlgorithm,
+		validity:      params.Validity,
 	}
 	caCertificate, caPrivateKey, err := createCertificate(certPram)
 	if err != nil {
@@ -75,144 +96,46 @@ func CreatePki(pkiParams PkiParams) (*PkiKeyCertPair, *PkiKeyCertPair, *PkiKeyCe
 	defer func(s time.Time) {
 		log.Debugf("pki: PKI asset creation took %s", time.Since(s))
 	}(start)
-	pkiParams.ExtraFQDNs = append(pkiParams.ExtraFQDNs, "kubernetes")
-	pkiParams.ExtraFQDNs = append(pkiParams.ExtraFQDNs, "kubernetes.default")
-	pkiParams.ExtraFQDNs = append(pkiParams.ExtraFQDNs, "kubernetes.default.svc")
-	pkiParams.ExtraFQDNs = append(pkiParams.ExtraFQDNs, fmt.Sprintf("kubernetes.default.svc.%s", pkiParams.ClusterDomain))
-	pkiParams.ExtraFQDNs = append(pkiParams.ExtraFQDNs, "kubernetes.kube-system")
-	pkiParams.ExtraFQDNs = append(pkiParams.ExtraFQDNs, "kubernetes.kube-system.svc")
-	pkiParams.ExtraFQDNs = append(pkiParams.ExtraFQDNs, fmt.Sprintf("kubernetes.kube-system.svc.%s", pkiParams.ClusterDomain))
 
 	var (
-		caCertificate         *x509.Certificate
-		caPrivateKey          *rsa.PrivateKey
-		apiServerCertificate  *x509.Certificate
-		apiServerPrivateKey   *rsa.PrivateKey
-		clientCertificate     *x509.Certificate
-		clientPrivateKey      *rsa.PrivateKey
-		kubeConfigCertificate *x509.Certificate
-		kubeConfigPrivateKey  *rsa.PrivateKey
-		etcdServerCertificate *x509.Certificate
-		etcdServerPrivateKey  *rsa.PrivateKey
-		etcdClientCertificate *x509.Certificate
-		etcdClientPrivateKey  *rsa.PrivateKey
-		etcdPeerCertPairs     []*PkiKeyCertPair
+		apiServerPair     *PkiKeyCertPair
+		clientPair        *PkiKeyCertPair
+		kubeConfigPair    *PkiKeyCertPair
+		etcdServerPair    *PkiKeyCertPair
+		etcdClientPair    *PkiKeyCertPair
+		etcdPeerCertPairs []*PkiKeyCertPair
 	)
 	var group errgroup.Group
 
-	var err error
-	caCertificate, err = pemToCertificate(pkiParams.CaPair.CertificatePem)
-	if err != nil {
-		return nil, nil, nil, nil, nil, nil, err
-	}
-	caPrivateKey, err = pemToKey(pkiParams.CaPair.PrivateKeyPem)
-	if err != nil {
+	if _, _, err := parseCaPair(pkiParams.CaPair); err != nil {
 		return nil, nil, nil, nil, nil, nil, err
 	}
 
 	group.Go(func() (err error) {
-		certPram := certParams{
-			commonName:    "apiserver",
-			caCertificate: caCertificate,
-			caPrivateKey:  caPrivateKey,
-			isEtcd:        false,
-			isServer:      true,
-			extraFQDNs:    pkiParams.ExtraFQDNs,
-			extraIPs:      pkiParams.ExtraIPs,
-			organization:  nil,
-			keySize:       pkiParams.PkiKeySize,
-		}
-		apiServerCertificate, apiServerPrivateKey, err = createCertificate(certPram)
+		apiServerPair, err = CreateAPIServerPki(pkiParams)
 		return err
 	})
-
 	group.Go(func() (err error) {
-		organization := make([]string, 1)
-		organization[0] = "system:masters"
-		certPram := certParams{
-			commonName:    "client",
-			caCertificate: caCertificate,
-			caPrivateKey:  caPrivateKey,
-			isEtcd:        false,
-			isServer:      false,
-			extraFQDNs:    nil,
-			extraIPs:      nil,
-			organization:  organization,
-			keySize:       pkiParams.PkiKeySize,
-		}
-		clientCertificate, clientPrivateKey, err = createCertificate(certPram)
+		clientPair, err = CreateClientPki(pkiParams)
 		return err
 	})
-
 	group.Go(func() (err error) {
-		organization := make([]string, 1)
-		organization[0] = "system:masters"
-
-		certPram := certParams{
-			commonName:    "client",
-			caCertificate: caCertificate,
-			caPrivateKey:  caPrivateKey,
-			isEtcd:        false,
-			isServer:      false,
-			extraFQDNs:    nil,
-			extraIPs:      nil,
-			organization:  organization,
-			keySize:       pkiParams.PkiKeySize,
-		}
-
-		kubeConfigCertificate, kubeConfigPrivateKey, err = createCertificate(certPram)
+		kubeConfigPair, err = CreateKubeConfigPki(pkiParams)
 		return err
 	})
-
 	group.Go(func() (err error) {
-		certPram := certParams{
-			commonName:    "etcdserver",
-			caCertificate: caCertificate,
-			caPrivateKey:  caPrivateKey,
-			isEtcd:        true,
-			isServer:      true,
-			extraFQDNs:    nil,
-			extraIPs:      pkiParams.ExtraIPs,
-			organization:  nil,
-			keySize:       pkiParams.PkiKeySize,
-		}
-		etcdServerCertificate, etcdServerPrivateKey, err = createCertificate(certPram)
+		etcdServerPair, err = CreateEtcdServerPki(pkiParams)
 		return err
 	})
-
 	group.Go(func() (err error) {
-		certPram := certParams{
-			commonName:    "etcdclient",
-			caCertificate: caCertificate,
-			caPrivateKey:  caPrivateKey,
-			isEtcd:        true,
-			isServer:      false,
-			extraFQDNs:    nil,
-			extraIPs:      pkiParams.ExtraIPs,
-			organization:  nil,
-			keySize:       pkiParams.PkiKeySize,
-		}
-		etcdClientCertificate, etcdClientPrivateKey, err = createCertificate(certPram)
+		etcdClientPair, err = CreateEtcdClientPki(pkiParams)
 		return err
 	})
-
 	etcdPeerCertPairs = make([]*PkiKeyCertPair, pkiParams.MasterCount)
 	for i := 0; i < pkiParams.MasterCount; i++ {
 		i := i
 		group.Go(func() (err error) {
-			certPram := certParams{
-				commonName:    "etcdpeer",
-				caCertificate: caCertificate,
-				caPrivateKey:  caPrivateKey,
-				isEtcd:        true,
-				isServer:      false,
-				extraFQDNs:    nil,
-				extraIPs:      pkiParams.ExtraIPs,
-				organization:  nil,
-				keySize:       pkiParams.PkiKeySize,
-			}
-			etcdPeerCertificate, etcdPeerPrivateKey, err := createCertificate(certPram)
-			etcdPeerCertPairs[i] = &PkiKeyCertPair{CertificatePem: string(certificateToPem(etcdPeerCertificate.Raw)), PrivateKeyPem: string(privateKeyToPem(etcdPeerPrivateKey))}
+			etcdPeerCertPairs[i], err = createEtcdPeerPki(pkiParams)
 			return err
 		})
 	}
@@ -220,43 +143,250 @@ func CreatePki(pkiParams PkiParams) (*PkiKeyCertPair, *PkiKeyCertPair, *PkiKeyCe
 	if err := group.Wait(); err != nil {
 		return nil, nil, nil, nil, nil, nil, err
 	}
+	return apiServerPair, clientPair, kubeConfigPair, etcdServerPair, etcdClientPair, etcdPeerCertPairs, nil
+}
 
-	return &PkiKeyCertPair{CertificatePem: string(certificateToPem(apiServerCertificate.Raw)), PrivateKeyPem: string(privateKeyToPem(apiServerPrivateKey))},
-		&PkiKeyCertPair{CertificatePem: string(certificateToPem(clientCertificate.Raw)), PrivateKeyPem: string(privateKeyToPem(clientPrivateKey))},
-		&PkiKeyCertPair{CertificatePem: string(certificateToPem(kubeConfigCertificate.Raw)), PrivateKeyPem: string(privateKeyToPem(kubeConfigPrivateKey))},
-		&PkiKeyCertPair{CertificatePem: string(certificateToPem(etcdServerCertificate.Raw)), PrivateKeyPem: string(privateKeyToPem(etcdServerPrivateKey))},
-		&PkiKeyCertPair{CertificatePem: string(certificateToPem(etcdClientCertificate.Raw)), PrivateKeyPem: string(privateKeyToPem(etcdClientPrivateKey))},
-		etcdPeerCertPairs,
-		nil
+// CreateAPIServerPki creates the API server certificate signed by the certificate authority in pkiParams
+func CreateAPIServerPki(pkiParams PkiParams) (*PkiKeyCertPair, error) {
+	return createLeafPki(pkiParams, certParams{
+		commonName: "apiserver",
+		isServer:   true,
+		extraFQDNs: apiServerFQDNs(pkiParams),
+		extraIPs:   pkiParams.ExtraIPs,
+		validity:   pkiParams.ServerValidity,
+	})
+}
+
+// CreateClientPki creates the client certificate used by the kubelet and the control plane components
+func CreateClientPki(pkiParams PkiParams) (*PkiKeyCertPair, error) {
+	return createLeafPki(pkiParams, certParams{
+		commonName:   "client",
+		organization: []string{"system:masters"},
+		validity:     pkiParams.ClientValidity,
+	})
+}
+
+// CreateKubeConfigPki creates the client certificate of the admin kubeconfig
+func CreateKubeConfigPki(pkiParams PkiParams) (*PkiKeyCertPair, error) {
+	return createLeafPki(pkiParams, certParams{
+		commonName:   "client",
+		organization: []string{"system:masters"},
+		validity:     pkiParams.ClientValidity,
+	})
+}
+
+// CreateEtcdServerPki creates the etcd server certificate
+func CreateEtcdServerPki(pkiParams PkiParams) (*PkiKeyCertPair, error) {
+	return createLeafPki(pkiParams, certParams{
+		commonName: "etcdserver",
+		isEtcd:     true,
+		isServer:   true,
+		extraIPs:   pkiParams.ExtraIPs,
+		validity:   pkiParams.ServerValidity,
+	})
+}
+
+// CreateEtcdClientPki creates the etcd client certificate
+func CreateEtcdClientPki(pkiParams PkiParams) (*PkiKeyCertPair, error) {
+	return createLeafPki(pkiParams, certParams{
+		commonName: "etcdclient",
+		isEtcd:     true,
+		extraIPs:   pkiParams.ExtraIPs,
+		validity:   pkiParams.ClientValidity,
+	})
+}
+
+// CreateEtcdPeerPki creates one etcd peer certificate per control plane node
+func CreateEtcdPeerPki(pkiParams PkiParams) ([]*PkiKeyCertPair, error) {
+	pairs := make([]*PkiKeyCertPair, pkiParams.MasterCount)
+	for i := 0; i < pkiParams.MasterCount; i++ {
+		pair, err := createEtcdPeerPki(pkiParams)
+		if err != nil {
+			return nil, err
+		}
+		pairs[i] = pair
+	}
+	return pairs, nil
+}
+
+func createEtcdPeerPki(pkiParams PkiParams) (*PkiKeyCertPair, error) {
+	return createLeafPki(pkiParams, certParams{
+		commonName: "etcdpeer",
+		isEtcd:     true,
+		extraIPs:   pkiParams.ExtraIPs,
+		validity:   pkiParams.ServerValidity,
+	})
+}
+
+// GetCertificateNotAfter returns the expiration date of a PEM encoded certificate
+func GetCertificateNotAfter(certificatePem string) (time.Time, error) {
+	certificate, err := ParseCertificate(certificatePem)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return certificate.NotAfter, nil
+}
+
+// ParseCertificate parses the first certificate of a PEM encoded block
+func ParseCertificate(certificatePem string) (*x509.Certificate, error) {
+	return pemToCertificate(certificatePem)
+}
+
+func createLeafPki(pkiParams PkiParams, options certParams) (*PkiKeyCertPair, error) {
+	var err error
+	if options.caCertificate, options.caPrivateKey, err = parseCaPair(pkiParams.CaPair); err != nil {
+		return nil, err
+	}
+	options.keySize = pkiParams.PkiKeySize
+	options.keyAlgorithm = pkiParams.KeyAlgorithm
+	certificate, privateKey, err := createCertificate(options)
+	if err != nil {
+		return nil, err
+	}
+	return &PkiKeyCertPair{CertificatePem: string(certificateToPem(certificate.Raw)), PrivateKeyPem: string(privateKeyToPem(privateKey))}, nil
+}
+
+func parseCaPair(caPair *PkiKeyCertPair) (*x509.Certificate, crypto.Signer, error) {
+	if caPair == nil {
+		return nil, nil, errors.New("a certificate authority is required to issue a certificate")
+	}
+	caCertificate, err := pemToCertificate(caPair.CertificatePem)
+	if err != nil {
+		return nil, nil, err
+	}
+	caPrivateKey, err := pemToKey(caPair.PrivateKeyPem)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !caCertificate.IsCA || caCertificate.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return nil, nil, fmt.Errorf("certificate %s is not a certificate authority", caCertificate.Subject.CommonName)
+	}
+	if publicKey, ok := caPrivateKey.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !publicKey.Equal(caCertificate.PublicKey) {
+		return nil, nil, fmt.Errorf("the private key does not match certificate authority %s", caCertificate.Subject.CommonName)
+	}
+	return caCertificate, caPrivateKey, nil
+}
+
+// SplitCaBundle splits a PEM bundle holding the private key and certificate of a certificate authority,
+// followed by the certificates of the authorities that issued it, as exported by Key Vault
+func SplitCaBundle(bundle string) (*PkiKeyCertPair, string, error) {
+	var key, ca, chain []byte
+	rest := []byte(bundle)
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		switch {
+		case block.Type == "CERTIFICATE" && ca == nil:
+			ca = pem.EncodeToMemory(block)
+		case block.Type == "CERTIFICATE":
+			chain = append(chain, pem.EncodeToMemory(block)...)
+		case strings.HasSuffix(block.Type, "PRIVATE KEY") && key == nil:
+			key = pem.EncodeToMemory(block)
+		}
+	}
+	if ca == nil || key == nil {
+		return nil, "", errors.New("the bundle must hold a PEM encoded certificate and private key")
+	}
+	pair := &PkiKeyCertPair{CertificatePem: string(ca), PrivateKeyPem: string(key)}
+	if _, _, err := parseCaPair(pair); err != nil {
+		return nil, "", err
+	}
+	return pair, string(chain), nil
+}
+
+// VerifyCaChain verifies that a certificate authority was issued by the PEM encoded chain.
+// The self-signed certificates of the chain are the trusted roots, or every certificate if there is none
+func VerifyCaChain(caCertificatePem, chainPem string) error {
+	caCertificate, err := pemToCertificate(caCertificatePem)
+	if err != nil {
+		return err
+	}
+	roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+	hasRoot := false
+	rest := []byte(chainPem)
+	var chain []*x509.Certificate
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return err
+		}
+		chain = append(chain, certificate)
+		if bytes.Equal(certificate.RawSubject, certificate.RawIssuer) {
+			roots.AddCert(certificate)
+			hasRoot = true
+		} else {
+			intermediates.AddCert(certificate)
+		}
+	}
+	if len(chain) == 0 {
+		return errors.New("the certificate chain is empty")
+	}
+	if !hasRoot {
+		for _, certificate := range chain {
+			roots.AddCert(certificate)
+		}
+	}
+	_, err = caCertificate.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+	return err
+}
+
+// apiServerFQDNs returns the extra FQDNs plus the in-cluster names of the kubernetes service
+func apiServerFQDNs(pkiParams PkiParams) []string {
+	fqdns := append([]string{}, pkiParams.ExtraFQDNs...)
+	fqdns = append(fqdns, "kubernetes")
+	fqdns = append(fqdns, "kubernetes.default")
+	fqdns = append(fqdns, "kubernetes.default.svc")
+	fqdns = append(fqdns, fmt.Sprintf("kubernetes.default.svc.%s", pkiParams.ClusterDomain))
+	fqdns = append(fqdns, "kubernetes.kube-system")
+	fqdns = append(fqdns, "kubernetes.kube-system.svc")
+	fqdns = append(fqdns, fmt.Sprintf("kubernetes.kube-system.svc.%s", pkiParams.ClusterDomain))
+	return fqdns
 }
 
 type certParams struct {
 	commonName    string
 	caCertificate *x509.Certificate
-	caPrivateKey  *rsa.PrivateKey
+	caPrivateKey  crypto.Signer
 	isEtcd        bool
 	isServer      bool
 	extraFQDNs    []string
 	extraIPs      []net.IP
 	organization  []string
 	keySize       int
+	keyAlgorithm  string
+	validity      time.Duration
 }
 
-func createCertificate(options certParams) (*x509.Certificate, *rsa.PrivateKey, error) {
+func createCertificate(options certParams) (*x509.Certificate, crypto.Signer, error) {
 	var err error
 
 	isCA := (options.caCertificate == nil)
 
 	now := time.Now()
 
+	validity := options.validity
+	if validity == 0 {
+		validity = ValidityDuration
+	}
+
 	template := x509.Certificate{
 		Subject:   pkix.Name{CommonName: options.commonName},
 		NotBefore: now,
-		NotAfter:  now.Add(ValidityDuration),
+		NotAfter:  now.Add(validity),
 
-		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
 		BasicConstraintsValid: true,
 	}
+	// key encipherment only applies to RSA keys
+	if options.keyAlgorithm != PkiKeyAlgorithmECDSA {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
 
 	if options.organization != nil {
 		template.Subject.Organization = options.organization
@@ -291,9 +421,12 @@ func createCertificate(options certParams) (*x509.Certificate, *rsa.PrivateKey,
 		return nil, nil, err
 	}
 
-	privateKey, _ := rsa.GenerateKey(rand.Reader, options.keySize)
+	privateKey, err := generatePrivateKey(options.keyAlgorithm, options.keySize)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	var privateKeyToUse *rsa.PrivateKey
+	var privateKeyToUse crypto.Signer
 	var certificateToUse *x509.Certificate
 	if !isCA {
 		privateKeyToUse = options.caPrivateKey
@@ -303,7 +436,7 @@ func createCertificate(options certParams) (*x509.Certificate, *rsa.PrivateKey,
 		certificateToUse = &template
 	}
 
-	certDerBytes, err := x509.CreateCertificate(rand.Reader, &template, certificateToUse, &privateKey.PublicKey, privateKeyToUse)
+	certDerBytes, err := x509.CreateCertificate(rand.Reader, &template, certificateToUse, privateKey.Public(), privateKeyToUse)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -316,6 +449,17 @@ func createCertificate(options certParams) (*x509.Certificate, *rsa.PrivateKey,
 	return certificate, privateKey, nil
 }
 
+func generatePrivateKey(keyAlgorithm string, keySize int) (crypto.Signer, error) {
+	switch keyAlgorithm {
+	case PkiKeyAlgorithmECDSA:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "", PkiKeyAlgorithmRSA:
+		return rsa.GenerateKey(rand.Reader, keySize)
+	default:
+		return nil, fmt.Errorf("unsupported key algorithm %s", keyAlgorithm)
+	}
+}
+
 func certificateToPem(derBytes []byte) []byte {
 	pemBlock := &pem.Block{
 		Type:  "CERTIFICATE",
@@ -327,10 +471,19 @@ func certificateToPem(derBytes []byte) []byte {
 	return pemBuffer.Bytes()
 }
 
-func privateKeyToPem(privateKey *rsa.PrivateKey) []byte {
-	pemBlock := &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+func privateKeyToPem(privateKey crypto.Signer) []byte {
+	var pemBlock *pem.Block
+	switch k := privateKey.(type) {
+	case *ecdsa.PrivateKey:
+		b, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return nil
+		}
+		pemBlock = &pem.Block{Type: "EC PRIVATE KEY", Bytes: b}
+	case *rsa.PrivateKey:
+		pemBlock = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}
+	default:
+		return nil
 	}
 	pemBuffer := bytes.Buffer{}
 	_ = pem.Encode(&pemBuffer, pemBlock)
@@ -346,10 +499,25 @@ func pemToCertificate(raw string) (*x509.Certificate, error) {
 	return x509.ParseCertificate(cpb.Bytes)
 }
 
-func pemToKey(raw string) (*rsa.PrivateKey, error) {
+func pemToKey(raw string) (crypto.Signer, error) {
 	kpb, _ := pem.Decode([]byte(raw))
 	if kpb == nil {
 		return nil, errors.New("The raw pem is not a valid PEM formatted block")
 	}
-	return x509.ParsePKCS1PrivateKey(kpb.Bytes)
+	switch kpb.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(kpb.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(kpb.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("The PKCS #8 private key is not supported")
+		}
+		return signer, nil
+	default:
+		return x509.ParsePKCS1PrivateKey(kpb.Bytes)
+	}
 }
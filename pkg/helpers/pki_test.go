@@ -4,11 +4,16 @@
 package helpers
 
 import (
-	"crypto/rsa"
+	"crypto"
+	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/pem"
+	"math/big"
 	"net"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCreateCertificateWithOrganisation(t *testing.T) {
@@ -17,7 +22,7 @@ func TestCreateCertificateWithOrganisation(t *testing.T) {
 
 	var (
 		caCertificate   *x509.Certificate
-		caPrivateKey    *rsa.PrivateKey
+		caPrivateKey    crypto.Signer
 		testCertificate *x509.Certificate
 	)
 	certParam := certParams{
@@ -77,7 +82,7 @@ func TestCreateCertificateWithoutOrganisation(t *testing.T) {
 
 	var (
 		caCertificate   *x509.Certificate
-		caPrivateKey    *rsa.PrivateKey
+		caPrivateKey    crypto.Signer
 		testCertificate *x509.Certificate
 	)
 	certParam := certParams{
@@ -309,3 +314,255 @@ func TestCreatePkiKeyCertPair(t *testing.T) {
 		t.Errorf("unexpected error thrown while executing CreatePkiKeyCertPair : %s", err.Error())
 	}
 }
+
+func TestCreateLeafPki(t *testing.T) {
+	caPair, err := CreatePkiKeyCertPair(PkiKeyCertPairParams{CommonName: "ca", PkiKeySize: DefaultPkiKeySize})
+	if err != nil {
+		t.Fatalf("failed to generate certificate authority: %s", err)
+	}
+	caCertificate, err := pemToCertificate(caPair.CertificatePem)
+	if err != nil {
+		t.Fatalf("failed to parse certificate authority: %s", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(caCertificate)
+
+	pkiParams := PkiParams{
+		CaPair:        caPair,
+		ClusterDomain: "cluster.local",
+		ExtraFQDNs:    []string{"santest.mydomain.com"},
+		ExtraIPs:      []net.IP{net.ParseIP("10.239.255.239").To4()},
+		MasterCount:   3,
+		PkiKeySize:    DefaultPkiKeySize,
+	}
+
+	apiServerPair, err := CreateAPIServerPki(pkiParams)
+	if err != nil {
+		t.Fatalf("failed to generate API server certificate: %s", err)
+	}
+	apiServerCertificate, err := pemToCertificate(apiServerPair.CertificatePem)
+	if err != nil {
+		t.Fatalf("failed to parse API server certificate: %s", err)
+	}
+	for _, name := range []string{"santest.mydomain.com", "kubernetes.default.svc.cluster.local"} {
+		if _, err = apiServerCertificate.Verify(x509.VerifyOptions{DNSName: name, Roots: roots}); err != nil {
+			t.Fatalf("failed to verify API server certificate for %s: %s", name, err)
+		}
+	}
+	if len(pkiParams.ExtraFQDNs) != 1 {
+		t.Fatalf("expected pkiParams.ExtraFQDNs to remain unchanged, got %v", pkiParams.ExtraFQDNs)
+	}
+
+	clientPair, err := CreateClientPki(pkiParams)
+	if err != nil {
+		t.Fatalf("failed to generate client certificate: %s", err)
+	}
+	clientCertificate, err := pemToCertificate(clientPair.CertificatePem)
+	if err != nil {
+		t.Fatalf("failed to parse client certificate: %s", err)
+	}
+	if _, err = clientCertificate.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Fatalf("failed to verify client certificate: %s", err)
+	}
+
+	etcdPeerPairs, err := CreateEtcdPeerPki(pkiParams)
+	if err != nil {
+		t.Fatalf("failed to generate etcd peer certificates: %s", err)
+	}
+	if len(etcdPeerPairs) != pkiParams.MasterCount {
+		t.Fatalf("expected %d etcd peer certificates, got %d", pkiParams.MasterCount, len(etcdPeerPairs))
+	}
+
+	notAfter, err := GetCertificateNotAfter(etcdPeerPairs[0].CertificatePem)
+	if err != nil {
+		t.Fatalf("failed to get certificate expiration: %s", err)
+	}
+	if notAfter.Before(time.Now().Add(ValidityDuration - time.Hour)) {
+		t.Fatalf("unexpected certificate expiration %s", notAfter)
+	}
+
+	if _, err = CreateEtcdServerPki(PkiParams{}); err == nil {
+		t.Fatalf("expected an error when the certificate authority is missing")
+	}
+	if _, err = GetCertificateNotAfter("not a certificate"); err == nil {
+		t.Fatalf("expected an error when the certificate is not PEM encoded")
+	}
+}
+
+func TestCreatePkiWithKeyAlgorithmAndValidity(t *testing.T) {
+	caPair, err := CreatePkiKeyCertPair(PkiKeyCertPairParams{
+		CommonName:   "ca",
+		PkiKeySize:   DefaultPkiKeySize,
+		KeyAlgorithm: PkiKeyAlgorithmECDSA,
+		Validity:     10 * 365 * 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("failed to generate certificate authority: %s", err)
+	}
+	if !strings.Contains(caPair.PrivateKeyPem, "EC PRIVATE KEY") {
+		t.Fatalf("expected an EC private key, got %s", caPair.PrivateKeyPem)
+	}
+
+	pkiParams := PkiParams{
+		CaPair:         caPair,
+		ClusterDomain:  "cluster.local",
+		ExtraIPs:       []net.IP{net.ParseIP("10.0.0.1")},
+		MasterCount:    1,
+		PkiKeySize:     DefaultPkiKeySize,
+		KeyAlgorithm:   PkiKeyAlgorithmECDSA,
+		ServerValidity: 365 * 24 * time.Hour,
+		ClientValidity: 90 * 24 * time.Hour,
+	}
+	apiServerPair, clientPair, kubeConfigPair, etcdServerPair, etcdClientPair, etcdPeerPairs, err := CreatePki(pkiParams)
+	if err != nil {
+		t.Fatalf("failed to generate certificates: %s", err)
+	}
+	servers := append([]*PkiKeyCertPair{apiServerPair, etcdServerPair}, etcdPeerPairs...)
+	clients := []*PkiKeyCertPair{clientPair, kubeConfigPair, etcdClientPair}
+	for validity, pairs := range map[time.Duration][]*PkiKeyCertPair{pkiParams.ServerValidity: servers, pkiParams.ClientValidity: clients} {
+		for _, pair := range pairs {
+			certificate, err := pemToCertificate(pair.CertificatePem)
+			if err != nil {
+				t.Fatalf("failed to parse certificate: %s", err)
+			}
+			if certificate.PublicKeyAlgorithm != x509.ECDSA {
+				t.Fatalf("expected an ECDSA public key for %s, got %s", certificate.Subject.CommonName, certificate.PublicKeyAlgorithm)
+			}
+			if certificate.KeyUsage&x509.KeyUsageKeyEncipherment != 0 {
+				t.Fatalf("unexpected key encipherment usage for %s", certificate.Subject.CommonName)
+			}
+			if d := certificate.NotAfter.Sub(certificate.NotBefore); d != validity {
+				t.Fatalf("expected %s to be valid for %s, got %s", certificate.Subject.CommonName, validity, d)
+			}
+			if _, err = pemToKey(pair.PrivateKeyPem); err != nil {
+				t.Fatalf("failed to parse private key of %s: %s", certificate.Subject.CommonName, err)
+			}
+		}
+	}
+
+	if _, err = CreatePkiKeyCertPair(PkiKeyCertPairParams{CommonName: "ca", KeyAlgorithm: "DSA"}); err == nil {
+		t.Fatalf("expected an error for an unsupported key algorithm")
+	}
+}
+
+func TestCreatePkiWithIntermediateCa(t *testing.T) {
+	rootPair, err := CreatePkiKeyCertPair(PkiKeyCertPairParams{CommonName: "root", PkiKeySize: DefaultPkiKeySize})
+	if err != nil {
+		t.Fatalf("failed to generate root certificate authority: %s", err)
+	}
+	intermediatePair := createTestIntermediateCa(t, rootPair, "intermediate")
+
+	bundle := intermediatePair.PrivateKeyPem + intermediatePair.CertificatePem + rootPair.CertificatePem
+	caPair, chain, err := SplitCaBundle(bundle)
+	if err != nil {
+		t.Fatalf("failed to split bundle: %s", err)
+	}
+	if caPair.CertificatePem != intermediatePair.CertificatePem || caPair.PrivateKeyPem != intermediatePair.PrivateKeyPem {
+		t.Fatalf("expected the first certificate of the bundle to be the certificate authority")
+	}
+	if chain != rootPair.CertificatePem {
+		t.Fatalf("expected the chain to be the root certificate, got %s", chain)
+	}
+	if err = VerifyCaChain(caPair.CertificatePem, chain); err != nil {
+		t.Fatalf("failed to verify chain: %s", err)
+	}
+
+	otherRootPair, err := CreatePkiKeyCertPair(PkiKeyCertPairParams{CommonName: "other", PkiKeySize: DefaultPkiKeySize})
+	if err != nil {
+		t.Fatalf("failed to generate root certificate authority: %s", err)
+	}
+	if err = VerifyCaChain(caPair.CertificatePem, otherRootPair.CertificatePem); err == nil {
+		t.Fatalf("expected an error verifying a chain that did not issue the certificate authority")
+	}
+	if err = VerifyCaChain(caPair.CertificatePem, ""); err == nil || err.Error() != "the certificate chain is empty" {
+		t.Fatalf("expected an empty chain error, got %v", err)
+	}
+
+	apiServerPair, _, _, _, _, _, err := CreatePki(PkiParams{
+		CaPair:        caPair,
+		ClusterDomain: "cluster.local",
+		MasterCount:   1,
+		PkiKeySize:    DefaultPkiKeySize,
+	})
+	if err != nil {
+		t.Fatalf("failed to generate certificates: %s", err)
+	}
+	apiServer, err := pemToCertificate(apiServerPair.CertificatePem)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %s", err)
+	}
+	roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+	roots.AppendCertsFromPEM([]byte(rootPair.CertificatePem))
+	intermediates.AppendCertsFromPEM([]byte(caPair.CertificatePem))
+	if _, err = apiServer.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+		t.Fatalf("expected the apiserver certificate to chain to the root, got %s", err)
+	}
+}
+
+func TestSplitCaBundleErrors(t *testing.T) {
+	caPair, err := CreatePkiKeyCertPair(PkiKeyCertPairParams{CommonName: "ca", PkiKeySize: DefaultPkiKeySize})
+	if err != nil {
+		t.Fatalf("failed to generate certificate authority: %s", err)
+	}
+	otherPair, err := CreatePkiKeyCertPair(PkiKeyCertPairParams{CommonName: "other", PkiKeySize: DefaultPkiKeySize})
+	if err != nil {
+		t.Fatalf("failed to generate certificate authority: %s", err)
+	}
+	leafPair, err := CreateClientPki(PkiParams{CaPair: caPair, PkiKeySize: DefaultPkiKeySize})
+	if err != nil {
+		t.Fatalf("failed to generate client certificate: %s", err)
+	}
+
+	cases := []struct {
+		name        string
+		bundle      string
+		expectedErr string
+	}{
+		{
+			name:        "missing private key",
+			bundle:      caPair.CertificatePem,
+			expectedErr: "the bundle must hold a PEM encoded certificate and private key",
+		},
+		{
+			name:        "mismatched private key",
+			bundle:      otherPair.PrivateKeyPem + caPair.CertificatePem,
+			expectedErr: "the private key does not match certificate authority ca",
+		},
+		{
+			name:        "not a certificate authority",
+			bundle:      leafPair.PrivateKeyPem + leafPair.CertificatePem,
+			expectedErr: "certificate client is not a certificate authority",
+		},
+	}
+	for _, c := range cases {
+		if _, _, err := SplitCaBundle(c.bundle); err == nil || err.Error() != c.expectedErr {
+			t.Fatalf("%s: expected error %q, got %v", c.name, c.expectedErr, err)
+		}
+	}
+}
+
+// createTestIntermediateCa returns a certificate authority issued by parent
+func createTestIntermediateCa(t *testing.T, parent *PkiKeyCertPair, commonName string) *PkiKeyCertPair {
+	parentCertificate, parentKey, err := parseCaPair(parent)
+	if err != nil {
+		t.Fatalf("failed to parse parent certificate authority: %s", err)
+	}
+	privateKey, err := generatePrivateKey(PkiKeyAlgorithmECDSA, 0)
+	if err != nil {
+		t.Fatalf("failed to generate private key: %s", err)
+	}
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	derBytes, err := x509.CreateCertificate(rand.Reader, &template, parentCertificate, privateKey.Public(), parentKey)
+	if err != nil {
+		t.Fatalf("failed to create intermediate certificate authority: %s", err)
+	}
+	return &PkiKeyCertPair{CertificatePem: string(certificateToPem(derBytes)), PrivateKeyPem: string(privateKeyToPem(privateKey))}
+}
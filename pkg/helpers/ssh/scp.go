@@ -19,11 +19,18 @@ import (
 // Context ctx is only enforced during the process that establishes
 // the SSH connection and creates the SSH client.
 func CopyToRemote(ctx context.Context, host *RemoteHost, file *RemoteFile) (combinedOutput string, err error) {
+	return CopyToRemoteWithCancel(ctx, nil, host, file)
+}
+
+// CopyToRemoteWithCancel copies a file to a remote host like CopyToRemote,
+// the SSH connection is closed, interrupting the copy, once channel cancel is closed.
+func CopyToRemoteWithCancel(ctx context.Context, cancel <-chan struct{}, host *RemoteHost, file *RemoteFile) (combinedOutput string, err error) {
 	c, err := clientWithRetry(ctx, host)
 	if err != nil {
 		return "", errors.Wrap(err, "creating SSH client")
 	}
 	defer c.Close()
+	defer closeOnCancel(c, cancel)()
 	s, err := c.NewSession()
 	if err != nil {
 		return "", errors.Wrap(err, "creating SSH session")
@@ -43,6 +50,12 @@ func CopyToRemote(ctx context.Context, host *RemoteHost, file *RemoteFile) (comb
 // Context ctx is only enforced during the process that establishes
 // the SSH connection and creates the SSH client.
 func CopyFromRemote(ctx context.Context, host *RemoteHost, remoteFile *RemoteFile, destinationPath string) (stderr string, err error) {
+	return CopyFromRemoteWithCancel(ctx, nil, host, remoteFile, destinationPath)
+}
+
+// CopyFromRemoteWithCancel copies a remote file to the local host like CopyFromRemote,
+// the SSH connection is closed, interrupting the copy, once channel cancel is closed.
+func CopyFromRemoteWithCancel(ctx context.Context, cancel <-chan struct{}, host *RemoteHost, remoteFile *RemoteFile, destinationPath string) (stderr string, err error) {
 	f, err := os.OpenFile(destinationPath, os.O_WRONLY|os.O_CREATE, 0644)
 	if err != nil {
 		return "", errors.Wrap(err, "opening destination file")
@@ -53,6 +66,7 @@ func CopyFromRemote(ctx context.Context, host *RemoteHost, remoteFile *RemoteFil
 		return "", errors.Wrap(err, "creating SSH client")
 	}
 	defer c.Close()
+	defer closeOnCancel(c, cancel)()
 	s, err := c.NewSession()
 	if err != nil {
 		return "", errors.Wrap(err, "creating SSH session")
@@ -7,6 +7,7 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"path"
@@ -26,20 +27,28 @@ import (
 // Context ctx is only enforced during the process that stablishes
 // the SSH connection and creates the SSH client.
 func ExecuteRemote(ctx context.Context, host *RemoteHost, script string) (combinedOutput string, err error) {
+	return ExecuteRemoteWithCancel(ctx, nil, host, script)
+}
+
+// ExecuteRemoteWithCancel executes a script in a remote host like ExecuteRemote,
+// the SSH connection is closed, interrupting the script, once channel cancel is closed.
+func ExecuteRemoteWithCancel(ctx context.Context, cancel <-chan struct{}, host *RemoteHost, script string) (combinedOutput string, err error) {
 	c, err := clientWithRetry(ctx, host)
 	if err != nil {
 		return "", errors.Wrap(err, "creating SSH client")
 	}
 	defer c.Close()
+	defer closeOnCancel(c, cancel)()
 	s, err := c.NewSession()
 	if err != nil {
 		return "", errors.Wrap(err, "creating SSH session")
 	}
 	defer s.Close()
-	if co, err := s.CombinedOutput(script); err != nil {
+	co, err := s.CombinedOutput(script)
+	if err != nil {
 		return string(co), errors.Wrapf(err, "executing script")
 	}
-	return "", nil
+	return string(co), nil
 }
 
 // PublicKeyAuth returns an AuthMethod that uses a ssh key pair
@@ -68,6 +77,22 @@ func ValidateConfig(host *JumpBox) error {
 	return nil
 }
 
+// closeOnCancel closes c once channel cancel is closed, until the returned func is called
+func closeOnCancel(c io.Closer, cancel <-chan struct{}) (stop func()) {
+	if cancel == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-cancel:
+			c.Close()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
 func clientWithRetry(ctx context.Context, host *RemoteHost) (*ssh.Client, error) {
 	// TODO Granular retry func
 	retryFunc := func(err error) bool {
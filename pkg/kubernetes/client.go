@@ -65,6 +65,21 @@ func (c *ClientSetClient) ListPodsByOptions(namespace string, opts metav1.ListOp
 	return c.clientset.CoreV1().Pods(namespace).List(context.TODO(), opts)
 }
 
+// ListEvents returns a list of events in the provided namespace.
+func (c *ClientSetClient) ListEvents(namespace string, opts metav1.ListOptions) (*v1.EventList, error) {
+	return c.clientset.CoreV1().Events(namespace).List(context.TODO(), opts)
+}
+
+// GetPodLogs returns the logs of a pod container.
+func (c *ClientSetClient) GetPodLogs(namespace, name string, opts *v1.PodLogOptions) ([]byte, error) {
+	return c.clientset.CoreV1().Pods(namespace).GetLogs(name, opts).DoRaw(context.TODO())
+}
+
+// GetRaw returns the response body of a GET request to the passed in api server path, i.e. /healthz.
+func (c *ClientSetClient) GetRaw(path string) ([]byte, error) {
+	return c.clientset.CoreV1().RESTClient().Get().AbsPath(path).DoRaw(context.TODO())
+}
+
 // ListNodes returns a list of Nodes registered in the api server.
 func (c *ClientSetClient) ListNodes() (*v1.NodeList, error) {
 	return c.ListNodesByOptions(metav1.ListOptions{})
@@ -100,6 +115,11 @@ func (c *ClientSetClient) ListDaemonSets(namespace string, opts metav1.ListOptio
 	return c.clientset.AppsV1().DaemonSets(namespace).List(context.TODO(), opts)
 }
 
+// ListPodDisruptionBudgets returns a list of pod disruption budgets in the provided namespace.
+func (c *ClientSetClient) ListPodDisruptionBudgets(namespace string, opts metav1.ListOptions) (*policyv1.PodDisruptionBudgetList, error) {
+	return c.clientset.PolicyV1beta1().PodDisruptionBudgets(namespace).List(context.TODO(), opts)
+}
+
 // ListSecrets returns a list of secrets in the provided namespace.
 func (c *ClientSetClient) ListSecrets(namespace string, opts metav1.ListOptions) (*v1.SecretList, error) {
 	return c.clientset.CoreV1().Secrets(namespace).List(context.TODO(), opts)
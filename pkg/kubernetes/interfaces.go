@@ -21,6 +21,14 @@ type Client interface {
 	ListPods(node *v1.Node) (*v1.PodList, error)
 	// ListPods returns all Pods running
 	ListAllPods() (*v1.PodList, error)
+	// ListPodsByOptions returns Pods based on the passed in list options.
+	ListPodsByOptions(namespace string, opts metav1.ListOptions) (*v1.PodList, error)
+	// ListEvents returns a list of events in the provided namespace.
+	ListEvents(namespace string, opts metav1.ListOptions) (*v1.EventList, error)
+	// GetPodLogs returns the logs of a pod container.
+	GetPodLogs(namespace, name string, opts *v1.PodLogOptions) ([]byte, error)
+	// GetRaw returns the response body of a GET request to the passed in api server path, i.e. /healthz.
+	GetRaw(path string) ([]byte, error)
 	// ListNodes returns a list of Nodes registered in the api server.
 	ListNodes() (*v1.NodeList, error)
 	// ListNodesByOptions returns a list of Nodes registered in the api server.
@@ -29,6 +37,12 @@ type Client interface {
 	ListServiceAccounts(namespace string) (*v1.ServiceAccountList, error)
 	// ListPodSecurityPolices returns the list of Pod Security Policies
 	ListPodSecurityPolices(opts metav1.ListOptions) (*policyv1.PodSecurityPolicyList, error)
+	// ListDeployments returns a list of deployments in the provided namespace.
+	ListDeployments(namespace string, opts metav1.ListOptions) (*appsv1.DeploymentList, error)
+	// ListDaemonSets returns a list of daemonsets in the provided namespace.
+	ListDaemonSets(namespace string, opts metav1.ListOptions) (*appsv1.DaemonSetList, error)
+	// ListPodDisruptionBudgets returns a list of pod disruption budgets in the provided namespace.
+	ListPodDisruptionBudgets(namespace string, opts metav1.ListOptions) (*policyv1.PodDisruptionBudgetList, error)
 	// GetDaemonSet returns details about DaemonSet with passed in name.
 	GetDaemonSet(namespace, name string) (*appsv1.DaemonSet, error)
 	// GetDeployment returns a given deployment in a namespace.
@@ -71,6 +71,66 @@ func (mr *MockClientMockRecorder) ListAllPods() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAllPods", reflect.TypeOf((*MockClient)(nil).ListAllPods))
 }
 
+// ListPodsByOptions mocks base method
+func (m *MockClient) ListPodsByOptions(namespace string, opts v12.ListOptions) (*v10.PodList, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListPodsByOptions", namespace, opts)
+	ret0, _ := ret[0].(*v10.PodList)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListPodsByOptions indicates an expected call of ListPodsByOptions
+func (mr *MockClientMockRecorder) ListPodsByOptions(namespace, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListPodsByOptions", reflect.TypeOf((*MockClient)(nil).ListPodsByOptions), namespace, opts)
+}
+
+// ListEvents mocks base method
+func (m *MockClient) ListEvents(namespace string, opts v12.ListOptions) (*v10.EventList, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListEvents", namespace, opts)
+	ret0, _ := ret[0].(*v10.EventList)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListEvents indicates an expected call of ListEvents
+func (mr *MockClientMockRecorder) ListEvents(namespace, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListEvents", reflect.TypeOf((*MockClient)(nil).ListEvents), namespace, opts)
+}
+
+// GetPodLogs mocks base method
+func (m *MockClient) GetPodLogs(namespace, name string, opts *v10.PodLogOptions) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPodLogs", namespace, name, opts)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPodLogs indicates an expected call of GetPodLogs
+func (mr *MockClientMockRecorder) GetPodLogs(namespace, name, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPodLogs", reflect.TypeOf((*MockClient)(nil).GetPodLogs), namespace, name, opts)
+}
+
+// GetRaw mocks base method
+func (m *MockClient) GetRaw(path string) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRaw", path)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRaw indicates an expected call of GetRaw
+func (mr *MockClientMockRecorder) GetRaw(path interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRaw", reflect.TypeOf((*MockClient)(nil).GetRaw), path)
+}
+
 // ListNodes mocks base method
 func (m *MockClient) ListNodes() (*v10.NodeList, error) {
 	m.ctrl.T.Helper()
@@ -131,6 +191,51 @@ func (mr *MockClientMockRecorder) ListPodSecurityPolices(opts interface{}) *gomo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListPodSecurityPolices", reflect.TypeOf((*MockClient)(nil).ListPodSecurityPolices), opts)
 }
 
+// ListDeployments mocks base method
+func (m *MockClient) ListDeployments(namespace string, opts v12.ListOptions) (*v1.DeploymentList, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListDeployments", namespace, opts)
+	ret0, _ := ret[0].(*v1.DeploymentList)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListDeployments indicates an expected call of ListDeployments
+func (mr *MockClientMockRecorder) ListDeployments(namespace, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListDeployments", reflect.TypeOf((*MockClient)(nil).ListDeployments), namespace, opts)
+}
+
+// ListDaemonSets mocks base method
+func (m *MockClient) ListDaemonSets(namespace string, opts v12.ListOptions) (*v1.DaemonSetList, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListDaemonSets", namespace, opts)
+	ret0, _ := ret[0].(*v1.DaemonSetList)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListDaemonSets indicates an expected call of ListDaemonSets
+func (mr *MockClientMockRecorder) ListDaemonSets(namespace, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListDaemonSets", reflect.TypeOf((*MockClient)(nil).ListDaemonSets), namespace, opts)
+}
+
+// ListPodDisruptionBudgets mocks base method
+func (m *MockClient) ListPodDisruptionBudgets(namespace string, opts v12.ListOptions) (*v1beta1.PodDisruptionBudgetList, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListPodDisruptionBudgets", namespace, opts)
+	ret0, _ := ret[0].(*v1beta1.PodDisruptionBudgetList)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListPodDisruptionBudgets indicates an expected call of ListPodDisruptionBudgets
+func (mr *MockClientMockRecorder) ListPodDisruptionBudgets(namespace, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListPodDisruptionBudgets", reflect.TypeOf((*MockClient)(nil).ListPodDisruptionBudgets), namespace, opts)
+}
+
 // GetDaemonSet mocks base method
 func (m *MockClient) GetDaemonSet(namespace, name string) (*v1.DaemonSet, error) {
 	m.ctrl.T.Helper()
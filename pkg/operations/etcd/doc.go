@@ -0,0 +1,5 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+// Package etcd takes and restores snapshots of the etcd cluster running on the control plane nodes.
+package etcd
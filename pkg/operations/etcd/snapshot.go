@@ -0,0 +1,241 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/aks-engine-azurestack/pkg/armhelpers"
+	"github.com/Azure/aks-engine-azurestack/pkg/helpers/ssh"
+	azStorage "github.com/Azure/azure-sdk-for-go/storage"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// DefaultInterval is the default polling interval used while waiting for etcd to become healthy after a restore
+	DefaultInterval = 10 * time.Second
+	// DefaultTimeout is the default amount of time to wait for etcd to become healthy after a restore
+	DefaultTimeout = 10 * time.Minute
+
+	remoteSnapshotPath = "/tmp/etcd-snapshot.db"
+
+	// EndpointHealthScript checks the health of the etcd member running on the remote host
+	EndpointHealthScript = `source /etc/environment; sudo ETCDCTL_API=3 etcdctl --command-timeout=30s --endpoints="${ETCDCTL_ENDPOINTS}" --cacert="${ETCDCTL_CA_FILE}" --cert="${ETCDCTL_CERT_FILE}" --key="${ETCDCTL_KEY_FILE}" endpoint health`
+
+	saveScript = `source /etc/environment; sudo ETCDCTL_API=3 etcdctl --command-timeout=5m --endpoints="${ETCDCTL_ENDPOINTS}" --cacert="${ETCDCTL_CA_FILE}" --cert="${ETCDCTL_CERT_FILE}" --key="${ETCDCTL_KEY_FILE}" snapshot save %[1]s && sudo chown "$(id -u):$(id -g)" %[1]s`
+
+	cleanupScript = `sudo rm -f %s`
+
+	// the static pod manifests are moved out of the way so the kubelet stops the control plane components
+	// while the etcd data directory is replaced, moving them back starts components with no stale cache
+	stopControlPlaneScript  = `sudo mkdir -p /etc/kubernetes/manifests.etcd-restore && sudo find /etc/kubernetes/manifests -maxdepth 1 -name '*.yaml' -exec mv -t /etc/kubernetes/manifests.etcd-restore {} + && sudo systemctl stop etcd`
+	startEtcdScript         = `sudo systemctl start --no-block etcd`
+	startControlPlaneScript = `sudo find /etc/kubernetes/manifests.etcd-restore -maxdepth 1 -name '*.yaml' -exec mv -t /etc/kubernetes/manifests {} + && sudo rmdir /etc/kubernetes/manifests.etcd-restore`
+
+	// restoreScript rebuilds the member data directory from the snapshot using the member settings found in /etc/default/etcd,
+	// the current data directory is kept next to the new one, with the suffix passed as second argument
+	restoreScript = `set -euo pipefail
+ARGS="$(grep ^DAEMON_ARGS= /etc/default/etcd)"
+arg() { echo "${ARGS}" | grep -oP -- "--$1 \"?\K[^\" ]+" | head -1; }
+sudo rm -rf /var/lib/etcddisk/restore
+sudo ETCDCTL_API=3 etcdctl snapshot restore %[1]s --name "$(arg name)" --initial-cluster "$(arg initial-cluster)" --initial-cluster-token "$(arg initial-cluster-token)" --initial-advertise-peer-urls "$(arg initial-advertise-peer-urls)" --data-dir /var/lib/etcddisk/restore
+if sudo test -d /var/lib/etcddisk/member; then sudo mv /var/lib/etcddisk/member /var/lib/etcddisk/member.%[2]s.bak; fi
+sudo mv /var/lib/etcddisk/restore/member /var/lib/etcddisk/member
+sudo rm -rf /var/lib/etcddisk/restore %[1]s
+sudo chown -R etcd:etcd /var/lib/etcddisk`
+
+	// rollbackScript puts back the data directory moved aside by restoreScript, if it got that far
+	rollbackScript = `set -euo pipefail
+if sudo test -d /var/lib/etcddisk/member.%[1]s.bak; then sudo rm -rf /var/lib/etcddisk/member && sudo mv /var/lib/etcddisk/member.%[1]s.bak /var/lib/etcddisk/member; fi
+sudo rm -rf /var/lib/etcddisk/restore
+sudo chown -R etcd:etcd /var/lib/etcddisk`
+)
+
+// Snapshotter takes and restores etcd snapshots through SSH sessions to the control plane nodes
+type Snapshotter struct {
+	Masters  []*ssh.RemoteHost
+	Logger   *logrus.Entry
+	Interval time.Duration
+	Timeout  time.Duration
+
+	executeRemote  func(ctx context.Context, host *ssh.RemoteHost, script string) (string, error)
+	copyToRemote   func(ctx context.Context, host *ssh.RemoteHost, file *ssh.RemoteFile) (string, error)
+	copyFromRemote func(ctx context.Context, host *ssh.RemoteHost, file *ssh.RemoteFile, destinationPath string) (string, error)
+	now            func() time.Time
+}
+
+// NewSnapshotter returns a Snapshotter that reaches the control plane nodes through SSH
+func NewSnapshotter(masters []*ssh.RemoteHost, logger *logrus.Entry) *Snapshotter {
+	return &Snapshotter{
+		Masters:        masters,
+		Logger:         logger,
+		Interval:       DefaultInterval,
+		Timeout:        DefaultTimeout,
+		executeRemote:  ssh.ExecuteRemote,
+		copyToRemote:   ssh.CopyToRemote,
+		copyFromRemote: ssh.CopyFromRemote,
+		now:            time.Now,
+	}
+}
+
+// Save takes a snapshot from the first control plane node able to produce one and downloads it to destinationPath.
+// It returns the name of the node the snapshot was taken from.
+func (s *Snapshotter) Save(ctx context.Context, destinationPath string) (string, error) {
+	if len(s.Masters) == 0 {
+		return "", errors.New("no control plane nodes to take the snapshot from")
+	}
+	var err error
+	for _, master := range s.Masters {
+		if err = s.save(ctx, master, destinationPath); err == nil {
+			return master.URI, nil
+		}
+		s.Logger.Warnf("Failed to take an etcd snapshot from %s: %v", master.URI, err)
+	}
+	return "", errors.Wrap(err, "taking etcd snapshot")
+}
+
+func (s *Snapshotter) save(ctx context.Context, master *ssh.RemoteHost, destinationPath string) error {
+	s.Logger.Infof("Taking etcd snapshot on %s", master.URI)
+	if out, err := s.executeRemote(ctx, master, fmt.Sprintf(saveScript, remoteSnapshotPath)); err != nil {
+		return errors.Wrap(err, out)
+	}
+	defer func() {
+		if out, err := s.executeRemote(ctx, master, fmt.Sprintf(cleanupScript, remoteSnapshotPath)); err != nil {
+			s.Logger.Warnf("Failed to delete %s from %s: %s", remoteSnapshotPath, master.URI, out)
+		}
+	}()
+	s.Logger.Infof("Downloading etcd snapshot to %s", destinationPath)
+	if stderr, err := s.copyFromRemote(ctx, master, &ssh.RemoteFile{Path: remoteSnapshotPath}, destinationPath); err != nil {
+		os.Remove(destinationPath)
+		return errors.Wrap(err, stderr)
+	}
+	fi, err := os.Stat(destinationPath)
+	if err != nil {
+		return errors.Wrapf(err, "reading %s", destinationPath)
+	}
+	if fi.Size() == 0 {
+		os.Remove(destinationPath)
+		return errors.New("downloaded snapshot is empty")
+	}
+	return nil
+}
+
+// Restore replaces the etcd data on every control plane node with the content of the snapshot.
+//
+// The control plane components are stopped on all nodes first, so the cluster is unavailable until Restore returns.
+// If the data directory of a member can't be rebuilt, the members already rebuilt are rolled back to their previous data
+// and the control plane is started again. Once every data directory is rebuilt, the previous ones are left on the nodes
+// as /var/lib/etcddisk/member.<timestamp>.bak.
+func (s *Snapshotter) Restore(ctx context.Context, snapshotPath string) error {
+	if len(s.Masters) == 0 {
+		return errors.New("no control plane nodes to restore the snapshot on")
+	}
+	content, err := os.ReadFile(snapshotPath)
+	if err != nil {
+		return errors.Wrapf(err, "reading %s", snapshotPath)
+	}
+	snapshot := ssh.NewRemoteFile(remoteSnapshotPath, "600", "root:root", content)
+	for _, master := range s.Masters {
+		s.Logger.Infof("Uploading etcd snapshot to %s", master.URI)
+		if out, err := s.copyToRemote(ctx, master, snapshot); err != nil {
+			return errors.Wrapf(err, "uploading snapshot to %s: %s", master.URI, out)
+		}
+	}
+	s.Logger.Info("Stopping control plane components")
+	if err := s.executeOnMasters(ctx, stopControlPlaneScript); err != nil {
+		return err
+	}
+	s.Logger.Info("Restoring etcd data directories")
+	backupSuffix := strconv.FormatInt(s.now().Unix(), 10)
+	for i, master := range s.Masters {
+		if out, err := s.executeRemote(ctx, master, fmt.Sprintf(restoreScript, remoteSnapshotPath, backupSuffix)); err != nil {
+			err = errors.Wrapf(err, "executing script on %s: %s", master.URI, out)
+			return s.rollback(ctx, s.Masters[:i+1], backupSuffix, err)
+		}
+	}
+	s.Logger.Info("Starting etcd")
+	if err := s.executeOnMasters(ctx, startEtcdScript); err != nil {
+		return errors.Wrapf(err, "all etcd members were restored, their previous data is kept as /var/lib/etcddisk/member.%s.bak", backupSuffix)
+	}
+	if err := s.waitForHealthy(ctx); err != nil {
+		return errors.Wrapf(err, "all etcd members were restored, their previous data is kept as /var/lib/etcddisk/member.%s.bak", backupSuffix)
+	}
+	s.Logger.Info("Starting control plane components")
+	return s.executeOnMasters(ctx, startControlPlaneScript)
+}
+
+// rollback puts back the previous data directory of the members the snapshot was restored on
+// and starts the control plane again, restoreErr is returned along with the members that were rolled back
+func (s *Snapshotter) rollback(ctx context.Context, restored []*ssh.RemoteHost, backupSuffix string, restoreErr error) error {
+	s.Logger.Warnf("Failed to restore etcd data directories, rolling back: %v", restoreErr)
+	rolledBack, failed := []string{}, []string{}
+	for _, master := range restored {
+		if out, err := s.executeRemote(ctx, master, fmt.Sprintf(rollbackScript, backupSuffix)); err != nil {
+			s.Logger.Errorf("Failed to roll back the etcd data directory on %s: %s: %v", master.URI, out, err)
+			failed = append(failed, master.URI)
+			continue
+		}
+		rolledBack = append(rolledBack, master.URI)
+	}
+	if len(failed) > 0 {
+		return errors.Wrapf(restoreErr, "etcd members %s were rolled back, etcd members %s could not be rolled back and hold the restored data, their previous data is kept as /var/lib/etcddisk/member.%s.bak",
+			strings.Join(rolledBack, ", "), strings.Join(failed, ", "), backupSuffix)
+	}
+	if err := s.executeOnMasters(ctx, startEtcdScript); err != nil {
+		return errors.Wrapf(restoreErr, "etcd members %s were rolled back but etcd could not be started: %v", strings.Join(rolledBack, ", "), err)
+	}
+	if err := s.executeOnMasters(ctx, startControlPlaneScript); err != nil {
+		return errors.Wrapf(restoreErr, "etcd members %s were rolled back but the control plane could not be started: %v", strings.Join(rolledBack, ", "), err)
+	}
+	return errors.Wrapf(restoreErr, "etcd members %s were rolled back to their previous data", strings.Join(rolledBack, ", "))
+}
+
+func (s *Snapshotter) executeOnMasters(ctx context.Context, script string) error {
+	for _, master := range s.Masters {
+		if out, err := s.executeRemote(ctx, master, script); err != nil {
+			return errors.Wrapf(err, "executing script on %s: %s", master.URI, out)
+		}
+	}
+	return nil
+}
+
+// waitForHealthy waits until every etcd member reports itself as healthy
+func (s *Snapshotter) waitForHealthy(ctx context.Context) error {
+	s.Logger.Info("Waiting for etcd members to become healthy")
+	for _, master := range s.Masters {
+		master := master
+		var out string
+		err := wait.PollImmediate(s.Interval, s.Timeout, func() (bool, error) {
+			var err error
+			out, err = s.executeRemote(ctx, master, EndpointHealthScript)
+			return err == nil, nil
+		})
+		if err != nil {
+			return errors.Wrapf(err, "waiting for etcd member on %s to become healthy: %s", master.URI, out)
+		}
+	}
+	return nil
+}
+
+// UploadSnapshot copies the snapshot to a blob in the specified storage container, the container is created if it does not exist
+func UploadSnapshot(client armhelpers.AKSStorageClient, containerName, blobName, snapshotPath string) error {
+	content, err := os.ReadFile(snapshotPath)
+	if err != nil {
+		return errors.Wrapf(err, "reading %s", snapshotPath)
+	}
+	if _, err = client.CreateContainer(containerName, &azStorage.CreateContainerOptions{Access: azStorage.ContainerAccessTypePrivate}); err != nil {
+		return errors.Wrapf(err, "creating storage container %s", containerName)
+	}
+	if err = client.SaveBlockBlob(containerName, blobName, content, nil); err != nil {
+		return errors.Wrapf(err, "uploading blob %s", blobName)
+	}
+	return nil
+}
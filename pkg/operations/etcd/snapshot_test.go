@@ -0,0 +1,159 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/aks-engine-azurestack/pkg/armhelpers"
+	"github.com/Azure/aks-engine-azurestack/pkg/helpers/ssh"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeRemote records the scripts executed on each host
+type fakeRemote struct {
+	scripts  []string
+	failHost string
+	failStep string
+	uploaded map[string][]byte
+}
+
+func (f *fakeRemote) snapshotter(masters ...string) *Snapshotter {
+	hosts := []*ssh.RemoteHost{}
+	for _, m := range masters {
+		hosts = append(hosts, &ssh.RemoteHost{URI: m})
+	}
+	s := NewSnapshotter(hosts, logrus.NewEntry(logrus.New()))
+	s.Interval = time.Millisecond
+	s.Timeout = 10 * time.Millisecond
+	s.executeRemote = func(ctx context.Context, host *ssh.RemoteHost, script string) (string, error) {
+		f.scripts = append(f.scripts, fmt.Sprintf("%s: %s", host.URI, script))
+		if host.URI == f.failHost && strings.Contains(script, f.failStep) {
+			return "remote failure", errors.New("executing script")
+		}
+		return "", nil
+	}
+	s.copyToRemote = func(ctx context.Context, host *ssh.RemoteHost, file *ssh.RemoteFile) (string, error) {
+		if f.uploaded == nil {
+			f.uploaded = map[string][]byte{}
+		}
+		f.uploaded[host.URI] = file.Content
+		return "", nil
+	}
+	s.copyFromRemote = func(ctx context.Context, host *ssh.RemoteHost, file *ssh.RemoteFile, destinationPath string) (string, error) {
+		return "", os.WriteFile(destinationPath, []byte("snapshot from "+host.URI), 0600)
+	}
+	return s
+}
+
+func TestSnapshotterSave(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dst := filepath.Join(t.TempDir(), "snapshot.db")
+
+	remote := &fakeRemote{failHost: "k8s-master-0", failStep: "snapshot save"}
+	master, err := remote.snapshotter("k8s-master-0", "k8s-master-1").Save(context.Background(), dst)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(master).To(Equal("k8s-master-1"))
+	content, err := os.ReadFile(dst)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(content)).To(Equal("snapshot from k8s-master-1"))
+	g.Expect(remote.scripts[len(remote.scripts)-1]).To(Equal("k8s-master-1: sudo rm -f /tmp/etcd-snapshot.db"))
+
+	remote = &fakeRemote{failHost: "k8s-master-0", failStep: "snapshot save"}
+	_, err = remote.snapshotter("k8s-master-0").Save(context.Background(), dst)
+	g.Expect(err).To(MatchError("taking etcd snapshot: remote failure: executing script"))
+
+	_, err = remote.snapshotter().Save(context.Background(), dst)
+	g.Expect(err).To(MatchError("no control plane nodes to take the snapshot from"))
+}
+
+func TestSnapshotterRestore(t *testing.T) {
+	g := NewGomegaWithT(t)
+	snapshot := filepath.Join(t.TempDir(), "snapshot.db")
+	g.Expect(os.WriteFile(snapshot, []byte("snapshot"), 0600)).To(Succeed())
+
+	now := func() time.Time { return time.Unix(1700000000, 0) }
+	restore := fmt.Sprintf(restoreScript, remoteSnapshotPath, "1700000000")
+	rollback := fmt.Sprintf(rollbackScript, "1700000000")
+
+	remote := &fakeRemote{}
+	s := remote.snapshotter("k8s-master-0", "k8s-master-1")
+	s.now = now
+	g.Expect(s.Restore(context.Background(), snapshot)).To(Succeed())
+	g.Expect(remote.uploaded).To(HaveKeyWithValue("k8s-master-0", []byte("snapshot")))
+	g.Expect(remote.uploaded).To(HaveKeyWithValue("k8s-master-1", []byte("snapshot")))
+	// every step runs on all nodes before the next one starts
+	g.Expect(remote.scripts).To(Equal([]string{
+		"k8s-master-0: " + stopControlPlaneScript,
+		"k8s-master-1: " + stopControlPlaneScript,
+		"k8s-master-0: " + restore,
+		"k8s-master-1: " + restore,
+		"k8s-master-0: " + startEtcdScript,
+		"k8s-master-1: " + startEtcdScript,
+		"k8s-master-0: " + EndpointHealthScript,
+		"k8s-master-1: " + EndpointHealthScript,
+		"k8s-master-0: " + startControlPlaneScript,
+		"k8s-master-1: " + startControlPlaneScript,
+	}))
+
+	remote = &fakeRemote{failHost: "k8s-master-1", failStep: "endpoint health"}
+	s = remote.snapshotter("k8s-master-0", "k8s-master-1")
+	s.now = now
+	err := s.Restore(context.Background(), snapshot)
+	g.Expect(err).To(MatchError("all etcd members were restored, their previous data is kept as /var/lib/etcddisk/member.1700000000.bak: waiting for etcd member on k8s-master-1 to become healthy: remote failure: timed out waiting for the condition"))
+	g.Expect(remote.scripts).NotTo(ContainElement("k8s-master-0: " + startControlPlaneScript))
+
+	// the members already restored are rolled back when a later one fails
+	remote = &fakeRemote{failHost: "k8s-master-1", failStep: "snapshot restore"}
+	s = remote.snapshotter("k8s-master-0", "k8s-master-1", "k8s-master-2")
+	s.now = now
+	err = s.Restore(context.Background(), snapshot)
+	g.Expect(err).To(MatchError("etcd members k8s-master-0, k8s-master-1 were rolled back to their previous data: executing script on k8s-master-1: remote failure: executing script"))
+	g.Expect(remote.scripts).To(Equal([]string{
+		"k8s-master-0: " + stopControlPlaneScript,
+		"k8s-master-1: " + stopControlPlaneScript,
+		"k8s-master-2: " + stopControlPlaneScript,
+		"k8s-master-0: " + restore,
+		"k8s-master-1: " + restore,
+		"k8s-master-0: " + rollback,
+		"k8s-master-1: " + rollback,
+		"k8s-master-0: " + startEtcdScript,
+		"k8s-master-1: " + startEtcdScript,
+		"k8s-master-2: " + startEtcdScript,
+		"k8s-master-0: " + startControlPlaneScript,
+		"k8s-master-1: " + startControlPlaneScript,
+		"k8s-master-2: " + startControlPlaneScript,
+	}))
+
+	// members that can't be rolled back are named in the error
+	remote = &fakeRemote{failHost: "k8s-master-1", failStep: "/var/lib/etcddisk"}
+	s = remote.snapshotter("k8s-master-0", "k8s-master-1")
+	s.now = now
+	err = s.Restore(context.Background(), snapshot)
+	g.Expect(err).To(MatchError("etcd members k8s-master-0 were rolled back, etcd members k8s-master-1 could not be rolled back and hold the restored data, their previous data is kept as /var/lib/etcddisk/member.1700000000.bak: executing script on k8s-master-1: remote failure: executing script"))
+	g.Expect(remote.scripts).NotTo(ContainElement("k8s-master-0: " + startEtcdScript))
+
+	err = remote.snapshotter("k8s-master-0").Restore(context.Background(), "missing.db")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestUploadSnapshot(t *testing.T) {
+	g := NewGomegaWithT(t)
+	snapshot := filepath.Join(t.TempDir(), "snapshot.db")
+	g.Expect(os.WriteFile(snapshot, []byte("snapshot"), 0600)).To(Succeed())
+
+	g.Expect(UploadSnapshot(&armhelpers.MockStorageClient{}, "etcd-backups", "cluster/snapshot.db", snapshot)).To(Succeed())
+	err := UploadSnapshot(&armhelpers.MockStorageClient{FailCreateContainer: true}, "etcd-backups", "cluster/snapshot.db", snapshot)
+	g.Expect(err).To(MatchError("creating storage container etcd-backups: CreateContainer failed"))
+	err = UploadSnapshot(&armhelpers.MockStorageClient{FailSaveBlockBlob: true}, "etcd-backups", "cluster/snapshot.db", snapshot)
+	g.Expect(err).To(MatchError("uploading blob cluster/snapshot.db: SaveBlockBlob failed"))
+}
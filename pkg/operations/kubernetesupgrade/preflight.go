@@ -0,0 +1,220 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package kubernetesupgrade
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/aks-engine-azurestack/pkg/helpers/ssh"
+	"github.com/Azure/aks-engine-azurestack/pkg/kubernetes"
+	"github.com/Azure/aks-engine-azurestack/pkg/operations/etcd"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PreflightStatus is the outcome of a single preflight check
+type PreflightStatus string
+
+const (
+	// PreflightPass means the check found nothing that could get in the way of the upgrade
+	PreflightPass PreflightStatus = "pass"
+	// PreflightWarn means the check could not be completed or found something worth looking at
+	PreflightWarn PreflightStatus = "warn"
+	// PreflightFail means the upgrade is likely to fail or to disrupt workloads
+	PreflightFail PreflightStatus = "fail"
+)
+
+const (
+	// preflightDiskWarnPercent is the master disk usage above which the disk space check warns
+	preflightDiskWarnPercent = 80
+	// preflightDiskFailPercent is the master disk usage above which the disk space check fails
+	preflightDiskFailPercent = 90
+
+	preflightEtcdHealthScript = etcd.EndpointHealthScript
+	preflightDiskUsageScript  = `df -P / /var/lib/etcddisk | awk 'NR>1 {print $6, $5}'`
+)
+
+// PreflightResult is the outcome of a preflight check on a single target (a node, a workload or the whole cluster)
+type PreflightResult struct {
+	Check   string          `json:"check"`
+	Target  string          `json:"target"`
+	Status  PreflightStatus `json:"status"`
+	Message string          `json:"message"`
+}
+
+// PreflightChecker verifies the cluster is healthy enough to be upgraded
+type PreflightChecker struct {
+	Client kubernetes.Client
+	// Masters are the control plane nodes the etcd and disk space checks run on.
+	// Those checks are reported as warnings when no masters are provided.
+	Masters []*ssh.RemoteHost
+	// ExecuteRemote runs a script on a remote host, it defaults to ssh.ExecuteRemote
+	ExecuteRemote func(ctx context.Context, host *ssh.RemoteHost, script string) (string, error)
+}
+
+// Run executes all checks and returns their results
+func (pc *PreflightChecker) Run(ctx context.Context) []PreflightResult {
+	results := []PreflightResult{}
+	results = append(results, pc.checkNodes()...)
+	results = append(results, pc.checkSystemWorkloads()...)
+	results = append(results, pc.checkPodDisruptionBudgets()...)
+	results = append(results, pc.checkMasters(ctx)...)
+	return results
+}
+
+// PreflightFailed returns true if any of the results is a failure
+func PreflightFailed(results []PreflightResult) bool {
+	for _, r := range results {
+		if r.Status == PreflightFail {
+			return true
+		}
+	}
+	return false
+}
+
+func (pc *PreflightChecker) checkNodes() []PreflightResult {
+	const check = "node ready"
+	nodes, err := pc.Client.ListNodes()
+	if err != nil {
+		return []PreflightResult{{check, "cluster", PreflightFail, fmt.Sprintf("listing nodes: %v", err)}}
+	}
+	results := []PreflightResult{}
+	for _, node := range nodes.Items {
+		node := node
+		switch {
+		case !kubernetes.IsNodeReady(&node):
+			results = append(results, PreflightResult{check, node.Name, PreflightFail, "node is not Ready"})
+		case node.Spec.Unschedulable:
+			results = append(results, PreflightResult{check, node.Name, PreflightWarn, "node is Ready but cordoned"})
+		}
+	}
+	if len(results) == 0 {
+		results = append(results, PreflightResult{check, "cluster", PreflightPass, fmt.Sprintf("all %d nodes are Ready", len(nodes.Items))})
+	}
+	return results
+}
+
+func (pc *PreflightChecker) checkSystemWorkloads() []PreflightResult {
+	const check = "kube-system workloads"
+	results := []PreflightResult{}
+	deployments, err := pc.Client.ListDeployments(metav1.NamespaceSystem, metav1.ListOptions{})
+	if err != nil {
+		results = append(results, PreflightResult{check, "deployments", PreflightFail, fmt.Sprintf("listing deployments: %v", err)})
+	} else {
+		for _, d := range deployments.Items {
+			desired := int32(1)
+			if d.Spec.Replicas != nil {
+				desired = *d.Spec.Replicas
+			}
+			if d.Status.AvailableReplicas < desired {
+				results = append(results, PreflightResult{check, "deployment/" + d.Name, PreflightFail,
+					fmt.Sprintf("%d of %d replicas available", d.Status.AvailableReplicas, desired)})
+			}
+		}
+	}
+	daemonSets, err := pc.Client.ListDaemonSets(metav1.NamespaceSystem, metav1.ListOptions{})
+	if err != nil {
+		results = append(results, PreflightResult{check, "daemonsets", PreflightFail, fmt.Sprintf("listing daemonsets: %v", err)})
+	} else {
+		for _, ds := range daemonSets.Items {
+			if ds.Status.NumberAvailable < ds.Status.DesiredNumberScheduled {
+				results = append(results, PreflightResult{check, "daemonset/" + ds.Name, PreflightFail,
+					fmt.Sprintf("%d of %d pods available", ds.Status.NumberAvailable, ds.Status.DesiredNumberScheduled)})
+			}
+		}
+	}
+	if len(results) == 0 {
+		results = append(results, PreflightResult{check, metav1.NamespaceSystem, PreflightPass, "all deployments and daemonsets are fully available"})
+	}
+	return results
+}
+
+func (pc *PreflightChecker) checkPodDisruptionBudgets() []PreflightResult {
+	const check = "pod disruption budgets"
+	pdbs, err := pc.Client.ListPodDisruptionBudgets(metav1.NamespaceAll, metav1.ListOptions{})
+	if err != nil {
+		return []PreflightResult{{check, "cluster", PreflightFail, fmt.Sprintf("listing pod disruption budgets: %v", err)}}
+	}
+	results := []PreflightResult{}
+	for _, pdb := range pdbs.Items {
+		// budgets that do not select any pod never block a drain
+		if pdb.Status.ExpectedPods > 0 && pdb.Status.DisruptionsAllowed < 1 {
+			results = append(results, PreflightResult{check, pdb.Namespace + "/" + pdb.Name, PreflightFail,
+				"no disruptions allowed, nodes running its pods cannot be drained"})
+		}
+	}
+	if len(results) == 0 {
+		results = append(results, PreflightResult{check, "cluster", PreflightPass, fmt.Sprintf("all %d budgets allow at least one eviction", len(pdbs.Items))})
+	}
+	return results
+}
+
+func (pc *PreflightChecker) checkMasters(ctx context.Context) []PreflightResult {
+	if len(pc.Masters) == 0 {
+		return []PreflightResult{
+			{"etcd health", "control plane", PreflightWarn, "skipped, no SSH access to the control plane nodes"},
+			{"master disk space", "control plane", PreflightWarn, "skipped, no SSH access to the control plane nodes"},
+		}
+	}
+	execute := pc.ExecuteRemote
+	if execute == nil {
+		execute = ssh.ExecuteRemote
+	}
+	results := []PreflightResult{}
+	for _, master := range pc.Masters {
+		if out, err := execute(ctx, master, preflightEtcdHealthScript); err != nil {
+			results = append(results, PreflightResult{"etcd health", master.URI, PreflightFail, firstLine(out, err)})
+		} else {
+			results = append(results, PreflightResult{"etcd health", master.URI, PreflightPass, firstLine(out, nil)})
+		}
+		out, err := execute(ctx, master, preflightDiskUsageScript)
+		if err != nil {
+			results = append(results, PreflightResult{"master disk space", master.URI, PreflightWarn, firstLine(out, err)})
+			continue
+		}
+		results = append(results, diskUsageResult(master.URI, out))
+	}
+	return results
+}
+
+// diskUsageResult evaluates the output of preflightDiskUsageScript, one "<mount point> <use%>" line per file system
+func diskUsageResult(target, out string) PreflightResult {
+	const check = "master disk space"
+	status := PreflightPass
+	usage := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		percent, err := strconv.Atoi(strings.TrimSuffix(fields[1], "%"))
+		if err != nil {
+			continue
+		}
+		switch {
+		case percent >= preflightDiskFailPercent:
+			status = PreflightFail
+		case percent >= preflightDiskWarnPercent && status == PreflightPass:
+			status = PreflightWarn
+		}
+		usage = append(usage, fmt.Sprintf("%s %d%% used", fields[0], percent))
+	}
+	if len(usage) == 0 {
+		return PreflightResult{check, target, PreflightWarn, "could not parse disk usage"}
+	}
+	return PreflightResult{check, target, status, strings.Join(usage, ", ")}
+}
+
+// firstLine returns the first line of the remote command output, or the error if there is no output
+func firstLine(out string, err error) string {
+	if line := strings.TrimSpace(strings.SplitN(strings.TrimSpace(out), "\n", 2)[0]); line != "" {
+		return line
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return "ok"
+}
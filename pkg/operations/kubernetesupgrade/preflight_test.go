@@ -0,0 +1,102 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package kubernetesupgrade
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/aks-engine-azurestack/pkg/armhelpers"
+	"github.com/Azure/aks-engine-azurestack/pkg/helpers/ssh"
+	"github.com/Azure/go-autorest/autorest/to"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+)
+
+func resultFor(results []PreflightResult, check, target string) PreflightResult {
+	for _, r := range results {
+		if r.Check == check && r.Target == target {
+			return r
+		}
+	}
+	return PreflightResult{}
+}
+
+func TestPreflightChecker(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	client := &armhelpers.MockKubernetesClient{}
+	client.DeploymentList = &appsv1.DeploymentList{Items: []appsv1.Deployment{{}, {}}}
+	client.DeploymentList.Items[0].Name = "coredns"
+	client.DeploymentList.Items[0].Spec.Replicas = to.Int32Ptr(2)
+	client.DeploymentList.Items[0].Status.AvailableReplicas = 1
+	client.DeploymentList.Items[1].Name = "metrics-server"
+	client.DeploymentList.Items[1].Status.AvailableReplicas = 1
+	client.PodDisruptionBudgetList = &policyv1beta1.PodDisruptionBudgetList{Items: []policyv1beta1.PodDisruptionBudget{{}, {}}}
+	client.PodDisruptionBudgetList.Items[0].Namespace = "default"
+	client.PodDisruptionBudgetList.Items[0].Name = "blocking"
+	client.PodDisruptionBudgetList.Items[0].Status.ExpectedPods = 2
+	client.PodDisruptionBudgetList.Items[1].Namespace = "default"
+	client.PodDisruptionBudgetList.Items[1].Name = "unused"
+
+	checker := &PreflightChecker{Client: client}
+	results := checker.Run(context.Background())
+	g.Expect(PreflightFailed(results)).To(BeTrue())
+	// the mock lists a node with only a MemoryPressure condition
+	g.Expect(resultFor(results, "node ready", "k8s-agentpool3-1234").Status).To(Equal(PreflightFail))
+	g.Expect(resultFor(results, "kube-system workloads", "deployment/coredns").Message).To(Equal("1 of 2 replicas available"))
+	g.Expect(resultFor(results, "kube-system workloads", "deployment/metrics-server")).To(Equal(PreflightResult{}))
+	g.Expect(resultFor(results, "pod disruption budgets", "default/blocking").Status).To(Equal(PreflightFail))
+	g.Expect(resultFor(results, "pod disruption budgets", "default/unused")).To(Equal(PreflightResult{}))
+	g.Expect(resultFor(results, "etcd health", "control plane").Status).To(Equal(PreflightWarn))
+
+	client.FailListNodes = true
+	client.DeploymentList = nil
+	client.PodDisruptionBudgetList = nil
+	checker.Masters = []*ssh.RemoteHost{{URI: "k8s-master-12345678-0"}, {URI: "k8s-master-12345678-1"}}
+	checker.ExecuteRemote = func(ctx context.Context, host *ssh.RemoteHost, script string) (string, error) {
+		switch {
+		case script == preflightEtcdHealthScript && host.URI == "k8s-master-12345678-1":
+			return "https://127.0.0.1:2379 is unhealthy: failed to commit proposal: context deadline exceeded\n", errors.New("executing script")
+		case script == preflightEtcdHealthScript:
+			return "https://127.0.0.1:2379 is healthy: successfully committed proposal: took = 2.1ms\n", nil
+		default:
+			return "/ 42%\n/var/lib/etcddisk 3%\n", nil
+		}
+	}
+	results = checker.Run(context.Background())
+	g.Expect(resultFor(results, "node ready", "cluster").Message).To(Equal("listing nodes: ListNodes failed"))
+	g.Expect(resultFor(results, "kube-system workloads", "kube-system").Status).To(Equal(PreflightPass))
+	g.Expect(resultFor(results, "pod disruption budgets", "cluster").Status).To(Equal(PreflightPass))
+	g.Expect(resultFor(results, "etcd health", "k8s-master-12345678-0").Status).To(Equal(PreflightPass))
+	g.Expect(resultFor(results, "etcd health", "k8s-master-12345678-1")).To(Equal(PreflightResult{
+		Check:   "etcd health",
+		Target:  "k8s-master-12345678-1",
+		Status:  PreflightFail,
+		Message: "https://127.0.0.1:2379 is unhealthy: failed to commit proposal: context deadline exceeded",
+	}))
+	g.Expect(resultFor(results, "master disk space", "k8s-master-12345678-0").Message).To(Equal("/ 42% used, /var/lib/etcddisk 3% used"))
+}
+
+func TestDiskUsageResult(t *testing.T) {
+	cases := []struct {
+		name     string
+		out      string
+		expected PreflightStatus
+	}{
+		{"Pass", "/ 42%\n/var/lib/etcddisk 3%\n", PreflightPass},
+		{"Warn", "/ 85%\n/var/lib/etcddisk 3%\n", PreflightWarn},
+		{"Fail", "/ 85%\n/var/lib/etcddisk 95%\n", PreflightFail},
+		{"Unparsable", "df: /var/lib/etcddisk: No such file or directory\n", PreflightWarn},
+	}
+	for _, tc := range cases {
+		c := tc
+		t.Run(c.name, func(t *testing.T) {
+			g := NewGomegaWithT(t)
+			g.Expect(diskUsageResult("k8s-master-12345678-0", c.out).Status).To(Equal(c.expected))
+		})
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package kubernetesupgrade
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/aks-engine-azurestack/pkg/api"
+	"github.com/Azure/aks-engine-azurestack/pkg/kubernetes"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+)
+
+// RepairNode replaces the VM backing node vmName with a new VM created at the same index from the current api model.
+// Agent nodes are cordoned and drained before the VM is deleted and, once the new node is Ready, get back the custom
+// annotations, labels and taints of the replaced node unless PreserveNodesProperties is disabled in their pool.
+// Nodes of VMSS agent pools can't be repaired, their instances are not addressable by index.
+// A control plane node is only repaired if all the other control plane nodes are Ready.
+func (ku *Upgrader) RepairNode(ctx context.Context, vmName string) error {
+	poolName, index, err := ku.getNodePoolAndIndex(vmName)
+	if err != nil {
+		return err
+	}
+	nodeName := strings.ToLower(vmName)
+
+	client, err := ku.getKubernetesClient(10 * time.Second)
+	if err != nil {
+		return errors.Wrap(err, "getting a Kubernetes client")
+	}
+	// the node object is deleted along with the VM, take a snapshot of its properties first
+	oldNode, err := client.GetNode(nodeName)
+	if err != nil {
+		ku.logger.Warnf("Failed to get node %s, its custom annotations, labels and taints won't be restored: %v", nodeName, err)
+		oldNode = nil
+	}
+
+	if poolName == MasterPoolName {
+		if err = ku.checkOtherMastersReady(client, index); err != nil {
+			return err
+		}
+		upgradeMasterNode, err := ku.newUpgradeMasterNode()
+		if err != nil {
+			return err
+		}
+		ku.logger.Infof("Deleting master VM %s", vmName)
+		if err = upgradeMasterNode.DeleteNode(&vmName, false); err != nil {
+			return errors.Wrapf(err, "deleting master VM %s", vmName)
+		}
+		ku.logger.Infof("Creating master VM %s (index %d)", vmName, index)
+		if err = upgradeMasterNode.CreateNode(ctx, MasterPoolName, index); err != nil {
+			return errors.Wrapf(err, "creating master VM %s", vmName)
+		}
+		if err = upgradeMasterNode.Validate(&vmName); err != nil {
+			return errors.Wrapf(err, "validating master VM %s", vmName)
+		}
+		ku.logger.Infof("Node %s was repaired successfully", nodeName)
+		return nil
+	}
+
+	upgradeAgentNode, err := ku.newUpgradeAgentNode(poolName)
+	if err != nil {
+		return err
+	}
+	ku.logger.Infof("Draining and deleting agent VM %s", vmName)
+	if err = upgradeAgentNode.DeleteNode(&vmName, true); err != nil {
+		return errors.Wrapf(err, "deleting agent VM %s", vmName)
+	}
+	ku.logger.Infof("Creating agent VM %s (index %d)", vmName, index)
+	if err = upgradeAgentNode.CreateNode(ctx, poolName, index); err != nil {
+		return errors.Wrapf(err, "creating agent VM %s", vmName)
+	}
+	if err = upgradeAgentNode.Validate(&vmName); err != nil {
+		return errors.Wrapf(err, "validating agent VM %s", vmName)
+	}
+
+	agentPoolProfile := ku.DataModel.Properties.GetAgentPoolByName(poolName)
+	preserveNodesProperties := api.DefaultPreserveNodesProperties
+	if agentPoolProfile.PreserveNodesProperties != nil {
+		preserveNodesProperties = *agentPoolProfile.PreserveNodesProperties
+	}
+	if preserveNodesProperties && oldNode != nil {
+		removeNodeStatusTaints(oldNode)
+		ku.logger.Infof("Copying custom annotations, labels, taints to the repaired node %s...", nodeName)
+		getOldNode := func() (*v1.Node, error) {
+			return oldNode, nil
+		}
+		if err = ku.copyCustomPropertiesToNode(client, nodeName, getOldNode, nodeName); err != nil {
+			ku.logger.Warningf("Failed to copy custom annotations, labels, taints to the repaired node %s: %v", nodeName, err)
+		}
+	}
+	ku.logger.Infof("Node %s was repaired successfully", nodeName)
+	return nil
+}
+
+// checkOtherMastersReady returns an error unless every control plane node other than the one at index is Ready,
+// deleting a control plane node while another one is down could make etcd lose quorum
+func (ku *Upgrader) checkOtherMastersReady(client kubernetes.Client, index int) error {
+	prefix := ku.DataModel.Properties.GetMasterVMPrefix()
+	notReady := []string{}
+	for i := 0; i < ku.DataModel.Properties.MasterProfile.Count; i++ {
+		if i == index {
+			continue
+		}
+		name := strings.ToLower(prefix + strconv.Itoa(i))
+		node, err := client.GetNode(name)
+		if err != nil {
+			ku.logger.Warnf("Failed to get control plane node %s: %v", name, err)
+			notReady = append(notReady, name)
+			continue
+		}
+		if !kubernetes.IsNodeReady(node) {
+			notReady = append(notReady, name)
+		}
+	}
+	if len(notReady) > 0 {
+		return errors.Errorf("control plane nodes %s are not Ready, repairing another control plane node could make etcd lose quorum", strings.Join(notReady, ", "))
+	}
+	return nil
+}
+
+// getNodePoolAndIndex returns the pool name and the index of VM vmName,
+// the pool name of control plane VMs is MasterPoolName
+func (ku *Upgrader) getNodePoolAndIndex(vmName string) (string, int, error) {
+	props := ku.DataModel.Properties
+	if props.MasterProfile != nil {
+		if index, ok := parseVMIndex(vmName, props.GetMasterVMPrefix()); ok {
+			return MasterPoolName, index, nil
+		}
+	}
+	for i, pool := range props.AgentPoolProfiles {
+		index, ok := parseVMIndex(vmName, props.GetAgentVMPrefix(pool, i))
+		if !ok {
+			continue
+		}
+		if pool.IsVirtualMachineScaleSets() {
+			return "", 0, errors.Errorf("node %s belongs to VMSS node pool %s, only nodes of availability set node pools and control plane nodes can be repaired", vmName, pool.Name)
+		}
+		return pool.Name, index, nil
+	}
+	return "", 0, errors.Errorf("node %s was not found in any node pool of the api model", vmName)
+}
+
+// parseVMIndex returns the index of VM vmName if its name is prefix followed by an index
+func parseVMIndex(vmName, prefix string) (int, bool) {
+	if prefix == "" || !strings.HasPrefix(strings.ToLower(vmName), strings.ToLower(prefix)) {
+		return 0, false
+	}
+	index, err := strconv.Atoi(vmName[len(prefix):])
+	if err != nil || index < 0 {
+		return 0, false
+	}
+	return index, true
+}
+
+// removeNodeStatusTaints removes the taints added by Kubernetes to reflect the conditions of a node,
+// i.e. node.kubernetes.io/not-ready, those must not be carried over to a replacement node
+func removeNodeStatusTaints(node *v1.Node) {
+	taints := []v1.Taint{}
+	for _, taint := range node.Spec.Taints {
+		if strings.HasPrefix(taint.Key, "node.kubernetes.io/") || strings.HasPrefix(taint.Key, "node.cloudprovider.kubernetes.io/") {
+			continue
+		}
+		taints = append(taints, taint)
+	}
+	node.Spec.Taints = taints
+}
@@ -0,0 +1,193 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package kubernetesupgrade
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/Azure/aks-engine-azurestack/pkg/api"
+	"github.com/Azure/aks-engine-azurestack/pkg/armhelpers"
+	"github.com/Azure/aks-engine-azurestack/pkg/i18n"
+	. "github.com/onsi/gomega"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+)
+
+func newMockRepairNodeUpgrader(mockClient *armhelpers.MockAKSEngineClient) *Upgrader {
+	cs := api.CreateMockContainerService("testcluster", "", 3, 3, false)
+	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &api.AgentPoolProfile{
+		Name:                "vmsspool",
+		Count:               1,
+		VMSize:              "Standard_D2_v2",
+		OSType:              api.Linux,
+		AvailabilityProfile: api.VirtualMachineScaleSets,
+	})
+	u := &Upgrader{}
+	u.Init(&i18n.Translator{}, log.NewEntry(log.New()), ClusterTopology{}, mockClient, "", nil, nil, TestAKSEngineVersion, false)
+	u.DataModel = cs
+	u.ResourceGroup = "TestRg"
+	u.SubscriptionID = "DEC923E3-1EF1-4745-9516-37906D56DEC4"
+	return u
+}
+
+func TestGetNodePoolAndIndex(t *testing.T) {
+	g := NewGomegaWithT(t)
+	u := newMockRepairNodeUpgrader(&armhelpers.MockAKSEngineClient{})
+	clusterID := u.DataModel.Properties.GetClusterID()
+
+	pool, index, err := u.getNodePoolAndIndex(fmt.Sprintf("k8s-master-%s-2", clusterID))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(pool).To(Equal(MasterPoolName))
+	g.Expect(index).To(Equal(2))
+
+	pool, index, err = u.getNodePoolAndIndex(fmt.Sprintf("k8s-agentpool1-%s-11", clusterID))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(pool).To(Equal("agentpool1"))
+	g.Expect(index).To(Equal(11))
+
+	_, _, err = u.getNodePoolAndIndex(fmt.Sprintf("k8s-vmsspool-%s-vmss000000", clusterID))
+	g.Expect(err).To(HaveOccurred())
+
+	_, _, err = u.getNodePoolAndIndex(fmt.Sprintf("k8s-agentpool1-%s-abc", clusterID))
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(Equal(fmt.Sprintf("node k8s-agentpool1-%s-abc was not found in any node pool of the api model", clusterID)))
+}
+
+func TestRemoveNodeStatusTaints(t *testing.T) {
+	g := NewGomegaWithT(t)
+	node := &v1.Node{}
+	node.Spec.Taints = []v1.Taint{
+		{Key: "node.kubernetes.io/not-ready", Effect: v1.TaintEffectNoSchedule},
+		{Key: "node.cloudprovider.kubernetes.io/uninitialized", Effect: v1.TaintEffectNoSchedule},
+		{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule},
+	}
+	removeNodeStatusTaints(node)
+	g.Expect(node.Spec.Taints).To(Equal([]v1.Taint{{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule}}))
+}
+
+func TestRepairNode(t *testing.T) {
+	g := NewGomegaWithT(t)
+	defer os.RemoveAll("_output")
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var updated *v1.Node
+	mockClient := &armhelpers.MockAKSEngineClient{MockKubernetesClient: &armhelpers.MockKubernetesClient{}}
+	mockClient.MockKubernetesClient.GetNodeFunc = func(name string) (*v1.Node, error) {
+		node := &v1.Node{}
+		node.Name = name
+		node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}
+		mu.Lock()
+		defer mu.Unlock()
+		// the node only has custom properties until it is replaced, the drain of the node updates it
+		if updated == nil {
+			node.Labels = map[string]string{"custom": "label"}
+			node.Spec.Taints = []v1.Taint{{Key: "node.kubernetes.io/unreachable", Effect: v1.TaintEffectNoSchedule}}
+		}
+		return node, nil
+	}
+	mockClient.MockKubernetesClient.UpdateNodeFunc = func(node *v1.Node) (*v1.Node, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		updated = node
+		return node, nil
+	}
+	u := newMockRepairNodeUpgrader(mockClient)
+	clusterID := u.DataModel.Properties.GetClusterID()
+
+	err := u.RepairNode(ctx, fmt.Sprintf("k8s-agentpool1-%s-1", clusterID))
+	g.Expect(err).NotTo(HaveOccurred())
+	mu.Lock()
+	g.Expect(updated).NotTo(BeNil())
+	g.Expect(updated.Labels).To(HaveKeyWithValue("custom", "label"))
+	g.Expect(updated.Spec.Taints).To(BeEmpty())
+	g.Expect(updated.Spec.Unschedulable).To(BeFalse())
+	mu.Unlock()
+
+	err = u.RepairNode(ctx, fmt.Sprintf("k8s-master-%s-0", clusterID))
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// a control plane node is not repaired while another one is NotReady
+	getNode := mockClient.MockKubernetesClient.GetNodeFunc
+	notReadyMaster := fmt.Sprintf("k8s-master-%s-2", clusterID)
+	mockClient.MockKubernetesClient.GetNodeFunc = func(name string) (*v1.Node, error) {
+		node, err := getNode(name)
+		if name == notReadyMaster {
+			node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionFalse}}
+		}
+		return node, err
+	}
+	mockClient.FailDeleteVirtualMachine = true
+	err = u.RepairNode(ctx, fmt.Sprintf("k8s-master-%s-0", clusterID))
+	g.Expect(err).To(MatchError(fmt.Sprintf("control plane nodes %s are not Ready, repairing another control plane node could make etcd lose quorum", notReadyMaster)))
+	// the NotReady node itself can be repaired
+	err = u.RepairNode(ctx, notReadyMaster)
+	g.Expect(err).To(MatchError(fmt.Sprintf("deleting master VM %s: DeleteVirtualMachine failed", notReadyMaster)))
+	mockClient.MockKubernetesClient.GetNodeFunc = getNode
+	mockClient.FailDeleteVirtualMachine = false
+
+	err = u.RepairNode(ctx, fmt.Sprintf("k8s-vmsspool-%s-vmss000000", clusterID))
+	g.Expect(err).To(HaveOccurred())
+
+	mockClient.FailDeleteVirtualMachine = true
+	err = u.RepairNode(ctx, fmt.Sprintf("k8s-agentpool1-%s-1", clusterID))
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestRepairNodeCopyCustomPropertiesFromSnapshot(t *testing.T) {
+	g := NewGomegaWithT(t)
+	nodeName := "k8s-agentpool1-12345678-1"
+
+	// the replaced node no longer exists, only the snapshot taken before deleting its VM holds its properties
+	snapshot := &v1.Node{}
+	snapshot.Name = nodeName
+	snapshot.Annotations = map[string]string{"custom": "annotation"}
+	snapshot.Labels = map[string]string{"custom": "label", "kubernetes.io/hostname": nodeName}
+	snapshot.Spec.Taints = []v1.Taint{
+		{Key: "node.kubernetes.io/not-ready", Effect: v1.TaintEffectNoExecute},
+		{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule},
+	}
+	removeNodeStatusTaints(snapshot)
+
+	var mu sync.Mutex
+	var updated *v1.Node
+	mockClient := &armhelpers.MockAKSEngineClient{MockKubernetesClient: &armhelpers.MockKubernetesClient{}}
+	mockClient.MockKubernetesClient.GetNodeFunc = func(name string) (*v1.Node, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if updated != nil {
+			return updated.DeepCopy(), nil
+		}
+		node := &v1.Node{}
+		node.Name = name
+		node.Labels = map[string]string{"kubernetes.io/hostname": name}
+		node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}
+		return node, nil
+	}
+	mockClient.MockKubernetesClient.UpdateNodeFunc = func(node *v1.Node) (*v1.Node, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		updated = node.DeepCopy()
+		return node, nil
+	}
+	u := newMockRepairNodeUpgrader(mockClient)
+	client, err := u.getKubernetesClient(0)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	getOldNode := func() (*v1.Node, error) {
+		return snapshot, nil
+	}
+	g.Expect(u.copyCustomPropertiesToNode(client, nodeName, getOldNode, nodeName)).To(Succeed())
+	mu.Lock()
+	defer mu.Unlock()
+	g.Expect(updated).NotTo(BeNil())
+	g.Expect(updated.Annotations).To(HaveKeyWithValue("custom", "annotation"))
+	g.Expect(updated.Labels).To(HaveKeyWithValue("custom", "label"))
+	g.Expect(updated.Spec.Taints).To(Equal([]v1.Taint{{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule}}))
+	g.Expect(updated.Spec.Unschedulable).To(BeFalse())
+}
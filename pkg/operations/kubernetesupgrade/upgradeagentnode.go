@@ -43,6 +43,7 @@ type UpgradeAgentNode struct {
 	kubeConfig              string
 	timeout                 time.Duration
 	cordonDrainTimeout      time.Duration
+	abortOnDrainFailure     bool
 }
 
 // DeleteNode takes state/resources of the master/agent node from ListNodeResources
@@ -66,6 +67,12 @@ func (kan *UpgradeAgentNode) DeleteNode(vmName *string, drain bool) error {
 	if drain {
 		err = operations.SafelyDrainNodeWithClient(client, kan.logger, nodeName, kan.cordonDrainTimeout)
 		if err != nil {
+			if kan.abortOnDrainFailure {
+				// when several nodes are replaced at once, deleting a node whose pods could not be evicted
+				// (i.e. blocked by a PodDisruptionBudget) may take down more replicas than the budget allows
+				kan.logger.Errorf("Error draining agent VM %s. Aborting deletion. Error: %v", *vmName, err)
+				return errors.Wrapf(err, "draining node %s", nodeName)
+			}
 			kan.logger.Warningf("Error draining agent VM %s. Proceeding with deletion. Error: %v", *vmName, err)
 			// Proceed with deletion anyways
 		}
@@ -86,11 +93,21 @@ func (kan *UpgradeAgentNode) DeleteNode(vmName *string, drain bool) error {
 
 // CreateNode creates a new master/agent node with the targeted version of Kubernetes
 func (kan *UpgradeAgentNode) CreateNode(ctx context.Context, poolName string, agentNo int) error {
+	return kan.CreateNodes(ctx, poolName, agentNo, 1)
+}
+
+// CreateNodes creates count agent nodes with consecutive indexes, starting at agentNo, in a single deployment
+func (kan *UpgradeAgentNode) CreateNodes(ctx context.Context, poolName string, agentNo, count int) error {
 	poolCountParameter := kan.ParametersMap[poolName+"Count"].(map[string]interface{})
-	poolCountParameter["value"] = agentNo + 1
+	poolCountParameter["value"] = agentNo + count
 	agentCount := poolCountParameter["value"]
-	kan.logger.Infof("Agent pool: %s, set count to: %d temporarily during upgrade. Upgrading agent: %d",
-		poolName, agentCount, agentNo)
+	if count == 1 {
+		kan.logger.Infof("Agent pool: %s, set count to: %d temporarily during upgrade. Upgrading agent: %d",
+			poolName, agentCount, agentNo)
+	} else {
+		kan.logger.Infof("Agent pool: %s, set count to: %d temporarily during upgrade. Upgrading agents: %d to %d",
+			poolName, agentCount, agentNo, agentNo+count-1)
+	}
 
 	poolOffsetVarName := poolName + "Offset"
 	templateVariables := kan.TemplateMap["variables"].(map[string]interface{})
@@ -83,6 +83,13 @@ type UpgradeCluster struct {
 	Force              bool
 	ControlPlaneOnly   bool
 	CurrentVersion     string
+	State              *UpgradeState
+	MaxSurge           int
+	MaxUnavailable     int
+	// VMSSUpgradeStrategy is either VMSSUpgradeStrategyReplace (the default when empty) or VMSSUpgradeStrategyInPlace
+	VMSSUpgradeStrategy string
+	// BackupEtcd, if set, is called before the first control plane node is upgraded
+	BackupEtcd func() error
 }
 
 // MasterPoolName pool name
@@ -90,10 +97,6 @@ const MasterPoolName = "master"
 
 // UpgradeCluster runs the workflow to upgrade a Kubernetes cluster.
 func (uc *UpgradeCluster) UpgradeCluster(az armhelpers.AKSEngineClient, kubeConfig string, aksEngineVersion string) error {
-	uc.MasterVMs = &[]compute.VirtualMachine{}
-	uc.UpgradedMasterVMs = &[]compute.VirtualMachine{}
-	uc.AgentPools = make(map[string]*AgentPoolTopology)
-
 	var kubeClient kubernetes.Client
 	if az != nil {
 		timeout := time.Duration(60) * time.Minute
@@ -104,8 +107,8 @@ func (uc *UpgradeCluster) UpgradeCluster(az armhelpers.AKSEngineClient, kubeConf
 		kubeClient = k
 	}
 
-	if err := uc.setNodesToUpgrade(kubeClient, uc.ResourceGroup); err != nil {
-		return uc.Translator.Errorf("Error while querying ARM for resources: %+v", err)
+	if err := uc.LoadClusterTopology(kubeClient); err != nil {
+		return err
 	}
 
 	if kubeClient != nil {
@@ -159,6 +162,19 @@ func (uc *UpgradeCluster) UpgradeCluster(az armhelpers.AKSEngineClient, kubeConf
 	return nil
 }
 
+// LoadClusterTopology queries ARM, and the Kubernetes API if a client is provided,
+// to find out which cluster nodes are already running the target version and which ones have to be upgraded.
+func (uc *UpgradeCluster) LoadClusterTopology(kubeClient kubernetes.Client) error {
+	uc.MasterVMs = &[]compute.VirtualMachine{}
+	uc.UpgradedMasterVMs = &[]compute.VirtualMachine{}
+	uc.AgentPools = make(map[string]*AgentPoolTopology)
+
+	if err := uc.setNodesToUpgrade(kubeClient, uc.ResourceGroup); err != nil {
+		return uc.Translator.Errorf("Error while querying ARM for resources: %+v", err)
+	}
+	return nil
+}
+
 // SetClusterAutoscalerReplicaCount changes the replica count of a cluster-autoscaler deployment.
 func (uc *UpgradeCluster) SetClusterAutoscalerReplicaCount(kubeClient kubernetes.Client, replicaCount int32) (int32, error) {
 	if kubeClient == nil {
@@ -196,6 +212,11 @@ func (uc *UpgradeCluster) getUpgradeWorkflow(kubeConfig string, aksEngineVersion
 	u.Init(uc.Translator, uc.Logger, uc.ClusterTopology, uc.Client, kubeConfig, uc.StepTimeout, uc.CordonDrainTimeout, aksEngineVersion, uc.ControlPlaneOnly)
 	u.CurrentVersion = uc.CurrentVersion
 	u.Force = uc.Force
+	u.State = uc.State
+	u.MaxSurge = uc.MaxSurge
+	u.MaxUnavailable = uc.MaxUnavailable
+	u.VMSSUpgradeStrategy = uc.VMSSUpgradeStrategy
+	u.BackupEtcd = uc.BackupEtcd
 	return u
 }
 
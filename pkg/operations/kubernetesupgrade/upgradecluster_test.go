@@ -7,8 +7,10 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -142,6 +144,223 @@ var _ = Describe("Upgrade Kubernetes cluster tests", func() {
 		Expect(err.Error()).To(Equal("DeleteVirtualMachine failed"))
 	})
 
+	It("Should back up etcd before upgrading master nodes", func() {
+		cs := api.CreateMockContainerService("testcluster", upgradeVersion, 1, 1, false)
+		uc := UpgradeCluster{
+			Translator: &i18n.Translator{},
+			Logger:     log.NewEntry(log.New()),
+		}
+
+		mockClient := armhelpers.MockAKSEngineClient{}
+		mockClient.FailDeleteVirtualMachine = true
+		uc.Client = &mockClient
+
+		uc.ClusterTopology = ClusterTopology{}
+		uc.SubscriptionID = "DEC923E3-1EF1-4745-9516-37906D56DEC4"
+		uc.ResourceGroup = "TestRg"
+		uc.DataModel = cs
+		uc.NameSuffix = "12345678"
+		uc.AgentPoolsToUpgrade = map[string]bool{"agentpool1": true}
+
+		backups := 0
+		uc.BackupEtcd = func() error {
+			backups++
+			return errors.New("etcdctl snapshot save failed")
+		}
+		err := uc.UpgradeCluster(&mockClient, "kubeConfig", TestAKSEngineVersion)
+		Expect(err).To(MatchError("backing up etcd before upgrading master nodes: etcdctl snapshot save failed"))
+		Expect(backups).To(Equal(1))
+
+		// a failed backup stops the upgrade even with Force
+		uc.Force = true
+		err = uc.UpgradeCluster(&mockClient, "kubeConfig", TestAKSEngineVersion)
+		Expect(err).To(MatchError("backing up etcd before upgrading master nodes: etcdctl snapshot save failed"))
+		Expect(backups).To(Equal(2))
+
+		// the master VM is only deleted once the backup is done
+		uc.BackupEtcd = func() error {
+			backups++
+			return nil
+		}
+		err = uc.UpgradeCluster(&mockClient, "kubeConfig", TestAKSEngineVersion)
+		Expect(err).To(MatchError("DeleteVirtualMachine failed"))
+		Expect(backups).To(Equal(3))
+	})
+
+	It("Should not recreate VMs the upgrade journal marks as completed when resuming an upgrade", func() {
+		cs := api.CreateMockContainerService("testcluster", upgradeVersion, 1, 1, false)
+		masterVMName := fmt.Sprintf("%s-12345678-0", common.LegacyControlPlaneVMPrefix)
+		mockClient := armhelpers.MockAKSEngineClient{}
+		mockClient.FailDeleteVirtualMachine = true
+		mockClient.FakeListVirtualMachineResult = func() []compute.VirtualMachine {
+			return []compute.VirtualMachine{
+				mockClient.MakeFakeVirtualMachine(masterVMName, fmt.Sprintf("Kubernetes:%s", upgradeVersion)),
+			}
+		}
+		newUpgradeCluster := func() UpgradeCluster {
+			uc := UpgradeCluster{
+				Translator:       &i18n.Translator{},
+				Logger:           log.NewEntry(log.New()),
+				Client:           &mockClient,
+				Force:            true,
+				ControlPlaneOnly: true,
+			}
+			uc.ClusterTopology = ClusterTopology{}
+			uc.SubscriptionID = "DEC923E3-1EF1-4745-9516-37906D56DEC4"
+			uc.ResourceGroup = "TestRg"
+			uc.DataModel = cs
+			uc.NameSuffix = "12345678"
+			uc.AgentPoolsToUpgrade = map[string]bool{"agentpool1": true}
+			return uc
+		}
+
+		uc := newUpgradeCluster()
+		err := uc.UpgradeCluster(&mockClient, "kubeConfig", TestAKSEngineVersion)
+		Expect(err).To(MatchError("DeleteVirtualMachine failed"))
+
+		dir, err := os.MkdirTemp("", "upgradestate")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		state := NewUpgradeState(filepath.Join(dir, UpgradeStateFilename), upgradeVersion, true, true)
+		Expect(state.SetNodeStep(masterVMName, MasterPoolName, 0, NodeUpgradeStepCompleted)).To(Succeed())
+
+		uc = newUpgradeCluster()
+		uc.State = state
+		err = uc.UpgradeCluster(&mockClient, "kubeConfig", TestAKSEngineVersion)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*uc.MasterVMs).To(HaveLen(1))
+	})
+
+	It("Should create max-surge extra nodes when upgrading availability set agent pools", func() {
+		cs := api.CreateMockContainerService("testcluster", upgradeVersion, 1, 4, false)
+		nameSuffix := cs.Properties.GetClusterID()
+		mockClient := armhelpers.MockAKSEngineClient{}
+		mockClient.FakeListVirtualMachineResult = func() []compute.VirtualMachine {
+			vms := []compute.VirtualMachine{
+				mockClient.MakeFakeVirtualMachine(fmt.Sprintf("%s-%s-0", common.LegacyControlPlaneVMPrefix, nameSuffix), fmt.Sprintf("Kubernetes:%s", upgradeVersion)),
+			}
+			for i := 0; i < 4; i++ {
+				vm := mockClient.MakeFakeVirtualMachine(fmt.Sprintf("k8s-agentpool1-%s-%d", nameSuffix, i), fmt.Sprintf("Kubernetes:%s", upgradeVersion))
+				vm.StorageProfile.OsDisk.OsType = compute.Linux
+				vms = append(vms, vm)
+			}
+			return vms
+		}
+		dir, err := os.MkdirTemp("", "upgradestate")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		uc := UpgradeCluster{
+			Translator:     &i18n.Translator{},
+			Logger:         log.NewEntry(log.New()),
+			Client:         &mockClient,
+			Force:          true,
+			MaxSurge:       2,
+			MaxUnavailable: 1,
+			State:          NewUpgradeState(filepath.Join(dir, UpgradeStateFilename), upgradeVersion, true, false),
+		}
+		uc.ClusterTopology = ClusterTopology{}
+		uc.SubscriptionID = "DEC923E3-1EF1-4745-9516-37906D56DEC4"
+		uc.ResourceGroup = "TestRg"
+		uc.DataModel = cs
+		uc.NameSuffix = nameSuffix
+		uc.AgentPoolsToUpgrade = map[string]bool{"agentpool1": true}
+
+		err = uc.UpgradeCluster(&mockClient, "kubeConfig", TestAKSEngineVersion)
+		Expect(err).NotTo(HaveOccurred())
+
+		agentIndexes := []int{}
+		for _, node := range uc.State.Nodes {
+			if node.Pool == "agentpool1" {
+				Expect(node.Step).To(Equal(NodeUpgradeStepCompleted))
+				agentIndexes = append(agentIndexes, node.Index)
+			}
+		}
+		// 4 upgraded nodes plus 2 extra nodes
+		Expect(agentIndexes).To(ConsistOf(0, 1, 2, 3, 4, 5))
+	})
+
+	It("Should copy the custom properties of the nodes recreated in place with max-surge 0", func() {
+		cs := api.CreateMockContainerService("testcluster", upgradeVersion, 1, 2, false)
+		nameSuffix := cs.Properties.GetClusterID()
+		mockClient := armhelpers.MockAKSEngineClient{MockKubernetesClient: &armhelpers.MockKubernetesClient{}}
+		agentNames := []string{}
+		mockClient.FakeListVirtualMachineResult = func() []compute.VirtualMachine {
+			vms := []compute.VirtualMachine{
+				mockClient.MakeFakeVirtualMachine(fmt.Sprintf("%s-%s-0", common.LegacyControlPlaneVMPrefix, nameSuffix), fmt.Sprintf("Kubernetes:%s", upgradeVersion)),
+			}
+			for i := 0; i < 2; i++ {
+				vm := mockClient.MakeFakeVirtualMachine(fmt.Sprintf("k8s-agentpool1-%s-%d", nameSuffix, i), fmt.Sprintf("Kubernetes:%s", upgradeVersion))
+				vm.StorageProfile.OsDisk.OsType = compute.Linux
+				vms = append(vms, vm)
+			}
+			return vms
+		}
+		for i := 0; i < 2; i++ {
+			agentNames = append(agentNames, fmt.Sprintf("k8s-agentpool1-%s-%d", nameSuffix, i))
+		}
+
+		// the old nodes carry a custom label naming them, the recreated nodes start without it
+		var mu sync.Mutex
+		nodes := map[string]*v1.Node{}
+		recreated := map[string]bool{}
+		mockClient.MockKubernetesClient.GetNodeFunc = func(name string) (*v1.Node, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if node, ok := nodes[name]; ok {
+				return node.DeepCopy(), nil
+			}
+			node := &v1.Node{}
+			node.Name = name
+			node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}
+			if !recreated[name] {
+				node.Labels = map[string]string{"custom": name}
+			}
+			nodes[name] = node
+			return node.DeepCopy(), nil
+		}
+		mockClient.MockKubernetesClient.UpdateNodeFunc = func(node *v1.Node) (*v1.Node, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			nodes[node.Name] = node.DeepCopy()
+			return node, nil
+		}
+		mockClient.MockKubernetesClient.DeleteNodeFunc = func(name string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			delete(nodes, name)
+			recreated[name] = true
+			return nil
+		}
+
+		uc := UpgradeCluster{
+			Translator:     &i18n.Translator{},
+			Logger:         log.NewEntry(log.New()),
+			Client:         &mockClient,
+			Force:          true,
+			MaxSurge:       0,
+			MaxUnavailable: 1,
+		}
+		uc.ClusterTopology = ClusterTopology{}
+		uc.SubscriptionID = "DEC923E3-1EF1-4745-9516-37906D56DEC4"
+		uc.ResourceGroup = "TestRg"
+		uc.DataModel = cs
+		uc.NameSuffix = nameSuffix
+		uc.AgentPoolsToUpgrade = map[string]bool{"agentpool1": true}
+
+		err := uc.UpgradeCluster(&mockClient, "kubeConfig", TestAKSEngineVersion)
+		Expect(err).NotTo(HaveOccurred())
+
+		mu.Lock()
+		defer mu.Unlock()
+		for _, name := range agentNames {
+			Expect(recreated[name]).To(BeTrue())
+			Expect(nodes).To(HaveKey(name))
+			Expect(nodes[name].Labels).To(HaveKeyWithValue("custom", name))
+			Expect(nodes[name].Spec.Unschedulable).To(BeFalse())
+		}
+	})
+
 	It("Should return error message when failing to deploy template during upgrade operation", func() {
 		cs := api.CreateMockContainerService("testcluster", upgradeVersion, 1, 1, false)
 		uc := UpgradeCluster{
@@ -162,7 +381,9 @@ var _ = Describe("Upgrade Kubernetes cluster tests", func() {
 
 		err := uc.UpgradeCluster(&mockClient, "kubeConfig", TestAKSEngineVersion)
 		Expect(err).To(HaveOccurred())
-		Expect(err.Error()).To(Equal("DeployTemplate failed"))
+		var deploymentErr *armhelpers.DeploymentError
+		Expect(errors.As(err, &deploymentErr)).To(BeTrue())
+		Expect(deploymentErr.TopError).To(MatchError("DeployTemplate failed"))
 	})
 
 	It("Should return error message when failing to get a virtual machine during upgrade operation", func() {
@@ -1022,6 +1243,111 @@ var _ = Describe("Upgrade Kubernetes cluster tests", func() {
 		Expect(err).To(HaveOccurred())
 	})
 
+	It("Tests upgradeAgentScaleSetsInPlace", func() {
+		ctx := context.Background()
+		cs := api.CreateMockContainerService("testcluster", upgradeVersion, 1, 3, false)
+		goalVersion := cs.Properties.OrchestratorProfile.OrchestratorVersion
+		dir, err := os.MkdirTemp("", "upgradestate")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		var mu sync.Mutex
+		unschedulable := map[string]bool{}
+		mockClient := armhelpers.MockAKSEngineClient{MockKubernetesClient: &armhelpers.MockKubernetesClient{}}
+		mockClient.MockKubernetesClient.GetNodeFunc = func(name string) (*v1.Node, error) {
+			node := &v1.Node{}
+			node.Name = name
+			node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}
+			node.Status.NodeInfo.KubeletVersion = "v" + goalVersion
+			return node, nil
+		}
+		mockClient.MockKubernetesClient.UpdateNodeFunc = func(node *v1.Node) (*v1.Node, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			unschedulable[node.Name] = node.Spec.Unschedulable
+			return node, nil
+		}
+		mockClient.FakeGetVirtualMachineScaleSetResult = func(name string) compute.VirtualMachineScaleSet {
+			return compute.VirtualMachineScaleSet{
+				Name: &name,
+				Tags: map[string]*string{"orchestrator": to.StringPtr("Kubernetes:" + goalVersion)},
+			}
+		}
+
+		u := &Upgrader{}
+		u.Init(&i18n.Translator{}, log.NewEntry(log.New()), ClusterTopology{}, &mockClient, "", nil, nil, TestAKSEngineVersion, false)
+		u.DataModel = cs
+		u.ResourceGroup = "TestRg"
+		u.MaxUnavailable = 2
+		u.State = NewUpgradeState(filepath.Join(dir, UpgradeStateFilename), goalVersion, false, false)
+		u.AgentPoolScaleSetsToUpgrade = []AgentPoolScaleSet{
+			{
+				Name: "k8s-agentpool1-12345678-vmss",
+				VMsToUpgrade: []AgentPoolScaleSetVM{
+					{Name: "k8s-agentpool1-12345678-vmss000000", InstanceID: "0"},
+					{Name: "k8s-agentpool1-12345678-vmss000001", InstanceID: "1"},
+					{Name: "k8s-agentpool1-12345678-vmss000002", InstanceID: "2"},
+				},
+			},
+		}
+
+		err = u.upgradeAgentScaleSetsInPlace(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		for _, vm := range u.AgentPoolScaleSetsToUpgrade[0].VMsToUpgrade {
+			Expect(u.State.NodeStep(vm.Name)).To(Equal(NodeUpgradeStepCompleted))
+			Expect(unschedulable).To(HaveKeyWithValue(vm.Name, false))
+		}
+
+		mockClient.FakeGetVirtualMachineScaleSetResult = func(name string) compute.VirtualMachineScaleSet {
+			return compute.VirtualMachineScaleSet{
+				Name: &name,
+				Tags: map[string]*string{"orchestrator": to.StringPtr("Kubernetes:1.0.0")},
+			}
+		}
+		u.State = nil
+		err = u.upgradeAgentScaleSetsInPlace(ctx)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal(fmt.Sprintf("the model of VMSS k8s-agentpool1-12345678-vmss targets Kubernetes:1.0.0 instead of Kubernetes %s", goalVersion)))
+
+		// the instances whose image changes are reimaged by the update, only the others are reimaged explicitly
+		image := func(version string) *compute.ImageReference {
+			return &compute.ImageReference{Publisher: to.StringPtr("microsoft-aks"), Offer: to.StringPtr("aks"), Sku: to.StringPtr("aks-engine-ubuntu-2004"), Version: to.StringPtr(version)}
+		}
+		mockClient.FakeGetVirtualMachineScaleSetResult = func(name string) compute.VirtualMachineScaleSet {
+			return compute.VirtualMachineScaleSet{
+				Name: &name,
+				Tags: map[string]*string{"orchestrator": to.StringPtr("Kubernetes:" + goalVersion)},
+				VirtualMachineScaleSetProperties: &compute.VirtualMachineScaleSetProperties{
+					VirtualMachineProfile: &compute.VirtualMachineScaleSetVMProfile{
+						StorageProfile: &compute.VirtualMachineScaleSetStorageProfile{ImageReference: image("2022.01.01")},
+					},
+				},
+			}
+		}
+		mockClient.FakeListVirtualMachineScaleSetVMsResult = func() []compute.VirtualMachineScaleSetVM {
+			vms := []compute.VirtualMachineScaleSetVM{}
+			for i, version := range []string{"2021.01.01", "2022.01.01", "2021.01.01"} {
+				vm := mockClient.MakeFakeVirtualMachineScaleSetVMWithGivenName("Kubernetes:"+upgradeVersion, fmt.Sprintf("k8s-agentpool1-12345678-vmss00000%d", i))
+				vm.InstanceID = to.StringPtr(strconv.Itoa(i))
+				vm.StorageProfile = &compute.StorageProfile{ImageReference: image(version)}
+				vms = append(vms, vm)
+			}
+			return vms
+		}
+		mockClient.ReimagedVirtualMachineScaleSetVMs = nil
+		u.State = NewUpgradeState(filepath.Join(dir, UpgradeStateFilename), goalVersion, false, false)
+		err = u.upgradeAgentScaleSetsInPlace(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mockClient.ReimagedVirtualMachineScaleSetVMs).To(Equal([]string{"1"}))
+		u.State = nil
+
+		mockClient.FakeGetVirtualMachineScaleSetResult = nil
+		mockClient.FailReimageVirtualMachineScaleSetVMs = true
+		err = u.upgradeAgentScaleSetsInPlace(ctx)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal("ReimageVirtualMachineScaleSetVMs failed"))
+	})
+
 	It("Tests CopyCustomPropertiesToNewNode", func() {
 		u := &Upgrader{}
 
@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
+	"sort"
 	"strings"
 	"time"
 
@@ -21,9 +22,11 @@ import (
 	"github.com/Azure/aks-engine-azurestack/pkg/i18n"
 	"github.com/Azure/aks-engine-azurestack/pkg/kubernetes"
 	"github.com/Azure/aks-engine-azurestack/pkg/operations"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-12-01/compute"
 	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	policyv1beta1 "k8s.io/api/policy/v1beta1"
@@ -44,8 +47,23 @@ type Upgrader struct {
 	CurrentVersion     string
 	ControlPlaneOnly   bool
 	Force              bool
+	State              *UpgradeState
+	MaxSurge           int
+	MaxUnavailable     int
+	// VMSSUpgradeStrategy is either VMSSUpgradeStrategyReplace (the default when empty) or VMSSUpgradeStrategyInPlace
+	VMSSUpgradeStrategy string
+	// BackupEtcd, if set, is called before the first control plane node is upgraded
+	BackupEtcd func() error
 }
 
+const (
+	// VMSSUpgradeStrategyReplace upgrades VMSS agent pools by adding a new instance and deleting an old one, one instance at a time
+	VMSSUpgradeStrategyReplace = "replace"
+	// VMSSUpgradeStrategyInPlace upgrades VMSS agent pools by applying the updated VMSS model to the existing instances and
+	// reimaging them, which keeps instance IDs, NICs and data disks
+	VMSSUpgradeStrategyInPlace = "in-place"
+)
+
 type vmStatus int
 
 const (
@@ -184,63 +202,13 @@ func (ku *Upgrader) upgradeMasterNodes(ctx context.Context) error {
 		return nil
 	}
 	ku.logger.Infof("Master nodes StorageProfile: %s", ku.ClusterTopology.DataModel.Properties.MasterProfile.StorageProfile)
+	ku.logger.Infof("Prepping master nodes for upgrade...")
 	// Upgrade Master VMs
-	templateMap, parametersMap, err := ku.generateUpgradeTemplate(ku.ClusterTopology.DataModel, ku.AKSEngineVersion)
+	upgradeMasterNode, err := ku.newUpgradeMasterNode()
 	if err != nil {
-		return ku.Translator.Errorf("error generating upgrade template: %s", err.Error())
-	}
-
-	ku.logger.Infof("Prepping master nodes for upgrade...")
-
-	transformer := &transform.Transformer{
-		Translator: ku.Translator,
-	}
-
-	if ku.ClusterTopology.DataModel.Properties.OrchestratorProfile.KubernetesConfig.PrivateJumpboxProvision() {
-		err = transformer.RemoveJumpboxResourcesFromTemplate(ku.logger, templateMap)
-		if err != nil {
-			return ku.Translator.Errorf("error removing jumpbox resources from template: %s", err.Error())
-		}
-	}
-
-	if ku.DataModel.Properties.OrchestratorProfile.KubernetesConfig.LoadBalancerSku == api.StandardLoadBalancerSku {
-		err = transformer.NormalizeForK8sSLBScalingOrUpgrade(ku.logger, templateMap)
-		if err != nil {
-			return ku.Translator.Errorf("error normalizing upgrade template for SLB: %s", err.Error())
-		}
-	}
-
-	if to.Bool(ku.DataModel.Properties.OrchestratorProfile.KubernetesConfig.EnableEncryptionWithExternalKms) {
-		err = transformer.RemoveKMSResourcesFromTemplate(ku.logger, templateMap)
-		if err != nil {
-			return ku.Translator.Errorf("error removing KMS resources from template: %s", err.Error())
-		}
-	}
-
-	if err = transformer.NormalizeResourcesForK8sMasterUpgrade(ku.logger, templateMap, ku.DataModel.Properties.MasterProfile.IsManagedDisks(), nil); err != nil {
-		ku.logger.Error(err.Error())
 		return err
 	}
 
-	transformer.RemoveImmutableResourceProperties(ku.logger, templateMap)
-
-	upgradeMasterNode := UpgradeMasterNode{
-		Translator: ku.Translator,
-		logger:     ku.logger,
-	}
-	upgradeMasterNode.TemplateMap = templateMap
-	upgradeMasterNode.ParametersMap = parametersMap
-	upgradeMasterNode.UpgradeContainerService = ku.ClusterTopology.DataModel
-	upgradeMasterNode.ResourceGroup = ku.ClusterTopology.ResourceGroup
-	upgradeMasterNode.SubscriptionID = ku.ClusterTopology.SubscriptionID
-	upgradeMasterNode.Client = ku.Client
-	upgradeMasterNode.kubeConfig = ku.kubeConfig
-	if ku.stepTimeout == nil {
-		upgradeMasterNode.timeout = defaultTimeout
-	} else {
-		upgradeMasterNode.timeout = *ku.stepTimeout
-	}
-
 	expectedMasterCount := ku.ClusterTopology.DataModel.Properties.MasterProfile.Count
 	mastersUpgradedCount := len(*ku.ClusterTopology.UpgradedMasterVMs)
 	mastersToUgradeCount := expectedMasterCount - mastersUpgradedCount
@@ -249,6 +217,12 @@ func (ku *Upgrader) upgradeMasterNodes(ctx context.Context) error {
 	ku.logger.Infof("Master nodes that need to be upgraded: %d", mastersToUgradeCount)
 	ku.logger.Infof("Master nodes that have been upgraded: %d", mastersUpgradedCount)
 
+	if mastersToUgradeCount > 0 && ku.BackupEtcd != nil {
+		if err = ku.BackupEtcd(); err != nil {
+			return errors.Wrap(err, "backing up etcd before upgrading master nodes")
+		}
+	}
+
 	ku.logger.Infof("Starting upgrade of master nodes...")
 
 	masterNodesInCluster := len(*ku.ClusterTopology.MasterVMs) + mastersUpgradedCount
@@ -264,6 +238,35 @@ func (ku *Upgrader) upgradeMasterNodes(ctx context.Context) error {
 			"Found missing master VMs in the cluster. Reconstructing names of missing master VMs for recreation during upgrade...")
 	}
 
+	// Replacement VMs created by an interrupted upgrade carry the new version tag
+	// but may have never joined the cluster, validate them before moving on.
+	for _, vm := range *ku.ClusterTopology.UpgradedMasterVMs {
+		step := ku.State.NodeStep(*vm.Name)
+		if step != NodeUpgradeStepCreating && step != NodeUpgradeStepCreated {
+			continue
+		}
+		masterIndex, _ := utils.GetVMNameIndex(vm.StorageProfile.OsDisk.OsType, *vm.Name)
+		if vm.VirtualMachineProperties != nil && to.String(vm.VirtualMachineProperties.ProvisioningState) == "Failed" {
+			ku.logger.Infof("Recreating master VM %s left in a failed provisioning state by the interrupted upgrade", *vm.Name)
+			if err = upgradeMasterNode.DeleteNode(vm.Name, false); err != nil {
+				ku.logger.Infof("Error deleting master VM: %s, err: %v", *vm.Name, err)
+				return err
+			}
+			ku.recordNodeStep(*vm.Name, MasterPoolName, masterIndex, NodeUpgradeStepCreating)
+			if err = upgradeMasterNode.CreateNode(ctx, "master", masterIndex); err != nil {
+				ku.logger.Infof("Error creating upgraded master VM: %s", *vm.Name)
+				return err
+			}
+			ku.recordNodeStep(*vm.Name, MasterPoolName, masterIndex, NodeUpgradeStepCreated)
+		}
+		ku.logger.Infof("Validating master VM %s created by the interrupted upgrade", *vm.Name)
+		if err = upgradeMasterNode.Validate(vm.Name); err != nil {
+			ku.logger.Infof("Error validating upgraded master VM: %s", *vm.Name)
+			return err
+		}
+		ku.recordNodeStep(*vm.Name, MasterPoolName, masterIndex, NodeUpgradeStepCompleted)
+	}
+
 	existingMastersIndex := make(map[int]bool)
 
 	for _, vm := range *ku.ClusterTopology.MasterVMs {
@@ -283,12 +286,15 @@ func (ku *Upgrader) upgradeMasterNodes(ctx context.Context) error {
 		}
 
 		ku.logger.Infof("Creating upgraded master VM with index: %d", masterIndexToCreate)
+		masterVMName := fmt.Sprintf("%s%d", ku.DataModel.Properties.GetMasterVMPrefix(), masterIndexToCreate)
 
+		ku.recordNodeStep(masterVMName, MasterPoolName, masterIndexToCreate, NodeUpgradeStepCreating)
 		err = upgradeMasterNode.CreateNode(ctx, "master", masterIndexToCreate)
 		if err != nil {
 			ku.logger.Infof("Error creating upgraded master VM with index: %d", masterIndexToCreate)
 			return err
 		}
+		ku.recordNodeStep(masterVMName, MasterPoolName, masterIndexToCreate, NodeUpgradeStepCreated)
 
 		tempVMName := ""
 		err = upgradeMasterNode.Validate(&tempVMName)
@@ -296,6 +302,7 @@ func (ku *Upgrader) upgradeMasterNodes(ctx context.Context) error {
 			ku.logger.Infof("Error validating upgraded master VM with index: %d", masterIndexToCreate)
 			return err
 		}
+		ku.recordNodeStep(masterVMName, MasterPoolName, masterIndexToCreate, NodeUpgradeStepCompleted)
 
 		existingMastersIndex[masterIndexToCreate] = true
 	}
@@ -309,27 +316,37 @@ func (ku *Upgrader) upgradeMasterNodes(ctx context.Context) error {
 	}
 
 	for _, vm := range *ku.ClusterTopology.MasterVMs {
-		ku.logger.Infof("Upgrading Master VM: %s", *vm.Name)
-
 		masterIndex, _ := utils.GetVMNameIndex(vm.StorageProfile.OsDisk.OsType, *vm.Name)
 
+		if ku.State.NodeStep(*vm.Name) == NodeUpgradeStepCompleted {
+			ku.logger.Infof("Master VM: %s was upgraded by the interrupted upgrade, skipping", *vm.Name)
+			upgradedMastersIndex[masterIndex] = true
+			continue
+		}
+		ku.logger.Infof("Upgrading Master VM: %s", *vm.Name)
+
+		ku.recordNodeStep(*vm.Name, MasterPoolName, masterIndex, NodeUpgradeStepDeleting)
 		err = upgradeMasterNode.DeleteNode(vm.Name, false)
 		if err != nil {
 			ku.logger.Infof("Error deleting master VM: %s, err: %v", *vm.Name, err)
 			return err
 		}
+		ku.recordNodeStep(*vm.Name, MasterPoolName, masterIndex, NodeUpgradeStepDeleted)
 
+		ku.recordNodeStep(*vm.Name, MasterPoolName, masterIndex, NodeUpgradeStepCreating)
 		err = upgradeMasterNode.CreateNode(ctx, "master", masterIndex)
 		if err != nil {
 			ku.logger.Infof("Error creating upgraded master VM: %s", *vm.Name)
 			return err
 		}
+		ku.recordNodeStep(*vm.Name, MasterPoolName, masterIndex, NodeUpgradeStepCreated)
 
 		err = upgradeMasterNode.Validate(vm.Name)
 		if err != nil {
 			ku.logger.Infof("Error validating upgraded master VM: %s", *vm.Name)
 			return err
 		}
+		ku.recordNodeStep(*vm.Name, MasterPoolName, masterIndex, NodeUpgradeStepCompleted)
 
 		upgradedMastersIndex[masterIndex] = true
 	}
@@ -337,46 +354,73 @@ func (ku *Upgrader) upgradeMasterNodes(ctx context.Context) error {
 	return nil
 }
 
-func (ku *Upgrader) upgradeAgentPools(ctx context.Context) error {
-	for _, agentPool := range ku.ClusterTopology.AgentPools {
-		// Upgrade Agent VMs
-		templateMap, parametersMap, err := ku.generateUpgradeTemplate(ku.ClusterTopology.DataModel, ku.AKSEngineVersion)
-		if err != nil {
-			ku.logger.Errorf("Error generating upgrade template: %v", err)
-			return ku.Translator.Errorf("Error generating upgrade template: %s", err.Error())
-		}
+// newUpgradeMasterNode generates the template deploying the master VMs of the current api model
+func (ku *Upgrader) newUpgradeMasterNode() (*UpgradeMasterNode, error) {
+	templateMap, parametersMap, err := ku.generateUpgradeTemplate(ku.ClusterTopology.DataModel, ku.AKSEngineVersion)
+	if err != nil {
+		return nil, ku.Translator.Errorf("error generating upgrade template: %s", err.Error())
+	}
 
-		ku.logger.Infof("Prepping agent pool '%s' for upgrade...", *agentPool.Name)
+	transformer := &transform.Transformer{
+		Translator: ku.Translator,
+	}
 
-		preservePools := map[string]bool{*agentPool.Name: true}
-		transformer := &transform.Transformer{
-			Translator: ku.Translator,
+	if ku.ClusterTopology.DataModel.Properties.OrchestratorProfile.KubernetesConfig.PrivateJumpboxProvision() {
+		err = transformer.RemoveJumpboxResourcesFromTemplate(ku.logger, templateMap)
+		if err != nil {
+			return nil, ku.Translator.Errorf("error removing jumpbox resources from template: %s", err.Error())
 		}
+	}
 
-		if ku.ClusterTopology.DataModel.Properties.OrchestratorProfile.KubernetesConfig.PrivateJumpboxProvision() {
-			err = transformer.RemoveJumpboxResourcesFromTemplate(ku.logger, templateMap)
-			if err != nil {
-				return ku.Translator.Errorf("error removing jumpbox resources from template: %s", err.Error())
-			}
+	if ku.DataModel.Properties.OrchestratorProfile.KubernetesConfig.LoadBalancerSku == api.StandardLoadBalancerSku {
+		err = transformer.NormalizeForK8sSLBScalingOrUpgrade(ku.logger, templateMap)
+		if err != nil {
+			return nil, ku.Translator.Errorf("error normalizing upgrade template for SLB: %s", err.Error())
 		}
+	}
 
-		var isMasterManagedDisk bool
-		if ku.DataModel.Properties.MasterProfile != nil {
-			isMasterManagedDisk = ku.DataModel.Properties.MasterProfile.IsManagedDisks()
+	if to.Bool(ku.DataModel.Properties.OrchestratorProfile.KubernetesConfig.EnableEncryptionWithExternalKms) {
+		err = transformer.RemoveKMSResourcesFromTemplate(ku.logger, templateMap)
+		if err != nil {
+			return nil, ku.Translator.Errorf("error removing KMS resources from template: %s", err.Error())
 		}
+	}
 
-		if ku.DataModel.Properties.OrchestratorProfile.KubernetesConfig.LoadBalancerSku == api.StandardLoadBalancerSku {
-			err = transformer.NormalizeForK8sSLBScalingOrUpgrade(ku.logger, templateMap)
-			if err != nil {
-				return ku.Translator.Errorf("error normalizing upgrade template for SLB: %s", err.Error())
-			}
-		}
-		if err = transformer.NormalizeResourcesForK8sAgentUpgrade(ku.logger, templateMap, isMasterManagedDisk, preservePools); err != nil {
-			ku.logger.Errorf(err.Error())
-			return ku.Translator.Errorf("Error generating upgrade template: %s", err.Error())
-		}
+	if err = transformer.NormalizeResourcesForK8sMasterUpgrade(ku.logger, templateMap, ku.DataModel.Properties.MasterProfile.IsManagedDisks(), nil); err != nil {
+		ku.logger.Error(err.Error())
+		return nil, err
+	}
 
-		transformer.RemoveImmutableResourceProperties(ku.logger, templateMap)
+	transformer.RemoveImmutableResourceProperties(ku.logger, templateMap)
+
+	upgradeMasterNode := &UpgradeMasterNode{
+		Translator: ku.Translator,
+		logger:     ku.logger,
+	}
+	upgradeMasterNode.TemplateMap = templateMap
+	upgradeMasterNode.ParametersMap = parametersMap
+	upgradeMasterNode.UpgradeContainerService = ku.ClusterTopology.DataModel
+	upgradeMasterNode.ResourceGroup = ku.ClusterTopology.ResourceGroup
+	upgradeMasterNode.SubscriptionID = ku.ClusterTopology.SubscriptionID
+	upgradeMasterNode.Client = ku.Client
+	upgradeMasterNode.kubeConfig = ku.kubeConfig
+	if ku.stepTimeout == nil {
+		upgradeMasterNode.timeout = defaultTimeout
+	} else {
+		upgradeMasterNode.timeout = *ku.stepTimeout
+	}
+
+	return upgradeMasterNode, nil
+}
+
+func (ku *Upgrader) upgradeAgentPools(ctx context.Context) error {
+	for _, agentPool := range ku.ClusterTopology.AgentPools {
+		ku.logger.Infof("Prepping agent pool '%s' for upgrade...", *agentPool.Name)
+		// Upgrade Agent VMs
+		upgradeAgentNode, err := ku.newUpgradeAgentNode(*agentPool.Name)
+		if err != nil {
+			return err
+		}
 
 		var agentCount int
 		var agentPoolProfile *api.AgentPoolProfile
@@ -393,28 +437,6 @@ func (ku *Upgrader) upgradeAgentPools(ctx context.Context) error {
 			return nil
 		}
 
-		upgradeAgentNode := UpgradeAgentNode{
-			Translator: ku.Translator,
-			logger:     ku.logger,
-		}
-		upgradeAgentNode.TemplateMap = templateMap
-		upgradeAgentNode.ParametersMap = parametersMap
-		upgradeAgentNode.UpgradeContainerService = ku.ClusterTopology.DataModel
-		upgradeAgentNode.SubscriptionID = ku.ClusterTopology.SubscriptionID
-		upgradeAgentNode.ResourceGroup = ku.ClusterTopology.ResourceGroup
-		upgradeAgentNode.Client = ku.Client
-		upgradeAgentNode.kubeConfig = ku.kubeConfig
-		if ku.stepTimeout == nil {
-			upgradeAgentNode.timeout = defaultTimeout
-		} else {
-			upgradeAgentNode.timeout = *ku.stepTimeout
-		}
-		if ku.cordonDrainTimeout == nil {
-			upgradeAgentNode.cordonDrainTimeout = defaultCordonDrainTimeout
-		} else {
-			upgradeAgentNode.cordonDrainTimeout = *ku.cordonDrainTimeout
-		}
-
 		agentVMs := make(map[int]*vmInfo)
 		// Go over upgraded VMs and verify provisioning state
 		// per https://docs.microsoft.com/en-us/rest/api/compute/virtualmachines/virtualmachines-state :
@@ -435,6 +457,14 @@ func (ku *Upgrader) upgradeAgentPools(ctx context.Context) error {
 
 			switch vmProvisioningState {
 			case "Creating", "Updating", "Succeeded":
+				if step := ku.State.NodeStep(*vm.Name); step == NodeUpgradeStepCreating || step == NodeUpgradeStepCreated {
+					ku.logger.Infof("Validating agent VM %s created by the interrupted upgrade", *vm.Name)
+					if err = upgradeAgentNode.Validate(vm.Name); err != nil {
+						ku.logger.Errorf("Error validating upgraded agent VM %s: %v", *vm.Name, err)
+						return err
+					}
+					ku.recordNodeStep(*vm.Name, *agentPool.Name, agentIndex, NodeUpgradeStepCompleted)
+				}
 				agentVMs[agentIndex] = &vmInfo{*vm.Name, vmStatusUpgraded}
 				upgradedCount++
 
@@ -454,125 +484,217 @@ func (ku *Upgrader) upgradeAgentPools(ctx context.Context) error {
 			}
 		}
 
+		toBeUpgradedCount := 0
 		for _, vm := range *agentPool.AgentVMs {
 			agentIndex, _ := utils.GetVMNameIndex(vm.StorageProfile.OsDisk.OsType, *vm.Name)
+			if ku.State.NodeStep(*vm.Name) == NodeUpgradeStepCompleted {
+				ku.logger.Infof("Agent VM: %s was upgraded by the interrupted upgrade, skipping", *vm.Name)
+				agentVMs[agentIndex] = &vmInfo{*vm.Name, vmStatusUpgraded}
+				upgradedCount++
+				continue
+			}
 			agentVMs[agentIndex] = &vmInfo{*vm.Name, vmStatusNotUpgraded}
+			toBeUpgradedCount++
 		}
-		toBeUpgradedCount := len(*agentPool.AgentVMs)
 
 		ku.logger.Infof("Starting upgrade of %d agent nodes (out of %d) in pool identifier: %s, name: %s...",
 			toBeUpgradedCount, agentCount, *agentPool.Identifier, *agentPool.Name)
 
 		// Create missing nodes to match agentCount. This could be due to previous upgrade failure
-		// If there are nodes that need to be upgraded, create one extra node, which will be used to take on the load from upgrading nodes.
-		if toBeUpgradedCount > 0 {
-			agentCount++
+		// If there are nodes that need to be upgraded, create up to maxSurge extra nodes, which will be used to take on the load from upgrading nodes.
+		maxSurge, maxUnavailable := ku.getSurgeSettings()
+		surgeCount := maxSurge
+		if surgeCount > toBeUpgradedCount {
+			surgeCount = toBeUpgradedCount
 		}
+		agentCount += surgeCount
 
-		newCreatedVMs := []string{}
 		client, err := ku.getKubernetesClient(10 * time.Second)
 		if err != nil {
 			ku.logger.Errorf("Error getting Kubernetes client: %v", err)
 			return err
 		}
 
-		for upgradedCount+toBeUpgradedCount < agentCount {
+		indexesToCreate := []int{}
+		for upgradedCount+toBeUpgradedCount+len(indexesToCreate) < agentCount {
 			agentIndex := getAvailableIndex(agentVMs)
-
-			var vmName string
-			vmName, err = utils.GetK8sVMName(ku.DataModel.Properties, agentPoolProfile, agentIndex)
-			if err != nil {
-				ku.logger.Errorf("Error reconstructing agent VM name with index %d: %v", agentIndex, err)
-				return err
-			}
-			ku.logger.Infof("Creating new agent node %s (index %d)", vmName, agentIndex)
-
-			err = upgradeAgentNode.CreateNode(ctx, *agentPool.Name, agentIndex)
-			if err != nil {
-				ku.logger.Errorf("Error creating agent node %s (index %d): %v", vmName, agentIndex, err)
-				return err
-			}
-
-			err = upgradeAgentNode.Validate(&vmName)
-			if err != nil {
-				ku.logger.Infof("Error validating agent node %s (index %d): %v", vmName, agentIndex, err)
-				return err
-			}
-
-			newCreatedVMs = append(newCreatedVMs, vmName)
-			agentVMs[agentIndex] = &vmInfo{vmName, vmStatusUpgraded}
-			upgradedCount++
+			// reserve the index so the next call returns the next available one
+			agentVMs[agentIndex] = &vmInfo{"", vmStatusUpgraded}
+			indexesToCreate = append(indexesToCreate, agentIndex)
+		}
+		newCreatedVMs, err := ku.createAgentNodes(ctx, upgradeAgentNode, agentPoolProfile, *agentPool.Name, indexesToCreate)
+		if err != nil {
+			return err
+		}
+		for i, agentIndex := range indexesToCreate {
+			agentVMs[agentIndex].name = newCreatedVMs[i]
 		}
+		upgradedCount += len(indexesToCreate)
 
 		if toBeUpgradedCount == 0 {
 			ku.logger.Infof("No nodes to upgrade")
 			continue
 		}
 
-		// Upgrade nodes in agent pool
-		upgradedCount = 0
+		// Upgrade nodes in agent pool, maxSurge+maxUnavailable nodes at a time
+		indexesToUpgrade := []int{}
 		for agentIndex, vm := range agentVMs {
-			if vm.status != vmStatusNotUpgraded {
-				continue
+			if vm.status == vmStatusNotUpgraded {
+				indexesToUpgrade = append(indexesToUpgrade, agentIndex)
 			}
-			ku.logger.Infof("Upgrading Agent VM: %s, pool name: %s", vm.name, *agentPool.Name)
+		}
+		sort.Ints(indexesToUpgrade)
+		batchSize := maxSurge + maxUnavailable
+		upgradeAgentNode.abortOnDrainFailure = batchSize > 1
+		// do not recreate the last surgeCount nodes in favor of the already created extra nodes
+		toBeRecreatedCount := toBeUpgradedCount - surgeCount
+
+		// copy custom properties from old node to new node if the PreserveNodesProperties in AgentPoolProfile is not set to false explicitly.
+		preserveNodesProperties := api.DefaultPreserveNodesProperties
+		if agentPoolProfile != nil && agentPoolProfile.PreserveNodesProperties != nil {
+			preserveNodesProperties = *agentPoolProfile.PreserveNodesProperties
+		}
 
-			// copy custom properties from old node to new node if the PreserveNodesProperties in AgentPoolProfile is not set to false explicitly.
-			preserveNodesProperties := api.DefaultPreserveNodesProperties
-			if agentPoolProfile != nil && agentPoolProfile.PreserveNodesProperties != nil {
-				preserveNodesProperties = *agentPoolProfile.PreserveNodesProperties
+		for len(indexesToUpgrade) > 0 {
+			batch := indexesToUpgrade
+			if len(batch) > batchSize {
+				batch = indexesToUpgrade[:batchSize]
 			}
-
-			if preserveNodesProperties {
-				if len(newCreatedVMs) > 0 {
-					newNodeName := newCreatedVMs[0]
-					newCreatedVMs = newCreatedVMs[1:]
-					ku.logger.Infof("Copying custom annotations, labels, taints from old node %s to new node %s...", vm.name, newNodeName)
-					err = ku.copyCustomPropertiesToNewNode(client, strings.ToLower(vm.name), newNodeName)
+			indexesToUpgrade = indexesToUpgrade[len(batch):]
+
+			// nodes with no extra node to take on their properties, i.e. with maxSurge=0, are recreated in place,
+			// their node object is deleted along with the VM so take a snapshot of its properties first
+			snapshots := map[int]*v1.Node{}
+			for _, agentIndex := range batch {
+				vm := agentVMs[agentIndex]
+				ku.logger.Infof("Upgrading Agent VM: %s, pool name: %s", vm.name, *agentPool.Name)
+				if !preserveNodesProperties {
+					continue
+				}
+				if len(newCreatedVMs) == 0 {
+					oldNode, err := client.GetNode(strings.ToLower(vm.name))
 					if err != nil {
-						ku.logger.Warningf("Failed to copy custom annotations, labels, taints from old node %s to new node %s: %v", vm.name, newNodeName, err)
+						ku.logger.Warningf("Failed to get node %s, its custom annotations, labels and taints won't be copied: %v", vm.name, err)
+						continue
 					}
+					removeNodeStatusTaints(oldNode)
+					snapshots[agentIndex] = oldNode
+					continue
+				}
+				newNodeName := newCreatedVMs[0]
+				newCreatedVMs = newCreatedVMs[1:]
+				ku.logger.Infof("Copying custom annotations, labels, taints from old node %s to new node %s...", vm.name, newNodeName)
+				err = ku.copyCustomPropertiesToNewNode(client, strings.ToLower(vm.name), newNodeName)
+				if err != nil {
+					ku.logger.Warningf("Failed to copy custom annotations, labels, taints from old node %s to new node %s: %v", vm.name, newNodeName, err)
 				}
 			}
 
-			err := upgradeAgentNode.DeleteNode(&vm.name, true)
-			if err != nil {
-				ku.logger.Errorf("Error deleting agent VM %s: %v", vm.name, err)
+			if err = ku.deleteAgentNodes(upgradeAgentNode, *agentPool.Name, agentVMs, batch); err != nil {
 				return err
 			}
 
-			vmName, err := utils.GetK8sVMName(ku.DataModel.Properties, agentPoolProfile, agentIndex)
-			if err != nil {
-				ku.logger.Errorf("Error fetching new VM name: %v", err)
-				return err
+			recreate := batch
+			if len(recreate) > toBeRecreatedCount {
+				recreate = batch[:toBeRecreatedCount]
 			}
-
-			// do not create last node in favor of already created extra node.
-			if upgradedCount == toBeUpgradedCount-1 {
+			toBeRecreatedCount -= len(recreate)
+			for _, agentIndex := range batch[len(recreate):] {
+				vmName := agentVMs[agentIndex].name
 				ku.logger.Infof("Skipping creation of VM %s (index %d)", vmName, agentIndex)
 				delete(agentVMs, agentIndex)
-			} else {
-				err = upgradeAgentNode.CreateNode(ctx, *agentPool.Name, agentIndex)
-				if err != nil {
-					ku.logger.Errorf("Error creating upgraded agent VM %s: %v", vmName, err)
-					return err
-				}
+				ku.recordNodeStep(vmName, *agentPool.Name, agentIndex, NodeUpgradeStepCompleted)
+			}
 
-				err = upgradeAgentNode.Validate(&vmName)
-				if err != nil {
-					ku.logger.Errorf("Error validating upgraded agent VM %s: %v", vmName, err)
-					return err
+			names, err := ku.createAgentNodes(ctx, upgradeAgentNode, agentPoolProfile, *agentPool.Name, recreate)
+			if err != nil {
+				return err
+			}
+			for i, agentIndex := range recreate {
+				agentVMs[agentIndex].status = vmStatusUpgraded
+				oldNode, ok := snapshots[agentIndex]
+				if !ok {
+					newCreatedVMs = append(newCreatedVMs, names[i])
+					continue
+				}
+				newNodeName := strings.ToLower(names[i])
+				ku.logger.Infof("Copying custom annotations, labels, taints to the recreated node %s...", newNodeName)
+				getOldNode := func() (*v1.Node, error) {
+					return oldNode, nil
+				}
+				if err = ku.copyCustomPropertiesToNode(client, newNodeName, getOldNode, newNodeName); err != nil {
+					ku.logger.Warningf("Failed to copy custom annotations, labels, taints to the recreated node %s: %v", newNodeName, err)
 				}
-				newCreatedVMs = append(newCreatedVMs, vmName)
-				vm.status = vmStatusUpgraded
 			}
-			upgradedCount++
 		}
 	}
 
 	return nil
 }
 
+// newUpgradeAgentNode generates the template deploying the VMs of the given agent pool of the current api model
+func (ku *Upgrader) newUpgradeAgentNode(poolName string) (*UpgradeAgentNode, error) {
+	templateMap, parametersMap, err := ku.generateUpgradeTemplate(ku.ClusterTopology.DataModel, ku.AKSEngineVersion)
+	if err != nil {
+		ku.logger.Errorf("Error generating upgrade template: %v", err)
+		return nil, ku.Translator.Errorf("Error generating upgrade template: %s", err.Error())
+	}
+
+	preservePools := map[string]bool{poolName: true}
+	transformer := &transform.Transformer{
+		Translator: ku.Translator,
+	}
+
+	if ku.ClusterTopology.DataModel.Properties.OrchestratorProfile.KubernetesConfig.PrivateJumpboxProvision() {
+		err = transformer.RemoveJumpboxResourcesFromTemplate(ku.logger, templateMap)
+		if err != nil {
+			return nil, ku.Translator.Errorf("error removing jumpbox resources from template: %s", err.Error())
+		}
+	}
+
+	var isMasterManagedDisk bool
+	if ku.DataModel.Properties.MasterProfile != nil {
+		isMasterManagedDisk = ku.DataModel.Properties.MasterProfile.IsManagedDisks()
+	}
+
+	if ku.DataModel.Properties.OrchestratorProfile.KubernetesConfig.LoadBalancerSku == api.StandardLoadBalancerSku {
+		err = transformer.NormalizeForK8sSLBScalingOrUpgrade(ku.logger, templateMap)
+		if err != nil {
+			return nil, ku.Translator.Errorf("error normalizing upgrade template for SLB: %s", err.Error())
+		}
+	}
+	if err = transformer.NormalizeResourcesForK8sAgentUpgrade(ku.logger, templateMap, isMasterManagedDisk, preservePools); err != nil {
+		ku.logger.Errorf(err.Error())
+		return nil, ku.Translator.Errorf("Error generating upgrade template: %s", err.Error())
+	}
+
+	transformer.RemoveImmutableResourceProperties(ku.logger, templateMap)
+
+	upgradeAgentNode := &UpgradeAgentNode{
+		Translator: ku.Translator,
+		logger:     ku.logger,
+	}
+	upgradeAgentNode.TemplateMap = templateMap
+	upgradeAgentNode.ParametersMap = parametersMap
+	upgradeAgentNode.UpgradeContainerService = ku.ClusterTopology.DataModel
+	upgradeAgentNode.SubscriptionID = ku.ClusterTopology.SubscriptionID
+	upgradeAgentNode.ResourceGroup = ku.ClusterTopology.ResourceGroup
+	upgradeAgentNode.Client = ku.Client
+	upgradeAgentNode.kubeConfig = ku.kubeConfig
+	if ku.stepTimeout == nil {
+		upgradeAgentNode.timeout = defaultTimeout
+	} else {
+		upgradeAgentNode.timeout = *ku.stepTimeout
+	}
+	if ku.cordonDrainTimeout == nil {
+		upgradeAgentNode.cordonDrainTimeout = defaultCordonDrainTimeout
+	} else {
+		upgradeAgentNode.cordonDrainTimeout = *ku.cordonDrainTimeout
+	}
+
+	return upgradeAgentNode, nil
+}
+
 func (ku *Upgrader) upgradeAgentScaleSets(ctx context.Context) error {
 	agentPoolMap := make(map[string]*api.AgentPoolProfile)
 	for _, app := range ku.ClusterTopology.DataModel.Properties.AgentPoolProfiles {
@@ -619,8 +741,10 @@ func (ku *Upgrader) upgradeAgentScaleSets(ctx context.Context) error {
 		deploymentName := fmt.Sprintf("k8s-upgrade-update-vmss-pools-%s-%d", time.Now().Format("06-01-02T15.04.05"), deploymentSuffix)
 
 		ku.logger.Infof("Deploying ARM template to update all VMSS node pools...")
-		_, err = ku.Client.DeployTemplate(
+		err = armhelpers.DeployTemplateSyncWithContext(
 			ctx,
+			ku.Client,
+			ku.logger,
 			ku.ClusterTopology.ResourceGroup,
 			deploymentName,
 			templateMap,
@@ -632,17 +756,38 @@ func (ku *Upgrader) upgradeAgentScaleSets(ctx context.Context) error {
 		}
 	}
 
+	if ku.VMSSUpgradeStrategy == VMSSUpgradeStrategyInPlace {
+		return ku.upgradeAgentScaleSetsInPlace(ctx)
+	}
+
 	ku.logger.Infof("Will now perform a rolling upgrade of each VMSS, one node (VM instance) at a time...")
 
 	for _, vmssToUpgrade := range ku.ClusterTopology.AgentPoolScaleSetsToUpgrade {
 		ku.logger.Infof("Upgrading VMSS %s", vmssToUpgrade.Name)
 
-		if len(vmssToUpgrade.VMsToUpgrade) == 0 {
+		vmsToUpgrade := []AgentPoolScaleSetVM{}
+		surged := false
+		for _, vm := range vmssToUpgrade.VMsToUpgrade {
+			switch ku.State.NodeStep(vm.Name) {
+			case NodeUpgradeStepCompleted:
+				ku.logger.Infof("VM %s in VMSS %s was upgraded by the interrupted upgrade, skipping", vm.Name, vmssToUpgrade.Name)
+				continue
+			case NodeUpgradeStepSurged, NodeUpgradeStepDeleting:
+				// the buffer instance of the interrupted upgrade is already part of the current capacity
+				surged = true
+			}
+			vmsToUpgrade = append(vmsToUpgrade, vm)
+		}
+
+		if len(vmsToUpgrade) == 0 {
 			ku.logger.Infof("No VMs to upgrade for VMSS %s, skipping", vmssToUpgrade.Name)
 			continue
 		}
 
 		newCapacity := *vmssToUpgrade.Sku.Capacity + 1
+		if surged {
+			newCapacity = *vmssToUpgrade.Sku.Capacity
+		}
 		ku.logger.Infof(
 			"VMSS %s current capacity is %d and new capacity will be %d while each node is swapped",
 			vmssToUpgrade.Name,
@@ -652,7 +797,7 @@ func (ku *Upgrader) upgradeAgentScaleSets(ctx context.Context) error {
 
 		*vmssToUpgrade.Sku.Capacity = newCapacity
 
-		for _, vmToUpgrade := range vmssToUpgrade.VMsToUpgrade {
+		for _, vmToUpgrade := range vmsToUpgrade {
 			if err := ku.Client.SetVirtualMachineScaleSetCapacity(
 				ctx,
 				ku.ClusterTopology.ResourceGroup,
@@ -665,6 +810,7 @@ func (ku *Upgrader) upgradeAgentScaleSets(ctx context.Context) error {
 			}
 
 			ku.logger.Infof("Successfully set capacity for VMSS %s", vmssToUpgrade.Name)
+			ku.recordNodeStep(vmToUpgrade.Name, vmssToUpgrade.Name, -1, NodeUpgradeStepSurged)
 
 			var cordonDrainTimeout time.Duration
 			if ku.cordonDrainTimeout == nil {
@@ -712,12 +858,15 @@ func (ku *Upgrader) upgradeAgentScaleSets(ctx context.Context) error {
 				}
 			}
 
-			if preserveNodesProperties {
-				newNodeName, err := ku.getLastVMNameInVMSS(ctx, ku.ClusterTopology.ResourceGroup, vmssToUpgrade.Name)
+			var newNodeName string
+			if preserveNodesProperties || ku.State != nil {
+				newNodeName, err = ku.getLastVMNameInVMSS(ctx, ku.ClusterTopology.ResourceGroup, vmssToUpgrade.Name)
 				if err != nil {
 					return err
 				}
+			}
 
+			if preserveNodesProperties {
 				ku.logger.Infof("Copying custom annotations, labels, taints from old node %s to new node %s...", vmToUpgrade.Name, newNodeName)
 				err = ku.copyCustomPropertiesToNewNode(client, strings.ToLower(vmToUpgrade.Name), strings.ToLower(newNodeName))
 				if err != nil {
@@ -727,6 +876,7 @@ func (ku *Upgrader) upgradeAgentScaleSets(ctx context.Context) error {
 
 			// At this point we have our buffer node that will replace the node to delete
 			// so we can just remove this current node then
+			ku.recordNodeStep(vmToUpgrade.Name, vmssToUpgrade.Name, -1, NodeUpgradeStepDeleting)
 			if err := ku.Client.DeleteVirtualMachineScaleSetVM(
 				ctx,
 				ku.ClusterTopology.ResourceGroup,
@@ -743,6 +893,73 @@ func (ku *Upgrader) upgradeAgentScaleSets(ctx context.Context) error {
 				"Successfully deleted VM %s in VMSS %s",
 				vmToUpgrade.Name,
 				vmssToUpgrade.Name)
+			ku.recordNodeStep(vmToUpgrade.Name, vmssToUpgrade.Name, -1, NodeUpgradeStepCompleted)
+			if newNodeName != "" {
+				// with --force, replacement instances run the goal version already and must not be replaced again on resume
+				ku.recordNodeStep(newNodeName, vmssToUpgrade.Name, -1, NodeUpgradeStepCompleted)
+			}
+		}
+		ku.logger.Infof("Completed upgrading VMSS %s", vmssToUpgrade.Name)
+	}
+
+	ku.logger.Infoln("Completed upgrading all VMSS")
+
+	return nil
+}
+
+// upgradeAgentScaleSetsInPlace applies the VMSS model updated by the upgrade deployment to the existing VMSS instances.
+// Instances are cordoned, drained, updated and reimaged maxUnavailable at a time (at least one),
+// and they are uncordoned once they are back as ready nodes running the goal version.
+func (ku *Upgrader) upgradeAgentScaleSetsInPlace(ctx context.Context) error {
+	_, batchSize := ku.getSurgeSettings()
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	goalVersion := ku.DataModel.Properties.OrchestratorProfile.OrchestratorVersion
+
+	var cordonDrainTimeout time.Duration
+	if ku.cordonDrainTimeout == nil {
+		cordonDrainTimeout = defaultCordonDrainTimeout
+	} else {
+		cordonDrainTimeout = *ku.cordonDrainTimeout
+	}
+	client, err := ku.getKubernetesClient(cordonDrainTimeout)
+	if err != nil {
+		ku.logger.Errorf("Error getting Kubernetes client: %v", err)
+		return err
+	}
+
+	ku.logger.Infof("Will now update each VMSS in place, %d node(s) (VM instances) at a time...", batchSize)
+
+	for _, vmssToUpgrade := range ku.ClusterTopology.AgentPoolScaleSetsToUpgrade {
+		ku.logger.Infof("Upgrading VMSS %s", vmssToUpgrade.Name)
+
+		vmss, err := ku.validateScaleSetModel(ctx, vmssToUpgrade.Name, goalVersion)
+		if err != nil {
+			return err
+		}
+		var modelImage *compute.ImageReference
+		if vmss.VirtualMachineScaleSetProperties != nil && vmss.VirtualMachineProfile != nil && vmss.VirtualMachineProfile.StorageProfile != nil {
+			modelImage = vmss.VirtualMachineProfile.StorageProfile.ImageReference
+		}
+
+		vmsToUpgrade := []AgentPoolScaleSetVM{}
+		for _, vm := range vmssToUpgrade.VMsToUpgrade {
+			if ku.State.NodeStep(vm.Name) == NodeUpgradeStepCompleted {
+				ku.logger.Infof("VM %s in VMSS %s was upgraded by the interrupted upgrade, skipping", vm.Name, vmssToUpgrade.Name)
+				continue
+			}
+			vmsToUpgrade = append(vmsToUpgrade, vm)
+		}
+
+		for start := 0; start < len(vmsToUpgrade); start += batchSize {
+			end := start + batchSize
+			if end > len(vmsToUpgrade) {
+				end = len(vmsToUpgrade)
+			}
+			if err = ku.updateScaleSetVMsInPlace(ctx, client, vmssToUpgrade.Name, modelImage, vmsToUpgrade[start:end], goalVersion, cordonDrainTimeout); err != nil {
+				return err
+			}
 		}
 		ku.logger.Infof("Completed upgrading VMSS %s", vmssToUpgrade.Name)
 	}
@@ -752,6 +969,244 @@ func (ku *Upgrader) upgradeAgentScaleSets(ctx context.Context) error {
 	return nil
 }
 
+// validateScaleSetModel makes sure the VMSS model targets the goal version before its instances are reimaged,
+// otherwise the instances would come back running the current version. It returns the VMSS.
+func (ku *Upgrader) validateScaleSetModel(ctx context.Context, vmssName, goalVersion string) (compute.VirtualMachineScaleSet, error) {
+	vmss, err := ku.Client.GetVirtualMachineScaleSet(ctx, ku.ClusterTopology.ResourceGroup, vmssName)
+	if err != nil {
+		ku.logger.Errorf("Failed to get VMSS %s", vmssName)
+		return vmss, err
+	}
+	if vmss.Tags == nil || vmss.Tags["orchestrator"] == nil {
+		ku.logger.Warnf("Expected tag \"orchestrator\" not found for VMSS: %s. Assuming its model targets Kubernetes %s", vmssName, goalVersion)
+		return vmss, nil
+	}
+	parts := strings.Split(*vmss.Tags["orchestrator"], ":")
+	if len(parts) != 2 || parts[1] != goalVersion {
+		return vmss, errors.Errorf("the model of VMSS %s targets %s instead of Kubernetes %s", vmssName, *vmss.Tags["orchestrator"], goalVersion)
+	}
+	return vmss, nil
+}
+
+// getInstancesToReimage returns the instances that are not reimaged when the latest VMSS model is applied to them.
+// Applying a model with a different image reimages the instance, the other instances keep their OS disk
+// and must be reimaged to boot with the new custom data.
+func (ku *Upgrader) getInstancesToReimage(ctx context.Context, vmssName string, modelImage *compute.ImageReference, instanceIDs []string) ([]string, error) {
+	if modelImage == nil {
+		return instanceIDs, nil
+	}
+	instanceImages := map[string]*compute.ImageReference{}
+	for page, err := ku.Client.ListVirtualMachineScaleSetVMs(ctx, ku.ClusterTopology.ResourceGroup, vmssName); page.NotDone(); err = page.NextWithContext(ctx) {
+		if err != nil {
+			return nil, errors.Wrapf(err, "listing the instances of VMSS %s", vmssName)
+		}
+		for _, vm := range page.Values() {
+			if vm.VirtualMachineScaleSetVMProperties != nil && vm.StorageProfile != nil {
+				instanceImages[to.String(vm.InstanceID)] = vm.StorageProfile.ImageReference
+			}
+		}
+	}
+	toReimage := []string{}
+	for _, id := range instanceIDs {
+		if image, ok := instanceImages[id]; ok && image != nil && !sameImageReference(image, modelImage) {
+			ku.logger.Infof("VM %s in VMSS %s is reimaged with the new image by the update", id, vmssName)
+			continue
+		}
+		toReimage = append(toReimage, id)
+	}
+	return toReimage, nil
+}
+
+// sameImageReference returns true if both image references point to the same image
+func sameImageReference(a, b *compute.ImageReference) bool {
+	return strings.EqualFold(to.String(a.ID), to.String(b.ID)) &&
+		strings.EqualFold(to.String(a.Publisher), to.String(b.Publisher)) &&
+		strings.EqualFold(to.String(a.Offer), to.String(b.Offer)) &&
+		strings.EqualFold(to.String(a.Sku), to.String(b.Sku)) &&
+		strings.EqualFold(to.String(a.Version), to.String(b.Version))
+}
+
+// updateScaleSetVMsInPlace drains a batch of VMSS instances, applies the latest VMSS model to them,
+// reimages those the update did not reimage so they boot with the new custom data and waits for the nodes to rejoin the cluster
+func (ku *Upgrader) updateScaleSetVMsInPlace(ctx context.Context, client kubernetes.Client, vmssName string, modelImage *compute.ImageReference, vms []AgentPoolScaleSetVM, goalVersion string, cordonDrainTimeout time.Duration) error {
+	instanceIDs := make([]string, len(vms))
+	var drain errgroup.Group
+	for i, vm := range vms {
+		instanceIDs[i] = vm.InstanceID
+		ku.recordNodeStep(vm.Name, vmssName, -1, NodeUpgradeStepUpdating)
+		nodeName := strings.ToLower(vm.Name)
+		drain.Go(func() error {
+			ku.logger.Infof("Draining node %s", nodeName)
+			if err := operations.SafelyDrainNodeWithClient(client, ku.logger, nodeName, cordonDrainTimeout); err != nil {
+				if len(vms) > 1 {
+					return errors.Wrapf(err, "draining node %s", nodeName)
+				}
+				ku.logger.Errorf("Error draining VM in VMSS: %v", err)
+				// Continue even if there's an error in draining the node, same as when it is replaced.
+			}
+			return nil
+		})
+	}
+	if err := drain.Wait(); err != nil {
+		return err
+	}
+
+	// the instance images must be read before the update applies the model image to them
+	toReimage, err := ku.getInstancesToReimage(ctx, vmssName, modelImage, instanceIDs)
+	if err != nil {
+		return err
+	}
+
+	ku.logger.Infof("Updating VMs %s in VMSS %s to the latest model", strings.Join(instanceIDs, ", "), vmssName)
+	if err = ku.Client.UpdateVirtualMachineScaleSetVMs(ctx, ku.ClusterTopology.ResourceGroup, vmssName, instanceIDs); err != nil {
+		ku.logger.Errorf("Failed to update VMs in VMSS %s", vmssName)
+		return err
+	}
+
+	if len(toReimage) > 0 {
+		ku.logger.Infof("Reimaging VMs %s in VMSS %s", strings.Join(toReimage, ", "), vmssName)
+		if err = ku.Client.ReimageVirtualMachineScaleSetVMs(ctx, ku.ClusterTopology.ResourceGroup, vmssName, toReimage); err != nil {
+			ku.logger.Errorf("Failed to reimage VMs in VMSS %s", vmssName)
+			return err
+		}
+	}
+
+	timeout := defaultTimeout
+	if ku.stepTimeout != nil {
+		timeout = *ku.stepTimeout
+	}
+	var ready errgroup.Group
+	for _, vm := range vms {
+		vm := vm
+		ready.Go(func() error {
+			if err := ku.waitForUpdatedNode(client, strings.ToLower(vm.Name), goalVersion, timeout); err != nil {
+				return err
+			}
+			ku.recordNodeStep(vm.Name, vmssName, -1, NodeUpgradeStepCompleted)
+			return nil
+		})
+	}
+	return ready.Wait()
+}
+
+// waitForUpdatedNode waits for the node to be ready and running the goal version, and then uncordons it
+func (ku *Upgrader) waitForUpdatedNode(client kubernetes.Client, nodeName, goalVersion string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		node, err := client.GetNode(nodeName)
+		if err == nil && kubernetes.IsNodeReady(node) && strings.TrimPrefix(node.Status.NodeInfo.KubeletVersion, "v") == goalVersion {
+			ku.logger.Infof("Node %s is ready, uncordoning it", nodeName)
+			node.Spec.Unschedulable = false
+			if _, err = client.UpdateNode(node); err != nil {
+				return errors.Wrapf(err, "uncordoning node %s", nodeName)
+			}
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.Errorf("node %s was not ready with Kubernetes %s within %v", nodeName, goalVersion, timeout)
+		}
+		ku.logger.Infof("Node %s not ready with Kubernetes %s yet...", nodeName, goalVersion)
+		time.Sleep(retry)
+	}
+}
+
+// getSurgeSettings returns how many extra agent nodes can be created, and how many agent nodes can be unavailable,
+// while an availability set agent pool is upgraded. The defaults replace one node at a time with the help of one extra node.
+func (ku *Upgrader) getSurgeSettings() (int, int) {
+	return SurgeSettings(ku.MaxSurge, ku.MaxUnavailable)
+}
+
+// SurgeSettings returns the maxSurge and maxUnavailable values the upgrade uses for the given settings,
+// the defaults are used when they are invalid
+func SurgeSettings(maxSurge, maxUnavailable int) (int, int) {
+	if maxSurge < 0 || maxUnavailable < 0 || maxSurge+maxUnavailable < 1 {
+		return 1, 0
+	}
+	return maxSurge, maxUnavailable
+}
+
+// createAgentNodes creates the agent nodes with the given indexes, one deployment per range of consecutive indexes,
+// and then waits for all of them to become ready. It returns the names of the new nodes, in the order of the indexes.
+func (ku *Upgrader) createAgentNodes(ctx context.Context, upgradeAgentNode *UpgradeAgentNode, agentPoolProfile *api.AgentPoolProfile, poolName string, indexes []int) ([]string, error) {
+	names := make([]string, len(indexes))
+	for i, agentIndex := range indexes {
+		vmName, err := utils.GetK8sVMName(ku.DataModel.Properties, agentPoolProfile, agentIndex)
+		if err != nil {
+			ku.logger.Errorf("Error reconstructing agent VM name with index %d: %v", agentIndex, err)
+			return nil, err
+		}
+		names[i] = vmName
+	}
+
+	sorted := make([]int, len(indexes))
+	copy(sorted, indexes)
+	sort.Ints(sorted)
+	nameByIndex := make(map[int]string)
+	for i, agentIndex := range indexes {
+		nameByIndex[agentIndex] = names[i]
+	}
+	for start := 0; start < len(sorted); {
+		end := start + 1
+		for end < len(sorted) && sorted[end] == sorted[end-1]+1 {
+			end++
+		}
+		for _, agentIndex := range sorted[start:end] {
+			ku.logger.Infof("Creating new agent node %s (index %d)", nameByIndex[agentIndex], agentIndex)
+			ku.recordNodeStep(nameByIndex[agentIndex], poolName, agentIndex, NodeUpgradeStepCreating)
+		}
+		if err := upgradeAgentNode.CreateNodes(ctx, poolName, sorted[start], end-start); err != nil {
+			ku.logger.Errorf("Error creating agent nodes with indexes %d to %d: %v", sorted[start], sorted[end-1], err)
+			return nil, err
+		}
+		for _, agentIndex := range sorted[start:end] {
+			ku.recordNodeStep(nameByIndex[agentIndex], poolName, agentIndex, NodeUpgradeStepCreated)
+		}
+		start = end
+	}
+
+	var group errgroup.Group
+	for i := range indexes {
+		vmName, agentIndex := names[i], indexes[i]
+		group.Go(func() error {
+			if err := upgradeAgentNode.Validate(&vmName); err != nil {
+				ku.logger.Errorf("Error validating agent node %s (index %d): %v", vmName, agentIndex, err)
+				return err
+			}
+			ku.recordNodeStep(vmName, poolName, agentIndex, NodeUpgradeStepCompleted)
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// deleteAgentNodes cordons, drains and deletes the agent nodes with the given indexes in parallel
+func (ku *Upgrader) deleteAgentNodes(upgradeAgentNode *UpgradeAgentNode, poolName string, agentVMs map[int]*vmInfo, indexes []int) error {
+	var group errgroup.Group
+	for _, agentIndex := range indexes {
+		vmName, agentIndex := agentVMs[agentIndex].name, agentIndex
+		group.Go(func() error {
+			ku.recordNodeStep(vmName, poolName, agentIndex, NodeUpgradeStepDeleting)
+			if err := upgradeAgentNode.DeleteNode(&vmName, true); err != nil {
+				ku.logger.Errorf("Error deleting agent VM %s: %v", vmName, err)
+				return err
+			}
+			ku.recordNodeStep(vmName, poolName, agentIndex, NodeUpgradeStepDeleted)
+			return nil
+		})
+	}
+	return group.Wait()
+}
+
+// recordNodeStep updates the upgrade journal, failing to persist it does not fail the upgrade
+func (ku *Upgrader) recordNodeStep(name, pool string, index int, step NodeUpgradeStep) {
+	if err := ku.State.SetNodeStep(name, pool, index, step); err != nil {
+		ku.logger.Warnf("Failed to record step %s of node %s in the upgrade state file: %v", step, name, err)
+	}
+}
+
 func (ku *Upgrader) generateUpgradeTemplate(upgradeContainerService *api.ContainerService, aksEngineVersion string) (map[string]interface{}, map[string]interface{}, error) {
 	var err error
 	ctx := engine.Context{
@@ -819,6 +1274,15 @@ func (ku *Upgrader) getLastVMNameInVMSS(ctx context.Context, resourceGroup strin
 }
 
 func (ku *Upgrader) copyCustomPropertiesToNewNode(client kubernetes.Client, oldNodeName string, newNodeName string) error {
+	getOldNode := func() (*v1.Node, error) {
+		return client.GetNode(oldNodeName)
+	}
+	return ku.copyCustomPropertiesToNode(client, oldNodeName, getOldNode, newNodeName)
+}
+
+// copyCustomPropertiesToNode copies the custom annotations, labels and taints of the node returned by getOldNode
+// to node newNodeName, the old node may be a snapshot of a node that no longer exists
+func (ku *Upgrader) copyCustomPropertiesToNode(client kubernetes.Client, oldNodeName string, getOldNode func() (*v1.Node, error), newNodeName string) error {
 	// The new node is created without any taints, Kubernetes might schedule some pods on this newly created node before the taints/annotations/labels
 	// are copied over from corresponding old node. So drain the new node first before copying over the node properties.
 	// Note: SafelyDrainNodeWithClient() sets the Unschedulable of the node to true, set Unschedulable to false in copyCustomNodeProperties
@@ -836,7 +1300,7 @@ func (ku *Upgrader) copyCustomPropertiesToNewNode(client kubernetes.Client, oldN
 	ch := make(chan struct{}, 1)
 	go func() {
 		for {
-			oldNode, err := client.GetNode(oldNodeName)
+			oldNode, err := getOldNode()
 			if err != nil {
 				ku.logger.Debugf("Failed to get properties of the old node %s: %v", oldNodeName, err)
 				time.Sleep(time.Second * 5)
@@ -856,6 +1320,7 @@ func (ku *Upgrader) copyCustomPropertiesToNewNode(client kubernetes.Client, oldN
 				time.Sleep(time.Second * 5)
 			} else {
 				ch <- struct{}{}
+				return
 			}
 		}
 	}()
@@ -77,3 +77,26 @@ func TestValidateUserCreatedPodSecurityPolices(t *testing.T) {
 		})
 	}
 }
+
+func TestGetSurgeSettings(t *testing.T) {
+	cases := []struct {
+		maxSurge               int
+		maxUnavailable         int
+		expectedMaxSurge       int
+		expectedMaxUnavailable int
+	}{
+		{0, 0, 1, 0},
+		{1, 0, 1, 0},
+		{3, 2, 3, 2},
+		{0, 2, 0, 2},
+		{-1, 2, 1, 0},
+	}
+	for _, c := range cases {
+		ku := &Upgrader{MaxSurge: c.maxSurge, MaxUnavailable: c.maxUnavailable}
+		maxSurge, maxUnavailable := ku.getSurgeSettings()
+		if maxSurge != c.expectedMaxSurge || maxUnavailable != c.expectedMaxUnavailable {
+			t.Fatalf("expected getSurgeSettings to return (%d, %d) for (%d, %d), got (%d, %d)",
+				c.expectedMaxSurge, c.expectedMaxUnavailable, c.maxSurge, c.maxUnavailable, maxSurge, maxUnavailable)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package kubernetesupgrade
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// UpgradeStateFilename is the name of the upgrade journal file, stored next to the api model
+const UpgradeStateFilename = "upgrade-state.json"
+
+// NodeUpgradeStep is the last step of the node replacement flow that completed for a node
+type NodeUpgradeStep string
+
+const (
+	// NodeUpgradeStepSurged means extra capacity was added to the node's VMSS to take on the node's workload
+	NodeUpgradeStepSurged NodeUpgradeStep = "Surged"
+	// NodeUpgradeStepDeleting means the node is about to be cordoned, drained and deleted
+	NodeUpgradeStepDeleting NodeUpgradeStep = "Deleting"
+	// NodeUpgradeStepDeleted means the node VM was deleted and its replacement was not created yet
+	NodeUpgradeStepDeleted NodeUpgradeStep = "Deleted"
+	// NodeUpgradeStepCreating means the deployment of the replacement VM started
+	NodeUpgradeStepCreating NodeUpgradeStep = "Creating"
+	// NodeUpgradeStepCreated means the replacement VM was deployed but it was not validated yet
+	NodeUpgradeStepCreated NodeUpgradeStep = "Created"
+	// NodeUpgradeStepUpdating means the VMSS instance is about to be drained and updated in place to the latest VMSS model
+	NodeUpgradeStepUpdating NodeUpgradeStep = "Updating"
+	// NodeUpgradeStepCompleted means the node was upgraded and validated
+	NodeUpgradeStepCompleted NodeUpgradeStep = "Completed"
+)
+
+// NodeUpgradeState is the journal entry of a single node
+type NodeUpgradeState struct {
+	Pool      string          `json:"pool"`
+	Index     int             `json:"index"`
+	Step      NodeUpgradeStep `json:"step"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+// UpgradeState is the journal of an upgrade operation.
+// It is persisted after every node step so an interrupted upgrade can be resumed where it stopped.
+// All methods are no-ops on a nil *UpgradeState.
+type UpgradeState struct {
+	GoalVersion      string                       `json:"goalVersion"`
+	Force            bool                         `json:"force,omitempty"`
+	ControlPlaneOnly bool                         `json:"controlPlaneOnly,omitempty"`
+	StartedAt        time.Time                    `json:"startedAt"`
+	UpdatedAt        time.Time                    `json:"updatedAt"`
+	Nodes            map[string]*NodeUpgradeState `json:"nodes"`
+
+	path string
+	mu   sync.Mutex
+}
+
+// NewUpgradeState creates an empty journal that will be persisted to path
+func NewUpgradeState(path, goalVersion string, force, controlPlaneOnly bool) *UpgradeState {
+	now := time.Now().UTC()
+	return &UpgradeState{
+		GoalVersion:      goalVersion,
+		Force:            force,
+		ControlPlaneOnly: controlPlaneOnly,
+		StartedAt:        now,
+		UpdatedAt:        now,
+		Nodes:            make(map[string]*NodeUpgradeState),
+		path:             path,
+	}
+}
+
+// LoadUpgradeState reads the journal of a previous upgrade operation from path
+func LoadUpgradeState(path string) (*UpgradeState, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	state := &UpgradeState{}
+	if err = json.Unmarshal(b, state); err != nil {
+		return nil, errors.Wrapf(err, "parsing upgrade state file %s", path)
+	}
+	if state.Nodes == nil {
+		state.Nodes = make(map[string]*NodeUpgradeState)
+	}
+	state.path = path
+	return state, nil
+}
+
+// NodeStep returns the last recorded step for the node, or an empty step if the node is not part of the journal
+func (s *UpgradeState) NodeStep(name string) NodeUpgradeStep {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n, ok := s.Nodes[strings.ToLower(name)]; ok {
+		return n.Step
+	}
+	return ""
+}
+
+// SetNodeStep records the step for the node and persists the journal
+func (s *UpgradeState) SetNodeStep(name, pool string, index int, step NodeUpgradeStep) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	s.Nodes[strings.ToLower(name)] = &NodeUpgradeState{
+		Pool:      pool,
+		Index:     index,
+		Step:      step,
+		UpdatedAt: now,
+	}
+	s.UpdatedAt = now
+	return s.save()
+}
+
+// Save persists the journal
+func (s *UpgradeState) Save() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save()
+}
+
+// Remove deletes the persisted journal, it is called once the upgrade succeeded
+func (s *UpgradeState) Remove() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "removing upgrade state file %s", s.path)
+	}
+	return nil
+}
+
+// save writes the journal to a temporary file first so a crash never leaves a truncated journal behind
+func (s *UpgradeState) save() error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshaling upgrade state")
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), UpgradeStateFilename+".*")
+	if err != nil {
+		return errors.Wrap(err, "saving upgrade state")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(b); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "saving upgrade state")
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.Wrap(err, "saving upgrade state")
+	}
+	if err = os.Rename(tmp.Name(), s.path); err != nil {
+		return errors.Wrap(err, "saving upgrade state")
+	}
+	return nil
+}
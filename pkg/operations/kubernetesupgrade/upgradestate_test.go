@@ -0,0 +1,69 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package kubernetesupgrade
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestUpgradeStatePersistence(t *testing.T) {
+	g := NewGomegaWithT(t)
+	path := filepath.Join(t.TempDir(), UpgradeStateFilename)
+
+	state := NewUpgradeState(path, "1.24.7", true, false)
+	g.Expect(state.Save()).To(Succeed())
+	g.Expect(state.SetNodeStep("K8S-Master-12345678-0", MasterPoolName, 0, NodeUpgradeStepCreated)).To(Succeed())
+	g.Expect(state.SetNodeStep("k8s-agentpool1-12345678-1", "agentpool1", 1, NodeUpgradeStepDeleted)).To(Succeed())
+
+	loaded, err := LoadUpgradeState(path)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(loaded.GoalVersion).To(Equal("1.24.7"))
+	g.Expect(loaded.Force).To(BeTrue())
+	g.Expect(loaded.ControlPlaneOnly).To(BeFalse())
+	g.Expect(loaded.NodeStep("k8s-master-12345678-0")).To(Equal(NodeUpgradeStepCreated))
+	g.Expect(loaded.NodeStep("k8s-agentpool1-12345678-1")).To(Equal(NodeUpgradeStepDeleted))
+	g.Expect(loaded.NodeStep("k8s-agentpool1-12345678-2")).To(BeEmpty())
+	g.Expect(loaded.Nodes["k8s-agentpool1-12345678-1"].Pool).To(Equal("agentpool1"))
+	g.Expect(loaded.Nodes["k8s-agentpool1-12345678-1"].Index).To(Equal(1))
+
+	g.Expect(loaded.SetNodeStep("k8s-master-12345678-0", MasterPoolName, 0, NodeUpgradeStepCompleted)).To(Succeed())
+	reloaded, err := LoadUpgradeState(path)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(reloaded.NodeStep("k8s-master-12345678-0")).To(Equal(NodeUpgradeStepCompleted))
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(entries).To(HaveLen(1))
+
+	g.Expect(reloaded.Remove()).To(Succeed())
+	_, err = os.Stat(path)
+	g.Expect(os.IsNotExist(err)).To(BeTrue())
+	g.Expect(reloaded.Remove()).To(Succeed())
+}
+
+func TestLoadUpgradeStateErrors(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir := t.TempDir()
+
+	_, err := LoadUpgradeState(filepath.Join(dir, UpgradeStateFilename))
+	g.Expect(os.IsNotExist(err)).To(BeTrue())
+
+	path := filepath.Join(dir, "invalid.json")
+	g.Expect(os.WriteFile(path, []byte("{"), 0600)).To(Succeed())
+	_, err = LoadUpgradeState(path)
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestNilUpgradeState(t *testing.T) {
+	g := NewGomegaWithT(t)
+	var state *UpgradeState
+	g.Expect(state.NodeStep("k8s-master-12345678-0")).To(BeEmpty())
+	g.Expect(state.SetNodeStep("k8s-master-12345678-0", MasterPoolName, 0, NodeUpgradeStepCompleted)).To(Succeed())
+	g.Expect(state.Save()).To(Succeed())
+	g.Expect(state.Remove()).To(Succeed())
+}